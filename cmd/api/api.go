@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,11 +12,15 @@ import (
 
 	"github.com/dubass83/go_social/docs"
 	"github.com/dubass83/go_social/internal/auth"
+	"github.com/dubass83/go_social/internal/blob"
 	"github.com/dubass83/go_social/internal/cache"
 	"github.com/dubass83/go_social/internal/env"
+	"github.com/dubass83/go_social/internal/events"
 	"github.com/dubass83/go_social/internal/mailer"
 	ratelimiter "github.com/dubass83/go_social/internal/rateLimiter"
 	"github.com/dubass83/go_social/internal/store"
+	"github.com/dubass83/go_social/internal/syndication"
+	"github.com/dubass83/go_social/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -29,8 +34,23 @@ type application struct {
 	cache         *cache.StoreCache
 	mailer        mailer.EmailSender
 	authenticator auth.Authenticator
-	rateLimiter   ratelimiter.Limiter
-	shutdown      chan error
+	blobs         blob.BlobStore
+	// mediaWake wakes the media processor up after an upload
+	mediaWake chan struct{}
+	// unsubscribeSigner signs the unsubscribe links of emails and
+	// mediaSigner the download URLs of media
+	unsubscribeSigner *auth.Signer
+	mediaSigner       *auth.Signer
+	rateLimiter       ratelimiter.Limiter
+	timeline          *timelineFanout
+	events            *events.Broker
+	gateway           *gateway
+	webhookClient     *webhooks.Client
+	// streams ends the event streams once cancelled by closeStreams on
+	// shutdown, Shutdown does not cancel the contexts of requests
+	streams      context.Context
+	closeStreams context.CancelFunc
+	shutdown     chan error
 }
 
 type config struct {
@@ -43,6 +63,17 @@ type config struct {
 	auth        authConf
 	cache       cacheConf
 	rateLimiter ratelimiter.Config
+	scheduler   schedulerConf
+	posts       postsConf
+	trending    trendingConf
+	timeline    timelineConf
+	feed        feedConf
+	stream      streamConf
+	gateway     gatewayConf
+	digest      digestConf
+	webhook     webhookConf
+	lists       listsConf
+	media       mediaConf
 }
 
 type dbConf struct {
@@ -59,6 +90,97 @@ type cacheConf struct {
 	enable bool
 }
 
+type schedulerConf struct {
+	interval time.Duration
+}
+
+type trendingConf struct {
+	interval time.Duration
+}
+
+type timelineConf struct {
+	workers   int
+	queueSize int
+	// authors with more followers are read on pull instead of fanned out
+	maxFollowers int
+	// posts and reposts copied into a timeline when following someone
+	backfill int
+}
+
+type feedConf struct {
+	// posts scored at most for a ranked feed
+	maxCandidates int
+	// how far back the ranked feed looks
+	window time.Duration
+	// how long a ranked feed can be paged through
+	sessionTTL time.Duration
+}
+
+type streamConf struct {
+	// comments sent to keep idle streams open
+	heartbeat time.Duration
+	// how long clients wait before reconnecting
+	retry  time.Duration
+	broker events.Config
+}
+
+type gatewayConf struct {
+	// how often clients are pinged, silent ones are dropped after two
+	pingInterval time.Duration
+	// messages queued per client before a slow one is disconnected
+	sendBuffer int
+	// posts and users a client may subscribe to
+	maxSubscriptions int
+}
+
+type digestConf struct {
+	// how often due digests are looked for
+	interval time.Duration
+	// digests sent at most per run
+	batchSize int
+}
+
+type webhookConf struct {
+	// how often due deliveries are looked for
+	interval time.Duration
+	// deliveries attempted at most per run
+	batchSize int
+	// attempts of a delivery before it is failed
+	maxAttempts int
+	// failures in a row before a webhook is disabled
+	disableAfter int
+	// how long a receiver may take to answer
+	timeout time.Duration
+	// wait before the first retry, doubled every attempt up to retryMax
+	retryBase time.Duration
+	retryMax  time.Duration
+	// internal networks receivers may be on, any other internal address
+	// is refused
+	allowedNetworks []netip.Prefix
+}
+
+type listsConf struct {
+	// accounts a list can have at most
+	maxMembers int
+}
+
+type mediaConf struct {
+	// size of an upload at most, in bytes
+	maxSize int64
+	// how long signed download URLs stay valid
+	urlTTL time.Duration
+	// how often images left to process are looked for
+	processInterval time.Duration
+	// images processed at most per run
+	processBatchSize int
+	// attempts at processing an image before it is failed
+	processAttempts int
+}
+
+type postsConf struct {
+	maxPinned int
+}
+
 type authConf struct {
 	basic basicAuthConf
 	jwt   jwtAuthConf
@@ -94,17 +216,18 @@ func (app *application) mount() http.Handler {
 	// Basic CORS
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", app.config.frontendURL)},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders:   []string{"Link", "ETag", "Last-Modified"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 	r.Use(app.RateLimiterMiddleware)
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
-	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	// processing should be stopped. Streams stay open for as long as the
+	// client is connected.
+	r.Use(timeoutUnlessStreaming(60 * time.Second))
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("welcome"))
@@ -115,7 +238,7 @@ func (app *application) mount() http.Handler {
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
 		r.Route("/posts", func(r chi.Router) {
-			r.Get("/", app.GetAllPostsHandler)
+			r.With(app.OptionalAuthTokenMiddelware).Get("/", app.GetAllPostsHandler)
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddelware)
 				r.Post("/", app.CreatePostHandler)
@@ -126,25 +249,194 @@ func (app *application) mount() http.Handler {
 					r.Delete("/", app.checkPostOwnership("admin", app.DeletePostHandler))
 					r.Patch("/", app.checkPostOwnership("moderator", app.UpdatePostHandler))
 					r.Post("/comments", app.CreateCommentToPostByIDHandler)
+					r.Post("/publish", app.checkPostOwnership("admin", app.PublishPostHandler))
+					r.Put("/pin", app.PinPostHandler)
+					r.Delete("/pin", app.UnpinPostHandler)
+					r.Put("/bookmark", app.BookmarkPostHandler)
+					r.Delete("/bookmark", app.DeleteBookmarkHandler)
+					r.Put("/repost", app.RepostHandler)
+					r.Delete("/repost", app.DeleteRepostHandler)
+					r.Get("/poll", app.GetPollHandler)
+					r.Post("/poll/votes", app.VotePollHandler)
+					r.Delete("/poll/votes", app.RetractVoteHandler)
+				})
+			})
+		})
+
+		r.Route("/media", func(r chi.Router) {
+			// download URLs carry their own signature
+			r.Get("/{mediaID}/download", app.DownloadMediaHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddelware)
+				r.Post("/", app.UploadMediaHandler)
+				r.Get("/{mediaID}", app.GetMediaHandler)
+				r.Delete("/{mediaID}", app.DeleteMediaHandler)
+			})
+		})
+
+		r.Route("/tags/{tag}", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(app.OptionalAuthTokenMiddelware)
+				r.Get("/feed.rss", app.TagSyndicationHandler(syndication.FormatRSS))
+				r.Get("/feed.atom", app.TagSyndicationHandler(syndication.FormatAtom))
+				r.Get("/feed.json", app.TagSyndicationHandler(syndication.FormatJSON))
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddelware)
+				r.Put("/follow", app.FollowTagHandler)
+				r.Delete("/follow", app.UnfollowTagHandler)
+			})
+		})
+
+		r.With(queryTokenMiddleware, app.AuthTokenMiddelware).Get(streamPath, app.StreamHandler)
+		r.With(queryTokenMiddleware, app.AuthTokenMiddelware).Get(gatewayPath, app.GatewayHandler)
+
+		r.Route("/notifications", func(r chi.Router) {
+			// unsubscribe links in emails work without logging in
+			r.Get("/unsubscribe", app.UnsubscribePageHandler)
+			r.Post("/unsubscribe", app.UnsubscribeHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddelware)
+				r.Get("/", app.GetNotificationsHandler)
+				r.Get("/unread_count", app.GetUnreadNotificationsCountHandler)
+				r.Put("/read", app.MarkAllNotificationsReadHandler)
+				r.Put("/{notificationID}/read", app.MarkNotificationReadHandler)
+				r.Get("/preferences", app.GetNotificationPreferencesHandler)
+				r.Put("/preferences", app.UpdateNotificationPreferencesHandler)
+			})
+		})
+
+		r.Route("/conversations", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddelware)
+			r.Get("/", app.GetConversationsHandler)
+			r.Post("/", app.CreateConversationHandler)
+			r.Get("/settings", app.GetMessageSettingsHandler)
+			r.Put("/settings", app.UpdateMessageSettingsHandler)
+			r.Route("/{conversationID}", func(r chi.Router) {
+				r.Use(app.conversationContextMiddleware)
+
+				r.Get("/", app.GetConversationHandler)
+				r.Get("/messages", app.GetMessagesHandler)
+				r.Post("/messages", app.SendMessageHandler)
+				r.Put("/read", app.MarkConversationReadHandler)
+				r.Delete("/membership", app.LeaveConversationHandler)
+			})
+		})
+
+		r.Route("/communities", func(r chi.Router) {
+			r.With(app.OptionalAuthTokenMiddelware).Get("/", app.GetCommunitiesHandler)
+			r.With(app.AuthTokenMiddelware).Post("/", app.CreateCommunityHandler)
+			r.Route("/{communityID}", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(app.OptionalAuthTokenMiddelware)
+					r.Use(app.communityContextMiddleware)
+
+					r.Get("/", app.GetCommunityHandler)
+					r.Get("/feed", app.GetCommunityFeedHandler)
+					r.Get("/members", app.GetCommunityMembersHandler)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddelware)
+					r.Use(app.communityContextMiddleware)
+
+					r.Patch("/", app.checkCommunityRole(store.CommunityRoleOwner, app.UpdateCommunityHandler))
+					r.Delete("/", app.checkCommunityRole(store.CommunityRoleOwner, app.DeleteCommunityHandler))
+					r.Put("/membership", app.JoinCommunityHandler)
+					r.Delete("/membership", app.LeaveCommunityHandler)
+					r.Put("/members/{userID}/role", app.checkCommunityRole(store.CommunityRoleOwner, app.SetCommunityRoleHandler))
+					r.Delete("/members/{userID}", app.checkCommunityRole(store.CommunityRoleModerator, app.RemoveCommunityMemberHandler))
 				})
 			})
 		})
 
+		r.Route("/lists", func(r chi.Router) {
+			r.With(app.AuthTokenMiddelware).Get("/", app.GetListsHandler)
+			r.With(app.AuthTokenMiddelware).Post("/", app.CreateListHandler)
+			r.Route("/{listID}", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(app.OptionalAuthTokenMiddelware)
+					r.Use(app.listContextMiddleware)
+
+					r.Get("/", app.GetListHandler)
+					r.Get("/members", app.GetListMembersHandler)
+					r.Get("/feed", app.GetListFeedHandler)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddelware)
+					r.Use(app.listContextMiddleware)
+
+					r.Patch("/", app.checkListOwnership(app.UpdateListHandler))
+					r.Delete("/", app.checkListOwnership(app.DeleteListHandler))
+					r.Put("/members/{userID}", app.checkListOwnership(app.AddListMemberHandler))
+					r.Delete("/members/{userID}", app.checkListOwnership(app.RemoveListMemberHandler))
+				})
+			})
+		})
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddelware)
+			r.Get("/", app.GetWebhooksHandler)
+			r.Post("/", app.CreateWebhookHandler)
+			r.Route("/{webhookID}", func(r chi.Router) {
+				r.Use(app.webhookContextMiddleware)
+
+				r.Patch("/", app.UpdateWebhookHandler)
+				r.Delete("/", app.DeleteWebhookHandler)
+				r.Get("/deliveries", app.GetWebhookDeliveriesHandler)
+			})
+		})
+
+		r.Route("/feed/ranking", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddelware)
+			r.Get("/", app.requireRole("admin", app.GetRankingWeightsHandler))
+			r.Put("/", app.requireRole("admin", app.UpdateRankingWeightsHandler))
+		})
+
+		r.Route("/trending", func(r chi.Router) {
+			r.Use(app.OptionalAuthTokenMiddelware)
+			r.Get("/tags", app.GetTrendingTagsHandler)
+			r.Get("/posts", app.GetTrendingPostsHandler)
+		})
+
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
 			r.Get("/activate/{token}", app.activateUserHandler)
-			r.With(app.AuthTokenMiddelware).Get("/me", app.GetUserByIDHandler)
-			r.Route("/{userID}", func(r chi.Router) {
+			r.Route("/me", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddelware)
-				// r.Use(app.userContextMiddelware)
-
-				r.Get("/", app.GetUserByIDHandler)
-				r.Put("/follow", app.FollowUserByIDHandler)
-				r.Put("/unfollow", app.UnfollowUserByIDHandler)
-				r.Get("/posts", app.GetUsersPostsHandler)
-				// r.Delete("/", app.DeletePostHandler)
-				// r.Patch("/", app.UpdatePostHandler)
-				// r.Post("/comments", app.CreateCommentToPostByIDHandler)
+
+				r.Get("/", app.GetMeHandler)
+				r.Patch("/", app.UpdateProfileHandler)
+				r.Put("/avatar", app.UpdateAvatarHandler)
+				r.Delete("/avatar", app.DeleteAvatarHandler)
+				r.Get("/drafts", app.GetUserDraftsHandler)
+				r.Get("/bookmarks", app.GetBookmarksHandler)
+				r.Get("/bookmarks/collections", app.GetBookmarkCollectionsHandler)
+				r.Get("/tags", app.GetFollowedTagsHandler)
+				r.Get("/suggestions", app.GetSuggestionsHandler)
+				r.Get("/blocks", app.GetBlockedUsersHandler)
+			})
+			r.Route("/{userID}", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(app.OptionalAuthTokenMiddelware)
+					r.Get("/feed.rss", app.UserSyndicationHandler(syndication.FormatRSS))
+					r.Get("/feed.atom", app.UserSyndicationHandler(syndication.FormatAtom))
+					r.Get("/feed.json", app.UserSyndicationHandler(syndication.FormatJSON))
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddelware)
+					// r.Use(app.userContextMiddelware)
+
+					r.Get("/", app.GetUserByIDHandler)
+					r.Put("/follow", app.FollowUserByIDHandler)
+					r.Put("/unfollow", app.UnfollowUserByIDHandler)
+					r.Put("/block", app.BlockUserHandler)
+					r.Delete("/block", app.UnblockUserHandler)
+					r.Get("/lists", app.GetUserListsHandler)
+					r.Get("/posts", app.GetUsersPostsHandler)
+					// r.Delete("/", app.DeletePostHandler)
+					// r.Patch("/", app.UpdatePostHandler)
+					// r.Post("/comments", app.CreateCommentToPostByIDHandler)
+				})
 			})
 
 			r.Group(func(r chi.Router) {
@@ -176,11 +468,27 @@ func (app *application) run(mux http.Handler) error {
 		ReadTimeout:  time.Second * 10,
 		IdleTimeout:  time.Minute,
 	}
+	// hijacked WebSocket connections and event streams are not closed by
+	// Shutdown
+	srv.RegisterOnShutdown(app.gateway.shutdown)
+	srv.RegisterOnShutdown(app.closeStreams)
+
+	// background workers stop together with the server
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go app.runPostScheduler(workers)
+	go app.runTrendingRefresher(workers)
+	go app.runDigestSender(workers)
+	go app.runWebhookDispatcher(workers)
+	go app.runMediaProcessor(workers)
+	app.timeline.run(workers)
+	go app.events.Run(workers)
 
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		s := <-quit
+		stopWorkers()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// BlockUserHandler godoc
+//
+//	@Summary		Block a user
+//	@Description	block user by ID: neither of us can message the other any more and they are not suggested to me
+//	@Tags			USERS
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [put]
+func (app *application) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	if blockedID == user.ID {
+		badRequestResponse(w, r, fmt.Errorf("users can not block themselves"))
+		return
+	}
+
+	if err := app.store.Block.Block(r.Context(), user.ID, blockedID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+	app.forgetSuggestions(r.Context(), user.ID)
+	app.forgetSuggestions(r.Context(), blockedID)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UnblockUserHandler godoc
+//
+//	@Summary		Unblock a user
+//	@Description	unblock user by ID
+//	@Tags			USERS
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [delete]
+func (app *application) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+
+	if err := app.store.Block.Unblock(r.Context(), user.ID, blockedID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	app.forgetSuggestions(r.Context(), user.ID)
+	app.forgetSuggestions(r.Context(), blockedID)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetBlockedUsersHandler godoc
+//
+//	@Summary		Get the users I blocked
+//	@Description	list the users I blocked, latest first
+//	@Tags			USERS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.BlockedUser
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [get]
+func (app *application) GetBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	blocked, err := app.store.Block.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, blocked); err != nil {
+		internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/dubass83/go_social/internal/store"
+)
+
+type bookmarkPayload struct {
+	Collection string `json:"collection" validate:"max=100"`
+}
+
+// BookmarkPostHandler godoc
+//
+//	@Summary		Bookmark a post
+//	@Description	save a post privately, optionally into a named collection. Bookmarking a saved post again moves it to the given collection
+//	@Tags			BOOKMARKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int				true	"Post ID"
+//	@Param			payload	body		bookmarkPayload	false	"Collection"
+//	@Success		200		{object}	store.Bookmark
+//	@Failure		400		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/bookmark [put]
+func (app *application) BookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload bookmarkPayload
+	// the body is optional, no body saves into the default collection
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	bookmark := &store.Bookmark{
+		UserID:     user.ID,
+		PostID:     post.ID,
+		Collection: payload.Collection,
+	}
+	if err := app.store.Bookmark.Save(r.Context(), bookmark); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, bookmark); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// DeleteBookmarkHandler godoc
+//
+//	@Summary		Remove a bookmark
+//	@Description	remove a post from my bookmarks
+//	@Tags			BOOKMARKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"Post ID"
+//	@Success		202
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/bookmark [delete]
+func (app *application) DeleteBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Bookmark.Delete(r.Context(), user.ID, post.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetBookmarksHandler godoc
+//
+//	@Summary		Get my bookmarks
+//	@Description	list my bookmarked posts, most recently saved first. The next page is linked in the Link header
+//	@Tags			BOOKMARKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			collection	query		string	false	"Only list this collection"
+//	@Param			limit		query		int		false	"Limit number of posts"	default(10)
+//	@Param			cursor		query		string	false	"Cursor of the page"
+//	@Success		200			{object}	[]*store.PostWithMetadata
+//	@Header			200			{string}	Link	"Link to the next page"
+//	@Failure		400			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks [get]
+func (app *application) GetBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	cursorQueryDefault := store.CursorPaginatedQuery{
+		Limit: 10,
+	}
+
+	cursorQuery, err := cursorQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(cursorQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	collection := r.URL.Query().Get("collection")
+
+	posts, next, err := app.store.Bookmark.GetPosts(r.Context(), user.ID, collection, cursorQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	writeNextLink(w, r, next)
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetBookmarkCollectionsHandler godoc
+//
+//	@Summary		Get my bookmark collections
+//	@Description	list the names of my bookmark collections with the number of posts in each
+//	@Tags			BOOKMARKS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.BookmarkCollection
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks/collections [get]
+func (app *application) GetBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	collections, err := app.store.Bookmark.GetCollections(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		internalServerError(w, r, err)
+	}
+}
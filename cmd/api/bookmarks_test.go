@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMalformedCursor(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	// the cursors are rejected before the stores, which the mock storage
+	// does not have, are asked for a page
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"should reject a bookmarks cursor that is not base64", "/v1/users/me/bookmarks?cursor=***"},
+		{"should reject a bookmarks cursor without an id", "/v1/users/me/bookmarks?cursor=MjAyNC0wMS0wMVQwMDowMDowMFo"},
+		{"should reject a notifications cursor", "/v1/notifications?cursor=garbage"},
+		{"should reject a conversations cursor", "/v1/conversations?cursor=garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetBookmarksHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	// posts 3 and 4 were saved at the same time, the post ID breaks the tie
+	app.store.Bookmark.(*store.MockBookmarkStore).Bookmarks = []store.Bookmark{
+		{UserID: 42, PostID: 1, CreatedAt: "2024-01-01T10:00:00Z"},
+		{UserID: 42, PostID: 2, CreatedAt: "2024-01-02T10:00:00Z"},
+		{UserID: 7, PostID: 9, CreatedAt: "2024-01-02T11:00:00Z"},
+		{UserID: 42, PostID: 3, CreatedAt: "2024-01-03T10:00:00Z"},
+		{UserID: 42, PostID: 4, CreatedAt: "2024-01-03T10:00:00Z"},
+		{UserID: 42, PostID: 5, Collection: "later", CreatedAt: "2024-01-04T10:00:00Z"},
+	}
+	linkRegexp := regexp.MustCompile(`^<(.+)>; rel="next"$`)
+
+	tests := []struct {
+		name string
+		url  string
+		want []int64
+	}{
+		{"should page through my bookmarks, most recently saved first", "/v1/users/me/bookmarks?limit=2", []int64{5, 4, 3, 2, 1}},
+		{"should page through one collection", "/v1/users/me/bookmarks?limit=2&collection=later", []int64{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int64{}
+			for url := tt.url; url != ""; {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer "+testToken)
+
+				rr := executeRequest(req, mux)
+
+				if rr.Code != http.StatusOK {
+					t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+				}
+				var body struct {
+					Data []store.PostWithMetadata `json:"data"`
+				}
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				for _, p := range body.Data {
+					got = append(got, p.ID)
+				}
+
+				url = ""
+				if m := linkRegexp.FindStringSubmatch(rr.Header().Get("Link")); m != nil {
+					url = m[1]
+				}
+				if len(got) > len(tt.want) {
+					t.Fatalf("expected %v, got more: %v", tt.want, got)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/dubass83/go_social/internal/store"
 )
 
 type commentPayLoad struct {
-	UserID  int64  `json:"user_id" validate:"required"`
+	// UserID is optional, comments are always written as the current user
+	UserID  int64  `json:"user_id"`
 	Content string `json:"content" validate:"required"`
+	// MediaIDs attach media the user uploaded, in order
+	MediaIDs []int64 `json:"media_ids" validate:"omitempty,max=4,unique,dive,gte=1"`
 }
 
 // CreateCommentToPostByIDHandler godoc
 //
 //	@Summary		Create a comment on a post
-//	@Description	create a new comment on a post by post ID
+//	@Description	create a new comment on a post by post ID. @mentions and #hashtags are parsed from the content and returned with their offsets as entities, mentioned users who can see the post get notified. Up to 4 uploaded media can be attached with media_ids
 //	@Tags			COMMENTS
 //	@Accept			json
 //	@Produce		json
@@ -22,6 +27,7 @@ type commentPayLoad struct {
 //	@Param			comment	body		commentPayLoad	true	"Comment payload"
 //	@Success		201		{object}	store.Comment
 //	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
 //	@Failure		404		{object}	map[string]string
 //	@Failure		500		{object}	map[string]string
 //	@Router			/posts/{id}/comments [post]
@@ -32,7 +38,8 @@ func (app *application) CreateCommentToPostByIDHandler(w http.ResponseWriter, r
 	payload := commentPayLoad{}
 
 	if err := readJSON(w, r, &payload); err != nil {
-		internalServerError(w, r, err)
+		badRequestResponse(w, r, err)
+		return
 	}
 
 	if err := validate.Struct(payload); err != nil {
@@ -40,15 +47,47 @@ func (app *application) CreateCommentToPostByIDHandler(w http.ResponseWriter, r
 		return
 	}
 
+	// the post was checked to be visible to the current user only, so
+	// nobody may comment in the name of someone else
+	user := getUserFromCtx(r)
+	if payload.UserID != 0 && payload.UserID != user.ID {
+		forbiddenResponse(w, r, fmt.Errorf("user %d can not comment as user %d", user.ID, payload.UserID))
+		return
+	}
+
+	media, err := app.attachableMedia(r, user.ID, payload.MediaIDs)
+	if err != nil {
+		switch err.(type) {
+		case errMediaNotOwned:
+			badRequestResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
 	comment := &store.Comment{
-		UserID:  payload.UserID,
+		UserID:  user.ID,
 		Content: payload.Content,
 		PostID:  post.ID,
+		Media:   media,
 	}
 
 	if err := app.store.Comment.Create(ctx, comment); err != nil {
 		internalServerError(w, r, err)
+		return
 	}
+	// signed before the comment is shared with the goroutines below
+	app.signMedia(comment)
+
+	go app.notifyMentioned(context.Background(), user.ID, post, comment.ID, comment.Entities)
+	go app.publishCommentCreated(post, comment)
+	go app.notify(context.Background(), &store.Notification{
+		UserID:    post.UserID,
+		Kind:      store.NotificationComment,
+		PostID:    &post.ID,
+		CommentID: &comment.ID,
+	}, user.ID)
 
 	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
 		internalServerError(w, r, err)
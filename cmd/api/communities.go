@@ -0,0 +1,541 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type communityKey string
+
+const communityCTX communityKey = "community"
+
+type CommunityPayload struct {
+	Name        string `json:"name" validate:"required,min=3,max=50"`
+	Description string `json:"description" validate:"max=500"`
+}
+
+type UpdateCommunityPayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=3,max=50"`
+	Description *string `json:"description" validate:"omitempty,max=500"`
+}
+
+type communityRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=owner moderator member"`
+}
+
+// CreateCommunityHandler godoc
+//
+//	@Summary		Create a community
+//	@Description	create a community with a unique name, I become its owner
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			community	body		CommunityPayload	true	"Community"
+//	@Success		201			{object}	store.Community
+//	@Failure		400			{object}	map[string]string
+//	@Failure		409			{object}	conflictEnvelope
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities [post]
+func (app *application) CreateCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CommunityPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	community := &store.Community{
+		Name:        payload.Name,
+		Description: payload.Description,
+	}
+	if err := app.store.Community.Create(r.Context(), community, user.ID); err != nil {
+		switch err {
+		case store.ErrDuplicate:
+			conflictResponse(w, r, fmt.Errorf("community %s already exists", payload.Name), nil)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, community); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetCommunitiesHandler godoc
+//
+//	@Summary		Get communities
+//	@Description	list the communities, the ones with the most members first, with my role in each
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit number of communities"	default(20)
+//	@Param			offset	query		int		false	"Offset for pagination"			default(0)
+//	@Param			search	query		string	false	"Search the name and description"
+//	@Success		200		{object}	[]store.Community
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/communities [get]
+func (app *application) GetCommunitiesHandler(w http.ResponseWriter, r *http.Request) {
+	pgQueryDefault := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	pgQuery, err := pgQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(pgQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	communities, err := app.store.Community.GetAll(r.Context(), getViewerID(r), pgQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, communities); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetCommunityHandler godoc
+//
+//	@Summary		Get a community
+//	@Description	get community by ID with my role in it
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Success		200			{object}	store.Community
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Router			/communities/{communityID} [get]
+func (app *application) GetCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, community); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateCommunityHandler godoc
+//
+//	@Summary		Update a community
+//	@Description	change the name or description of a community I own
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int						true	"Community ID"
+//	@Param			community	body		UpdateCommunityPayload	true	"Changes"
+//	@Success		200			{object}	store.Community
+//	@Failure		400			{object}	map[string]string
+//	@Failure		403			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		409			{object}	conflictEnvelope
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID} [patch]
+func (app *application) UpdateCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	var payload UpdateCommunityPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Name != nil {
+		community.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		community.Description = *payload.Description
+	}
+
+	if err := app.store.Community.Update(r.Context(), community); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		case store.ErrDuplicate:
+			conflictResponse(w, r, fmt.Errorf("community %s already exists", community.Name), nil)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, community); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// DeleteCommunityHandler godoc
+//
+//	@Summary		Delete a community
+//	@Description	delete a community I own together with its posts
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Success		200			{object}	map[string]string
+//	@Failure		403			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID} [delete]
+func (app *application) DeleteCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	if err := app.store.Community.Delete(r.Context(), community.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"message": fmt.Sprintf("community with id %d was deleted", community.ID),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// JoinCommunityHandler godoc
+//
+//	@Summary		Join a community
+//	@Description	become a member of a community, members can post to it
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Success		202
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/membership [put]
+func (app *application) JoinCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+	user := getUserFromCtx(r)
+
+	if err := app.store.Community.Join(r.Context(), community.ID, user.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// LeaveCommunityHandler godoc
+//
+//	@Summary		Leave a community
+//	@Description	stop being a member of a community, the owner has to hand it over first
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/membership [delete]
+func (app *application) LeaveCommunityHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+	user := getUserFromCtx(r)
+
+	if community.Role == store.CommunityRoleOwner {
+		badRequestResponse(w, r, fmt.Errorf("the owner can not leave community %d, make someone else the owner first", community.ID))
+		return
+	}
+
+	if err := app.store.Community.RemoveMember(r.Context(), community.ID, user.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetCommunityMembersHandler godoc
+//
+//	@Summary		Get the members of a community
+//	@Description	list the members of a community, the owner and moderators first
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			limit		query		int		false	"Limit number of members"	default(20)
+//	@Param			offset		query		int		false	"Offset for pagination"		default(0)
+//	@Param			search		query		string	false	"Search the usernames"
+//	@Success		200			{object}	[]store.CommunityMember
+//	@Failure		400			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Router			/communities/{communityID}/members [get]
+func (app *application) GetCommunityMembersHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	pgQueryDefault := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "asc",
+	}
+
+	pgQuery, err := pgQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(pgQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	members, err := app.store.Community.GetMembers(r.Context(), community.ID, pgQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, members); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// SetCommunityRoleHandler godoc
+//
+//	@Summary		Change the role of a member
+//	@Description	make a member of a community I own a moderator or a member again, or hand the community over by making them the owner, which makes me a moderator
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path	int						true	"Community ID"
+//	@Param			userID		path	int						true	"User ID"
+//	@Param			role		body	communityRolePayload	true	"Role"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID}/role [put]
+func (app *application) SetCommunityRoleHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload communityRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if community.Role == store.CommunityRoleOwner && memberID == getUserFromCtx(r).ID {
+		badRequestResponse(w, r, fmt.Errorf("the owner hands community %d over by making someone else the owner", community.ID))
+		return
+	}
+
+	if err := app.store.Community.SetRole(r.Context(), community.ID, memberID, payload.Role); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// RemoveCommunityMemberHandler godoc
+//
+//	@Summary		Remove a member
+//	@Description	remove a member with a lower role than mine from a community I moderate
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path	int	true	"Community ID"
+//	@Param			userID		path	int	true	"User ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID} [delete]
+func (app *application) RemoveCommunityMemberHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+
+	member, err := app.store.Community.GetMember(ctx, community.ID, memberID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// site admins may remove anyone but the owner, the others only members
+	// below them
+	if member.Role == store.CommunityRoleOwner {
+		forbiddenResponse(w, r, fmt.Errorf("the owner of community %d can not be removed", community.ID))
+		return
+	}
+	admin, err := app.store.Role.IsPrecedent(ctx, user.RoleID, "admin")
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	if !admin {
+		self, err := app.store.Community.GetMember(ctx, community.ID, user.ID)
+		if err != nil && err != store.ErrNotFound {
+			internalServerError(w, r, err)
+			return
+		}
+		if self == nil || self.Level <= member.Level {
+			forbiddenResponse(w, r, fmt.Errorf("user %d can not remove user %d from community %d", user.ID, memberID, community.ID))
+			return
+		}
+	}
+
+	if err := app.store.Community.RemoveMember(ctx, community.ID, memberID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetCommunityFeedHandler godoc
+//
+//	@Summary		Get the feed of a community
+//	@Description	list the posts of a community visible to me, newest first
+//	@Tags			COMMUNITIES
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			limit		query		int		false	"Limit number of posts"	default(10)
+//	@Param			offset		query		int		false	"Offset for pagination"	default(0)
+//	@Param			sort		query		string	false	"Sort order (asc/desc)"	default(desc)
+//	@Param			tags		query		string	false	"Filter by tags (comma-separated)"
+//	@Param			search		query		string	false	"Search query"
+//	@Success		200			{object}	[]store.PostWithMetadata
+//	@Failure		400			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Router			/communities/{communityID}/feed [get]
+func (app *application) GetCommunityFeedHandler(w http.ResponseWriter, r *http.Request) {
+	community := getCommunityFromCtx(r)
+
+	pgPostsQueryDefault := store.PaginatedFeedQuery{
+		Limit:  10,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	pgPostsQuery, err := pgPostsQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(pgPostsQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Post.GetCommunityPosts(r.Context(), community.ID, getViewerID(r), pgPostsQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// communityContextMiddleware loads the community of the URL with the role
+// of the current user in it
+func (app *application) communityContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "communityID"), 10, 64)
+		if err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		community, err := app.store.Community.GetByID(ctx, id, getViewerID(r))
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				notFoundResponse(w, r, err)
+			default:
+				internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, communityCTX, community)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommunityFromCtx(r *http.Request) *store.Community {
+	community, _ := r.Context().Value(communityCTX).(*store.Community)
+	return community
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateCommunityHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"should reject no name", `{"description": "gophers"}`},
+		{"should reject a short name", `{"name": "go"}`},
+		{"should reject a long name", `{"name": "` + strings.Repeat("g", 51) + `"}`},
+		{"should reject a long description", `{"name": "gophers", "description": "` + strings.Repeat("g", 501) + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/communities", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+// newCommunityTestApplication returns an application with community 5 owned
+// by user 1, moderated by users 2 and 6 and joined by user 3. The requests
+// are made by the user the returned pointer is set to.
+func newCommunityTestApplication(t *testing.T) (*application, *store.User) {
+	t.Helper()
+	app := newTestApplication(t)
+	user := &store.User{}
+	app.cache.User.(*cache.MockUserCache).On("Get", mock.Anything, int64(42)).Return(user, nil)
+
+	ctx := context.Background()
+	communities := app.store.Community
+	if err := communities.Create(ctx, &store.Community{ID: 5, Name: "gophers"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{2, 3, 6} {
+		if err := communities.Join(ctx, 5, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []int64{2, 6} {
+		if err := communities.SetRole(ctx, 5, id, store.CommunityRoleModerator); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return app, user
+}
+
+func communityRequest(t *testing.T, app *application, method, url, body string) int {
+	t.Helper()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	return executeRequest(req, app.mount()).Code
+}
+
+func TestCheckCommunityRole(t *testing.T) {
+	tests := []struct {
+		name string
+		user store.User
+		want int
+	}{
+		{"should let the owner delete the community", store.User{ID: 1, RoleID: 1}, http.StatusOK},
+		{"should not let a moderator delete the community", store.User{ID: 2, RoleID: 1}, http.StatusForbidden},
+		{"should not let a member delete the community", store.User{ID: 3, RoleID: 1}, http.StatusForbidden},
+		{"should not let an outsider delete the community", store.User{ID: 4, RoleID: 1}, http.StatusForbidden},
+		{"should not let a site moderator delete the community", store.User{ID: 4, RoleID: 2}, http.StatusForbidden},
+		{"should let a site admin delete the community", store.User{ID: 4, RoleID: 3}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, user := newCommunityTestApplication(t)
+			*user = tt.user
+
+			if code := communityRequest(t, app, http.MethodDelete, "/v1/communities/5", ""); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestCheckPostOwnershipCommunity(t *testing.T) {
+	communityID := int64(5)
+	otherCommunityID := int64(8)
+
+	tests := []struct {
+		name        string
+		user        store.User
+		communityID *int64
+		want        int
+	}{
+		{"should let a community moderator delete a post of the community", store.User{ID: 2, RoleID: 1}, &communityID, http.StatusOK},
+		{"should let the community owner delete a post of the community", store.User{ID: 1, RoleID: 1}, &communityID, http.StatusOK},
+		{"should not let a community member delete a post of the community", store.User{ID: 3, RoleID: 1}, &communityID, http.StatusForbidden},
+		{"should not let a community moderator delete a post of another community", store.User{ID: 2, RoleID: 1}, &otherCommunityID, http.StatusForbidden},
+		{"should not let a community moderator delete a post outside communities", store.User{ID: 2, RoleID: 1}, nil, http.StatusForbidden},
+		{"should let a site admin delete a post of the community", store.User{ID: 4, RoleID: 3}, &communityID, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, user := newCommunityTestApplication(t)
+			*user = tt.user
+			posts := app.store.Post.(*store.MockPostStore)
+			posts.CommunityID = tt.communityID
+
+			if code := communityRequest(t, app, http.MethodDelete, "/v1/posts/1", ""); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestSetCommunityRoleHandler(t *testing.T) {
+	t.Run("should hand the community over to the new owner", func(t *testing.T) {
+		app, user := newCommunityTestApplication(t)
+		*user = store.User{ID: 1, RoleID: 1}
+
+		code := communityRequest(t, app, http.MethodPut, "/v1/communities/5/members/3/role", `{"role": "owner"}`)
+
+		if code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, code)
+		}
+		for id, want := range map[int64]string{1: store.CommunityRoleModerator, 3: store.CommunityRoleOwner} {
+			member, err := app.store.Community.GetMember(context.Background(), 5, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if member.Role != want {
+				t.Errorf("expected user %d to be %s, got %s", id, want, member.Role)
+			}
+		}
+	})
+
+	tests := []struct {
+		name string
+		user store.User
+		url  string
+		body string
+		want int
+	}{
+		{"should not let the owner change their own role", store.User{ID: 1, RoleID: 1}, "/v1/communities/5/members/1/role", `{"role": "member"}`, http.StatusBadRequest},
+		{"should not find a user who is not a member", store.User{ID: 1, RoleID: 1}, "/v1/communities/5/members/4/role", `{"role": "moderator"}`, http.StatusNotFound},
+		{"should reject an unknown role", store.User{ID: 1, RoleID: 1}, "/v1/communities/5/members/3/role", `{"role": "admin"}`, http.StatusBadRequest},
+		{"should not let a moderator set roles", store.User{ID: 2, RoleID: 1}, "/v1/communities/5/members/3/role", `{"role": "moderator"}`, http.StatusForbidden},
+		{"should let a site admin set roles", store.User{ID: 4, RoleID: 3}, "/v1/communities/5/members/3/role", `{"role": "moderator"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, user := newCommunityTestApplication(t)
+			*user = tt.user
+
+			if code := communityRequest(t, app, http.MethodPut, tt.url, tt.body); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestRemoveCommunityMemberHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     store.User
+		memberID int64
+		want     int
+	}{
+		{"should let a moderator remove a member", store.User{ID: 2, RoleID: 1}, 3, http.StatusAccepted},
+		{"should not let a moderator remove another moderator", store.User{ID: 2, RoleID: 1}, 6, http.StatusForbidden},
+		{"should not let a moderator remove the owner", store.User{ID: 2, RoleID: 1}, 1, http.StatusForbidden},
+		{"should let the owner remove a moderator", store.User{ID: 1, RoleID: 1}, 6, http.StatusAccepted},
+		{"should not let a member remove members", store.User{ID: 3, RoleID: 1}, 6, http.StatusForbidden},
+		{"should let a site admin remove a moderator", store.User{ID: 4, RoleID: 3}, 6, http.StatusAccepted},
+		{"should not let a site admin remove the owner", store.User{ID: 4, RoleID: 3}, 1, http.StatusForbidden},
+		{"should not find a user who is not a member", store.User{ID: 2, RoleID: 1}, 4, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, user := newCommunityTestApplication(t)
+			*user = tt.user
+
+			code := communityRequest(t, app, http.MethodDelete, fmt.Sprintf("/v1/communities/5/members/%d", tt.memberID), "")
+
+			if code != tt.want {
+				t.Fatalf("expected status code %d, got %d", tt.want, code)
+			}
+			if code == http.StatusNotFound {
+				return
+			}
+			_, err := app.store.Community.GetMember(context.Background(), 5, tt.memberID)
+			if removed := err == store.ErrNotFound; removed != (code == http.StatusAccepted) {
+				t.Errorf("expected user %d to be removed only when accepted, got %v", tt.memberID, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type conversationKey string
+
+const conversationCTX conversationKey = "conversation"
+
+type CreateConversationPayload struct {
+	// UserIDs are the other members, a single one without a title makes a
+	// 1:1 conversation
+	UserIDs []int64 `json:"user_ids" validate:"required,min=1,max=9,unique,dive,gt=0"`
+	Title   *string `json:"title" validate:"omitempty,min=1,max=100"`
+}
+
+type MessagePayload struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+// readReceipt is the data of message.read events
+type readReceipt struct {
+	ConversationID int64 `json:"conversation_id"`
+	store.ConversationMember
+}
+
+// CreateConversationHandler godoc
+//
+//	@Summary		Start a conversation
+//	@Description	start a 1:1 conversation with one user, or a group with up to 9 others (or a titled one with one other). Starting a 1:1 conversation that exists returns it. Users who blocked me, who I blocked, or who only take messages from the users they follow can not be added, nor two users who blocked one another
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversation	body		CreateConversationPayload	true	"Members"
+//	@Success		200				{object}	store.Conversation	"The existing 1:1 conversation"
+//	@Success		201				{object}	store.Conversation
+//	@Failure		400				{object}	map[string]string
+//	@Failure		403				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [post]
+func (app *application) CreateConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	if slices.Contains(payload.UserIDs, user.ID) {
+		badRequestResponse(w, r, fmt.Errorf("members are other users"))
+		return
+	}
+	ctx := r.Context()
+
+	denied, err := app.store.Conversation.GetUnmessageable(ctx, user.ID, payload.UserIDs)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	if len(denied) > 0 {
+		forbiddenResponse(w, r, fmt.Errorf("user %d can not be messaged", denied[0]))
+		return
+	}
+	// the members are put in touch with each other too
+	blocks, err := app.store.Block.GetAmong(ctx, payload.UserIDs)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	if len(blocks) > 0 {
+		forbiddenResponse(w, r, fmt.Errorf("users %d and %d blocked one another", blocks[0].UserID, blocks[0].BlockedID))
+		return
+	}
+
+	id, created, err := app.store.Conversation.Create(ctx, user.ID, payload.UserIDs, payload.Title)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	conversation, err := app.store.Conversation.GetByID(ctx, id, user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetConversationsHandler godoc
+//
+//	@Summary		Get my conversations
+//	@Description	list my conversations, the one with the latest message first, with their members, last message and my unread count. The next page is linked in the Link header
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit number of conversations"	default(20)
+//	@Param			cursor	query		string	false	"Cursor of the page"
+//	@Success		200		{object}	[]store.Conversation
+//	@Header			200		{string}	Link	"Link to the next page"
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [get]
+func (app *application) GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	cursorQueryDefault := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	cursorQuery, err := cursorQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(cursorQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	conversations, next, err := app.store.Conversation.GetByUserID(r.Context(), user.ID, cursorQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	writeNextLink(w, r, next)
+	if err := app.jsonResponse(w, http.StatusOK, conversations); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetConversationHandler godoc
+//
+//	@Summary		Get a conversation
+//	@Description	get one of my conversations with the read receipts of its members
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int	true	"Conversation ID"
+//	@Success		200				{object}	store.Conversation
+//	@Failure		404				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID} [get]
+func (app *application) GetConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetMessagesHandler godoc
+//
+//	@Summary		Get the messages of a conversation
+//	@Description	list the messages of one of my conversations, newest first. The next page is linked in the Link header
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int		true	"Conversation ID"
+//	@Param			limit			query		int		false	"Limit number of messages"	default(50)
+//	@Param			cursor			query		string	false	"Cursor of the page"
+//	@Success		200				{object}	[]store.Message
+//	@Header			200				{string}	Link	"Link to the next page"
+//	@Failure		400				{object}	map[string]string
+//	@Failure		404				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [get]
+func (app *application) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+
+	cursorQueryDefault := store.CursorPaginatedQuery{
+		Limit: 50,
+	}
+
+	cursorQuery, err := cursorQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(cursorQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	messages, next, err := app.store.Conversation.GetMessages(r.Context(), conversation.ID, cursorQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	writeNextLink(w, r, next)
+	if err := app.jsonResponse(w, http.StatusOK, messages); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// SendMessageHandler godoc
+//
+//	@Summary		Send a message
+//	@Description	send a message to one of my conversations, it is streamed to the members as a message event. A 1:1 message is refused once either user blocked the other or the other only takes messages from the users they follow and stopped following me. A group message is refused while I blocked another member or was blocked by one
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int				true	"Conversation ID"
+//	@Param			message			body		MessagePayload	true	"Message"
+//	@Success		201				{object}	store.Message
+//	@Failure		400				{object}	map[string]string
+//	@Failure		403				{object}	map[string]string
+//	@Failure		404				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [post]
+func (app *application) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+
+	var payload MessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// members may have fallen out since they were added: the two members
+	// of a 1:1 conversation are checked again, and nobody in a group may
+	// message across a block, leaving is the way out
+	if !conversation.IsGroup {
+		others := slices.DeleteFunc(conversation.MemberIDs(), func(id int64) bool { return id == user.ID })
+		denied, err := app.store.Conversation.GetUnmessageable(ctx, user.ID, others)
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		if len(denied) > 0 {
+			forbiddenResponse(w, r, fmt.Errorf("user %d can not be messaged", denied[0]))
+			return
+		}
+	} else {
+		blocks, err := app.store.Block.GetAmong(ctx, conversation.MemberIDs())
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		for _, b := range blocks {
+			if other, ok := b.Involves(user.ID); ok {
+				forbiddenResponse(w, r, fmt.Errorf("user %d of the group can not be messaged", other))
+				return
+			}
+		}
+	}
+
+	message := &store.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Content:        payload.Content,
+	}
+	if err := app.store.Conversation.AddMessage(ctx, message); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	go app.publishEvent(events.TypeMessage, message, conversation.MemberIDs()...)
+
+	if err := app.jsonResponse(w, http.StatusCreated, message); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// LeaveConversationHandler godoc
+//
+//	@Summary		Leave a conversation
+//	@Description	leave one of my conversations, it no longer shows up and I get none of its messages. Starting a 1:1 conversation I left again joins it back
+//	@Tags			CONVERSATIONS
+//	@Produce		json
+//	@Param			conversationID	path		int	true	"Conversation ID"
+//	@Success		200				{object}	map[string]string
+//	@Failure		404				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/membership [delete]
+func (app *application) LeaveConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+	user := getUserFromCtx(r)
+
+	if err := app.store.Conversation.Leave(r.Context(), conversation.ID, user.ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	data := map[string]string{
+		"message": fmt.Sprintf("left conversation %d", conversation.ID),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// MarkConversationReadHandler godoc
+//
+//	@Summary		Mark a conversation as read
+//	@Description	mark the messages of one of my conversations as read up to message_id, or all of them. The read receipt is streamed to the members as a message.read event
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int	true	"Conversation ID"
+//	@Param			message_id		query		int	false	"Last message read"
+//	@Success		200				{object}	store.ConversationMember
+//	@Failure		400				{object}	map[string]string
+//	@Failure		404				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/read [put]
+func (app *application) MarkConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+
+	var messageID int64
+	if id := r.URL.Query().Get("message_id"); id != "" {
+		var err error
+		if messageID, err = strconv.ParseInt(id, 10, 64); err != nil || messageID < 1 {
+			badRequestResponse(w, r, fmt.Errorf("invalid message_id: %s", id))
+			return
+		}
+	}
+
+	user := getUserFromCtx(r)
+
+	member, err := app.store.Conversation.MarkRead(r.Context(), conversation.ID, user.ID, messageID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+	member.Username = user.Username
+	go app.publishEvent(events.TypeMessageRead, readReceipt{ConversationID: conversation.ID, ConversationMember: *member}, conversation.MemberIDs()...)
+
+	if err := app.jsonResponse(w, http.StatusOK, member); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetMessageSettingsHandler godoc
+//
+//	@Summary		Get my message settings
+//	@Description	get who may message me: when followed_only is set only the users I follow can
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	store.MessageSettings
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/settings [get]
+func (app *application) GetMessageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	settings, err := app.store.Conversation.GetSettings(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateMessageSettingsHandler godoc
+//
+//	@Summary		Update my message settings
+//	@Description	set whether only the users I follow can message me, it also applies to my existing 1:1 conversations
+//	@Tags			CONVERSATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			settings	body		store.MessageSettings	true	"Settings"
+//	@Success		200			{object}	store.MessageSettings
+//	@Failure		400			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/settings [put]
+func (app *application) UpdateMessageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings store.MessageSettings
+	if err := readJSON(w, r, &settings); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	if err := app.store.Conversation.SetSettings(r.Context(), user.ID, &settings); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// conversationContextMiddleware loads the conversation of the URL as seen by
+// the user, conversations they are not a member of are not found
+func (app *application) conversationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+		if err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		conversation, err := app.store.Conversation.GetByID(ctx, id, getUserFromCtx(r).ID)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				notFoundResponse(w, r, err)
+			default:
+				internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, conversationCTX, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *store.Conversation {
+	conversation, _ := r.Context().Value(conversationCTX).(*store.Conversation)
+	return conversation
+}
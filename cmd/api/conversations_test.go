@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateConversationHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"should reject no members", `{"user_ids": []}`},
+		{"should reject a member twice", `{"user_ids": [7, 7]}`},
+		{"should reject too many members", `{"user_ids": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]}`},
+		{"should reject myself as a member", `{"user_ids": [42]}`},
+		{"should reject an empty title", `{"user_ids": [7], "title": ""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/conversations", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestBlockUserHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	t.Run("should not allow blocking myself", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/42/block", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestGroupConversationBlocks(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	blocks := app.store.Block.(*store.MockBlockStore)
+	app.store.Conversation.(*store.MockConversationStore).Conversation = &store.Conversation{
+		ID:      5,
+		IsGroup: true,
+		Members: []store.ConversationMember{{ID: 42}, {ID: 7}, {ID: 8}},
+	}
+
+	send := func(t *testing.T) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, "/v1/conversations/5/messages", strings.NewReader(`{"content": "hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should refuse messages of a member blocked by another", func(t *testing.T) {
+		blocks.Blocks = []store.UserBlock{{UserID: 7, BlockedID: 42}}
+		if code := send(t); code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("should refuse messages of a member who blocked another", func(t *testing.T) {
+		blocks.Blocks = []store.UserBlock{{UserID: 42, BlockedID: 8}}
+		if code := send(t); code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, code)
+		}
+	})
+
+	t.Run("should allow messages when the blocks do not involve the sender", func(t *testing.T) {
+		blocks.Blocks = []store.UserBlock{{UserID: 7, BlockedID: 8}}
+		if code := send(t); code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, code)
+		}
+	})
+
+	t.Run("should refuse a group of members who blocked one another", func(t *testing.T) {
+		blocks.Blocks = []store.UserBlock{{UserID: 7, BlockedID: 8}}
+		req, err := http.NewRequest(http.MethodPost, "/v1/conversations", strings.NewReader(`{"user_ids": [7, 8]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should let members leave", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/v1/conversations/5/membership", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
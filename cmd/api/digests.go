@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dubass83/go_social/internal/mailer"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// digestItems is how many notifications a digest lists, the others are
+// counted
+const digestItems = 20
+
+// digestData is what the digest template renders
+type digestData struct {
+	Username         string
+	Frequency        string
+	Notifications    []*store.Notification
+	More             int
+	NotificationsURL string
+	UnsubscribeURL   string
+}
+
+// runDigestSender sends the digests that are due every interval until ctx
+// is cancelled
+func (app *application) runDigestSender(ctx context.Context) {
+	ticker := time.NewTicker(app.config.digest.interval)
+	defer ticker.Stop()
+
+	log.Info().Msgf("digest sender started with interval %s", app.config.digest.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("digest sender stopped")
+			return
+		case <-ticker.C:
+			app.sendDueDigests(ctx)
+		}
+	}
+}
+
+// sendDueDigests sends a batch of due digests, the rest are sent on the next
+// run. A digest that fails to send is retried on the next run.
+func (app *application) sendDueDigests(ctx context.Context) {
+	now := time.Now()
+	recipients, err := app.store.NotificationPreference.GetDueDigests(ctx, now, app.config.digest.batchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get due digests")
+		return
+	}
+
+	for _, recipient := range recipients {
+		if err := app.sendDigest(ctx, recipient, now); err != nil {
+			log.Error().Err(err).Int64("user_id", recipient.UserID).Msg("failed to send digest")
+			continue
+		}
+		if err := app.store.NotificationPreference.MarkDigestSent(ctx, recipient.UserID, now); err != nil {
+			log.Error().Err(err).Int64("user_id", recipient.UserID).Msg("failed to record the digest as sent")
+		}
+	}
+}
+
+// sendDigest emails the recipient their unread notifications since the last
+// digest, nothing is sent when there are none
+func (app *application) sendDigest(ctx context.Context, recipient store.DigestRecipient, now time.Time) error {
+	// one more than listed tells whether there are more
+	notifications, err := app.store.Notification.GetUnreadSince(ctx, recipient.UserID, recipient.Since(now), recipient.Kinds, digestItems+1)
+	if err != nil {
+		return err
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	data := digestData{
+		Username:         recipient.Username,
+		Frequency:        recipient.Frequency,
+		Notifications:    notifications,
+		NotificationsURL: app.config.frontendURL + "/notifications",
+		UnsubscribeURL:   app.unsubscribeURL(recipient.UserID),
+	}
+	if len(notifications) > digestItems {
+		data.Notifications = notifications[:digestItems]
+		// the exact number is not worth another query
+		data.More = len(notifications) - digestItems
+	}
+
+	return app.mailer.Send(mailer.Message{
+		To:       []string{recipient.Email},
+		Subject:  fmt.Sprintf("Your %s Go Social digest", recipient.Frequency),
+		Data:     data,
+		Template: "digest",
+		Headers: map[string]string{
+			// one-click unsubscribe from the mail client (RFC 8058)
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// unsubscribeURL is a link that stops the notification emails of the user
+// without logging in
+func (app *application) unsubscribeURL(userID int64) string {
+	token := app.unsubscribeSigner.Sign(strconv.FormatInt(userID, 10))
+	return fmt.Sprintf("http://%s/v1/notifications/unsubscribe?token=%s", app.config.apiURL, token)
+}
+
+// unsubscribePage asks to confirm the unsubscribe, following the link of a
+// digest must not unsubscribe by itself: mail scanners and link previews
+// open links nobody clicked
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe from Go Social</title></head>
+<body>
+{{if .Done}}
+<p>You will not get notification emails anymore.</p>
+{{else}}
+<form method="post" action="?token={{.Token}}">
+  <p>Stop all notification emails from Go Social?</p>
+  <button type="submit">Unsubscribe</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// UnsubscribePageHandler godoc
+//
+//	@Summary		Confirm unsubscribing from notification emails
+//	@Description	the page linked from every digest, asking to confirm with a POST to the same URL. Opening it changes nothing
+//	@Tags			NOTIFICATIONS
+//	@Produce		html
+//	@Param			token	query	string	true	"Signed unsubscribe token"
+//	@Success		200
+//	@Failure		400	{object}	map[string]string
+//	@Router			/notifications/unsubscribe [get]
+func (app *application) UnsubscribePageHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, err := app.unsubscribeUserID(token); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	app.renderUnsubscribePage(w, r, token, false)
+}
+
+// UnsubscribeHandler godoc
+//
+//	@Summary		Unsubscribe from notification emails
+//	@Description	stop the digests of the user the signed token was issued for and deliver their email notifications in-app only. Posted by the confirmation page and by mail clients for one-click unsubscribe (RFC 8058); browsers get a page back
+//	@Tags			NOTIFICATIONS
+//	@Produce		json
+//	@Param			token	query	string	true	"Signed unsubscribe token"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/notifications/unsubscribe [post]
+func (app *application) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.unsubscribeUserID(r.URL.Query().Get("token"))
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.NotificationPreference.UnsubscribeEmail(r.Context(), userID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		app.renderUnsubscribePage(w, r, "", true)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// unsubscribeUserID returns the user an unsubscribe token was signed for
+func (app *application) unsubscribeUserID(token string) (int64, error) {
+	payload, err := app.unsubscribeSigner.Verify(token)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(payload, 10, 64)
+}
+
+func (app *application) renderUnsubscribePage(w http.ResponseWriter, r *http.Request, token string, done bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	data := struct {
+		Token string
+		Done  bool
+	}{token, done}
+	if err := unsubscribePage.Execute(w, data); err != nil {
+		log.Error().Err(err).Msg("failed to render the unsubscribe page")
+	}
+}
@@ -25,3 +25,35 @@ func unAuthorizedResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Error().Err(err).Msgf("unauthorized error: %s path: %s", r.Method, r.RequestURI)
 	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
 }
+
+func forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Msgf("forbidden error: %s path: %s", r.Method, r.RequestURI)
+	writeJSONError(w, http.StatusForbidden, "forbidden")
+}
+
+// conflictEnvelope is the body of 409 responses, Data is the current state
+// of what the request conflicted with, if any
+type conflictEnvelope struct {
+	Error string `json:"error"`
+	Data  any    `json:"data"`
+}
+
+func conflictResponse(w http.ResponseWriter, r *http.Request, err error, current any) {
+	log.Error().Err(err).Msgf("conflict error: %s path: %s", r.Method, r.RequestURI)
+	writeJSON(w, http.StatusConflict, &conflictEnvelope{Error: err.Error(), Data: current})
+}
+
+func preconditionRequiredResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Msgf("precondition required error: %s path: %s", r.Method, r.RequestURI)
+	writeJSONError(w, http.StatusPreconditionRequired, err.Error())
+}
+
+func payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Msgf("payload too large error: %s path: %s", r.Method, r.RequestURI)
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Msgf("unsupported media type error: %s path: %s", r.Method, r.RequestURI)
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/dubass83/go_social/internal/store"
 )
@@ -9,7 +10,8 @@ import (
 // GetUserFeedHandler godoc
 //
 //	@Summary		Get user feed
-//	@Description	get paginated feed of posts from followed users
+//	@Description	get paginated feed of posts from followed users, their reposts and posts with followed tags. Each entry has a source (own, following, repost or tag) with reposted_by or source_tag telling who or what brought it in.
+//	@Description	With mode=ranked the feed is ordered by a score of recency, affinity with the author, engagement and tag overlap instead. The ranking is snapshotted in a session, the next page is linked in the Link header and carries the session, sort is ignored
 //	@Tags			FEEDS
 //	@Accept			json
 //	@Produce		json
@@ -18,8 +20,12 @@ import (
 //	@Param			sort	query		string	false	"Sort order (asc/desc)"	default(desc)
 //	@Param			tags	query		string	false	"Filter by tags (comma-separated)"
 //	@Param			search	query		string	false	"Search query"
-//	@Success		200		{array}		store.Post
+//	@Param			mode	query		string	false	"Feed order (latest/ranked)"	default(latest)
+//	@Param			session	query		string	false	"Ranked session to page through"
+//	@Success		200		{array}		store.PostWithMetadata
+//	@Header			200		{string}	Link	"Link to the next page of a ranked feed"
 //	@Failure		400		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string	"Ranked session not found or expired"
 //	@Failure		500		{object}	map[string]string
 //	@Router			/users/feed [get]
 func (app *application) GetUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -27,6 +33,7 @@ func (app *application) GetUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Limit:  10,
 		Offset: 0,
 		Sort:   "desc",
+		Mode:   "latest",
 	}
 
 	pgFeedQuery, err := pgFeedQueryDefault.Parse(r)
@@ -44,6 +51,11 @@ func (app *application) GetUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	ctx := r.Context()
 
+	if pgFeedQuery.Mode == "ranked" {
+		app.getRankedFeed(w, r, user.ID, pgFeedQuery)
+		return
+	}
+
 	feed, err := app.store.Post.GetUserFeed(ctx, user.ID, pgFeedQuery)
 
 	if err != nil {
@@ -56,3 +68,103 @@ func (app *application) GetUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+// getRankedFeed writes a page of the ranked feed. Without a session the feed
+// is ranked anew and the pages that follow are read from that snapshot, so
+// posts do not move between pages while the scores change.
+func (app *application) getRankedFeed(w http.ResponseWriter, r *http.Request, userID int64, pg store.PaginatedFeedQuery) {
+	ctx := r.Context()
+
+	if pg.Session == "" {
+		session, err := app.store.Ranking.CreateSession(ctx, userID, pg, store.RankedFeedOptions{
+			MaxCandidates: app.config.feed.maxCandidates,
+			Window:        app.config.feed.window,
+			SessionTTL:    app.config.feed.sessionTTL,
+		})
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		pg.Session = session.ID
+	}
+
+	feed, more, err := app.store.Ranking.GetSessionPage(ctx, userID, pg.Session, app.config.feed.sessionTTL, pg.Limit, pg.Offset)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if more {
+		writeNextPageLink(w, r, map[string]string{
+			"session": pg.Session,
+			"offset":  strconv.Itoa(pg.Offset + pg.Limit),
+		})
+	}
+	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetRankingWeightsHandler godoc
+//
+//	@Summary		Get feed ranking weights
+//	@Description	get the weights scoring the ranked feed
+//	@Tags			FEEDS
+//	@Produce		json
+//	@Success		200	{object}	store.RankingWeights
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/feed/ranking [get]
+func (app *application) GetRankingWeightsHandler(w http.ResponseWriter, r *http.Request) {
+	weights, err := app.store.Ranking.GetWeights(r.Context())
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, weights); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateRankingWeightsHandler godoc
+//
+//	@Summary		Update feed ranking weights
+//	@Description	set the weights scoring the ranked feed, sessions ranked before keep their order
+//	@Tags			FEEDS
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		store.RankingWeights	true	"Ranking weights"
+//	@Success		200		{object}	store.RankingWeights
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/feed/ranking [put]
+func (app *application) UpdateRankingWeightsHandler(w http.ResponseWriter, r *http.Request) {
+	var weights store.RankingWeights
+	if err := readJSON(w, r, &weights); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(weights); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Ranking.SetWeights(r.Context(), &weights); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, weights); err != nil {
+		internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRankedFeed(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.feed = feedConf{maxCandidates: 5, window: 72 * time.Hour, sessionTTL: time.Hour}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	ranking := app.store.Ranking.(*store.MockRankingStore)
+	linkRegexp := regexp.MustCompile(`^<(.+)>; rel="next"$`)
+
+	get := func(t *testing.T, url string) (*http.Response, []int64) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		resp := executeRequest(req, mux).Result()
+		ids := []int64{}
+		if resp.StatusCode != http.StatusOK {
+			return resp, ids
+		}
+		var body struct {
+			Data []store.PostWithMetadata `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range body.Data {
+			ids = append(ids, p.ID)
+		}
+		return resp, ids
+	}
+
+	t.Run("should page through the snapshot of the ranking", func(t *testing.T) {
+		ranking.Ranked = []int64{8, 3, 5, 1, 9, 2, 7}
+
+		got := []int64{}
+		for url := "/v1/users/feed?mode=ranked&limit=2"; url != ""; {
+			resp, ids := get(t, url)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+			}
+			got = append(got, ids...)
+
+			// scores changing while paging do not move posts between pages
+			ranking.Ranked = []int64{2, 7, 9, 1, 5, 3, 8}
+
+			url = ""
+			if m := linkRegexp.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+				url = m[1]
+			}
+			if len(got) > 5 {
+				t.Fatalf("expected the feed to end after 5 candidates, got %v", got)
+			}
+		}
+		if want := []int64{8, 3, 5, 1, 9}; !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("should not find an unknown session", func(t *testing.T) {
+		resp, _ := get(t, "/v1/users/feed?mode=ranked&session="+uuid.NewString())
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("should reject a malformed session", func(t *testing.T) {
+		resp, _ := get(t, "/v1/users/feed?mode=ranked&session=latest")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("should reject an unknown mode", func(t *testing.T) {
+		resp, _ := get(t, "/v1/users/feed?mode=popular")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+}
+
+func TestUpdateRankingWeightsHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &store.User{ID: 42, RoleID: 3}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(admin, nil)
+
+	tests := []struct {
+		name   string
+		roleID int
+		body   string
+		want   int
+	}{
+		{"should update the weights", 3, `{"recency": 1, "affinity": 0.5, "engagement": 2, "tags": 0, "half_life_hours": 6}`, http.StatusOK},
+		{"should reject a negative weight", 3, `{"recency": -1, "affinity": 0.5, "engagement": 2, "tags": 0, "half_life_hours": 6}`, http.StatusBadRequest},
+		{"should reject a half-life of zero", 3, `{"recency": 1, "affinity": 0.5, "engagement": 2, "tags": 0, "half_life_hours": 0}`, http.StatusBadRequest},
+		{"should only let admins update the weights", 1, `{"recency": 1, "affinity": 0.5, "engagement": 2, "tags": 0, "half_life_hours": 6}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin.RoleID = tt.roleID
+			req, err := http.NewRequest(http.MethodPut, "/v1/feed/ranking", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	want := store.RankingWeights{Recency: 1, Affinity: 0.5, Engagement: 2, Tags: 0, HalfLifeHours: 6}
+	got := app.store.Ranking.(*store.MockRankingStore).Weights
+	got.UpdatedAt = ""
+	if got != want {
+		t.Errorf("expected weights %+v, got %+v", want, got)
+	}
+}
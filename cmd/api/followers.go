@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -31,10 +34,18 @@ func (app *application) FollowUserByIDHandler(w http.ResponseWriter, r *http.Req
 	}
 	user := getUserFromCtx(r)
 
-	if err := app.store.Follow.CreateFollow(r.Context(), user.ID, flID); err != nil {
+	followed, err := app.store.Follow.CreateFollow(r.Context(), user.ID, flID)
+	if err != nil {
 		internalServerError(w, r, err)
 		return
 	}
+	// following again changes nothing and notifies nobody
+	if followed {
+		app.fanOutFollow(user.ID, flID)
+		app.forgetSuggestions(r.Context(), user.ID)
+		go app.notify(context.Background(), &store.Notification{UserID: flID, Kind: store.NotificationFollow}, user.ID)
+		go app.publishEvent(events.TypeUserFollowed, followEvent{UserID: user.ID, FollowID: flID}, flID)
+	}
 
 	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
 		internalServerError(w, r, err)
@@ -66,6 +77,8 @@ func (app *application) UnfollowUserByIDHandler(w http.ResponseWriter, r *http.R
 		internalServerError(w, r, err)
 		return
 	}
+	app.fanOutUnfollow(user.ID, flID)
+	app.forgetSuggestions(r.Context(), user.ID)
 
 	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
 		internalServerError(w, r, err)
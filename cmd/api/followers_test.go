@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFollowUserByIDHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.timeline = newTimelineFanout(1, 10)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	mockSuggestions := app.cache.Suggestions.(*cache.MockSuggestionsCache)
+	mockSuggestions.On("Delete", mock.Anything, int64(42)).Return(nil)
+
+	t.Run("should fan out a follow only once", func(t *testing.T) {
+		for range 2 {
+			req, err := http.NewRequest(http.MethodPut, "/v1/users/7/follow", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+			}
+		}
+
+		if jobs := len(app.timeline.queues[0]); jobs != 1 {
+			t.Errorf("expected 1 timeline job, got %d", jobs)
+		}
+		mockSuggestions.AssertNumberOfCalls(t, "Delete", 1)
+	})
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// gatewayPath is where the WebSocket gateway is served
+	gatewayPath = "/ws"
+	// gatewayWriteWait is how long a write to a client may take
+	gatewayWriteWait = 10 * time.Second
+	// gatewayMaxMessage is the largest message a client may send
+	gatewayMaxMessage = 4096
+	// gatewayTypingInterval is how often typing is passed on per post
+	gatewayTypingInterval = 2 * time.Second
+	// userStream is the subscription key of the user's own events
+	userStream = "user"
+)
+
+// Messages clients send to the gateway
+const (
+	wsSubscribe           = "subscribe"
+	wsUnsubscribe         = "unsubscribe"
+	wsTyping              = "typing"
+	wsPresenceSubscribe   = "presence.subscribe"
+	wsPresenceUnsubscribe = "presence.unsubscribe"
+	wsPing                = "ping"
+)
+
+// Messages the gateway sends besides events
+const (
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsPong         = "pong"
+	wsError        = "error"
+)
+
+// wsClientMessage is a message from a client, post_id is used by the
+// (un)subscribe and typing messages, user_ids by the presence ones
+type wsClientMessage struct {
+	Type    string  `json:"type"`
+	PostID  int64   `json:"post_id,omitempty"`
+	UserIDs []int64 `json:"user_ids,omitempty"`
+}
+
+// wsServerMessage is a message to a client, events keep their ID and topic
+type wsServerMessage struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Topic string `json:"topic,omitempty"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// typingEvent is the data of typing events
+type typingEvent struct {
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+}
+
+// presenceEvent is the data of presence events
+type presenceEvent struct {
+	UserID int64 `json:"user_id"`
+	Online bool  `json:"online"`
+}
+
+// gateway keeps the open WebSocket connections, so they can be closed when
+// the server shuts down
+type gateway struct {
+	upgrader websocket.Upgrader
+	presence events.Presence
+
+	mu      sync.Mutex
+	conns   map[*wsConn]struct{}
+	closing bool
+}
+
+// newGateway accepts connections from pages of the allowed origin and from
+// clients that are not browsers
+func newGateway(allowedOrigin string, presence events.Presence) *gateway {
+	return &gateway{
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || origin == allowedOrigin
+			},
+		},
+		presence: presence,
+		conns:    make(map[*wsConn]struct{}),
+	}
+}
+
+func (g *gateway) add(c *wsConn) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closing {
+		return false
+	}
+	g.conns[c] = struct{}{}
+	return true
+}
+
+func (g *gateway) remove(c *wsConn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.conns, c)
+}
+
+// shutdown closes every connection with a going away close frame, clients
+// are expected to reconnect to another replica
+func (g *gateway) shutdown() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closing = true
+	for c := range g.conns {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	log.Info().Msgf("closing %d gateway connections", len(g.conns))
+}
+
+// GatewayHandler godoc
+//
+//	@Summary		Open a WebSocket
+//	@Description	bidirectional real-time gateway. Clients send JSON messages: subscribe/unsubscribe with post_id for the comments and typing on a post, typing with post_id, presence.subscribe/presence.unsubscribe with user_ids, and ping. The user's own events (see /stream) are sent without subscribing. The token may be passed as access_token since browsers can not set headers on WebSockets
+//	@Tags			STREAM
+//	@Param			access_token	query	string	false	"JWT when the Authorization header can not be set"
+//	@Success		101
+//	@Failure		401	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/ws [get]
+func (app *application) GatewayHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	conn, err := app.gateway.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already answered the client
+		log.Error().Err(err).Msg("failed to upgrade to a websocket")
+		return
+	}
+
+	c := &wsConn{
+		app:        app,
+		conn:       conn,
+		user:       user,
+		id:         uuid.NewString(),
+		send:       make(chan wsServerMessage, app.config.gateway.sendBuffer),
+		done:       make(chan struct{}),
+		subs:       make(map[string]*events.Subscription),
+		lastTyping: make(map[int64]time.Time),
+	}
+	if !app.gateway.add(c) {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		c.writeClose()
+		return
+	}
+	defer app.gateway.remove(c)
+
+	c.run()
+}
+
+// wsConn is a client connection. The reader handles the client's messages,
+// the writer sends queued messages and pings; a client not reading fast
+// enough to keep its queue from filling up is disconnected.
+type wsConn struct {
+	app  *application
+	conn *websocket.Conn
+	user *store.User
+	id   string
+	send chan wsServerMessage
+
+	done       chan struct{}
+	closeOnce  sync.Once
+	closeCode  int
+	closeText  string
+	mu         sync.Mutex
+	subs       map[string]*events.Subscription
+	lastTyping map[int64]time.Time
+}
+
+func (c *wsConn) run() {
+	pongWait := 2 * c.app.config.gateway.pingInterval
+
+	c.subscribe(userStream, func() *events.Subscription {
+		sub, _, _ := c.app.events.Subscribe(c.user.ID, "")
+		return sub
+	})
+	c.setPresence(true)
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+
+	c.conn.SetReadLimit(gatewayMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		var msg wsClientMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				c.enqueue(wsServerMessage{Type: wsError, Data: errorData("messages must be JSON")})
+				continue
+			}
+			c.close(websocket.CloseNormalClosure, "")
+			break
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.handle(msg)
+	}
+
+	<-writerDone
+	c.mu.Lock()
+	for key, sub := range c.subs {
+		delete(c.subs, key)
+		c.app.events.Unsubscribe(sub)
+	}
+	c.mu.Unlock()
+	c.setPresence(false)
+}
+
+func (c *wsConn) writeLoop() {
+	ticker := time.NewTicker(c.app.config.gateway.pingInterval)
+	defer ticker.Stop()
+	defer c.writeClose()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+			c.refreshPresence()
+		}
+	}
+}
+
+// close ends the connection with a close code, the first reason wins
+func (c *wsConn) close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+	})
+}
+
+// writeClose sends the close frame and closes the connection, which also
+// stops the reader
+func (c *wsConn) writeClose() {
+	if c.closeCode != websocket.CloseAbnormalClosure {
+		deadline := time.Now().Add(gatewayWriteWait)
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText), deadline)
+	}
+	c.conn.Close()
+}
+
+// enqueue queues a message for the writer, disconnecting a client whose
+// queue is full
+func (c *wsConn) enqueue(msg wsServerMessage) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	default:
+		log.Warn().Int64("user_id", c.user.ID).Msg("gateway client is too slow, disconnecting")
+		c.close(websocket.CloseTryAgainLater, "client is too slow")
+	}
+}
+
+func (c *wsConn) handle(msg wsClientMessage) {
+	switch msg.Type {
+	case wsPing:
+		c.enqueue(wsServerMessage{Type: wsPong})
+	case wsSubscribe:
+		c.subscribePost(msg.PostID)
+	case wsUnsubscribe:
+		topic := events.PostTopic(msg.PostID)
+		c.unsubscribe(topic)
+		c.enqueue(wsServerMessage{Type: wsUnsubscribed, Topic: topic})
+	case wsTyping:
+		c.typing(msg.PostID)
+	case wsPresenceSubscribe:
+		c.subscribePresence(msg.UserIDs)
+	case wsPresenceUnsubscribe:
+		for _, userID := range msg.UserIDs {
+			c.unsubscribe(events.PresenceTopic(userID))
+		}
+		c.enqueue(wsServerMessage{Type: wsUnsubscribed, Data: msg.UserIDs})
+	default:
+		c.enqueue(wsServerMessage{Type: wsError, Data: errorData(fmt.Sprintf("unknown message type %q", msg.Type))})
+	}
+}
+
+// subscribePost streams the comments and typing on a post the user can see
+func (c *wsConn) subscribePost(postID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	visible, err := c.app.store.Post.IsVisibleTo(ctx, postID, c.user.ID)
+	if err != nil {
+		log.Error().Err(err).Int64("post_id", postID).Msg("failed to check the visibility of the post")
+		c.enqueue(wsServerMessage{Type: wsError, Data: errorData("the server encountered a problem")})
+		return
+	}
+	if !visible {
+		c.enqueue(wsServerMessage{Type: wsError, Data: errorData(fmt.Sprintf("post %d not found", postID))})
+		return
+	}
+
+	topic := events.PostTopic(postID)
+	if !c.subscribe(topic, func() *events.Subscription { return c.app.events.SubscribeTopic(topic) }) {
+		return
+	}
+	c.enqueue(wsServerMessage{Type: wsSubscribed, Topic: topic})
+}
+
+// subscribePresence streams users going online and offline, starting with
+// whether they are online now
+func (c *wsConn) subscribePresence(userIDs []int64) {
+	for _, userID := range userIDs {
+		topic := events.PresenceTopic(userID)
+		if !c.subscribe(topic, func() *events.Subscription { return c.app.events.SubscribeTopic(topic) }) {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	online, err := c.app.gateway.presence.Online(ctx, userIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read presence")
+		c.enqueue(wsServerMessage{Type: wsError, Data: errorData("the server encountered a problem")})
+		return
+	}
+	for _, userID := range userIDs {
+		c.enqueue(wsServerMessage{Type: events.TypePresence, Topic: events.PresenceTopic(userID), Data: presenceEvent{UserID: userID, Online: online[userID]}})
+	}
+}
+
+// typing tells the others watching a post that the user is typing a
+// comment, at most every gatewayTypingInterval
+func (c *wsConn) typing(postID int64) {
+	topic := events.PostTopic(postID)
+
+	c.mu.Lock()
+	_, subscribed := c.subs[topic]
+	last := c.lastTyping[postID]
+	if subscribed && time.Since(last) >= gatewayTypingInterval {
+		c.lastTyping[postID] = time.Now()
+	}
+	c.mu.Unlock()
+
+	if !subscribed {
+		c.enqueue(wsServerMessage{Type: wsError, Data: errorData(fmt.Sprintf("subscribe to post %d first", postID))})
+		return
+	}
+	if time.Since(last) < gatewayTypingInterval {
+		return
+	}
+	ev, err := events.NewTopic(events.TypeTyping, topic, typingEvent{PostID: postID, UserID: c.user.ID})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create typing event")
+		return
+	}
+	if err := c.app.events.Publish(context.Background(), ev); err != nil {
+		log.Error().Err(err).Msg("failed to publish typing event")
+	}
+}
+
+// subscribe adds a subscription under a key unless there is one already and
+// forwards its events to the client
+func (c *wsConn) subscribe(key string, subscribe func() *events.Subscription) bool {
+	c.mu.Lock()
+	if _, ok := c.subs[key]; ok {
+		c.mu.Unlock()
+		return true
+	}
+	// the user's own events do not count
+	if len(c.subs) > c.app.config.gateway.maxSubscriptions {
+		c.mu.Unlock()
+		c.enqueue(wsServerMessage{Type: wsError, Data: errorData(fmt.Sprintf("at most %d subscriptions are allowed", c.app.config.gateway.maxSubscriptions))})
+		return false
+	}
+	sub := subscribe()
+	c.subs[key] = sub
+	c.mu.Unlock()
+
+	go c.forward(key, sub)
+	return true
+}
+
+func (c *wsConn) unsubscribe(key string) {
+	c.mu.Lock()
+	sub, ok := c.subs[key]
+	delete(c.subs, key)
+	c.mu.Unlock()
+
+	if ok {
+		c.app.events.Unsubscribe(sub)
+	}
+}
+
+func (c *wsConn) forward(key string, sub *events.Subscription) {
+	for ev := range sub.C {
+		if ev.Type == events.TypeTyping {
+			var typing typingEvent
+			if err := json.Unmarshal(ev.Data, &typing); err == nil && typing.UserID == c.user.ID {
+				continue
+			}
+		}
+		c.enqueue(wsServerMessage{Type: ev.Type, ID: ev.ID, Topic: ev.Topic, Data: ev.Data})
+	}
+
+	// the broker closes subscriptions that fall behind
+	c.mu.Lock()
+	current := c.subs[key] == sub
+	c.mu.Unlock()
+	if current {
+		c.close(websocket.CloseTryAgainLater, "client is too slow")
+	}
+}
+
+// setPresence records the connection and tells the watchers of the user
+func (c *wsConn) setPresence(connected bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+
+	presence := c.app.gateway.presence
+	var err error
+	if connected {
+		err = presence.Connect(ctx, c.user.ID, c.id)
+	} else {
+		err = presence.Disconnect(ctx, c.user.ID, c.id)
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", c.user.ID).Msg("failed to update presence")
+		return
+	}
+
+	online, err := presence.Online(ctx, []int64{c.user.ID})
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", c.user.ID).Msg("failed to read presence")
+		return
+	}
+	ev, err := events.NewTopic(events.TypePresence, events.PresenceTopic(c.user.ID), presenceEvent{UserID: c.user.ID, Online: online[c.user.ID]})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create presence event")
+		return
+	}
+	if err := c.app.events.Publish(ctx, ev); err != nil {
+		log.Error().Err(err).Msg("failed to publish presence event")
+	}
+}
+
+func (c *wsConn) refreshPresence() {
+	ctx, cancel := context.WithTimeout(context.Background(), store.QueryTimeoutDuration)
+	defer cancel()
+	if err := c.app.gateway.presence.Connect(ctx, c.user.ID, c.id); err != nil {
+		log.Error().Err(err).Int64("user_id", c.user.ID).Msg("failed to refresh presence")
+	}
+}
+
+func errorData(msg string) map[string]string {
+	return map[string]string{"error": msg}
+}
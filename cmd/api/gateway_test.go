@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGatewayHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.gateway = gatewayConf{pingInterval: time.Minute, sendBuffer: 10, maxSubscriptions: 1}
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws?access_token=" + testToken
+
+	t.Run("should not upgrade without a token", func(t *testing.T) {
+		_, res, err := websocket.DefaultDialer.Dial(strings.Split(url, "?")[0], nil)
+		if err == nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected the handshake to be refused with 401, got %v", err)
+		}
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	t.Run("should answer pings", func(t *testing.T) {
+		if err := conn.WriteJSON(wsClientMessage{Type: wsPing}); err != nil {
+			t.Fatal(err)
+		}
+		expectMessage(t, conn, wsPong)
+	})
+
+	t.Run("should report the presence of users", func(t *testing.T) {
+		if err := conn.WriteJSON(wsClientMessage{Type: wsPresenceSubscribe, UserIDs: []int64{42}}); err != nil {
+			t.Fatal(err)
+		}
+		msg := expectMessage(t, conn, events.TypePresence)
+		if data, ok := msg.Data.(map[string]any); !ok || data["online"] != true {
+			t.Errorf("expected the user to be online, got %v", msg.Data)
+		}
+	})
+
+	t.Run("should limit the subscriptions", func(t *testing.T) {
+		if err := conn.WriteJSON(wsClientMessage{Type: wsPresenceSubscribe, UserIDs: []int64{7}}); err != nil {
+			t.Fatal(err)
+		}
+		expectMessage(t, conn, wsError)
+	})
+
+	t.Run("should forward the events of the user", func(t *testing.T) {
+		app.publishEvent(events.TypeReaction, map[string]int{"post_id": 3}, 42)
+		expectMessage(t, conn, events.TypeReaction)
+	})
+
+	t.Run("should close the connections on shutdown", func(t *testing.T) {
+		app.gateway.shutdown()
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("expected a going away close, got %v", err)
+		}
+	})
+}
+
+func expectMessage(t *testing.T, conn *websocket.Conn, typ string) wsServerMessage {
+	t.Helper()
+	var msg wsServerMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read a %s message: %v", typ, err)
+	}
+	if msg.Type != typ {
+		t.Fatalf("expected a %s message, got %+v", typ, msg)
+	}
+	return msg
+}
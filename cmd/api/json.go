@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
@@ -37,8 +38,30 @@ func writeJSONError(w http.ResponseWriter, status int, message string) error {
 }
 
 func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
+	app.signMedia(data)
 	type envelope struct {
 		Data any `json:"data"`
 	}
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// writeNextLink points the client at the next page of a cursor paginated
+// listing, nothing is written for the last page
+func writeNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	if cursor == "" {
+		return
+	}
+	writeNextPageLink(w, r, map[string]string{"cursor": cursor})
+}
+
+// writeNextPageLink points the client at the request URL with params
+// replacing its query parameters
+func writeNextPageLink(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	next := *r.URL
+	query := next.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
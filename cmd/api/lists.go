@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type listKey string
+
+const listCTX listKey = "list"
+
+type ListPayload struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	Private     bool   `json:"private"`
+}
+
+type UpdateListPayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=500"`
+	Private     *bool   `json:"private"`
+}
+
+// CreateListHandler godoc
+//
+//	@Summary		Create a list
+//	@Description	create a named list of accounts, private lists are only visible to me
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			list	body		ListPayload	true	"List"
+//	@Success		201		{object}	store.List
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/lists [post]
+func (app *application) CreateListHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ListPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &store.List{
+		UserID:      getUserFromCtx(r).ID,
+		Name:        payload.Name,
+		Description: payload.Description,
+		Private:     payload.Private,
+	}
+	if err := app.store.List.Create(r.Context(), list); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, list); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetListsHandler godoc
+//
+//	@Summary		Get my lists
+//	@Description	list my lists, latest first
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.List
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/lists [get]
+func (app *application) GetListsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	lists, err := app.store.List.GetByUserID(r.Context(), user.ID, user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, lists); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetUserListsHandler godoc
+//
+//	@Summary		Get the lists of a user
+//	@Description	list the public lists of user by ID, latest first
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	[]store.List
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/lists [get]
+func (app *application) GetUserListsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	lists, err := app.store.List.GetByUserID(r.Context(), userID, getViewerID(r))
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, lists); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetListHandler godoc
+//
+//	@Summary		Get a list
+//	@Description	get list by ID, private lists are only found by their owner
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path		int	true	"List ID"
+//	@Success		200		{object}	store.List
+//	@Failure		400		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/lists/{listID} [get]
+func (app *application) GetListHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, list); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateListHandler godoc
+//
+//	@Summary		Update a list
+//	@Description	rename one of my lists, change its description or make it private or public
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path		int					true	"List ID"
+//	@Param			list	body		UpdateListPayload	true	"Changes"
+//	@Success		200		{object}	store.List
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID} [patch]
+func (app *application) UpdateListHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	var payload UpdateListPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.Name != nil {
+		list.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		list.Description = *payload.Description
+	}
+	if payload.Private != nil {
+		list.Private = *payload.Private
+	}
+
+	if err := app.store.List.Update(r.Context(), list); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, list); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// DeleteListHandler godoc
+//
+//	@Summary		Delete a list
+//	@Description	delete one of my lists
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path		int	true	"List ID"
+//	@Success		200		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID} [delete]
+func (app *application) DeleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	if err := app.store.List.Delete(r.Context(), list.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"message": fmt.Sprintf("list with id %d was deleted", list.ID),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetListMembersHandler godoc
+//
+//	@Summary		Get the members of a list
+//	@Description	list the accounts on a list, the latest added first
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path		int	true	"List ID"
+//	@Success		200		{object}	[]store.ListMember
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/lists/{listID}/members [get]
+func (app *application) GetListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	members, err := app.store.List.GetMembers(r.Context(), list.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, members); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// AddListMemberHandler godoc
+//
+//	@Summary		Add a member to a list
+//	@Description	put user by ID on one of my lists
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path	int	true	"List ID"
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	conflictEnvelope
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID}/members/{userID} [put]
+func (app *application) AddListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.List.AddMember(r.Context(), list.ID, memberID, app.config.lists.maxMembers); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		case store.ErrLimitExceeded:
+			conflictResponse(w, r, fmt.Errorf("a list can have at most %d members", app.config.lists.maxMembers), nil)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// RemoveListMemberHandler godoc
+//
+//	@Summary		Remove a member from a list
+//	@Description	take user by ID off one of my lists
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path	int	true	"List ID"
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/lists/{listID}/members/{userID} [delete]
+func (app *application) RemoveListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.List.RemoveMember(r.Context(), list.ID, memberID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetListFeedHandler godoc
+//
+//	@Summary		Get the feed of a list
+//	@Description	get paginated feed of the posts and reposts of the members of a list that I may see. Posts have the source list, reposts the source repost with reposted_by.
+//	@Tags			LISTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			listID	path		int		true	"List ID"
+//	@Param			limit	query		int		false	"Limit number of posts"	default(10)
+//	@Param			offset	query		int		false	"Offset for pagination"	default(0)
+//	@Param			sort	query		string	false	"Sort order (asc/desc)"	default(desc)
+//	@Param			tags	query		string	false	"Filter by tags (comma-separated)"
+//	@Param			search	query		string	false	"Search query"
+//	@Success		200		{array}		store.PostWithMetadata
+//	@Failure		400		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/lists/{listID}/feed [get]
+func (app *application) GetListFeedHandler(w http.ResponseWriter, r *http.Request) {
+	list := getListFromCtx(r)
+
+	pgFeedQueryDefault := store.PaginatedFeedQuery{
+		Limit:  10,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	pgFeedQuery, err := pgFeedQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(pgFeedQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	feed, err := app.store.Post.GetListFeed(r.Context(), list.ID, getViewerID(r), pgFeedQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// listContextMiddleware loads the list of the URL, private lists of other
+// users are not found
+func (app *application) listContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "listID"), 10, 64)
+		if err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		list, err := app.store.List.GetByID(ctx, id)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				notFoundResponse(w, r, err)
+			default:
+				internalServerError(w, r, err)
+			}
+			return
+		}
+		if list.Private && list.UserID != getViewerID(r) {
+			notFoundResponse(w, r, fmt.Errorf("list %d is not found", id))
+			return
+		}
+
+		ctx = context.WithValue(ctx, listCTX, list)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkListOwnership lets through the owner of the list in the context
+func (app *application) checkListOwnership(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromCtx(r)
+		list := getListFromCtx(r)
+
+		if list.UserID != user.ID {
+			forbiddenResponse(w, r, fmt.Errorf("user %d does not own list %d", user.ID, list.ID))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getListFromCtx(r *http.Request) *store.List {
+	list, _ := r.Context().Value(listCTX).(*store.List)
+	return list
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateListHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"should reject no name", `{"description": "gophers", "private": true}`},
+		{"should reject a long name", `{"name": "` + strings.Repeat("g", 101) + `"}`},
+		{"should reject a long description", `{"name": "gophers", "description": "` + strings.Repeat("g", 501) + `"}`},
+		{"should reject unknown fields", `{"name": "gophers", "members": [7]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/lists", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+// newListTestApplication returns an application with the private list 1 of
+// user 7, the public list 2 of user 7 and the private list 3 of the test
+// user (ID 42), lists have up to 2 members
+func newListTestApplication(t *testing.T) *application {
+	t.Helper()
+	app := newTestApplication(t)
+	app.config.lists.maxMembers = 2
+	app.cache.User.(*cache.MockUserCache).On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	app.store.List.(*store.MockListStore).Lists = []*store.List{
+		{ID: 1, UserID: 7, Name: "close friends", Private: true},
+		{ID: 2, UserID: 7, Name: "gophers"},
+		{ID: 3, UserID: 42, Name: "mine", Private: true},
+	}
+	return app
+}
+
+func listRequest(t *testing.T, app *application, method, url string, authenticated bool) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated {
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+	}
+
+	return executeRequest(req, app.mount()).Code
+}
+
+func TestListContextMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		authenticated bool
+		want          int
+	}{
+		{"should not find the private list of another user", "/v1/lists/1", true, http.StatusNotFound},
+		{"should not find the members of the private list of another user", "/v1/lists/1/members", true, http.StatusNotFound},
+		{"should not find the feed of the private list of another user", "/v1/lists/1/feed", true, http.StatusNotFound},
+		{"should not find a private list without logging in", "/v1/lists/1", false, http.StatusNotFound},
+		{"should find the public list of another user", "/v1/lists/2", true, http.StatusOK},
+		{"should find the feed of a public list without logging in", "/v1/lists/2/feed", false, http.StatusOK},
+		{"should find my private list", "/v1/lists/3", true, http.StatusOK},
+		{"should find the feed of my private list", "/v1/lists/3/feed", true, http.StatusOK},
+		{"should not find a missing list", "/v1/lists/9", true, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := listRequest(t, newListTestApplication(t), http.MethodGet, tt.url, tt.authenticated); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestCheckListOwnership(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{"should not let another user delete a public list", http.MethodDelete, "/v1/lists/2", http.StatusForbidden},
+		{"should not let another user add members to a public list", http.MethodPut, "/v1/lists/2/members/9", http.StatusForbidden},
+		{"should not let another user remove members from a public list", http.MethodDelete, "/v1/lists/2/members/9", http.StatusForbidden},
+		{"should not find the private list of another user to delete", http.MethodDelete, "/v1/lists/1", http.StatusNotFound},
+		{"should let the owner delete their list", http.MethodDelete, "/v1/lists/3", http.StatusOK},
+		{"should let the owner add members to their list", http.MethodPut, "/v1/lists/3/members/9", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := listRequest(t, newListTestApplication(t), tt.method, tt.url, true); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+func TestAddListMemberHandler(t *testing.T) {
+	app := newListTestApplication(t)
+
+	tests := []struct {
+		name     string
+		memberID string
+		want     int
+	}{
+		{"should add a member", "7", http.StatusAccepted},
+		{"should add a member up to the limit", "8", http.StatusAccepted},
+		{"should refuse a member over the limit", "9", http.StatusConflict},
+		{"should accept a member again at the limit", "7", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := listRequest(t, app, http.MethodPut, "/v1/lists/3/members/"+tt.memberID, true); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+		})
+	}
+
+	members, err := app.store.List.GetMembers(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Errorf("expected 2 members, got %v", members)
+	}
+}
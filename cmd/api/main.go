@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/dubass83/go_social/internal/auth"
+	"github.com/dubass83/go_social/internal/blob"
 	"github.com/dubass83/go_social/internal/cache"
 	"github.com/dubass83/go_social/internal/db"
 	"github.com/dubass83/go_social/internal/env"
+	"github.com/dubass83/go_social/internal/events"
 	"github.com/dubass83/go_social/internal/mailer"
 	ratelimiter "github.com/dubass83/go_social/internal/rateLimiter"
 	"github.com/dubass83/go_social/internal/store"
+	"github.com/dubass83/go_social/internal/webhooks"
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -37,6 +44,11 @@ const tokenHost = "goSocial"
 //	@name						Authorization
 
 func main() {
+	webhookNetworks, err := webhooks.ParseNetworks(env.GetString("WEBHOOK_ALLOWED_NETWORKS", ""))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to parse WEBHOOK_ALLOWED_NETWORKS")
+	}
+
 	conf := config{
 		addr:        env.GetString("API_ADDR", ":8080"),
 		apiURL:      env.GetString("EXTERNAL_URL", "localhost:8080"),
@@ -77,6 +89,64 @@ func main() {
 			TimeFrame:           time.Duration(env.GetInt("RATE_LIMIT_TIMEFRAME", 60)) * time.Second,
 			Enabled:             env.GetBool("RATE_LIMIT_ENABLE", true),
 		},
+		scheduler: schedulerConf{
+			interval: time.Duration(env.GetInt("POST_SCHEDULER_INTERVAL", 30)) * time.Second,
+		},
+		trending: trendingConf{
+			interval: time.Duration(env.GetInt("TRENDING_REFRESH_INTERVAL", 300)) * time.Second,
+		},
+		timeline: timelineConf{
+			workers:      env.GetInt("TIMELINE_FANOUT_WORKERS", 4),
+			queueSize:    env.GetInt("TIMELINE_QUEUE_SIZE", 1000),
+			maxFollowers: env.GetInt("TIMELINE_MAX_FANOUT_FOLLOWERS", 10000),
+			backfill:     env.GetInt("TIMELINE_BACKFILL", 50),
+		},
+		feed: feedConf{
+			maxCandidates: env.GetInt("FEED_RANKED_MAX_CANDIDATES", 500),
+			window:        time.Duration(env.GetInt("FEED_RANKED_WINDOW", 168)) * time.Hour,
+			sessionTTL:    time.Duration(env.GetInt("FEED_SESSION_TTL", 1800)) * time.Second,
+		},
+		stream: streamConf{
+			heartbeat: time.Duration(env.GetInt("STREAM_HEARTBEAT_INTERVAL", 25)) * time.Second,
+			retry:     time.Duration(env.GetInt("STREAM_RETRY", 3)) * time.Second,
+			broker: events.Config{
+				HistorySize: env.GetInt("STREAM_HISTORY_SIZE", 100),
+				HistoryTTL:  time.Duration(env.GetInt("STREAM_HISTORY_TTL", 600)) * time.Second,
+				BufferSize:  env.GetInt("STREAM_BUFFER_SIZE", 64),
+			},
+		},
+		gateway: gatewayConf{
+			pingInterval:     time.Duration(env.GetInt("GATEWAY_PING_INTERVAL", 30)) * time.Second,
+			sendBuffer:       env.GetInt("GATEWAY_SEND_BUFFER", 64),
+			maxSubscriptions: env.GetInt("GATEWAY_MAX_SUBSCRIPTIONS", 100),
+		},
+		digest: digestConf{
+			interval:  time.Duration(env.GetInt("DIGEST_INTERVAL", 900)) * time.Second,
+			batchSize: env.GetInt("DIGEST_BATCH_SIZE", 100),
+		},
+		webhook: webhookConf{
+			interval:        time.Duration(env.GetInt("WEBHOOK_POLL_INTERVAL", 5)) * time.Second,
+			batchSize:       env.GetInt("WEBHOOK_BATCH_SIZE", 50),
+			maxAttempts:     env.GetInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			disableAfter:    env.GetInt("WEBHOOK_DISABLE_AFTER", 20),
+			timeout:         time.Duration(env.GetInt("WEBHOOK_TIMEOUT", 10)) * time.Second,
+			retryBase:       time.Duration(env.GetInt("WEBHOOK_RETRY_BASE", 30)) * time.Second,
+			retryMax:        6 * time.Hour,
+			allowedNetworks: webhookNetworks,
+		},
+		posts: postsConf{
+			maxPinned: env.GetInt("POSTS_MAX_PINNED", 3),
+		},
+		lists: listsConf{
+			maxMembers: env.GetInt("LISTS_MAX_MEMBERS", 500),
+		},
+		media: mediaConf{
+			maxSize:          int64(env.GetInt("MEDIA_MAX_SIZE_MB", 10)) << 20,
+			urlTTL:           time.Duration(env.GetInt("MEDIA_URL_TTL", 3600)) * time.Second,
+			processInterval:  time.Duration(env.GetInt("MEDIA_PROCESS_INTERVAL", 30)) * time.Second,
+			processBatchSize: env.GetInt("MEDIA_PROCESS_BATCH_SIZE", 10),
+			processAttempts:  env.GetInt("MEDIA_PROCESS_ATTEMPTS", 3),
+		},
 	}
 
 	// Logger
@@ -120,23 +190,65 @@ func main() {
 
 	rateLimiter := ratelimiter.NewFixedWindowLimeter(conf.rateLimiter)
 
+	// events reach the other replicas through Redis when it is enabled, and
+	// presence is shared with them
+	var eventsBackend events.Backend
+	presence := events.NewMemoryPresence(3 * conf.gateway.pingInterval)
+	if rds != nil {
+		eventsBackend = events.NewRedisBackend(rds)
+		presence = events.NewRedisPresence(rds, 3*conf.gateway.pingInterval)
+	}
+
+	// Blob storage
+	var blobs blob.BlobStore
+	switch kind := env.GetString("BLOB_STORE", "local"); kind {
+	case "local":
+		blobs, err = blob.NewLocalStore(env.GetString("BLOB_LOCAL_DIR", "./uploads"))
+	case "s3":
+		blobs, err = blob.NewS3Store(blob.S3Config{
+			Endpoint:  env.GetString("S3_ENDPOINT", "http://localhost:9000"),
+			Region:    env.GetString("S3_REGION", "us-east-1"),
+			Bucket:    env.GetString("S3_BUCKET", "go-social"),
+			AccessKey: env.GetString("S3_ACCESS_KEY", "minioadmin"),
+			SecretKey: env.GetString("S3_SECRET_KEY", "minioadmin"),
+		}, time.Duration(env.GetInt("S3_TIMEOUT", 60))*time.Second)
+	default:
+		err = fmt.Errorf("unknown blob store %q", kind)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create blob store")
+	}
+
+	streams, closeStreams := context.WithCancel(context.Background())
 	app := &application{
-		config:        conf,
-		store:         store,
-		cache:         storeCache,
-		mailer:        mailer,
-		authenticator: jwt,
-		rateLimiter:   rateLimiter,
-		shutdown:      make(chan error),
+		config:            conf,
+		store:             store,
+		cache:             storeCache,
+		mailer:            mailer,
+		authenticator:     jwt,
+		unsubscribeSigner: auth.NewSigner(conf.auth.jwt.secret, "unsubscribe"),
+		mediaSigner:       auth.NewSigner(conf.auth.jwt.secret, "media"),
+		mediaWake:         make(chan struct{}, 1),
+		blobs:             blobs,
+		rateLimiter:       rateLimiter,
+		timeline:          newTimelineFanout(conf.timeline.workers, conf.timeline.queueSize),
+		events:            events.NewBroker(conf.stream.broker, eventsBackend),
+		gateway:           newGateway(env.GetString("CORS_ALLOWED_ORIGIN", conf.frontendURL), presence),
+		webhookClient:     webhooks.NewClient(conf.webhook.timeout, conf.webhook.allowedNetworks),
+		streams:           streams,
+		closeStreams:      closeStreams,
+		shutdown:          make(chan error),
 	}
 
 	if err := app.run(app.mount()); err != nil {
-		time.Sleep(time.Second)
-		select {
-		case <-app.shutdown:
-			log.Info().Msg("prepare for graceful shutdown")
-		default:
+		if !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal().Err(err).Msg("failed to run application")
 		}
+		// ListenAndServe returns as soon as Shutdown starts, wait for the
+		// requests in flight
+		if err := <-app.shutdown; err != nil {
+			log.Error().Err(err).Msg("failed to shut down gracefully")
+		}
+		log.Info().Msg("server stopped")
 	}
 }
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dubass83/go_social/internal/blob"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// mediaTypes are the content types that can be uploaded, with the extension
+// their files are stored with
+var mediaTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"application/pdf": ".pdf",
+}
+
+// UploadMediaHandler godoc
+//
+//	@Summary		Upload a file
+//	@Description	upload an image, video or PDF to attach to posts and comments, the content type is sniffed from the file itself. Images are processed in the background and can be downloaded once their status is ready
+//	@Tags			MEDIA
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"File to upload"
+//	@Success		201		{object}	store.Media
+//	@Failure		400		{object}	map[string]string
+//	@Failure		413		{object}	map[string]string
+//	@Failure		415		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/media [post]
+func (app *application) UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	media, ok := app.saveUpload(w, r, nil)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, media); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+}
+
+// saveUpload stores the file of a multipart upload as media of the user.
+// accept can refuse content types on top of the ones that can never be
+// uploaded. It answers with an error and returns false when the upload
+// fails.
+func (app *application) saveUpload(w http.ResponseWriter, r *http.Request, accept func(contentType string) error) (*store.Media, bool) {
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	maxSize := app.config.media.maxSize
+
+	// the form around the file gets some room on top of the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			payloadTooLargeResponse(w, r, fmt.Errorf("files can be at most %d bytes", maxSize))
+			return nil, false
+		}
+		badRequestResponse(w, r, err)
+		return nil, false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		badRequestResponse(w, r, fmt.Errorf("form has no file: %w", err))
+		return nil, false
+	}
+	defer file.Close()
+
+	if header.Size > maxSize {
+		payloadTooLargeResponse(w, r, fmt.Errorf("files can be at most %d bytes", maxSize))
+		return nil, false
+	}
+	if header.Size == 0 {
+		badRequestResponse(w, r, fmt.Errorf("file is empty"))
+		return nil, false
+	}
+
+	// the type the client claims is not trusted, the file is sniffed
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		internalServerError(w, r, err)
+		return nil, false
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(sniff[:n]), ";")
+	ext, ok := mediaTypes[contentType]
+	if !ok {
+		unsupportedMediaTypeResponse(w, r, fmt.Errorf("files of type %s can not be uploaded", contentType))
+		return nil, false
+	}
+	if accept != nil {
+		if err := accept(contentType); err != nil {
+			unsupportedMediaTypeResponse(w, r, err)
+			return nil, false
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		internalServerError(w, r, err)
+		return nil, false
+	}
+
+	media := &store.Media{
+		UserID:      user.ID,
+		Key:         fmt.Sprintf("media/%d/%s%s", user.ID, uuid.NewString(), ext),
+		ContentType: contentType,
+		Size:        header.Size,
+		Filename:    mediaFilename(header.Filename, ext),
+		Status:      store.MediaReady,
+	}
+	// images carry metadata such as GPS data until they are processed
+	if strings.HasPrefix(contentType, "image/") {
+		media.Status = store.MediaProcessing
+	}
+
+	if err := app.blobs.Put(ctx, media.Key, file, media.Size, media.ContentType); err != nil {
+		internalServerError(w, r, err)
+		return nil, false
+	}
+	if err := app.store.Media.Create(ctx, media); err != nil {
+		app.deleteBlob(media.Key)
+		internalServerError(w, r, err)
+		return nil, false
+	}
+	if media.Status == store.MediaProcessing {
+		app.wakeMediaProcessor()
+	}
+	return media, true
+}
+
+// mediaFilename keeps the base name of an uploaded file, for downloads
+func mediaFilename(name, ext string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		name = "file" + ext
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
+
+// GetMediaHandler godoc
+//
+//	@Summary		Get a file I uploaded
+//	@Description	get a file I uploaded with a fresh download URL
+//	@Tags			MEDIA
+//	@Produce		json
+//	@Param			id	path		int	true	"Media ID"
+//	@Success		200	{object}	store.Media
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/media/{id} [get]
+func (app *application) GetMediaHandler(w http.ResponseWriter, r *http.Request) {
+	media, ok := app.getOwnMedia(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, media); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+}
+
+// DeleteMediaHandler godoc
+//
+//	@Summary		Delete a file I uploaded
+//	@Description	delete a file I uploaded, it disappears from the posts and comments it is attached to
+//	@Tags			MEDIA
+//	@Produce		json
+//	@Param			id	path		int	true	"Media ID"
+//	@Success		200	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/media/{id} [delete]
+func (app *application) DeleteMediaHandler(w http.ResponseWriter, r *http.Request) {
+	media, ok := app.getOwnMedia(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.Media.Delete(r.Context(), media.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	app.deleteBlob(media.Key)
+	for _, v := range media.Variants {
+		app.deleteBlob(v.Key)
+	}
+
+	data := map[string]string{
+		"message": fmt.Sprintf("media with id %d was successfully deleted", media.ID),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+}
+
+// getOwnMedia returns the media of the URL when the user uploaded it, and
+// answers with 404 otherwise
+func (app *application) getOwnMedia(w http.ResponseWriter, r *http.Request) (*store.Media, bool) {
+	user := getUserFromCtx(r)
+
+	mediaID, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	media, err := app.store.Media.GetByID(r.Context(), mediaID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	// media of other users are hidden, they are reached through posts
+	if media.UserID != user.ID {
+		notFoundResponse(w, r, fmt.Errorf("media %d belongs to user %d", media.ID, media.UserID))
+		return nil, false
+	}
+	return media, true
+}
+
+// DownloadMediaHandler godoc
+//
+//	@Summary		Download a file
+//	@Description	download a file or a variant of an image with the signed URLs found in the url fields of media
+//	@Tags			MEDIA
+//	@Produce		application/octet-stream
+//	@Param			id		path	int		true	"Media ID"
+//	@Param			token	query	string	true	"Signature of the URL"
+//	@Param			variant	query	string	false	"Name of an image variant"
+//	@Success		200
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	conflictEnvelope{data=store.Media}	"Media still being processed"
+//	@Failure		500	{object}	map[string]string
+//	@Router			/media/{id}/download [get]
+func (app *application) DownloadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	mediaID, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	expires, err := app.verifyMediaToken(mediaID, r.URL.Query().Get("token"))
+	if err != nil {
+		forbiddenResponse(w, r, err)
+		return
+	}
+
+	media, err := app.store.Media.GetByID(ctx, mediaID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+	switch media.Status {
+	case store.MediaProcessing:
+		conflictResponse(w, r, fmt.Errorf("media %d is still being processed", media.ID), media)
+		return
+	case store.MediaFailed:
+		notFoundResponse(w, r, fmt.Errorf("media %d could not be processed", media.ID))
+		return
+	}
+
+	key, contentType, size, filename := media.Key, media.ContentType, media.Size, media.Filename
+	if name := r.URL.Query().Get("variant"); name != "" {
+		v, ok := media.Variant(name)
+		if !ok {
+			notFoundResponse(w, r, fmt.Errorf("media %d has no variant %q", media.ID, name))
+			return
+		}
+		key, contentType, size = v.Key, v.ContentType, v.Size
+		filename = strings.TrimSuffix(filename, path.Ext(filename)) + "_" + v.Name + mediaTypes[v.ContentType]
+	}
+
+	body, err := app.blobs.Get(ctx, key)
+	if err != nil {
+		switch err {
+		case blob.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+	defer body.Close()
+
+	// only images and videos are shown in the browser, anything else is
+	// downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") {
+		disposition = "inline"
+	}
+	maxAge := int(time.Until(expires).Seconds())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		log.Error().Err(err).Int64("media_id", media.ID).Msg("failed to send media")
+	}
+}
+
+// mediaURL returns a signed download URL for media. The expiry is rounded
+// so the same URL is handed out for a while and browsers can cache it. The
+// variants of an image are downloaded with the same token.
+func (app *application) mediaURL(media *store.Media) string {
+	ttl := app.config.media.urlTTL
+	expires := time.Now().Truncate(ttl).Add(2 * ttl).Unix()
+	token := app.mediaSigner.Sign(fmt.Sprintf("%d:%d", media.ID, expires))
+	return fmt.Sprintf("http://%s/v1/media/%d/download?token=%s", app.config.apiURL, media.ID, url.QueryEscape(token))
+}
+
+// verifyMediaToken checks that a download token was signed for the media
+// and is still valid, and returns when it expires
+func (app *application) verifyMediaToken(mediaID int64, token string) (time.Time, error) {
+	payload, err := app.mediaSigner.Verify(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	id, unix, ok := strings.Cut(payload, ":")
+	if !ok || id != strconv.FormatInt(mediaID, 10) {
+		return time.Time{}, fmt.Errorf("token is not for media %d", mediaID)
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed token expiry: %w", err)
+	}
+	expires := time.Unix(seconds, 0)
+	if time.Now().After(expires) {
+		return time.Time{}, fmt.Errorf("token for media %d expired at %s", mediaID, expires)
+	}
+	return expires, nil
+}
+
+// signMedia sets the download URLs of the media in a response or event.
+// URLs already set are kept, so posts handed to goroutines can be signed
+// before and read concurrently after.
+func (app *application) signMedia(data any) {
+	switch v := data.(type) {
+	case *store.Media:
+		if v.URL != "" {
+			return
+		}
+		u := app.mediaURL(v)
+		for i := range v.Variants {
+			v.Variants[i].URL = u + "&variant=" + url.QueryEscape(v.Variants[i].Name)
+		}
+		v.URL = u
+	case *store.Post:
+		if v == nil {
+			return
+		}
+		app.signMediaList(v.Media)
+		app.signMedia(v.QuotedPost)
+		for i := range v.Comments {
+			app.signMediaList(v.Comments[i].Media)
+		}
+	case *store.PostWithMetadata:
+		if v != nil {
+			app.signMedia(&v.Post)
+		}
+	case []*store.PostWithMetadata:
+		for _, p := range v {
+			app.signMedia(p)
+		}
+	case *store.Comment:
+		if v != nil {
+			app.signMediaList(v.Media)
+		}
+	case []store.Comment:
+		for i := range v {
+			app.signMediaList(v[i].Media)
+		}
+	case commentEvent:
+		app.signMedia(v.Comment)
+	case *store.User:
+		if v != nil && v.Avatar != nil {
+			app.signMedia(v.Avatar)
+		}
+	case *store.PublicUser:
+		if v != nil && v.Avatar != nil {
+			app.signMedia(v.Avatar)
+		}
+	}
+}
+
+func (app *application) signMediaList(media []store.Media) {
+	for i := range media {
+		app.signMedia(&media[i])
+	}
+}
+
+// attachableMedia returns the media of ids in order when the user uploaded
+// all of them
+func (app *application) attachableMedia(r *http.Request, userID int64, ids []int64) ([]store.Media, error) {
+	if len(ids) == 0 {
+		return []store.Media{}, nil
+	}
+	owned, err := app.store.Media.GetOwned(r.Context(), userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	media := make([]store.Media, len(ids))
+	for i, id := range ids {
+		m, ok := owned[id]
+		if !ok {
+			return nil, errMediaNotOwned{id}
+		}
+		media[i] = m
+	}
+	return media, nil
+}
+
+// errMediaNotOwned is returned for media IDs the user can not attach
+type errMediaNotOwned struct {
+	id int64
+}
+
+func (e errMediaNotOwned) Error() string {
+	return fmt.Sprintf("media %d does not exist or was uploaded by another user", e.id)
+}
+
+// deleteBlob removes a file even when the request was canceled, a leftover
+// file is only logged
+func (app *application) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := app.blobs.Delete(ctx, key); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to delete media file")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/imaging"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// mediaSizes are the variants generated for images larger than them
+var mediaSizes = []imaging.Size{
+	{Name: "small", Max: 320},
+	{Name: "medium", Max: 800},
+	{Name: "large", Max: 1600},
+}
+
+// mediaProcessLease is how long an image is left to a replica processing
+// it, and how long a failed attempt waits before it is retried
+const mediaProcessLease = 5 * time.Minute
+
+// runMediaProcessor processes uploaded images, right after an upload and
+// every interval for retries and uploads received by other replicas. It
+// runs until ctx is cancelled.
+func (app *application) runMediaProcessor(ctx context.Context) {
+	ticker := time.NewTicker(app.config.media.processInterval)
+	defer ticker.Stop()
+
+	log.Info().Msgf("media processor started with interval %s", app.config.media.processInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("media processor stopped")
+			return
+		case <-ticker.C:
+		case <-app.mediaWake:
+		}
+		app.processMedia(ctx)
+	}
+}
+
+// wakeMediaProcessor lets the processor know an image was uploaded, without
+// waiting when it is already about to run
+func (app *application) wakeMediaProcessor() {
+	select {
+	case app.mediaWake <- struct{}{}:
+	default:
+	}
+}
+
+// processMedia processes a batch of images one after the other, decoded
+// images take a lot of memory
+func (app *application) processMedia(ctx context.Context) {
+	conf := app.config.media
+	batch, err := app.store.Media.ClaimProcessing(ctx, conf.processBatchSize, mediaProcessLease)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to claim media to process")
+		return
+	}
+
+	for _, m := range batch {
+		err := app.processImage(ctx, m)
+		if err == nil {
+			log.Debug().Int64("media_id", m.ID).Msg("media processed")
+			app.publishEvent(events.TypeMediaProcessed, m, m.UserID)
+			continue
+		}
+		if err == store.ErrNotFound {
+			continue
+		}
+
+		if m.Attempts < conf.processAttempts {
+			log.Warn().Err(err).Int64("media_id", m.ID).Int("attempts", m.Attempts).Msg("failed to process media, retrying later")
+			continue
+		}
+		log.Error().Err(err).Int64("media_id", m.ID).Msg("failed to process media, giving up")
+		if err := app.store.Media.SetFailed(ctx, m.ID); err != nil {
+			log.Error().Err(err).Int64("media_id", m.ID).Msg("failed to mark media failed")
+			continue
+		}
+		m.Status = store.MediaFailed
+		app.publishEvent(events.TypeMediaProcessed, m, m.UserID)
+	}
+}
+
+// processImage replaces the original with a copy without metadata, stores
+// the variants next to it and marks the image ready
+func (app *application) processImage(ctx context.Context, m *store.Media) error {
+	body, err := app.blobs.Get(ctx, m.Key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	result, err := imaging.Process(data, m.ContentType, mediaSizes)
+	if err != nil {
+		return err
+	}
+
+	// media/42/3f2b….jpg has its variants at media/42/3f2b…_small.jpg
+	base := strings.TrimSuffix(m.Key, path.Ext(m.Key))
+	keys := []string{m.Key}
+	variants := make([]store.MediaVariant, 0, len(result.Variants))
+	for _, img := range result.Variants {
+		v := store.MediaVariant{
+			Name:        img.Name,
+			Key:         base + "_" + img.Name + mediaTypes[img.ContentType],
+			ContentType: img.ContentType,
+			Width:       img.Width,
+			Height:      img.Height,
+			Size:        int64(len(img.Data)),
+		}
+		if err := app.blobs.Put(ctx, v.Key, bytes.NewReader(img.Data), v.Size, v.ContentType); err != nil {
+			return err
+		}
+		keys = append(keys, v.Key)
+		variants = append(variants, v)
+	}
+
+	original := result.Original
+	if err := app.blobs.Put(ctx, m.Key, bytes.NewReader(original.Data), int64(len(original.Data)), m.ContentType); err != nil {
+		return err
+	}
+
+	m.Size = int64(len(original.Data))
+	m.Width, m.Height = &original.Width, &original.Height
+	if result.Blurhash != "" {
+		m.Blurhash = &result.Blurhash
+	}
+	m.Variants = variants
+
+	if err := app.store.Media.SetProcessed(ctx, m); err != nil {
+		// the media was deleted meanwhile, along with the files there
+		// were, and the ones written since have to go as well
+		if err == store.ErrNotFound {
+			for _, key := range keys {
+				app.deleteBlob(key)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/blob"
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUploadMediaHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.media = mediaConf{maxSize: 1 << 10, urlTTL: time.Hour}
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	tests := []struct {
+		name     string
+		filename string
+		content  []byte
+		status   int
+	}{
+		{name: "text is rejected even when named like an image", filename: "cat.png", content: []byte("just some text"), status: http.StatusUnsupportedMediaType},
+		{name: "too large", filename: "big.png", content: bytes.Repeat([]byte{0}, 2<<10), status: http.StatusRequestEntityTooLarge},
+		{name: "empty", filename: "empty.png", content: nil, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			form := multipart.NewWriter(body)
+			part, err := form.CreateFormFile("file", tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(tt.content)
+			form.Close()
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/media", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+			if rr.Code != tt.status {
+				t.Errorf("expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestMediaURL(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.apiURL = "localhost:8080"
+	app.config.media = mediaConf{urlTTL: time.Hour}
+
+	media := &store.Media{ID: 7}
+	link, err := url.Parse(app.mediaURL(media))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Path != "/v1/media/7/download" {
+		t.Errorf("expected the download path of media 7, got %s", link.Path)
+	}
+	token := link.Query().Get("token")
+
+	expires, err := app.verifyMediaToken(7, token)
+	if err != nil {
+		t.Fatalf("expected the token to be valid, got %v", err)
+	}
+	if until := time.Until(expires); until < time.Hour || until > 2*time.Hour {
+		t.Errorf("expected the URL to stay valid between 1 and 2 hours, got %s", until)
+	}
+	if _, err := app.verifyMediaToken(8, token); err == nil {
+		t.Error("expected the token of media 7 to be refused for media 8")
+	}
+	expired := app.mediaSigner.Sign("7:" + strings.Repeat("1", 9))
+	if _, err := app.verifyMediaToken(7, expired); err == nil {
+		t.Error("expected an expired token to be refused")
+	}
+	if app.mediaURL(media) != app.mediaURL(media) {
+		t.Error("expected the same URL to be handed out within the TTL")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/media/8/download?token="+url.QueryEscape(token), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req, app.mount())
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	app := newTestApplication(t)
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.blobs = blobs
+
+	// a 1000x500 JPEG with a comment standing in for metadata, which is
+	// dropped by re-encoding like EXIF data
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 1000, 500)), nil); err != nil {
+		t.Fatal(err)
+	}
+	comment := []byte("\xff\xfe\x00\x0bGPS 52.52")
+	data := append(append([]byte{0xff, 0xd8}, comment...), buf.Bytes()[2:]...)
+
+	ctx := context.Background()
+	m := &store.Media{ID: 1, UserID: 42, Key: "media/42/photo.jpg", ContentType: "image/jpeg", Status: store.MediaProcessing}
+	if err := blobs.Put(ctx, m.Key, bytes.NewReader(data), int64(len(data)), m.ContentType); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.processImage(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Width == nil || *m.Width != 1000 || m.Height == nil || *m.Height != 500 {
+		t.Errorf("expected 1000x500, got %v x %v", m.Width, m.Height)
+	}
+	if m.Blurhash == nil || *m.Blurhash == "" {
+		t.Error("expected a blurhash")
+	}
+
+	original, err := blobs.Get(ctx, m.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := io.ReadAll(original)
+	original.Close()
+	if bytes.Contains(stored, []byte("GPS")) {
+		t.Error("expected the metadata to be stripped from the stored original")
+	}
+	if int64(len(stored)) != m.Size {
+		t.Errorf("expected the size of the stripped original %d, got %d", len(stored), m.Size)
+	}
+
+	// the image is smaller than the large size
+	want := map[string]string{"small": "media/42/photo_small.jpg", "medium": "media/42/photo_medium.jpg"}
+	if len(m.Variants) != len(want) {
+		t.Fatalf("expected %d variants, got %+v", len(want), m.Variants)
+	}
+	for _, v := range m.Variants {
+		if want[v.Name] != v.Key {
+			t.Errorf("expected the %s variant at %s, got %s", v.Name, want[v.Name], v.Key)
+		}
+		if _, err := blobs.Get(ctx, v.Key); err != nil {
+			t.Errorf("expected the %s variant to be stored, got %v", v.Name, err)
+		}
+	}
+}
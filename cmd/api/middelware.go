@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/rs/zerolog/log"
 )
@@ -31,46 +34,72 @@ func (app *application) AuthTokenMiddelware(next http.Handler) http.Handler {
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 {
-			log.Error().Msg("Invalid authorization header format")
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
-		if parts[0] != "Bearer" {
-			log.Error().Msg("Authorization header must start with 'Bearer' but got '" + parts[0] + "'")
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
-		token := parts[1]
-		jwtToken, err := app.authenticator.ValidateToken(token)
+
+		user, err := app.authenticate(r.Context(), authHeader)
 		if err != nil {
-			log.Error().Err(err).Msg("Invalid token")
+			log.Error().Err(err).Msg("Failed to authenticate")
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
+		ctx := context.WithValue(r.Context(), UserCtxKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		if !jwtToken.Valid {
-			log.Error().Msg("Token is not valid")
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+// OptionalAuthTokenMiddelware authenticates the request when it carries an
+// Authorization header and lets anonymous requests through otherwise
+func (app *application) OptionalAuthTokenMiddelware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		claims, _ := jwtToken.Claims.(jwt.MapClaims)
-		userID, _ := strconv.ParseInt(strconv.Itoa(int(claims["sub"].(float64))), 10, 64)
-		ctx := r.Context()
-
-		user, err := app.GetUserFromCacheByID(ctx, userID)
+		user, err := app.authenticate(r.Context(), authHeader)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to get user")
+			log.Error().Err(err).Msg("Failed to authenticate")
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
-		ctx = context.WithValue(ctx, UserCtxKey, user)
+		ctx := context.WithValue(r.Context(), UserCtxKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticate resolves the user of a "Bearer <token>" Authorization header
+func (app *application) authenticate(ctx context.Context, authHeader string) (*store.User, error) {
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid authorization header format")
+	}
+	if parts[0] != "Bearer" {
+		return nil, fmt.Errorf("authorization header must start with 'Bearer' but got '%s'", parts[0])
+	}
+	token := parts[1]
+	jwtToken, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !jwtToken.Valid {
+		return nil, fmt.Errorf("token is not valid")
+	}
+
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	sub, ok := claims["sub"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	userID, _ := strconv.ParseInt(strconv.Itoa(int(sub)), 10, 64)
+
+	user, err := app.GetUserFromCacheByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
 func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromCtx(r)
@@ -82,6 +111,19 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 			return
 		}
 
+		// community moderators moderate what was posted to the community
+		if post.CommunityID != nil && post.IsPublished() {
+			allowed, err := app.store.Community.IsPrecedent(r.Context(), *post.CommunityID, user.ID, store.CommunityRoleModerator)
+			if err != nil {
+				internalServerError(w, r, err)
+				return
+			}
+			if allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
 		// role precedence check
 		allowed, err := app.store.Role.IsPrecedent(r.Context(), user.RoleID, requiredRole)
 		if err != nil {
@@ -98,6 +140,53 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	})
 }
 
+// requireRole lets through users with at least the required role
+func (app *application) requireRole(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromCtx(r)
+
+		allowed, err := app.store.Role.IsPrecedent(r.Context(), user.RoleID, requiredRole)
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			forbiddenResponse(w, r, fmt.Errorf("user %d lacks the %s role", user.ID, requiredRole))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkCommunityRole lets through members of the community in the context
+// with at least the required community role, and site admins
+func (app *application) checkCommunityRole(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromCtx(r)
+		community := getCommunityFromCtx(r)
+
+		allowed, err := app.store.Community.IsPrecedent(r.Context(), community.ID, user.ID, requiredRole)
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			allowed, err = app.store.Role.IsPrecedent(r.Context(), user.RoleID, "admin")
+			if err != nil {
+				internalServerError(w, r, err)
+				return
+			}
+		}
+		if !allowed {
+			forbiddenResponse(w, r, fmt.Errorf("user %d lacks the %s role in community %d", user.ID, requiredRole, community.ID))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
 //      allowed, err := app.store.Role.IsPrecedent(ctx, user.RoleID, roleName)
 //      return allowed, err
@@ -134,6 +223,24 @@ func (app *application) GetUserFromCacheByID(ctx context.Context, userID int64)
 	return user, nil
 }
 
+// streamPath is where long-lived event streams are served
+const streamPath = "/stream"
+
+// timeoutUnlessStreaming cancels the context of requests after the timeout,
+// except for event streams and WebSockets
+func timeoutUnlessStreaming(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withTimeout := middleware.Timeout(timeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1"+streamPath || r.URL.Path == "/v1"+gatewayPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+			withTimeout.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type unreadCount struct {
+	Unread int `json:"unread"`
+}
+
+// GetNotificationsHandler godoc
+//
+//	@Summary		Get my notifications
+//	@Description	list my notifications, most recently updated first. Unread notifications of the same kind on the same post, and unread follows, are grouped with the users who acted. The next page is linked in the Link header
+//	@Tags			NOTIFICATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			unread	query		bool	false	"Only list unread notifications"
+//	@Param			limit	query		int		false	"Limit number of notifications"	default(20)
+//	@Param			cursor	query		string	false	"Cursor of the page"
+//	@Success		200		{object}	[]store.Notification
+//	@Header			200		{string}	Link	"Link to the next page"
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	cursorQueryDefault := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	cursorQuery, err := cursorQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(cursorQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	query := store.NotificationsQuery{CursorPaginatedQuery: cursorQuery}
+	if unread := r.URL.Query().Get("unread"); unread != "" {
+		if query.Unread, err = strconv.ParseBool(unread); err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	user := getUserFromCtx(r)
+
+	notifications, next, err := app.store.Notification.GetByUserID(r.Context(), user.ID, query)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	writeNextLink(w, r, next)
+	if err := app.jsonResponse(w, http.StatusOK, notifications); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetUnreadNotificationsCountHandler godoc
+//
+//	@Summary		Count my unread notifications
+//	@Description	get the number of my unread notifications, grouped notifications count once
+//	@Tags			NOTIFICATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	unreadCount
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/unread_count [get]
+func (app *application) GetUnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	count, err := app.store.Notification.CountUnread(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, unreadCount{Unread: count}); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// MarkNotificationReadHandler godoc
+//
+//	@Summary		Mark a notification as read
+//	@Description	mark one of my notifications as read, new activity then starts a new notification
+//	@Tags			NOTIFICATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			notificationID	path	int	true	"Notification ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/{notificationID}/read [put]
+func (app *application) MarkNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+
+	if err := app.store.Notification.MarkRead(r.Context(), user.ID, id); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// MarkAllNotificationsReadHandler godoc
+//
+//	@Summary		Mark all notifications as read
+//	@Description	mark every one of my notifications as read
+//	@Tags			NOTIFICATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Success		202
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [put]
+func (app *application) MarkAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	if err := app.store.Notification.MarkAllRead(r.Context(), user.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+type notificationPreferencesPayload struct {
+	// Channels sets the channel of some kinds, the others are kept
+	Channels map[string]string `json:"channels" validate:"dive,keys,oneof=follow comment mention repost,endkeys,oneof=in_app email none"`
+	Digest   string            `json:"digest" validate:"omitempty,oneof=daily weekly off"`
+}
+
+// GetNotificationPreferencesHandler godoc
+//
+//	@Summary		Get my notification preferences
+//	@Description	get the channel of every kind of notification (in_app, email or none) and how often the email digest is sent (daily, weekly or off)
+//	@Tags			NOTIFICATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	store.NotificationPreferences
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) GetNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	prefs, err := app.store.NotificationPreference.Get(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateNotificationPreferencesHandler godoc
+//
+//	@Summary		Update my notification preferences
+//	@Description	set the channel of some kinds of notifications and the digest frequency. Notifications sent to none are not recorded, the ones sent to email are also listed in the digest
+//	@Tags			NOTIFICATIONS
+//	@Accept			json
+//	@Produce		json
+//	@Param			preferences	body		notificationPreferencesPayload	true	"Preferences"
+//	@Success		200			{object}	store.NotificationPreferences
+//	@Failure		400			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [put]
+func (app *application) UpdateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload notificationPreferencesPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := app.store.NotificationPreference.Set(ctx, user.ID, &store.NotificationPreferences{
+		Channels: payload.Channels,
+		Digest:   payload.Digest,
+	}); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	prefs, err := app.store.NotificationPreference.Get(ctx, user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/auth"
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUnsubscribeHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"should reject a missing token", ""},
+		{"should reject a token of another purpose", auth.NewSigner("test", "other").Sign("42")},
+		{"should reject a token without a user", app.unsubscribeSigner.Sign("everyone")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/notifications/unsubscribe?token="+tt.token, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUnsubscribePageHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	t.Run("should ask to confirm without unsubscribing", func(t *testing.T) {
+		token := app.unsubscribeSigner.Sign("42")
+		req, err := http.NewRequest(http.MethodGet, "/v1/notifications/unsubscribe?token="+token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("expected a page, got %q", rr.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(rr.Body.String(), `method="post"`) {
+			t.Errorf("expected a form posting the unsubscribe, got %s", rr.Body)
+		}
+		if unsubscribed := app.store.NotificationPreference.(*store.MockNotificationPreferenceStore).Unsubscribed; len(unsubscribed) != 0 {
+			t.Errorf("expected nobody to be unsubscribed, got %v", unsubscribed)
+		}
+	})
+
+	t.Run("should reject an invalid token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/notifications/unsubscribe?token=nope", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestUpdateNotificationPreferencesHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"should reject an unknown kind", `{"channels": {"likes": "email"}}`},
+		{"should reject an unknown channel", `{"channels": {"follow": "sms"}}`},
+		{"should reject an unknown digest frequency", `{"digest": "hourly"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPut, "/v1/notifications/preferences", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetNotificationsHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	do := func(t *testing.T, method, url string, v any) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code != http.StatusOK && rr.Code != http.StatusAccepted {
+			t.Fatalf("%s %s: expected success, got status code %d", method, url, rr.Code)
+		}
+		if v != nil {
+			if err := json.NewDecoder(rr.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	summaries := func(t *testing.T, url string) []string {
+		t.Helper()
+		var resp struct {
+			Data []store.Notification `json:"data"`
+		}
+		do(t, http.MethodGet, url, &resp)
+		got := []string{}
+		for _, n := range resp.Data {
+			got = append(got, n.Summary)
+		}
+		return got
+	}
+	unread := func(t *testing.T) int {
+		t.Helper()
+		var resp struct {
+			Data unreadCount `json:"data"`
+		}
+		do(t, http.MethodGet, "/v1/notifications/unread_count", &resp)
+		return resp.Data.Unread
+	}
+
+	ctx := context.Background()
+	post := int64(1)
+	app.notify(ctx, &store.Notification{UserID: 42, Kind: store.NotificationFollow}, 7)
+	app.notify(ctx, &store.Notification{UserID: 42, Kind: store.NotificationRepost, PostID: &post}, 9)
+	app.notify(ctx, &store.Notification{UserID: 42, Kind: store.NotificationFollow}, 8)
+	// nobody is notified about what they did themselves
+	app.notify(ctx, &store.Notification{UserID: 42, Kind: store.NotificationFollow}, 42)
+
+	t.Run("should group unread notifications of the same kind", func(t *testing.T) {
+		want := []string{"user8 and user7 followed you", "user9 reposted your post"}
+		if got := summaries(t, "/v1/notifications"); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if count := unread(t); count != 2 {
+			t.Errorf("expected 2 unread notifications, got %d", count)
+		}
+	})
+
+	t.Run("should start a new group once a notification is read", func(t *testing.T) {
+		do(t, http.MethodPut, "/v1/notifications/1/read", nil)
+		if count := unread(t); count != 1 {
+			t.Errorf("expected 1 unread notification, got %d", count)
+		}
+
+		app.notify(ctx, &store.Notification{UserID: 42, Kind: store.NotificationFollow}, 6)
+
+		want := []string{"user6 followed you", "user9 reposted your post"}
+		if got := summaries(t, "/v1/notifications?unread=true"); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if got := summaries(t, "/v1/notifications"); len(got) != 3 {
+			t.Errorf("expected 3 notifications, got %v", got)
+		}
+	})
+
+	t.Run("should mark every notification as read", func(t *testing.T) {
+		do(t, http.MethodPut, "/v1/notifications/read", nil)
+		if count := unread(t); count != 0 {
+			t.Errorf("expected no unread notifications, got %d", count)
+		}
+	})
+
+	t.Run("should not find a notification of another user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/v1/notifications/99/read", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
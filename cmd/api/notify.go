@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/dubass83/go_social/internal/entities"
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// notifyMentioned lets the users mentioned in a post, or in a comment on it
+// when commentID is set, know about it. Authors do not get notified about
+// their own mentions, nor do users who can not see the post.
+func (app *application) notifyMentioned(ctx context.Context, authorID int64, post *store.Post, commentID int64, e *entities.Entities) {
+	if e == nil {
+		return
+	}
+
+	for _, userID := range e.UserIDs() {
+		if userID == authorID {
+			continue
+		}
+		// a comment mention does not grant access to the post
+		if commentID != 0 && post.Visibility != store.PostVisibilityPublic && userID != post.UserID {
+			visible, err := app.store.Post.IsVisibleTo(ctx, post.ID, userID)
+			if err != nil {
+				log.Error().Err(err).Int64("post_id", post.ID).Msg("failed to check the visibility of the post")
+				continue
+			}
+			if !visible {
+				continue
+			}
+		}
+		n := &store.Notification{UserID: userID, Kind: store.NotificationMention, PostID: &post.ID}
+		if commentID != 0 {
+			n.CommentID = &commentID
+		}
+		app.notify(ctx, n, authorID)
+	}
+}
+
+// notifyFollowers lets the followers of the author know about a published
+// post they can see. Followers mentioned in the post already got a mention.
+func (app *application) notifyFollowers(ctx context.Context, post *store.Post) {
+	if post.Visibility != store.PostVisibilityPublic && post.Visibility != store.PostVisibilityFollowers {
+		return
+	}
+
+	followerIDs, err := app.store.Follow.GetFollowerIDs(ctx, post.UserID)
+	if err != nil {
+		log.Error().Err(err).Int64("post_id", post.ID).Msg("failed to get the followers to notify")
+		return
+	}
+	var mentioned []int64
+	if post.Entities != nil {
+		mentioned = post.Entities.UserIDs()
+	}
+	for _, userID := range followerIDs {
+		if slices.Contains(mentioned, userID) {
+			continue
+		}
+		app.notify(ctx, &store.Notification{UserID: userID, Kind: store.NotificationPost, PostID: &post.ID}, post.UserID)
+	}
+}
+
+// notify records that actorID acted on the notified user and streams the
+// notification it was grouped into. Nobody gets notified about what they did
+// themselves, failures are only logged.
+func (app *application) notify(ctx context.Context, n *store.Notification, actorID int64) {
+	if n.UserID == actorID {
+		return
+	}
+	channel, err := app.store.NotificationPreference.GetChannel(ctx, n.UserID, n.Kind)
+	if err != nil {
+		// better a notification too many than a lost one
+		log.Error().Err(err).Int64("user_id", n.UserID).Msg("failed to get notification preferences")
+	}
+	if channel == store.ChannelNone {
+		return
+	}
+	if err := app.store.Notification.Add(ctx, n, actorID); err != nil {
+		log.Error().Err(err).Int64("user_id", n.UserID).Str("kind", n.Kind).Msg("failed to add notification")
+		return
+	}
+	app.publishEvent(events.TypeNotification, n, n.UserID)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dubass83/go_social/internal/store"
+)
+
+// PinPostHandler godoc
+//
+//	@Summary		Pin a post
+//	@Description	pin one of my published posts to the top of my profile
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"Post ID"
+//	@Success		202
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	conflictEnvelope
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/pin [put]
+func (app *application) PinPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if user.ID != post.UserID {
+		forbiddenResponse(w, r, fmt.Errorf("user %d can not pin post %d of user %d", user.ID, post.ID, post.UserID))
+		return
+	}
+	if !post.IsPublished() {
+		badRequestResponse(w, r, fmt.Errorf("post with id %d is not published", post.ID))
+		return
+	}
+
+	if err := app.store.Pin.Pin(r.Context(), user.ID, post.ID, app.config.posts.maxPinned); err != nil {
+		if err == store.ErrLimitExceeded {
+			conflictResponse(w, r, fmt.Errorf("at most %d posts can be pinned", app.config.posts.maxPinned), nil)
+			return
+		}
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UnpinPostHandler godoc
+//
+//	@Summary		Unpin a post
+//	@Description	remove one of my posts from the top of my profile
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"Post ID"
+//	@Success		202
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/pin [delete]
+func (app *application) UnpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if user.ID != post.UserID {
+		forbiddenResponse(w, r, fmt.Errorf("user %d can not unpin post %d of user %d", user.ID, post.ID, post.UserID))
+		return
+	}
+
+	if err := app.store.Pin.Unpin(r.Context(), user.ID, post.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
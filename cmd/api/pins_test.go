@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPinPostHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.posts.maxPinned = 2
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	pins := app.store.Pin.(*store.MockPinStore)
+
+	pin := func(t *testing.T, method string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, "/v1/posts/1/pin", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should pin my post once", func(t *testing.T) {
+		for range 2 {
+			if rr := pin(t, http.MethodPut); rr.Code != http.StatusAccepted {
+				t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+			}
+		}
+		if len(pins.Pinned[42]) != 1 {
+			t.Errorf("expected 1 pinned post, got %v", pins.Pinned[42])
+		}
+	})
+
+	t.Run("should unpin my post", func(t *testing.T) {
+		if rr := pin(t, http.MethodDelete); rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		if len(pins.Pinned[42]) != 0 {
+			t.Errorf("expected no pinned posts, got %v", pins.Pinned[42])
+		}
+	})
+
+	t.Run("should refuse to pin more than the limit", func(t *testing.T) {
+		pins.Pinned[42] = []int64{7, 8}
+
+		rr := pin(t, http.MethodPut)
+
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		var body conflictEnvelope
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Error != "at most 2 posts can be pinned" {
+			t.Errorf("unexpected error %q", body.Error)
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// polls stay open at least minPollDuration and at most maxPollDuration
+// after their post is published
+const (
+	minPollDuration = 5 * time.Minute
+	maxPollDuration = 30 * 24 * time.Hour
+)
+
+type PollPayload struct {
+	Options   []string  `json:"options" validate:"required,min=2,max=6,unique,dive,required,max=100"`
+	Multiple  bool      `json:"multiple"`
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+}
+
+type votePayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"required,min=1,max=6,unique,dive,gte=1"`
+}
+
+// pollStart returns the time a post is published at and its poll opens,
+// publishAt for scheduled posts and now otherwise
+func pollStart(publishAt *time.Time) time.Time {
+	start := time.Now()
+	if publishAt != nil && publishAt.After(start) {
+		start = *publishAt
+	}
+	return start
+}
+
+// checkPollOpen makes sure a poll expiring at expiresAt stays open for at
+// least minPollDuration once its post is published at start
+func checkPollOpen(expiresAt, start time.Time) error {
+	if expiresAt.Before(start.Add(minPollDuration)) {
+		return fmt.Errorf("poll must stay open for at least %s", minPollDuration)
+	}
+	return nil
+}
+
+// newPoll checks the expiry of a poll against the time its post is published
+func newPoll(payload *PollPayload, publishAt *time.Time) (*store.Poll, error) {
+	start := pollStart(publishAt)
+	if err := checkPollOpen(payload.ExpiresAt, start); err != nil {
+		return nil, err
+	}
+	if payload.ExpiresAt.After(start.Add(maxPollDuration)) {
+		return nil, fmt.Errorf("poll can stay open for at most %s", maxPollDuration)
+	}
+
+	poll := &store.Poll{
+		Multiple:  payload.Multiple,
+		ExpiresAt: payload.ExpiresAt,
+		Options:   make([]store.PollOption, len(payload.Options)),
+	}
+	for i, text := range payload.Options {
+		poll.Options[i].Text = text
+	}
+	return poll, nil
+}
+
+// GetPollHandler godoc
+//
+//	@Summary		Get the poll of a post
+//	@Description	get the poll of a post with its live tallies and my vote
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{object}	store.Poll
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/poll [get]
+func (app *application) GetPollHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	poll, err := app.store.Poll.GetByPostID(r.Context(), post.ID, getViewerID(r))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, fmt.Errorf("post with id %d has no poll", post.ID))
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, poll); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// VotePollHandler godoc
+//
+//	@Summary		Vote in the poll of a post
+//	@Description	vote for one option, or several ones in multiple choice polls. Every user votes once, until the poll closes the vote can be retracted and cast again
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int			true	"Post ID"
+//	@Param			vote	body		votePayload	true	"Chosen options"
+//	@Success		200		{object}	store.Poll
+//	@Failure		400		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	conflictEnvelope{data=store.Poll}	"Closed poll, or the poll already voted in"
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/poll/votes [post]
+func (app *application) VotePollHandler(w http.ResponseWriter, r *http.Request) {
+	var payload votePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
+
+	if !post.IsPublished() {
+		badRequestResponse(w, r, fmt.Errorf("post with id %d is not published", post.ID))
+		return
+	}
+
+	poll, err := app.store.Poll.GetByPostID(ctx, post.ID, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, fmt.Errorf("post with id %d has no poll", post.ID))
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+	if poll.Closed {
+		conflictResponse(w, r, fmt.Errorf("poll of post %d is closed", post.ID), poll)
+		return
+	}
+	if !poll.Multiple && len(payload.OptionIDs) > 1 {
+		badRequestResponse(w, r, fmt.Errorf("poll of post %d takes a single option", post.ID))
+		return
+	}
+	for _, id := range payload.OptionIDs {
+		if !poll.HasOption(id) {
+			badRequestResponse(w, r, fmt.Errorf("option %d is not an option of the poll of post %d", id, post.ID))
+			return
+		}
+	}
+
+	if err := app.store.Poll.Vote(ctx, poll.ID, user.ID, payload.OptionIDs); err != nil {
+		switch err {
+		case store.ErrDuplicate:
+			conflictResponse(w, r, fmt.Errorf("user %d already voted in the poll of post %d", user.ID, post.ID), poll)
+		case store.ErrPollClosed:
+			conflictResponse(w, r, fmt.Errorf("poll of post %d is closed", post.ID), poll)
+		case store.ErrNotFound:
+			badRequestResponse(w, r, fmt.Errorf("options %v are not options of the poll of post %d", payload.OptionIDs, post.ID))
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.pollResponse(w, r, post.ID, user.ID)
+}
+
+// RetractVoteHandler godoc
+//
+//	@Summary		Retract my vote
+//	@Description	retract my vote in the poll of a post while it is open
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{object}	store.Poll
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	conflictEnvelope{data=store.Poll}	"Closed poll"
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/poll/votes [delete]
+func (app *application) RetractVoteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
+
+	poll, err := app.store.Poll.GetByPostID(ctx, post.ID, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, fmt.Errorf("post with id %d has no poll", post.ID))
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Poll.Retract(ctx, poll.ID, user.ID); err != nil {
+		switch err {
+		case store.ErrPollClosed:
+			conflictResponse(w, r, fmt.Errorf("poll of post %d is closed", post.ID), poll)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.pollResponse(w, r, post.ID, user.ID)
+}
+
+// pollResponse writes the poll of a post with the tallies after a vote
+func (app *application) pollResponse(w http.ResponseWriter, r *http.Request, postID, userID int64) {
+	poll, err := app.store.Poll.GetByPostID(r.Context(), postID, userID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, poll); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// closeExpiredPolls closes the polls that expired and tells the authors of
+// their posts and their voters the final tallies
+func (app *application) closeExpiredPolls(ctx context.Context) {
+	closed, err := app.store.Poll.CloseExpired(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to close expired polls")
+		return
+	}
+	for _, c := range closed {
+		log.Debug().Int64("post_id", c.Poll.PostID).Msg("poll closed")
+		app.publishEvent(events.TypePollClosed, c.Poll, append([]int64{c.AuthorID}, c.VoterIDs...)...)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewPoll(t *testing.T) {
+	now := time.Now()
+	tomorrow := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		publishAt *time.Time
+		wantErr   bool
+	}{
+		{name: "open for a day", expiresAt: now.Add(24 * time.Hour)},
+		{name: "expired", expiresAt: now.Add(-time.Hour), wantErr: true},
+		{name: "too short", expiresAt: now.Add(time.Minute), wantErr: true},
+		{name: "too long", expiresAt: now.Add(31 * 24 * time.Hour), wantErr: true},
+		{name: "expires before a scheduled post is published", expiresAt: now.Add(time.Hour), publishAt: &tomorrow, wantErr: true},
+		{name: "open for a day after a scheduled post is published", expiresAt: tomorrow.Add(24 * time.Hour), publishAt: &tomorrow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &PollPayload{Options: []string{"yes", "no"}, ExpiresAt: tt.expiresAt}
+			poll, err := newPoll(payload, tt.publishAt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && len(poll.Options) != 2 {
+				t.Errorf("expected 2 options, got %d", len(poll.Options))
+			}
+		})
+	}
+}
+
+func TestCreatePostHandlerPoll(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	expiresAt := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name string
+		poll string
+	}{
+		{"should reject a single option", `{"options": ["yes"], "expires_at": "` + expiresAt + `"}`},
+		{"should reject seven options", `{"options": ["1", "2", "3", "4", "5", "6", "7"], "expires_at": "` + expiresAt + `"}`},
+		{"should reject an option twice", `{"options": ["yes", "yes"], "expires_at": "` + expiresAt + `"}`},
+		{"should reject an empty option", `{"options": ["yes", ""], "expires_at": "` + expiresAt + `"}`},
+		{"should reject no expiry", `{"options": ["yes", "no"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"title": "vote", "content": "what do you think?", "poll": ` + tt.poll + `}`
+			req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestPublishPostHandlerPoll(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	posts := app.store.Post.(*store.MockPostStore)
+	posts.Status = store.PostStatusDraft
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		body      string
+		want      int
+	}{
+		{"should publish a poll that stays open long enough", now.Add(time.Hour), "", http.StatusOK},
+		{"should reject a poll that expires too soon after now", now.Add(2 * time.Minute), "", http.StatusBadRequest},
+		{"should reject a poll that expires before it is published", now.Add(time.Hour), `{"publish_at": "` + now.Add(2*time.Hour).Format(time.RFC3339) + `"}`, http.StatusBadRequest},
+		{"should schedule a poll that stays open long enough", now.Add(3 * time.Hour), `{"publish_at": "` + now.Add(2*time.Hour).Format(time.RFC3339) + `"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts.Poll = &store.Poll{PostID: 1, ExpiresAt: tt.expiresAt}
+			req, err := http.NewRequest(http.MethodPost, "/v1/posts/1/publish", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+}
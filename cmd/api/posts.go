@@ -2,9 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dubass83/go_social/internal/entities"
 	"github.com/dubass83/go_social/internal/store"
 	"github.com/go-chi/chi/v5"
 )
@@ -17,24 +24,45 @@ type PostPayload struct {
 	Title   string   `json:"title" validate:"required,min=2,max=100"`
 	Content string   `json:"content" validate:"required,min=2,max=1000"`
 	Tags    []string `json:"tags"`
+	// Status defaults to published, or to scheduled when PublishAt is set
+	Status     string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt  *time.Time `json:"publish_at"`
+	Visibility string     `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	// QuotedPostID turns the post into a quote of another public post
+	QuotedPostID *int64 `json:"quoted_post_id" validate:"omitempty,gte=1"`
+	// CommunityID posts to a community the user is a member of
+	CommunityID *int64 `json:"community_id" validate:"omitempty,gte=1"`
+	// Poll attaches a poll, it can not be changed afterwards
+	Poll *PollPayload `json:"poll"`
+	// MediaIDs attach media the user uploaded, in order
+	MediaIDs []int64 `json:"media_ids" validate:"omitempty,max=4,unique,dive,gte=1"`
+}
+
+type publishPostPayload struct {
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type UpdatePostPayload struct {
-	Title   string   `json:"title" validate:"omitempty,min=2,max=100"`
-	Content string   `json:"content" validate:"omitempty,min=2,max=1000"`
-	Tags    []string `json:"tags" validate:"omitempty"`
+	Title      string   `json:"title" validate:"omitempty,min=2,max=100"`
+	Content    string   `json:"content" validate:"omitempty,min=2,max=1000"`
+	Tags       []string `json:"tags" validate:"omitempty"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	// Version is an alternative to the If-Match header for clients
+	// that can not set custom headers
+	Version *int64 `json:"version" validate:"omitempty,gte=0"`
 }
 
 // CreatePostHandler godoc
 //
 //	@Summary		Create a new post
-//	@Description	create a new post with title, content and tags
+//	@Description	create a new post with title, content and tags. @mentions and #hashtags are parsed from the content, hashtags are added to the tags and both are returned with their offsets as entities. Posts are published right away unless they are saved as a draft or scheduled with publish_at. Visibility is public, followers or mentioned, where users mentioned with @username can always see the post. Setting quoted_post_id quotes another public post, setting community_id posts to a community I am a member of. A poll has 2 to 6 options and expires between 5 minutes and 30 days after the post is published
 //	@Tags			POSTS
 //	@Accept			json
 //	@Produce		json
 //	@Param			post	body		PostPayload	true	"Post payload"
 //	@Success		201		{object}	store.Post
 //	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
 //	@Failure		500		{object}	map[string]string
 //	@Router			/posts [post]
 func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -49,19 +77,94 @@ func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	status, err := resolvePostStatus(payload.Status, payload.PublishAt)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	tags, err := normalizeTags(payload.Tags)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	var poll *store.Poll
+	if payload.Poll != nil {
+		poll, err = newPoll(payload.Poll, payload.PublishAt)
+		if err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	var quoted *store.Post
+	if payload.QuotedPostID != nil {
+		quoted, err = app.store.Post.GetByID(r.Context(), strconv.FormatInt(*payload.QuotedPostID, 10))
+		if err != nil {
+			if err == store.ErrNotFound {
+				badRequestResponse(w, r, fmt.Errorf("quoted post with id %d does not exist", *payload.QuotedPostID))
+				return
+			}
+			internalServerError(w, r, err)
+			return
+		}
+		if err := checkShareable(quoted); err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+	}
+
 	user := getUserFromCtx(r)
 
+	if payload.CommunityID != nil {
+		member, err := app.store.Community.IsPrecedent(r.Context(), *payload.CommunityID, user.ID, store.CommunityRoleMember)
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		if !member {
+			forbiddenResponse(w, r, fmt.Errorf("user %d is not a member of community %d", user.ID, *payload.CommunityID))
+			return
+		}
+	}
+
+	media, err := app.attachableMedia(r, user.ID, payload.MediaIDs)
+	if err != nil {
+		switch err.(type) {
+		case errMediaNotOwned:
+			badRequestResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.ID,
+		Title:        payload.Title,
+		Content:      payload.Content,
+		Tags:         postTags(tags, payload.Content),
+		UserID:       user.ID,
+		Status:       status,
+		PublishAt:    payload.PublishAt,
+		Visibility:   payload.Visibility,
+		QuotedPostID: payload.QuotedPostID,
+		QuotedPost:   quoted,
+		CommunityID:  payload.CommunityID,
+		Poll:         poll,
+		Media:        media,
 	}
 
 	if err := app.store.Post.Create(r.Context(), post); err != nil {
 		internalServerError(w, r, err)
 		return
 	}
+	// signed before the post is shared with the goroutines below
+	app.signMedia(post)
+
+	if post.Status == store.PostStatusPublished {
+		go app.postPublished(context.Background(), post)
+	}
 
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		internalServerError(w, r, err)
@@ -72,7 +175,7 @@ func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request
 // GetAllPostsHandler godoc
 //
 //	@Summary		Get a paginated list of all posts
-//	@Description	Return a paginated list of all posts (not filtered by follows), useful as a public discovery feed for new users who do not follow anyone yet.
+//	@Description	Return a paginated list of all posts (not filtered by follows), useful as a public discovery feed for new users who do not follow anyone yet. Anonymous visitors only get public posts, authenticated users also get the posts that are visible to them.
 //	@Tags			POSTS
 //	@Accept			json
 //	@Produce		json
@@ -105,7 +208,7 @@ func (app *application) GetAllPostsHandler(w http.ResponseWriter, r *http.Reques
 
 	ctx := r.Context()
 
-	posts, err := app.store.Post.GetAllPosts(ctx, pgPostsQuery)
+	posts, err := app.store.Post.GetAllPosts(ctx, getViewerID(r), pgPostsQuery)
 
 	if err != nil {
 		internalServerError(w, r, err)
@@ -127,6 +230,7 @@ func (app *application) GetAllPostsHandler(w http.ResponseWriter, r *http.Reques
 //	@Produce		json
 //	@Param			id	path		int	true	"Posts ID"
 //	@Success		200	{object}	store.Post
+//	@Header			200	{string}	ETag	"Current version of the post"
 //	@Failure		400	{object}	map[string]string
 //	@Failure		404	{object}	map[string]string
 //	@Failure		500	{object}	map[string]string
@@ -144,6 +248,12 @@ func (app *application) GetPostByIDHandler(w http.ResponseWriter, r *http.Reques
 	}
 	post.Comments = comments
 
+	if err := app.store.Post.AttachDetails(ctx, getViewerID(r), post); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post))
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		internalServerError(w, r, err)
 		return
@@ -186,16 +296,20 @@ func (app *application) DeletePostHandler(w http.ResponseWriter, r *http.Request
 // UpdatePostHandler godoc
 //
 //	@Summary		Update a post
-//	@Description	update post by ID with optional title, content and tags
+//	@Description	update post by ID with optional title, content and tags. The version the client edited must be sent either as an If-Match header with the ETag from GET or as the version field of the payload
 //	@Tags			POSTS
 //	@Accept			json
 //	@Produce		json
-//	@Param			id		path		int					true	"Post ID"
-//	@Param			post	body		UpdatePostPayload	true	"Update post payload"
-//	@Success		200		{object}	store.Post
-//	@Failure		400		{object}	map[string]string
-//	@Failure		404		{object}	map[string]string
-//	@Failure		500		{object}	map[string]string
+//	@Param			id			path		int					true	"Post ID"
+//	@Param			If-Match	header		string				false	"ETag of the post being edited"
+//	@Param			post		body		UpdatePostPayload	true	"Update post payload"
+//	@Success		200			{object}	store.Post
+//	@Header			200			{string}	ETag	"New version of the post"
+//	@Failure		400			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		409			{object}	conflictEnvelope{data=store.Post}	"Current post when the edited version is stale"
+//	@Failure		428			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
 //	@Router			/posts/{id} [patch]
 func (app *application) UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -213,14 +327,45 @@ func (app *application) UpdatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	version, err := expectedPostVersion(r, post, payload.Version)
+	if err != nil {
+		if err == errMissingPrecondition {
+			preconditionRequiredResponse(w, r, err)
+			return
+		}
+		badRequestResponse(w, r, err)
+		return
+	}
+	if version != post.Version {
+		w.Header().Set("ETag", postETag(post))
+		conflictResponse(w, r, store.ErrConflict, post)
+		return
+	}
+
+	// the mentions before the edit, only users mentioned by the edit get notified
+	if err := app.store.Post.AttachDetails(ctx, getViewerID(r), post); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	// hashtags that are gone from the content are dropped from the tags
+	tags, err := normalizeTags(payload.Tags)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	if tags == nil {
+		tags = withoutTags(post.Tags, entities.Parse(post.Content).Tags())
+	}
 	if payload.Content != "" {
 		post.Content = payload.Content
 	}
 	if payload.Title != "" {
 		post.Title = payload.Title
 	}
-	if payload.Tags != nil {
-		post.Tags = payload.Tags
+	post.Tags = postTags(tags, post.Content)
+	if payload.Visibility != "" {
+		post.Visibility = payload.Visibility
 	}
 
 	user := getUserFromCtx(r)
@@ -231,23 +376,225 @@ func (app *application) UpdatePostHandler(w http.ResponseWriter, r *http.Request
 	// }
 
 	updatedPost := &store.Post{
-		Title:   post.Title,
-		Content: post.Content,
-		Tags:    post.Tags,
-		UserID:  user.ID,
+		Title:        post.Title,
+		Content:      post.Content,
+		Tags:         post.Tags,
+		UserID:       user.ID,
+		Status:       post.Status,
+		PublishAt:    post.PublishAt,
+		Visibility:   post.Visibility,
+		QuotedPostID: post.QuotedPostID,
+		CommunityID:  post.CommunityID,
+	}
+
+	if err := app.store.Post.Update(ctx, post.ID, version, updatedPost); err != nil {
+		if err == store.ErrConflict {
+			// somebody else saved in between, answer with what is stored now
+			current, err := app.store.Post.GetByID(ctx, strconv.FormatInt(post.ID, 10))
+			if err != nil {
+				internalServerError(w, r, err)
+				return
+			}
+			w.Header().Set("ETag", postETag(current))
+			conflictResponse(w, r, store.ErrConflict, current)
+			return
+		}
+		internalServerError(w, r, err)
+		return
 	}
 
-	if err := app.store.Post.Update(ctx, post.ID, post.Version, updatedPost); err != nil {
+	if err := app.store.Post.AttachDetails(ctx, getViewerID(r), updatedPost); err != nil {
 		internalServerError(w, r, err)
 		return
 	}
+	// signed before the post is shared with the goroutine below
+	app.signMedia(updatedPost)
+
+	// drafts and scheduled posts notify when they are published, the author
+	// mentioned the users even when a moderator saves the edit
+	if updatedPost.Status == store.PostStatusPublished {
+		go app.notifyMentioned(context.Background(), updatedPost.UserID, updatedPost, 0, updatedPost.Entities.MentionedSince(post.Entities))
+	}
 
+	w.Header().Set("ETag", postETag(updatedPost))
 	if err := app.jsonResponse(w, http.StatusOK, updatedPost); err != nil {
 		internalServerError(w, r, err)
 		return
 	}
 }
 
+// PublishPostHandler godoc
+//
+//	@Summary		Publish a draft
+//	@Description	publish a draft or scheduled post now, or schedule it when publish_at is in the future
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Post ID"
+//	@Param			payload	body		publishPostPayload	false	"Publish time"
+//	@Success		200		{object}	store.Post
+//	@Failure		400		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		409		{object}	conflictEnvelope{data=store.Post}	"Post that is already published"
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/publish [post]
+func (app *application) PublishPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	var payload publishPostPayload
+	// the body is optional, no body means publish now
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if post.Status == store.PostStatusPublished {
+		conflictResponse(w, r, fmt.Errorf("post with id %d is already published", post.ID), post)
+		return
+	}
+
+	if err := app.store.Post.AttachDetails(r.Context(), getViewerID(r), post); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	// the poll was checked against the publish time the draft was saved
+	// with, publishing later may leave it too little time to be voted on
+	if post.Poll != nil {
+		if err := checkPollOpen(post.Poll.ExpiresAt, pollStart(payload.PublishAt)); err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := app.store.Post.Publish(r.Context(), post, payload.PublishAt); err != nil {
+		if err == store.ErrConflict {
+			conflictResponse(w, r, fmt.Errorf("post with id %d is already published", post.ID), post)
+			return
+		}
+		internalServerError(w, r, err)
+		return
+	}
+
+	// signed before the post is shared with the goroutines below
+	app.signMedia(post)
+
+	if post.Status == store.PostStatusPublished {
+		go app.postPublished(context.Background(), post)
+	}
+
+	w.Header().Set("ETag", postETag(post))
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+}
+
+// resolvePostStatus checks the status and publish time requested for a new
+// post and returns the status to store it with
+func resolvePostStatus(status string, publishAt *time.Time) (string, error) {
+	if status == "" {
+		status = store.PostStatusPublished
+		if publishAt != nil {
+			status = store.PostStatusScheduled
+		}
+	}
+
+	switch status {
+	case store.PostStatusScheduled:
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return "", errors.New("scheduled posts need a publish_at in the future")
+		}
+	case store.PostStatusPublished:
+		if publishAt != nil {
+			return "", errors.New("publish_at can not be set on a post that is published right away")
+		}
+	}
+	return status, nil
+}
+
+// postTags returns the tags given by the client followed by the hashtags of
+// the content, without duplicates
+func postTags(tags []string, content string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, tag := range append(append([]string{}, tags...), entities.Parse(content).Tags()...) {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// normalizeTags normalizes the tags given by the client the way hashtags of
+// the content are, a nil slice stays nil
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized, ok := entities.NormalizeTag(tag)
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q, tags are up to 100 letters, digits or underscores and not only digits", tag)
+		}
+		result = append(result, normalized)
+	}
+	return result, nil
+}
+
+// withoutTags returns tags without the ones in remove
+func withoutTags(tags, remove []string) []string {
+	result := []string{}
+	for _, tag := range tags {
+		if !slices.Contains(remove, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+var errMissingPrecondition = errors.New("an If-Match header or a version field is required to update a post")
+
+// postETag returns a strong entity tag derived from the post version
+func postETag(post *store.Post) string {
+	return fmt.Sprintf(`"%d"`, post.Version)
+}
+
+// expectedPostVersion resolves the version the client based its edit on.
+// The If-Match header wins over the version field of the payload.
+func expectedPostVersion(r *http.Request, post *store.Post, payloadVersion *int64) (int64, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		if payloadVersion == nil {
+			return 0, errMissingPrecondition
+		}
+		return *payloadVersion, nil
+	}
+	if ifMatch == "*" {
+		return post.Version, nil
+	}
+
+	// a list of tags is allowed, the edit is accepted if any of them matches
+	var version int64 = -1
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			return 0, fmt.Errorf("weak entity tags can not be used with If-Match: %s", tag)
+		}
+		v, err := strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed entity tag in If-Match: %s", tag)
+		}
+		version = v
+		if v == post.Version {
+			return v, nil
+		}
+	}
+	return version, nil
+}
+
 func (app *application) postContextMiddelware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postID := chi.URLParam(r, "postID")
@@ -263,6 +610,26 @@ func (app *application) postContextMiddelware(next http.Handler) http.Handler {
 			internalServerError(w, r, err)
 			return
 		}
+
+		// drafts and scheduled posts only exist for their author
+		viewerID := getViewerID(r)
+		if !post.IsPublished() && viewerID != post.UserID {
+			notFoundResponse(w, r, fmt.Errorf("post with id %s is not published", postID))
+			return
+		}
+
+		// posts a user is not allowed to see are hidden the same way
+		if post.Visibility != store.PostVisibilityPublic && viewerID != post.UserID {
+			visible, err := app.store.Post.IsVisibleTo(ctx, post.ID, viewerID)
+			if err != nil {
+				internalServerError(w, r, err)
+				return
+			}
+			if !visible {
+				notFoundResponse(w, r, fmt.Errorf("post with id %s is not visible to user %d", postID, viewerID))
+				return
+			}
+		}
 		ctx = context.WithValue(ctx, postCTX, post)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUpdatePostHandlerPreconditions(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	newRequest := func(method, body, ifMatch string) *http.Request {
+		req, err := http.NewRequest(method, "/v1/posts/1", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return req
+	}
+
+	t.Run("should return an ETag for a post", func(t *testing.T) {
+		rr := executeRequest(newRequest(http.MethodGet, "", ""), mux)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"1"` {
+			t.Errorf("expected ETag %q, got %q", `"1"`, etag)
+		}
+	})
+
+	t.Run("should require a precondition", func(t *testing.T) {
+		rr := executeRequest(newRequest(http.MethodPatch, `{"title":"new title"}`, ""), mux)
+
+		if rr.Code != http.StatusPreconditionRequired {
+			t.Errorf("expected status code %d, got %d", http.StatusPreconditionRequired, rr.Code)
+		}
+	})
+
+	t.Run("should reject a stale If-Match with the current post", func(t *testing.T) {
+		rr := executeRequest(newRequest(http.MethodPatch, `{"title":"new title"}`, `"0"`), mux)
+
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		var body struct {
+			Data store.Post `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.Version != 1 || body.Data.Title != "title" {
+			t.Errorf("expected the current post in the conflict response, got %+v", body.Data)
+		}
+	})
+
+	t.Run("should reject a stale version field", func(t *testing.T) {
+		rr := executeRequest(newRequest(http.MethodPatch, `{"title":"new title","version":3}`, ""), mux)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should update with a matching If-Match", func(t *testing.T) {
+		rr := executeRequest(newRequest(http.MethodPatch, `{"title":"new title"}`, `"1"`), mux)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"2"` {
+			t.Errorf("expected ETag %q, got %q", `"2"`, etag)
+		}
+	})
+
+	t.Run("should answer with the details of the updated post", func(t *testing.T) {
+		app.store.Post.(*store.MockPostStore).Poll = &store.Poll{PostID: 1, Options: []store.PollOption{{ID: 1, Text: "yes"}, {ID: 2, Text: "no"}}}
+		defer func() { app.store.Post.(*store.MockPostStore).Poll = nil }()
+
+		rr := executeRequest(newRequest(http.MethodPatch, `{"title":"new title"}`, `"1"`), mux)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var body struct {
+			Data store.Post `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.Poll == nil || len(body.Data.Poll.Options) != 2 {
+			t.Errorf("expected the poll of the post, got %+v", body.Data.Poll)
+		}
+	})
+}
+
+func TestResolvePostStatus(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		status    string
+		publishAt *time.Time
+		want      string
+		wantErr   bool
+	}{
+		{name: "defaults to published", want: store.PostStatusPublished},
+		{name: "publish_at schedules", publishAt: &future, want: store.PostStatusScheduled},
+		{name: "draft", status: store.PostStatusDraft, want: store.PostStatusDraft},
+		{name: "scheduled without publish_at", status: store.PostStatusScheduled, wantErr: true},
+		{name: "scheduled in the past", status: store.PostStatusScheduled, publishAt: &past, wantErr: true},
+		{name: "published with publish_at", status: store.PostStatusPublished, publishAt: &future, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolvePostStatus(tt.status, tt.publishAt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected status %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPostTags(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		content string
+		want    []string
+	}{
+		{content: "no hashtags", want: []string{}},
+		{tags: []string{"news"}, content: "#Go and #go, #news", want: []string{"news", "go"}},
+		{tags: withoutTags([]string{"news", "go"}, []string{"go"}), content: "now #rust", want: []string{"news", "rust"}},
+	}
+
+	for _, tt := range tests {
+		if got := postTags(tt.tags, tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("postTags(%v, %q) = %v, want %v", tt.tags, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{tags: nil, want: nil},
+		{tags: []string{"#News", "Go_lang"}, want: []string{"news", "go_lang"}},
+		{tags: []string{"news", ""}, wantErr: true},
+		{tags: []string{"two words"}, wantErr: true},
+		{tags: []string{"2024"}, wantErr: true},
+		{tags: []string{strings.Repeat("a", 101)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeTags(tt.tags)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeTags(%v) error = %v, want error %v", tt.tags, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalizeTags(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestUpdatePostHandlerMentions(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a moderator edits the post of user 42
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 9, RoleID: 2}, nil)
+
+	req, err := http.NewRequest(http.MethodPatch, "/v1/posts/1", strings.NewReader(`{"content":"content for @user7"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("If-Match", `"1"`)
+
+	rr := executeRequest(req, mux)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	want := "user42 mentioned you in a post"
+	var got []*store.Notification
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		got, _, err = app.store.Notification.GetByUserID(context.Background(), 7, store.NotificationsQuery{CursorPaginatedQuery: store.CursorPaginatedQuery{Limit: 10}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) > 0 {
+			break
+		}
+	}
+	if len(got) != 1 || got[0].Summary != want {
+		t.Errorf("expected user 7 to be told %q, got %+v", want, got)
+	}
+}
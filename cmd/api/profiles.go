@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// UpdateProfilePayload changes the fields that are set and keeps the others
+type UpdateProfilePayload struct {
+	DisplayName *string   `json:"display_name" validate:"omitempty,max=50"`
+	Bio         *string   `json:"bio" validate:"omitempty,max=300"`
+	Location    *string   `json:"location" validate:"omitempty,max=100"`
+	Links       *[]string `json:"links" validate:"omitempty,max=5,unique,dive,http_url,max=200"`
+}
+
+// GetMeHandler godoc
+//
+//	@Summary		Get my account
+//	@Description	get the account and profile of the current user
+//	@Tags			USERS
+//	@Produce		json
+//	@Success		200	{object}	store.User
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [get]
+func (app *application) GetMeHandler(w http.ResponseWriter, r *http.Request) {
+	// the user of the context may come from the cache, the avatar is
+	// attached to a copy so it is not cached along
+	user := *getUserFromCtx(r)
+	if err := app.attachAvatar(r.Context(), &user); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, &user); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateProfileHandler godoc
+//
+//	@Summary		Update my profile
+//	@Description	change the display name, bio, location and links of the current user, fields left out are kept. Links must be http or https URLs.
+//	@Tags			USERS
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile fields"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	trimSpace(payload.DisplayName)
+	trimSpace(payload.Bio)
+	trimSpace(payload.Location)
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := *getUserFromCtx(r)
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.Links != nil {
+		user.Links = *payload.Links
+	}
+
+	app.saveProfile(w, r, &user)
+}
+
+// UpdateAvatarHandler godoc
+//
+//	@Summary		Upload my avatar
+//	@Description	upload an image as the avatar of the current user. It is processed like any other image, its variants serve as thumbnails. The previous avatar stays among my uploads.
+//	@Tags			USERS
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"Image to use"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	map[string]string
+//	@Failure		413		{object}	map[string]string
+//	@Failure		415		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (app *application) UpdateAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	media, ok := app.saveUpload(w, r, func(contentType string) error {
+		if !strings.HasPrefix(contentType, "image/") {
+			return fmt.Errorf("avatars must be images, not %s", contentType)
+		}
+		return nil
+	})
+	if !ok {
+		return
+	}
+
+	user := *getUserFromCtx(r)
+	user.AvatarID = &media.ID
+	user.Avatar = media
+
+	app.saveProfile(w, r, &user)
+}
+
+// DeleteAvatarHandler godoc
+//
+//	@Summary		Remove my avatar
+//	@Description	remove the avatar of the current user, the image stays among my uploads
+//	@Tags			USERS
+//	@Produce		json
+//	@Success		200	{object}	store.User
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [delete]
+func (app *application) DeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := *getUserFromCtx(r)
+	user.AvatarID = nil
+	user.Avatar = nil
+
+	app.saveProfile(w, r, &user)
+}
+
+// saveProfile stores the profile of user, drops the cached copy and
+// answers with the updated user
+func (app *application) saveProfile(w http.ResponseWriter, r *http.Request, user *store.User) {
+	ctx := r.Context()
+	if err := app.store.User.UpdateProfile(ctx, user); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	if err := app.cache.User.Delete(ctx, user.ID); err != nil {
+		log.Warn().Err(err).Int64("user_id", user.ID).Msg("Failed to delete user from cache")
+	}
+
+	if user.Avatar == nil {
+		if err := app.attachAvatar(ctx, user); err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+	}
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// attachAvatar loads the avatar of user. An avatar deleted since the user
+// was cached is left out.
+func (app *application) attachAvatar(ctx context.Context, user *store.User) error {
+	if user.AvatarID == nil {
+		return nil
+	}
+	media, err := app.store.Media.GetByID(ctx, *user.AvatarID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			user.AvatarID = nil
+			return nil
+		}
+		return err
+	}
+	user.Avatar = media
+	return nil
+}
+
+// trimSpace trims the optional field s in place
+func trimSpace(s *string) {
+	if s != nil {
+		*s = strings.TrimSpace(*s)
+	}
+}
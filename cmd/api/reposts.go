@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/dubass83/go_social/internal/store"
+)
+
+// RepostHandler godoc
+//
+//	@Summary		Repost a post
+//	@Description	share a public post with my followers, it shows up in their feed attributed to me
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"Post ID"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/repost [put]
+func (app *application) RepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if err := checkShareable(post); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	reposted, err := app.store.Repost.Create(r.Context(), user.ID, post.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	// reposting again changes nothing and notifies nobody
+	if reposted {
+		app.fanOutRepost(user.ID, post.ID)
+		go app.publishReaction(reactionRepost, post, user.ID)
+		go app.notify(context.Background(), &store.Notification{UserID: post.UserID, Kind: store.NotificationRepost, PostID: &post.ID}, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// DeleteRepostHandler godoc
+//
+//	@Summary		Undo a repost
+//	@Description	remove my repost of a post
+//	@Tags			POSTS
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	int	true	"Post ID"
+//	@Success		202
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/repost [delete]
+func (app *application) DeleteRepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Repost.Delete(r.Context(), user.ID, post.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	app.fanOutUndoRepost(user.ID, post.ID)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// checkShareable makes sure reposts and quotes do not widen the audience of
+// a post: only published public posts can be shared
+func checkShareable(post *store.Post) error {
+	if !post.IsPublished() {
+		return fmt.Errorf("post with id %d is not published", post.ID)
+	}
+	if post.Visibility != store.PostVisibilityPublic {
+		return fmt.Errorf("post with id %d is not public and can not be shared", post.ID)
+	}
+	return nil
+}
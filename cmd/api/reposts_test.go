@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRepostHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.timeline = newTimelineFanout(1, 10)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	t.Run("should fan out a repost only once", func(t *testing.T) {
+		for range 2 {
+			req, err := http.NewRequest(http.MethodPut, "/v1/posts/1/repost", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+			}
+		}
+
+		if jobs := len(app.timeline.queues[0]); jobs != 1 {
+			t.Errorf("expected 1 timeline job, got %d", jobs)
+		}
+	})
+
+	t.Run("should fan out a repost again once undone", func(t *testing.T) {
+		for _, method := range []string{http.MethodDelete, http.MethodPut} {
+			req, err := http.NewRequest(method, "/v1/posts/1/repost", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+			}
+		}
+
+		jobs := []string{}
+		for len(app.timeline.queues[0]) > 0 {
+			jobs = append(jobs, (<-app.timeline.queues[0]).name)
+		}
+		if want := []string{"repost", "undo repost", "repost"}; !slices.Equal(jobs, want) {
+			t.Errorf("expected timeline jobs %v, got %v", want, jobs)
+		}
+	})
+}
+
+func TestQuotePostHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	t.Run("should return the quoted post with the quote", func(t *testing.T) {
+		body := `{"title": "quote", "content": "look at this", "quoted_post_id": 1}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		var resp struct {
+			Data store.Post `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Data.QuotedPostID == nil || *resp.Data.QuotedPostID != 1 || resp.Data.QuotedPost == nil {
+			t.Errorf("expected post 1 to be quoted, got %v", resp.Data.QuotedPostID)
+		}
+	})
+}
+
+func TestCheckShareable(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		post    store.Post
+		wantErr bool
+	}{
+		{"should share a published public post", store.Post{Status: store.PostStatusPublished, PublishAt: &past, Visibility: store.PostVisibilityPublic}, false},
+		{"should not share a draft", store.Post{Status: store.PostStatusDraft, Visibility: store.PostVisibilityPublic}, true},
+		{"should not share a post scheduled for later", store.Post{Status: store.PostStatusPublished, PublishAt: &future, Visibility: store.PostVisibilityPublic}, true},
+		{"should not share a followers-only post", store.Post{Status: store.PostStatusPublished, PublishAt: &past, Visibility: store.PostVisibilityFollowers}, true},
+		{"should not share a post for the mentioned users", store.Post{Status: store.PostStatusPublished, PublishAt: &past, Visibility: store.PostVisibilityMentioned}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkShareable(&tt.post); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
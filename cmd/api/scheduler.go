@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// runPostScheduler publishes scheduled posts once their publish_at has
+// passed and closes expired polls. It runs until ctx is cancelled.
+func (app *application) runPostScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+
+	log.Info().Msgf("post scheduler started with interval %s", app.config.scheduler.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("post scheduler stopped")
+			return
+		case <-ticker.C:
+			app.closeExpiredPolls(ctx)
+
+			posts, err := app.store.Post.PublishScheduled(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to publish scheduled posts")
+				continue
+			}
+			for _, post := range posts {
+				log.Debug().Int64("post_id", post.ID).Msg("scheduled post published")
+				app.postPublished(ctx, post)
+			}
+		}
+	}
+}
+
+// postPublished is called once a post becomes visible to others, either
+// on creation, through the publish endpoint or by the scheduler. It adds the
+// post to the home timelines, notifies the mentioned users and the followers
+// and streams it.
+func (app *application) postPublished(ctx context.Context, post *store.Post) {
+	app.fanOutPost(post)
+	app.notifyMentioned(ctx, post.UserID, post, 0, post.Entities)
+	app.notifyFollowers(ctx, post)
+	app.publishPostCreated(ctx, post)
+}
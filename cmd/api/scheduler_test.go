@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/entities"
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+)
+
+func TestPostPublished(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("should stream the post to the author and followers", func(t *testing.T) {
+		sub, _, _ := app.events.Subscribe(42, "")
+		defer app.events.Unsubscribe(sub)
+
+		app.postPublished(context.Background(), &store.Post{ID: 1, UserID: 42, Visibility: store.PostVisibilityPublic})
+
+		select {
+		case ev := <-sub.C:
+			if ev.Type != events.TypePostCreated {
+				t.Errorf("expected a %s event, got %s", events.TypePostCreated, ev.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the post to be streamed")
+		}
+	})
+
+	t.Run("should notify the followers who can see the post", func(t *testing.T) {
+		for _, follower := range []int64{7, 8, 9} {
+			if _, err := app.store.Follow.CreateFollow(context.Background(), follower, 42); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// user 9 is mentioned and gets a mention instead
+		post := &store.Post{ID: 2, UserID: 42, Content: "hi @user9", Visibility: store.PostVisibilityFollowers}
+		post.Entities = entities.Parse(post.Content)
+		post.Entities.ResolveMentions(map[string]int64{"user9": 9})
+
+		app.postPublished(context.Background(), post)
+
+		notifications := app.store.Notification
+		for _, tt := range []struct {
+			userID int64
+			want   string
+		}{
+			{7, "user42 published a post"},
+			{8, "user42 published a post"},
+			{9, "user42 mentioned you in a post"},
+		} {
+			got, _, err := notifications.GetByUserID(context.Background(), tt.userID, store.NotificationsQuery{CursorPaginatedQuery: store.CursorPaginatedQuery{Limit: 10}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Summary != tt.want || *got[0].PostID != post.ID {
+				t.Errorf("expected user %d to be told %q, got %+v", tt.userID, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("should not notify followers of a post for the mentioned users", func(t *testing.T) {
+		app.postPublished(context.Background(), &store.Post{ID: 3, UserID: 42, Visibility: store.PostVisibilityMentioned})
+
+		if count, _ := app.store.Notification.CountUnread(context.Background(), 7); count != 1 {
+			t.Errorf("expected user 7 to keep 1 notification, got %d", count)
+		}
+	})
+}
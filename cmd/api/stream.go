@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// StreamHandler godoc
+//
+//	@Summary		Stream my events
+//	@Description	Server-Sent Events for the current user: post.created for new posts of followed users, comment.created for comments on my posts, reaction when my posts are reposted and notification. Clients resume with the Last-Event-ID header (sent by EventSource on reconnect) or the last_event_id parameter; a reset event means events were missed and the client should reload. EventSource can not set headers, so the token may be passed as access_token instead
+//	@Tags			STREAM
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header	string	false	"ID of the last event received"
+//	@Param			last_event_id	query	string	false	"ID of the last event received"
+//	@Param			access_token	query	string	false	"JWT when the Authorization header can not be set"
+//	@Success		200
+//	@Failure		401	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/stream [get]
+func (app *application) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// the server write timeout would cut the stream
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		internalServerError(w, r, fmt.Errorf("streaming is not supported: %w", err))
+		return
+	}
+
+	user := getUserFromCtx(r)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	sub, missed, resumed := app.events.Subscribe(user.ID, lastEventID)
+	defer app.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", app.config.stream.retry.Milliseconds())
+	if !resumed {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", events.TypeReset)
+	}
+	for _, ev := range missed {
+		writeEvent(w, ev)
+	}
+	if err := rc.Flush(); err != nil {
+		log.Error().Err(err).Msg("failed to flush event stream")
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.streams.Done():
+			// the client reconnects to another replica
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-sub.C:
+			// a subscription falling behind is closed, the client resumes
+			if !ok {
+				return
+			}
+			writeEvent(w, ev)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev events.Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+}
+
+// queryTokenMiddleware lets clients that can not set headers, like the
+// browser's EventSource, pass their token as the access_token parameter
+func queryTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publishEvent sends an event to users, failures are only logged
+func (app *application) publishEvent(typ string, data any, userIDs ...int64) {
+	app.signMedia(data)
+	ev, err := events.New(typ, data, userIDs...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create event")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := app.events.Publish(ctx, ev); err != nil {
+		log.Error().Err(err).Str("type", typ).Msg("failed to publish event")
+	}
+	app.enqueueWebhooks(ctx, ev)
+}
+
+// publishPostCreated streams a new post to the users who can see it in
+// their feed: the author and their followers, or only the mentioned users
+// for posts visible to them alone
+func (app *application) publishPostCreated(ctx context.Context, post *store.Post) {
+	recipients := []int64{post.UserID}
+	if post.Visibility == store.PostVisibilityMentioned {
+		if post.Entities != nil {
+			recipients = append(recipients, post.Entities.UserIDs()...)
+		}
+	} else {
+		followers, err := app.store.Follow.GetFollowerIDs(ctx, post.UserID)
+		if err != nil {
+			log.Error().Err(err).Int64("post_id", post.ID).Msg("failed to get followers of the post author")
+			return
+		}
+		recipients = append(recipients, followers...)
+	}
+	app.publishEvent(events.TypePostCreated, post, recipients...)
+}
+
+// commentEvent is the data of comment.created events
+type commentEvent struct {
+	PostID  int64          `json:"post_id"`
+	Comment *store.Comment `json:"comment"`
+}
+
+// publishCommentCreated streams a comment to the author of the post and to
+// the gateway clients watching the post
+func (app *application) publishCommentCreated(post *store.Post, comment *store.Comment) {
+	data := commentEvent{PostID: post.ID, Comment: comment}
+	if comment.UserID != post.UserID {
+		app.publishEvent(events.TypeCommentCreated, data, post.UserID)
+	}
+
+	ev, err := events.NewTopic(events.TypeCommentCreated, events.PostTopic(post.ID), data)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create event")
+		return
+	}
+	if err := app.events.Publish(context.Background(), ev); err != nil {
+		log.Error().Err(err).Str("type", ev.Type).Msg("failed to publish event")
+	}
+}
+
+// followEvent is the data of user.followed events
+type followEvent struct {
+	// UserID followed FollowID
+	UserID   int64 `json:"user_id"`
+	FollowID int64 `json:"follow_id"`
+}
+
+// Kinds of reactions, reposts are the only one so far
+const reactionRepost = "repost"
+
+// reactionEvent is the data of reaction events
+type reactionEvent struct {
+	Kind   string `json:"kind"`
+	PostID int64  `json:"post_id"`
+	UserID int64  `json:"user_id"`
+}
+
+// publishReaction streams a reaction to a post to its author
+func (app *application) publishReaction(kind string, post *store.Post, userID int64) {
+	if userID == post.UserID {
+		return
+	}
+	app.publishEvent(events.TypeReaction, reactionEvent{Kind: kind, PostID: post.ID, UserID: userID}, post.UserID)
+}
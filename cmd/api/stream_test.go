@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.stream.heartbeat = time.Minute
+	app.config.stream.retry = time.Second
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("should stream the events of the user and resume after the last one", func(t *testing.T) {
+		sub, _, _ := app.events.Subscribe(42, "")
+		app.publishEvent(events.TypePostCreated, map[string]int{"id": 1}, 42)
+		app.publishEvent(events.TypePostCreated, map[string]int{"id": 2}, 42)
+		first := <-sub.C
+		app.events.Unsubscribe(sub)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/stream?access_token="+testToken, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Last-Event-ID", first.ID)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("unexpected response %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+		}
+
+		lines := bufio.NewScanner(res.Body)
+		expectLine(t, lines, "retry: 1000")
+		expectLine(t, lines, "")
+		expectLine(t, lines, "id: ")
+		expectLine(t, lines, "event: post.created")
+		expectLine(t, lines, `data: {"id":2}`)
+		expectLine(t, lines, "")
+
+		app.publishEvent(events.TypeReaction, map[string]int{"post_id": 3}, 42)
+		expectLine(t, lines, "id: ")
+		expectLine(t, lines, "event: reaction")
+		expectLine(t, lines, `data: {"post_id":3}`)
+	})
+
+	t.Run("should end the stream on shutdown", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/stream?access_token="+testToken, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		lines := bufio.NewScanner(res.Body)
+		expectLine(t, lines, "retry: 1000")
+
+		app.closeStreams()
+		for lines.Scan() {
+		}
+		if err := lines.Err(); err != nil {
+			t.Fatalf("expected the stream to end, got %v", err)
+		}
+	})
+}
+
+func expectLine(t *testing.T, lines *bufio.Scanner, prefix string) {
+	t.Helper()
+	if !lines.Scan() {
+		t.Fatalf("stream ended while waiting for %q: %v", prefix, lines.Err())
+	}
+	if !strings.HasPrefix(lines.Text(), prefix) {
+		t.Fatalf("expected a line starting with %q, got %q", prefix, lines.Text())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// suggestionsCacheSize suggestions are computed and cached at once, the
+// limit of a request only cuts them
+const suggestionsCacheSize = 50
+
+// GetSuggestionsHandler godoc
+//
+//	@Summary		Get who to follow
+//	@Description	suggest users to follow: followed by the users you follow, popular in the tags you post about or follow, or recently active. Accounts you already follow are left out
+//	@Tags			USERS
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit number of suggestions"	default(10)
+//	@Success		200		{object}	[]store.Suggestion
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/suggestions [get]
+func (app *application) GetSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if limit < 1 || limit > suggestionsCacheSize {
+		badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and %d", suggestionsCacheSize))
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	suggestions, err := app.getSuggestions(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// getSuggestions reads the suggestions of a user from the cache, computing
+// and caching them on a miss
+func (app *application) getSuggestions(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	suggestions, err := app.cache.Suggestions.Get(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Int64("user_id", userID).Msg("Failed to get suggestions from cache")
+	}
+	if suggestions != nil {
+		return suggestions, nil
+	}
+
+	suggestions, err = app.store.Suggestion.GetForUser(ctx, userID, suggestionsCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cache.Suggestions.Set(ctx, userID, suggestions); err != nil {
+		log.Warn().Err(err).Int64("user_id", userID).Msg("Failed to set suggestions in cache")
+	}
+	return suggestions, nil
+}
+
+// forgetSuggestions drops the cached suggestions of a user whose follows
+// changed, so followed accounts are not suggested again
+func (app *application) forgetSuggestions(ctx context.Context, userID int64) {
+	if err := app.cache.Suggestions.Delete(ctx, userID); err != nil {
+		log.Warn().Err(err).Int64("user_id", userID).Msg("Failed to delete suggestions from cache")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetSuggestionsHandler(t *testing.T) {
+	suggestions := []store.Suggestion{
+		{UserID: 7, Username: "user7", Reason: store.SuggestionReasonFollowedByFollows, Score: 3, MutualsCount: 2},
+		{UserID: 8, Username: "user8", Reason: store.SuggestionReasonTags, Score: 2, Tags: []string{"go"}},
+		{UserID: 9, Username: "user9", Reason: store.SuggestionReasonActive, Score: 1},
+	}
+
+	get := func(t *testing.T, app *application, url string) (int, []store.Suggestion) {
+		t.Helper()
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, app.mount())
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil
+		}
+		var resp struct {
+			Data []store.Suggestion `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Code, resp.Data
+	}
+
+	newApp := func(t *testing.T) *application {
+		app := newTestApplication(t)
+		app.cache.User.(*cache.MockUserCache).On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+		app.store.Suggestion.(*store.MockSuggestionStore).Suggestions = suggestions
+		return app
+	}
+
+	t.Run("should compute and cache the suggestions on a miss", func(t *testing.T) {
+		app := newApp(t)
+		suggestionsCache := app.cache.Suggestions.(*cache.MockSuggestionsCache)
+		suggestionsCache.On("Get", mock.Anything, int64(42)).Return(nil, nil)
+		suggestionsCache.On("Set", mock.Anything, int64(42), suggestions).Return(nil)
+
+		code, got := get(t, app, "/v1/users/me/suggestions?limit=2")
+
+		if code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+		if len(got) != 2 || got[0].UserID != 7 || got[1].UserID != 8 {
+			t.Errorf("expected users 7 and 8 to be suggested, got %v", got)
+		}
+		suggestionsCache.AssertExpectations(t)
+	})
+
+	t.Run("should serve cached suggestions", func(t *testing.T) {
+		app := newApp(t)
+		suggestionsCache := app.cache.Suggestions.(*cache.MockSuggestionsCache)
+		suggestionsCache.On("Get", mock.Anything, int64(42)).Return(suggestions[2:], nil)
+
+		code, got := get(t, app, "/v1/users/me/suggestions")
+
+		if code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+		if len(got) != 1 || got[0].UserID != 9 {
+			t.Errorf("expected the cached suggestion of user 9, got %v", got)
+		}
+		if computed := app.store.Suggestion.(*store.MockSuggestionStore).Computed; computed != 0 {
+			t.Errorf("expected no suggestions to be computed, got %d", computed)
+		}
+		suggestionsCache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should compute the suggestions when the cache fails", func(t *testing.T) {
+		app := newApp(t)
+		suggestionsCache := app.cache.Suggestions.(*cache.MockSuggestionsCache)
+		suggestionsCache.On("Get", mock.Anything, int64(42)).Return(nil, errors.New("connection refused"))
+		suggestionsCache.On("Set", mock.Anything, int64(42), suggestions).Return(errors.New("connection refused"))
+
+		code, got := get(t, app, "/v1/users/me/suggestions")
+
+		if code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+		if len(got) != len(suggestions) {
+			t.Errorf("expected %d suggestions, got %v", len(suggestions), got)
+		}
+	})
+
+	for _, url := range []string{
+		"/v1/users/me/suggestions?limit=0",
+		"/v1/users/me/suggestions?limit=51",
+		"/v1/users/me/suggestions?limit=ten",
+	} {
+		t.Run("should reject "+url, func(t *testing.T) {
+			code, _ := get(t, newApp(t), url)
+			if code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, code)
+			}
+		})
+	}
+}
+
+func TestForgetSuggestions(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		users  []int64
+	}{
+		{"should forget my suggestions when I unfollow a user", http.MethodPut, "/v1/users/7/unfollow", []int64{42}},
+		{"should forget the suggestions of both users of a block", http.MethodPut, "/v1/users/7/block", []int64{42, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			mux := app.mount()
+			testToken, err := app.authenticator.GenerateToken(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.cache.User.(*cache.MockUserCache).On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+			suggestionsCache := app.cache.Suggestions.(*cache.MockSuggestionsCache)
+			suggestionsCache.On("Delete", mock.Anything, mock.Anything).Return(nil)
+
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code >= http.StatusBadRequest {
+				t.Fatalf("expected success, got status code %d", rr.Code)
+			}
+			suggestionsCache.AssertNumberOfCalls(t, "Delete", len(tt.users))
+			for _, id := range tt.users {
+				suggestionsCache.AssertCalled(t, "Delete", mock.Anything, id)
+			}
+		})
+	}
+}
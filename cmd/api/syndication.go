@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dubass83/go_social/internal/entities"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/dubass83/go_social/internal/syndication"
+	"github.com/go-chi/chi/v5"
+)
+
+// syndicationItems is the number of latest posts in a feed document
+const syndicationItems = 50
+
+// UserSyndicationHandler godoc
+//
+//	@Summary		Subscribe to a user
+//	@Description	the latest posts of a user as RSS 2.0, Atom or JSON Feed 1.1 for feed readers. Anonymous readers only get public posts. Supports conditional GET with If-None-Match and If-Modified-Since
+//	@Tags			FEEDS
+//	@Produce		xml,json
+//	@Param			userID				path	int		true	"User ID"
+//	@Param			If-None-Match		header	string	false	"ETag of the copy the reader has"
+//	@Param			If-Modified-Since	header	string	false	"Last-Modified of the copy the reader has"
+//	@Success		200
+//	@Success		304
+//	@Header			200	{string}	ETag			"Version of the feed"
+//	@Header			200	{string}	Last-Modified	"Time the newest post was published or edited"
+//	@Failure		400	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/users/{userID}/feed.rss [get]
+//	@Router			/users/{userID}/feed.atom [get]
+//	@Router			/users/{userID}/feed.json [get]
+func (app *application) UserSyndicationHandler(format syndication.Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+		if err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+
+		user, err := app.store.User.GetByID(r.Context(), userID)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				notFoundResponse(w, r, err)
+			default:
+				internalServerError(w, r, err)
+			}
+			return
+		}
+
+		posts, err := app.store.Post.GetUserPosts(r.Context(), userID, getViewerID(r), syndicationQuery(nil))
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+
+		app.writeSyndication(w, r, format, posts, &syndication.Feed{
+			Title:       fmt.Sprintf("%s on GO Social", user.Username),
+			Description: fmt.Sprintf("Posts by %s", user.Username),
+			Link:        fmt.Sprintf("%s/users/%d", app.config.frontendURL, user.ID),
+		})
+	}
+}
+
+// TagSyndicationHandler godoc
+//
+//	@Summary		Subscribe to a tag
+//	@Description	the latest posts with a tag as RSS 2.0, Atom or JSON Feed 1.1 for feed readers. Anonymous readers only get public posts. Supports conditional GET with If-None-Match and If-Modified-Since
+//	@Tags			FEEDS
+//	@Produce		xml,json
+//	@Param			tag					path	string	true	"Tag, without #"
+//	@Param			If-None-Match		header	string	false	"ETag of the copy the reader has"
+//	@Param			If-Modified-Since	header	string	false	"Last-Modified of the copy the reader has"
+//	@Success		200
+//	@Success		304
+//	@Header			200	{string}	ETag			"Version of the feed"
+//	@Header			200	{string}	Last-Modified	"Time the newest post was published or edited"
+//	@Failure		400	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/tags/{tag}/feed.rss [get]
+//	@Router			/tags/{tag}/feed.atom [get]
+//	@Router			/tags/{tag}/feed.json [get]
+func (app *application) TagSyndicationHandler(format syndication.Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag, ok := entities.NormalizeTag(chi.URLParam(r, "tag"))
+		if !ok {
+			badRequestResponse(w, r, fmt.Errorf("%q is not a valid tag", chi.URLParam(r, "tag")))
+			return
+		}
+
+		posts, err := app.store.Post.GetAllPosts(r.Context(), getViewerID(r), syndicationQuery([]string{tag}))
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+
+		app.writeSyndication(w, r, format, posts, &syndication.Feed{
+			Title:       fmt.Sprintf("#%s on GO Social", tag),
+			Description: fmt.Sprintf("Posts tagged #%s", tag),
+			Link:        app.config.frontendURL,
+		})
+	}
+}
+
+func syndicationQuery(tags []string) store.PaginatedFeedQuery {
+	return store.PaginatedFeedQuery{
+		Limit: syndicationItems,
+		Sort:  "desc",
+		Tags:  tags,
+	}
+}
+
+// writeSyndication fills the feed with the posts and writes it in the
+// format, or answers 304 when the reader's copy is still current
+func (app *application) writeSyndication(w http.ResponseWriter, r *http.Request, format syndication.Format, posts []*store.PostWithMetadata, feed *syndication.Feed) {
+	feed.FeedURL = fmt.Sprintf("http://%s%s", app.config.apiURL, r.URL.Path)
+
+	// the version of a feed changes with the posts it holds and their edits
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s|", format, feed.Title)
+
+	for _, post := range posts {
+		fmt.Fprintf(hash, "%d:%d|", post.ID, post.Version)
+
+		item := syndication.Item{
+			URL:     fmt.Sprintf("%s/posts/%d", app.config.frontendURL, post.ID),
+			Title:   post.Title,
+			Content: post.Content,
+			Author:  post.User.Username,
+			Tags:    post.Tags,
+		}
+		if post.PublishAt != nil {
+			item.Published = *post.PublishAt
+		}
+		item.Updated = item.Published
+		if updated, err := time.Parse(time.RFC3339Nano, post.UpdatedAt); err == nil && updated.After(item.Updated) {
+			item.Updated = updated
+		}
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	etag := `W/"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Authorization")
+	if !feed.Updated.IsZero() {
+		w.Header().Set("Last-Modified", feed.Updated.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, feed.Updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var doc bytes.Buffer
+	if err := feed.Write(&doc, format); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc.Bytes())
+}
+
+// notModified reports whether the reader's copy, identified by the
+// If-None-Match or else the If-Modified-Since header, is still current
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/store"
+)
+
+func TestUserSyndicationHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	publishAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	post := &store.PostWithMetadata{Post: store.Post{
+		ID:         1,
+		UserID:     7,
+		Title:      "title",
+		Content:    "content",
+		Version:    1,
+		Status:     store.PostStatusPublished,
+		PublishAt:  &publishAt,
+		UpdatedAt:  publishAt.Format(time.RFC3339Nano),
+		Visibility: store.PostVisibilityPublic,
+	}}
+	app.store.Post.(*store.MockPostStore).Listed = []*store.PostWithMetadata{post}
+
+	get := func(t *testing.T, ifModifiedSince string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/7/feed.atom", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	resp := get(t, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	lastModified := resp.Header.Get("Last-Modified")
+	if want := publishAt.Format(http.TimeFormat); lastModified != want {
+		t.Errorf("expected Last-Modified %s, got %s", want, lastModified)
+	}
+
+	t.Run("should answer 304 while the posts are unchanged", func(t *testing.T) {
+		if resp := get(t, lastModified); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("expected status code %d, got %d", http.StatusNotModified, resp.StatusCode)
+		}
+	})
+
+	t.Run("should serve the feed again once a post is edited", func(t *testing.T) {
+		editedAt := publishAt.Add(time.Hour)
+		post.Version = 2
+		post.Content = "edited"
+		post.UpdatedAt = editedAt.Format(time.RFC3339Nano)
+
+		resp := get(t, lastModified)
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if got, want := resp.Header.Get("Last-Modified"), editedAt.Format(http.TimeFormat); got != want {
+			t.Errorf("expected Last-Modified %s, got %s", want, got)
+		}
+	})
+}
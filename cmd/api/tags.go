@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dubass83/go_social/internal/entities"
+	"github.com/go-chi/chi/v5"
+)
+
+// FollowTagHandler godoc
+//
+//	@Summary		Follow a tag
+//	@Description	follow a tag, with or without its leading # (URL-encoded as %23), posts tagged with it show up in the feed with source tag
+//	@Tags			TAGS
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag	path	string	true	"Tag"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [put]
+func (app *application) FollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := entities.NormalizeTag(chi.URLParam(r, "tag"))
+	if !ok {
+		badRequestResponse(w, r, fmt.Errorf("%q is not a valid tag", chi.URLParam(r, "tag")))
+		return
+	}
+	user := getUserFromCtx(r)
+
+	if err := app.store.TagFollow.Follow(r.Context(), user.ID, tag); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	app.forgetSuggestions(r.Context(), user.ID)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UnfollowTagHandler godoc
+//
+//	@Summary		Unfollow a tag
+//	@Description	stop following a tag
+//	@Tags			TAGS
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag	path	string	true	"Tag"
+//	@Success		202
+//	@Failure		400	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/follow [delete]
+func (app *application) UnfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := entities.NormalizeTag(chi.URLParam(r, "tag"))
+	if !ok {
+		badRequestResponse(w, r, fmt.Errorf("%q is not a valid tag", chi.URLParam(r, "tag")))
+		return
+	}
+	user := getUserFromCtx(r)
+
+	if err := app.store.TagFollow.Unfollow(r.Context(), user.ID, tag); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+	app.forgetSuggestions(r.Context(), user.ID)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetFollowedTagsHandler godoc
+//
+//	@Summary		Get my followed tags
+//	@Description	list the tags the current user follows, latest first
+//	@Tags			TAGS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.FollowedTag
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tags [get]
+func (app *application) GetFollowedTagsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	tags, err := app.store.TagFollow.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFollowTagHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	suggestionsCache := app.cache.Suggestions.(*cache.MockSuggestionsCache)
+	suggestionsCache.On("Delete", mock.Anything, int64(42)).Return(nil)
+
+	request := func(t *testing.T, method, url string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(req, mux).Code
+	}
+
+	followed := func(t *testing.T) []string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/tags", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var body struct {
+			Data []store.FollowedTag `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		tags := []string{}
+		for _, tag := range body.Data {
+			tags = append(tags, tag.Tag)
+		}
+		return tags
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+		tags   []string
+	}{
+		{"should follow a tag", http.MethodPut, "/v1/tags/rust/follow", http.StatusAccepted, []string{"rust"}},
+		{"should follow a tag with its # in lower case", http.MethodPut, "/v1/tags/%23Go/follow", http.StatusAccepted, []string{"go", "rust"}},
+		{"should follow a tag once", http.MethodPut, "/v1/tags/go/follow", http.StatusAccepted, []string{"go", "rust"}},
+		{"should reject a tag of digits", http.MethodPut, "/v1/tags/2024/follow", http.StatusBadRequest, []string{"go", "rust"}},
+		{"should reject a tag with spaces", http.MethodPut, "/v1/tags/two%20words/follow", http.StatusBadRequest, []string{"go", "rust"}},
+		{"should unfollow a tag", http.MethodDelete, "/v1/tags/%23RUST/follow", http.StatusAccepted, []string{"go"}},
+		{"should unfollow a tag that is not followed", http.MethodDelete, "/v1/tags/rust/follow", http.StatusAccepted, []string{"go"}},
+		{"should reject unfollowing an invalid tag", http.MethodDelete, "/v1/tags/go-lang/follow", http.StatusBadRequest, []string{"go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := request(t, tt.method, tt.url); code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, code)
+			}
+			if got := followed(t); !slices.Equal(got, tt.tags) {
+				t.Errorf("expected the followed tags %v, got %v", tt.tags, got)
+			}
+		})
+	}
+
+	// every accepted follow and unfollow forgets the suggestions
+	suggestionsCache.AssertNumberOfCalls(t, "Delete", 5)
+}
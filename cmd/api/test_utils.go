@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dubass83/go_social/internal/auth"
 	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/events"
 	"github.com/dubass83/go_social/internal/store"
+	"github.com/dubass83/go_social/internal/webhooks"
 )
 
 func newTestApplication(t *testing.T) *application {
@@ -16,11 +20,20 @@ func newTestApplication(t *testing.T) *application {
 	mockStorage := store.NewMockStorage()
 	mockCache := cache.NewMockStoreCache()
 	testAuth := &auth.TestAuthenticator{}
+	streams, closeStreams := context.WithCancel(context.Background())
+	t.Cleanup(closeStreams)
 
 	return &application{
-		store:         mockStorage,
-		cache:         mockCache,
-		authenticator: testAuth,
+		store:             mockStorage,
+		cache:             mockCache,
+		authenticator:     testAuth,
+		unsubscribeSigner: auth.NewSigner("test", "unsubscribe"),
+		mediaSigner:       auth.NewSigner("test", "media"),
+		events:            events.NewBroker(events.Config{HistorySize: 10, HistoryTTL: time.Minute, BufferSize: 10}, nil),
+		gateway:           newGateway("", events.NewMemoryPresence(time.Minute)),
+		webhookClient:     webhooks.NewClient(time.Second, nil),
+		streams:           streams,
+		closeStreams:      closeStreams,
 	}
 }
 
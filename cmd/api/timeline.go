@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// timelineJob is a change to the materialized home timelines
+type timelineJob struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// timelineFanout runs timeline jobs in the background. Jobs with the same
+// key run on the same worker in the order they were queued, so following
+// and unfollowing a user can not overtake each other.
+type timelineFanout struct {
+	queues []chan timelineJob
+}
+
+func newTimelineFanout(workers, queueSize int) *timelineFanout {
+	tf := &timelineFanout{queues: make([]chan timelineJob, max(workers, 1))}
+	for i := range tf.queues {
+		tf.queues[i] = make(chan timelineJob, queueSize)
+	}
+	return tf
+}
+
+// run starts the workers, they stop once ctx is cancelled
+func (tf *timelineFanout) run(ctx context.Context) {
+	for _, queue := range tf.queues {
+		go func(queue chan timelineJob) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-queue:
+					if err := job.run(ctx); err != nil {
+						log.Error().Err(err).Str("job", job.name).Msg("timeline fan-out failed")
+					}
+				}
+			}
+		}(queue)
+	}
+	log.Info().Msgf("timeline fan-out started with %d workers", len(tf.queues))
+}
+
+// enqueue queues a job, giving up after a second when the queue stays full.
+// Timelines missing a dropped job are fixed by a rebuild.
+func (tf *timelineFanout) enqueue(key int64, name string, run func(ctx context.Context) error) {
+	if tf == nil {
+		return
+	}
+	queue := tf.queues[uint64(key)%uint64(len(tf.queues))]
+	select {
+	case queue <- timelineJob{name: name, run: run}:
+	case <-time.After(time.Second):
+		log.Error().Str("job", name).Msg("timeline fan-out queue is full, dropping job")
+	}
+}
+
+func (app *application) fanOutPost(post *store.Post) {
+	app.timeline.enqueue(post.UserID, "post", func(ctx context.Context) error {
+		return app.store.Timeline.AddPost(ctx, post, app.config.timeline.maxFollowers)
+	})
+}
+
+func (app *application) fanOutRepost(userID, postID int64) {
+	app.timeline.enqueue(userID, "repost", func(ctx context.Context) error {
+		return app.store.Timeline.AddRepost(ctx, userID, postID, app.config.timeline.maxFollowers)
+	})
+}
+
+func (app *application) fanOutUndoRepost(userID, postID int64) {
+	app.timeline.enqueue(userID, "undo repost", func(ctx context.Context) error {
+		return app.store.Timeline.RemoveRepost(ctx, userID, postID)
+	})
+}
+
+func (app *application) fanOutFollow(userID, followID int64) {
+	app.timeline.enqueue(userID, "follow", func(ctx context.Context) error {
+		return app.store.Timeline.AddFollow(ctx, userID, followID, app.config.timeline.backfill)
+	})
+}
+
+func (app *application) fanOutUnfollow(userID, followID int64) {
+	app.timeline.enqueue(userID, "unfollow", func(ctx context.Context) error {
+		return app.store.Timeline.RemoveFollow(ctx, userID, followID)
+	})
+}
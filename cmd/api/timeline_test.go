@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTimelineFanout(t *testing.T) {
+	t.Run("should run the jobs of a key in the order they were queued", func(t *testing.T) {
+		tf := newTimelineFanout(3, 100)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tf.run(ctx)
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		done := map[int64][]int{}
+		for i := range 20 {
+			for key := int64(1); key <= 5; key++ {
+				wg.Add(1)
+				tf.enqueue(key, "test", func(ctx context.Context) error {
+					defer wg.Done()
+					mu.Lock()
+					defer mu.Unlock()
+					done[key] = append(done[key], i)
+					return nil
+				})
+			}
+		}
+		wg.Wait()
+
+		for key, order := range done {
+			if !slices.IsSorted(order) || len(order) != 20 {
+				t.Errorf("expected the 20 jobs of key %d in order, got %v", key, order)
+			}
+		}
+	})
+
+	t.Run("should do nothing without a fan-out", func(t *testing.T) {
+		var tf *timelineFanout
+		tf.enqueue(1, "test", func(ctx context.Context) error {
+			t.Error("expected the job not to run")
+			return nil
+		})
+	})
+}
+
+func TestTimelineFanoutHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	app.timeline = newTimelineFanout(4, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.timeline.run(ctx)
+
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	app.cache.Suggestions.(*cache.MockSuggestionsCache).On("Delete", mock.Anything, int64(42)).Return(nil)
+
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{http.MethodPut, "/v1/users/7/follow"},
+		{http.MethodPut, "/v1/posts/1/repost"},
+		{http.MethodPut, "/v1/users/7/unfollow"},
+		{http.MethodDelete, "/v1/posts/1/repost"},
+		{http.MethodPut, "/v1/users/7/follow"},
+	}
+	for _, r := range requests {
+		req, err := http.NewRequest(r.method, r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s: expected success, got status code %d", r.method, r.url, rr.Code)
+		}
+	}
+
+	// the changes of a user are applied one after another, so following
+	// again after unfollowing leaves the posts in the timeline
+	want := []string{"follow 42 7", "repost 42 1", "unfollow 42 7", "undo repost 42 1", "follow 42 7"}
+	timeline := app.store.Timeline.(*store.MockTimelineStore)
+	deadline := time.Now().Add(time.Second)
+	for len(timeline.Calls()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := timeline.Calls(); !slices.Equal(got, want) {
+		t.Errorf("expected timeline changes %v, got %v", want, got)
+	}
+}
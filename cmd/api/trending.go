@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+var trendingQueryDefault = store.TrendingQuery{
+	Window: "day",
+	Limit:  10,
+	Offset: 0,
+}
+
+// GetTrendingTagsHandler godoc
+//
+//	@Summary		Get trending tags
+//	@Description	return the tags of public posts with the most recent activity within the window, scored by posts, comments and reposts that count less the older they are. Scores are refreshed in the background every TRENDING_REFRESH_INTERVAL
+//	@Tags			TRENDING
+//	@Accept			json
+//	@Produce		json
+//	@Param			window	query		string	false	"Sliding window (hour/day/week)"	default(day)
+//	@Param			limit	query		int		false	"Limit number of tags"				default(10)
+//	@Param			offset	query		int		false	"Offset for pagination"				default(0)
+//	@Success		200		{object}	[]store.TrendingTag
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/trending/tags [get]
+func (app *application) GetTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tq, err := trendingQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(tq); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	tags, err := app.store.Trending.GetTags(r.Context(), tq)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetTrendingPostsHandler godoc
+//
+//	@Summary		Get trending posts
+//	@Description	return the public posts with the most comments, reposts and quotes within the window, recent activity counting more. Scores are refreshed in the background every TRENDING_REFRESH_INTERVAL
+//	@Tags			TRENDING
+//	@Accept			json
+//	@Produce		json
+//	@Param			window	query		string	false	"Sliding window (hour/day/week)"	default(day)
+//	@Param			limit	query		int		false	"Limit number of posts"				default(10)
+//	@Param			offset	query		int		false	"Offset for pagination"				default(0)
+//	@Success		200		{object}	[]*store.PostWithMetadata
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/trending/posts [get]
+func (app *application) GetTrendingPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tq, err := trendingQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+	if err := validate.Struct(tq); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Trending.GetPosts(r.Context(), getViewerID(r), tq)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// runTrendingRefresher recomputes the trending scores of every window right
+// away and then periodically. It runs until ctx is cancelled.
+func (app *application) runTrendingRefresher(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trending.interval)
+	defer ticker.Stop()
+
+	log.Info().Msgf("trending refresher started with interval %s", app.config.trending.interval)
+	for {
+		app.refreshTrending(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("trending refresher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) refreshTrending(ctx context.Context) {
+	for window, length := range store.TrendingWindows {
+		start := time.Now()
+		if err := app.store.Trending.Refresh(ctx, window, length); err != nil {
+			log.Error().Err(err).Str("window", window).Msg("failed to refresh trending scores")
+			continue
+		}
+		log.Debug().Str("window", window).Dur("took", time.Since(start)).Msg("trending scores refreshed")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dubass83/go_social/internal/store"
+)
+
+func TestGetTrendingTagsHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+
+	app.store.Trending.(*store.MockTrendingStore).Tags = map[string][]store.TrendingTag{
+		"day": {
+			{Tag: "rust", Score: 2.5, PostsCount: 1},
+			{Tag: "go", Score: 7, PostsCount: 3},
+			{Tag: "zig", Score: 2.5, PostsCount: 2},
+			{Tag: "c", Score: 0.5, PostsCount: 1},
+		},
+		"week": {
+			{Tag: "go", Score: 20, PostsCount: 9},
+		},
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want []string
+	}{
+		{"should list the tags of the day by score", "/v1/trending/tags", []string{"go", "rust", "zig", "c"}},
+		{"should page through the tags", "/v1/trending/tags?limit=2&offset=1", []string{"rust", "zig"}},
+		{"should list the tags of another window", "/v1/trending/tags?window=week", []string{"go"}},
+		{"should list no tags of a window without activity", "/v1/trending/tags?window=hour", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+			var resp struct {
+				Data []store.TrendingTag `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, tag := range resp.Data {
+				got = append(got, tag.Tag)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected %v, got %v", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+
+	for _, url := range []string{
+		"/v1/trending/tags?window=month",
+		"/v1/trending/tags?limit=0",
+		"/v1/trending/tags?limit=101",
+		"/v1/trending/posts?offset=-1",
+	} {
+		t.Run("should reject "+url, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRefreshTrending(t *testing.T) {
+	app := newTestApplication(t)
+	trending := app.store.Trending.(*store.MockTrendingStore)
+
+	app.refreshTrending(context.Background())
+
+	if len(trending.Refreshed) != len(store.TrendingWindows) {
+		t.Fatalf("expected %d windows to be refreshed, got %v", len(store.TrendingWindows), trending.Refreshed)
+	}
+	for window, length := range store.TrendingWindows {
+		if trending.Refreshed[window] != length {
+			t.Errorf("expected window %s to be refreshed over %s, got %s", window, length, trending.Refreshed[window])
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/dubass83/go_social/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -14,20 +16,45 @@ const UserCtxKey UserKey = "user"
 // GetUserByIDHandler godoc
 //
 //	@Summary		Get a user
-//	@Description	get user by ID
+//	@Description	get the public profile of a user, without their email and account details
 //	@Tags			USERS
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
+//	@Success		200	{object}	store.PublicUser
 //	@Failure		400	{object}	map[string]string
 //	@Failure		404	{object}	map[string]string
 //	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
 //	@Router			/users/{id} [get]
 func (app *application) GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
-	user := getUserFromCtx(r)
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.User.GetByID(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+	// accounts that were never activated have no profile to show
+	if !user.Active {
+		notFoundResponse(w, r, fmt.Errorf("user %d is not active", user.ID))
+		return
+	}
+	if err := app.attachAvatar(r.Context(), user); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, user.Public()); err != nil {
 		internalServerError(w, r, err)
 	}
 
@@ -36,7 +63,7 @@ func (app *application) GetUserByIDHandler(w http.ResponseWriter, r *http.Reques
 // GetUsersPostsHandler godoc
 //
 //	@Summary		Get a users posts
-//	@Description	Fetch all posts authored by a specific user, for display on their profile page.
+//	@Description	Fetch the posts authored by a specific user that the current user is allowed to see, for display on their profile page. Pinned posts come first and are flagged with pinned.
 //	@Tags			USERS
 //	@Accept			json
 //	@Produce		json
@@ -69,11 +96,16 @@ func (app *application) GetUsersPostsHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	user := getUserFromCtx(r)
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
 
-	posts, err := app.store.Post.GetUserPosts(r.Context(), user.ID, pgPostsQuery)
+	posts, err := app.store.Post.GetUserPosts(r.Context(), userID, getViewerID(r), pgPostsQuery)
 	if err != nil {
 		internalServerError(w, r, err)
+		return
 	}
 
 	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
@@ -82,6 +114,53 @@ func (app *application) GetUsersPostsHandler(w http.ResponseWriter, r *http.Requ
 
 }
 
+// GetUserDraftsHandler godoc
+//
+//	@Summary		Get my drafts
+//	@Description	Fetch the drafts and scheduled posts of the current user.
+//	@Tags			USERS
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit number of posts"	default(10)
+//	@Param			offset	query		int		false	"Offset for pagination"	default(0)
+//	@Param			sort	query		string	false	"Sort order (asc/desc)"	default(desc)
+//	@Param			search	query		string	false	"Search query"
+//	@Success		200		{object}	[]*store.PostWithMetadata
+//	@Failure		400		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/drafts [get]
+func (app *application) GetUserDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	pgPostsQueryDefault := store.PaginatedFeedQuery{
+		Limit:  10,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	pgPostsQuery, err := pgPostsQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(pgPostsQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	posts, err := app.store.Post.GetUserDrafts(r.Context(), user.ID, pgPostsQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
 // activateUserHandler godoc
 //
 //	@Summary		Activate a user
@@ -145,3 +224,11 @@ func getUserFromCtx(r *http.Request) *store.User {
 	user := r.Context().Value(UserCtxKey).(*store.User)
 	return user
 }
+
+// getViewerID returns the ID of the authenticated user, or 0 for anonymous requests
+func getViewerID(r *http.Request) int64 {
+	if user, ok := r.Context().Value(UserCtxKey).(*store.User); ok {
+		return user.ID
+	}
+	return 0
+}
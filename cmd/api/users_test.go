@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/dubass83/go_social/internal/cache"
@@ -82,3 +84,105 @@ func TestGetUserByIDHandler(t *testing.T) {
 		mockCacheStore.ExpectedCalls = nil // Reset the expected calls to avoid interference with other tests
 	})
 }
+
+func TestGetUserByIDHandlerHidesAccountDetails(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	defer func() {
+		mockCacheStore.Calls = nil
+		mockCacheStore.ExpectedCalls = nil
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	rr := executeRequest(req, mux)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data["id"] != float64(7) {
+		t.Errorf("expected user 7, got %v", body.Data["id"])
+	}
+	for _, field := range []string{"email", "activation_token", "role_id", "active"} {
+		if _, ok := body.Data[field]; ok {
+			t.Errorf("expected %s to be hidden", field)
+		}
+	}
+}
+
+func TestUpdateProfileHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+	mockCacheStore.On("Delete", mock.Anything, int64(42)).Return(nil)
+	defer func() {
+		mockCacheStore.Calls = nil
+		mockCacheStore.ExpectedCalls = nil
+	}()
+
+	tests := []struct {
+		name        string
+		payload     string
+		code        int
+		displayName string
+	}{
+		{"updates the profile", `{"display_name":"  Ada  ","links":["https://example.com"]}`, http.StatusOK, "Ada"},
+		{"clears fields and keeps the others", `{"bio":"","links":[]}`, http.StatusOK, ""},
+		{"refuses long display names", `{"display_name":"` + strings.Repeat("a", 51) + `"}`, http.StatusBadRequest, ""},
+		{"refuses long bios", `{"bio":"` + strings.Repeat("a", 301) + `"}`, http.StatusBadRequest, ""},
+		{"refuses links that are not URLs", `{"links":["javascript:alert(1)"]}`, http.StatusBadRequest, ""},
+		{"refuses too many links", `{"links":["http://a.io","http://b.io","http://c.io","http://d.io","http://e.io","http://f.io"]}`, http.StatusBadRequest, ""},
+		{"refuses the email", `{"email":"x@example.com"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+			if rr.Code != tt.code {
+				t.Fatalf("expected status code %d, got %d: %s", tt.code, rr.Code, rr.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data store.User `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.DisplayName != tt.displayName {
+				t.Errorf("expected display name %q, got %q", tt.displayName, body.Data.DisplayName)
+			}
+		})
+	}
+	mockCacheStore.AssertNumberOfCalls(t, "Delete", 2)
+}
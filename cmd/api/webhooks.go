@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dubass83/go_social/internal/events"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/dubass83/go_social/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+type webhookKey string
+
+const webhookCTX webhookKey = "webhook"
+
+type CreateWebhookPayload struct {
+	URL        string   `json:"url" validate:"required,http_url,max=2000"`
+	EventTypes []string `json:"event_types" validate:"required,min=1,max=10,dive,oneof=post.created comment.created reaction notification user.followed"`
+	// AllUsers receives the events of every user, admins only
+	AllUsers bool `json:"all_users"`
+}
+
+type UpdateWebhookPayload struct {
+	URL        *string  `json:"url" validate:"omitempty,http_url,max=2000"`
+	EventTypes []string `json:"event_types" validate:"omitempty,min=1,max=10,dive,oneof=post.created comment.created reaction notification user.followed"`
+	// Active enables a webhook again after it was disabled for failing
+	Active *bool `json:"active"`
+}
+
+// CreateWebhookHandler godoc
+//
+//	@Summary		Register a webhook
+//	@Description	register an endpoint receiving signed POSTs of my events of some types (post.created, comment.created, reaction, notification, user.followed). Admins may set all_users to receive the events of every user. Endpoints on loopback, private or link-local addresses are refused. The secret deliveries are signed with is only returned here
+//	@Tags			WEBHOOKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhook	body		CreateWebhookPayload	true	"Webhook"
+//	@Success		201		{object}	store.Webhook
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [post]
+func (app *application) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := app.webhookClient.CheckURL(ctx, payload.URL); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.AllUsers {
+		allowed, err := app.store.Role.IsPrecedent(ctx, user.RoleID, "admin")
+		if err != nil {
+			internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			forbiddenResponse(w, r, fmt.Errorf("user %d lacks the admin role to receive the events of all users", user.ID))
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	webhook := &store.Webhook{
+		UserID:     user.ID,
+		URL:        payload.URL,
+		Secret:     secret,
+		EventTypes: payload.EventTypes,
+		AllUsers:   payload.AllUsers,
+	}
+	if err := app.store.Webhook.Create(ctx, webhook); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, webhook); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetWebhooksHandler godoc
+//
+//	@Summary		Get my webhooks
+//	@Description	list my webhooks, a webhook disabled after failing too often has active false and disabled_at set
+//	@Tags			WEBHOOKS
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	[]store.Webhook
+//	@Failure		500	{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [get]
+func (app *application) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	hooks, err := app.store.Webhook.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, hooks); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// UpdateWebhookHandler godoc
+//
+//	@Summary		Update a webhook
+//	@Description	change the URL or event types of my webhook, or set active to disable it or enable it again
+//	@Tags			WEBHOOKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookID	path		int						true	"Webhook ID"
+//	@Param			webhook		body		UpdateWebhookPayload	true	"Changes"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		400			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [patch]
+func (app *application) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	var payload UpdateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if payload.URL != nil {
+		if err := app.webhookClient.CheckURL(r.Context(), *payload.URL); err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+		webhook.URL = *payload.URL
+	}
+	if payload.EventTypes != nil {
+		webhook.EventTypes = payload.EventTypes
+	}
+	if payload.Active != nil {
+		webhook.Active = *payload.Active
+	}
+
+	if err := app.store.Webhook.Update(r.Context(), webhook); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			notFoundResponse(w, r, err)
+		default:
+			internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, webhook); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// DeleteWebhookHandler godoc
+//
+//	@Summary		Delete a webhook
+//	@Description	delete my webhook together with its delivery log
+//	@Tags			WEBHOOKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		200			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [delete]
+func (app *application) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	if err := app.store.Webhook.Delete(r.Context(), webhook.ID); err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"message": fmt.Sprintf("webhook with id %d was deleted", webhook.ID),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// GetWebhookDeliveriesHandler godoc
+//
+//	@Summary		Get the deliveries of a webhook
+//	@Description	list the deliveries of my webhook, newest first, with their status, attempts and last response. The next page is linked in the Link header
+//	@Tags			WEBHOOKS
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhookID	path		int		true	"Webhook ID"
+//	@Param			limit		query		int		false	"Limit number of deliveries"	default(20)
+//	@Param			cursor		query		string	false	"Cursor of the page"
+//	@Success		200			{object}	[]store.WebhookDelivery
+//	@Header			200			{string}	Link	"Link to the next page"
+//	@Failure		400			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/deliveries [get]
+func (app *application) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	cursorQueryDefault := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	cursorQuery, err := cursorQueryDefault.Parse(r)
+	if err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(cursorQuery); err != nil {
+		badRequestResponse(w, r, err)
+		return
+	}
+
+	deliveries, next, err := app.store.Webhook.GetDeliveries(r.Context(), webhook.ID, cursorQuery)
+	if err != nil {
+		internalServerError(w, r, err)
+		return
+	}
+
+	writeNextLink(w, r, next)
+	if err := app.jsonResponse(w, http.StatusOK, deliveries); err != nil {
+		internalServerError(w, r, err)
+	}
+}
+
+// webhookContextMiddleware loads the webhook of the URL, webhooks of other
+// users are not found
+func (app *application) webhookContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+		if err != nil {
+			badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		webhook, err := app.store.Webhook.GetByID(ctx, id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				notFoundResponse(w, r, err)
+				return
+			}
+			internalServerError(w, r, err)
+			return
+		}
+		if webhook.UserID != getUserFromCtx(r).ID {
+			notFoundResponse(w, r, fmt.Errorf("webhook %d is not found", id))
+			return
+		}
+
+		ctx = context.WithValue(ctx, webhookCTX, webhook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getWebhookFromCtx(r *http.Request) *store.Webhook {
+	webhook, _ := r.Context().Value(webhookCTX).(*store.Webhook)
+	return webhook
+}
+
+// enqueueWebhooks queues an event published to users for the webhooks
+// subscribed to it, failures are only logged
+func (app *application) enqueueWebhooks(ctx context.Context, ev events.Event) {
+	// topic events like typing and presence are only for connected clients
+	if app.store.Webhook == nil || len(ev.UserIDs) == 0 || ev.Topic != "" {
+		return
+	}
+
+	payload := webhooks.Payload{
+		ID:        uuid.NewString(),
+		Type:      ev.Type,
+		CreatedAt: time.Now().UTC(),
+		Data:      ev.Data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal webhook payload")
+		return
+	}
+
+	if _, err := app.store.Webhook.Enqueue(ctx, payload.ID, payload.Type, ev.UserIDs, body); err != nil {
+		log.Error().Err(err).Str("type", ev.Type).Msg("failed to enqueue webhook deliveries")
+	}
+}
+
+// runWebhookDispatcher delivers the due webhook deliveries every interval
+// until ctx is cancelled
+func (app *application) runWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(app.config.webhook.interval)
+	defer ticker.Stop()
+
+	log.Info().Msgf("webhook dispatcher started with interval %s", app.config.webhook.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			app.dispatchWebhooks(ctx)
+		}
+	}
+}
+
+// dispatchWebhooks delivers a batch of due deliveries concurrently. They are
+// leased for a little longer than a delivery may take, so a replica going
+// away mid-delivery only delays them.
+func (app *application) dispatchWebhooks(ctx context.Context) {
+	conf := app.config.webhook
+	deliveries, err := app.store.Webhook.ClaimDue(ctx, conf.batchSize, 2*conf.timeout)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to claim webhook deliveries")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.deliverWebhook(ctx, d)
+		}()
+	}
+	wg.Wait()
+}
+
+// deliverWebhook attempts a delivery once and records the outcome, failures
+// are retried with exponential backoff until maxAttempts
+func (app *application) deliverWebhook(ctx context.Context, d *store.WebhookDelivery) {
+	conf := app.config.webhook
+
+	code, err := app.webhookClient.Deliver(ctx, d.URL, d.Secret, d.EventID, d.EventType, d.Payload)
+	if err == nil {
+		if err := app.store.Webhook.RecordSuccess(ctx, d, code); err != nil {
+			log.Error().Err(err).Int64("delivery_id", d.ID).Msg("failed to record webhook delivery")
+		}
+		return
+	}
+
+	attempts := d.Attempts + 1
+	var next *time.Time
+	if attempts < conf.maxAttempts {
+		at := time.Now().Add(webhooks.Backoff(attempts, conf.retryBase, conf.retryMax))
+		next = &at
+	}
+	disabled, err := app.store.Webhook.RecordFailure(ctx, d, code, err.Error(), next, conf.disableAfter)
+	if err != nil {
+		log.Error().Err(err).Int64("delivery_id", d.ID).Msg("failed to record webhook delivery")
+		return
+	}
+	if disabled {
+		log.Warn().Int64("webhook_id", d.WebhookID).Msg("webhook disabled after repeated failures")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dubass83/go_social/internal/cache"
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/dubass83/go_social/internal/webhooks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateWebhookHandler(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(&store.User{ID: 42}, nil)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"should reject a missing URL", `{"event_types": ["post.created"]}`},
+		{"should reject a URL that is not HTTP", `{"url": "ftp://example.com", "event_types": ["post.created"]}`},
+		{"should reject no event types", `{"url": "https://example.com/hooks", "event_types": []}`},
+		{"should reject an unknown event type", `{"url": "https://example.com/hooks", "event_types": ["typing"]}`},
+		{"should reject a loopback URL", `{"url": "http://127.0.0.1:8080/hooks", "event_types": ["post.created"]}`},
+		{"should reject a metadata URL", `{"url": "http://169.254.169.254/latest/meta-data", "event_types": ["post.created"]}`},
+		{"should reject a private URL", `{"url": "http://10.0.0.5/hooks", "event_types": ["post.created"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestCreateWebhookHandlerAllUsers(t *testing.T) {
+	app := newTestApplication(t)
+	mux := app.mount()
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &store.User{ID: 42}
+	mockCacheStore := app.cache.User.(*cache.MockUserCache)
+	mockCacheStore.On("Get", mock.Anything, int64(42)).Return(user, nil)
+	app.webhookClient = webhooks.NewClient(time.Second, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+
+	tests := []struct {
+		name   string
+		roleID int
+		body   string
+		want   int
+	}{
+		{"should not let a user receive the events of every user", 1, `{"url": "http://127.0.0.1:8080/hooks", "event_types": ["post.created"], "all_users": true}`, http.StatusForbidden},
+		{"should not let a moderator receive the events of every user", 2, `{"url": "http://127.0.0.1:8080/hooks", "event_types": ["post.created"], "all_users": true}`, http.StatusForbidden},
+		{"should let an admin receive the events of every user", 3, `{"url": "http://127.0.0.1:8080/hooks", "event_types": ["post.created"], "all_users": true}`, http.StatusCreated},
+		{"should let a user receive their own events", 1, `{"url": "http://127.0.0.1:8080/hooks", "event_types": ["post.created"]}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user.RoleID = tt.roleID
+			req, err := http.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected status code %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	if created := app.store.Webhook.(*store.MockWebhookStore).Webhooks; len(created) != 2 {
+		t.Errorf("expected only the allowed webhooks to be created, got %d", len(created))
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer receiver.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	app := newTestApplication(t)
+	app.config.webhook = webhookConf{maxAttempts: 3, disableAfter: 4, retryBase: time.Minute, retryMax: time.Hour}
+	app.webhookClient = webhooks.NewClient(time.Second, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	webhookStore := app.store.Webhook.(*store.MockWebhookStore)
+	if err := webhookStore.Create(context.Background(), &store.Webhook{UserID: 42}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		attempts  int
+		wantCode  int
+		wantOK    bool
+		wantRetry time.Duration
+	}{
+		{"should record a delivery the receiver took", receiver.URL + "?code=204", 0, http.StatusNoContent, true, 0},
+		{"should retry after an error of the receiver", receiver.URL + "?code=500", 0, http.StatusInternalServerError, false, time.Minute},
+		{"should retry later after every failed attempt", receiver.URL + "?code=503", 1, http.StatusServiceUnavailable, false, 2 * time.Minute},
+		{"should retry when the receiver can not be reached", closed.URL, 0, 0, false, time.Minute},
+		{"should give up after the last attempt", receiver.URL + "?code=500", 2, http.StatusInternalServerError, false, 0},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &store.WebhookDelivery{ID: int64(i + 1), WebhookID: 1, EventID: "1", EventType: "post.created", Payload: []byte(`{}`), Attempts: tt.attempts, URL: tt.url, Secret: "secret"}
+			start := time.Now()
+
+			app.deliverWebhook(context.Background(), d)
+
+			attempts := webhookStore.Attempts
+			if len(attempts) != i+1 || attempts[i].DeliveryID != d.ID {
+				t.Fatalf("expected the attempt of delivery %d to be recorded, got %+v", d.ID, attempts)
+			}
+			got := attempts[i]
+			if got.Succeeded != tt.wantOK || got.StatusCode != tt.wantCode {
+				t.Errorf("expected success %v with status code %d, got %v with %d", tt.wantOK, tt.wantCode, got.Succeeded, got.StatusCode)
+			}
+			switch {
+			case tt.wantRetry == 0 && got.NextAttempt != nil:
+				t.Errorf("expected no retry, got one at %v", got.NextAttempt)
+			case tt.wantRetry != 0 && (got.NextAttempt == nil || got.NextAttempt.Before(start.Add(tt.wantRetry)) || got.NextAttempt.After(time.Now().Add(tt.wantRetry))):
+				t.Errorf("expected a retry in %s, got %v", tt.wantRetry, got.NextAttempt)
+			}
+		})
+	}
+
+	// the last 4 attempts failed in a row
+	if w := webhookStore.Webhooks[0]; w.Active || w.DisabledAt == nil {
+		t.Errorf("expected the webhook to be disabled after 4 failures, got %+v", w)
+	}
+}
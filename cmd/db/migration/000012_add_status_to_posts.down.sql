@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_posts_status_publish_at;
+
+ALTER TABLE posts
+DROP COLUMN publish_at,
+DROP COLUMN status;
@@ -0,0 +1,9 @@
+ALTER TABLE posts
+ADD COLUMN status varchar(20) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published')),
+ADD COLUMN publish_at timestamp(0) with time zone;
+
+-- everything that exists today was published when it was created
+UPDATE posts SET publish_at = created_at;
+
+CREATE INDEX IF NOT EXISTS idx_posts_status_publish_at ON posts (status, publish_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_followers_follow_id;
+DROP TABLE IF EXISTS post_mentions;
+
+ALTER TABLE posts
+DROP COLUMN visibility;
@@ -0,0 +1,16 @@
+ALTER TABLE posts
+ADD COLUMN visibility varchar(20) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'followers', 'mentioned'));
+
+-- users mentioned in a post, they can always see it
+CREATE TABLE IF NOT EXISTS post_mentions (
+  post_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+
+  PRIMARY KEY (post_id, user_id),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follow_id ON followers (follow_id);
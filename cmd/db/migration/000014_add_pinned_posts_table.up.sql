@@ -0,0 +1,11 @@
+-- a post can only be pinned by its author, so it is pinned at most once
+CREATE TABLE IF NOT EXISTS pinned_posts (
+  post_id BIGINT PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_posts_user_id ON pinned_posts (user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS bookmarks (
+  user_id BIGINT NOT NULL,
+  post_id BIGINT NOT NULL,
+  -- name of the collection, empty for the default one
+  collection varchar(100) NOT NULL DEFAULT '',
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, post_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user_id_created_at ON bookmarks (user_id, created_at DESC, post_id DESC);
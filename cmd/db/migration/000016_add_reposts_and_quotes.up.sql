@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS reposts (
+  user_id BIGINT NOT NULL,
+  post_id BIGINT NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, post_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reposts_post_id ON reposts (post_id);
+
+-- no foreign key on purpose: a quote outlives the post it quotes and is
+-- then shown with the quoted post as unavailable
+ALTER TABLE posts ADD COLUMN quoted_post_id BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_posts_quoted_post_id ON posts (quoted_post_id);
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS hashtags (
+  id bigserial PRIMARY KEY,
+  -- lower case, without the leading #
+  name varchar(100) NOT NULL UNIQUE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS post_hashtags (
+  post_id BIGINT NOT NULL,
+  hashtag_id BIGINT NOT NULL,
+
+  PRIMARY KEY (post_id, hashtag_id),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (hashtag_id) REFERENCES hashtags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_hashtags_hashtag_id ON post_hashtags (hashtag_id);
+
+CREATE TABLE IF NOT EXISTS comment_mentions (
+  comment_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+
+  PRIMARY KEY (comment_id, user_id),
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_user_id ON comment_mentions (user_id);
+
+CREATE TABLE IF NOT EXISTS comment_hashtags (
+  comment_id BIGINT NOT NULL,
+  hashtag_id BIGINT NOT NULL,
+
+  PRIMARY KEY (comment_id, hashtag_id),
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+  FOREIGN KEY (hashtag_id) REFERENCES hashtags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_hashtags_hashtag_id ON comment_hashtags (hashtag_id);
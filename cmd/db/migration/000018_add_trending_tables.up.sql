@@ -0,0 +1,28 @@
+-- scores computed by the trending job, one set per sliding window
+CREATE TABLE IF NOT EXISTS trending_tags (
+  time_window varchar(10) NOT NULL,
+  tag varchar(100) NOT NULL,
+  score double precision NOT NULL,
+  posts_count int NOT NULL,
+  refreshed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (time_window, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_tags_score ON trending_tags (time_window, score DESC);
+
+CREATE TABLE IF NOT EXISTS trending_posts (
+  time_window varchar(10) NOT NULL,
+  post_id BIGINT NOT NULL,
+  score double precision NOT NULL,
+  refreshed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (time_window, post_id),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_posts_score ON trending_posts (time_window, score DESC);
+
+-- the job looks up recent activity
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at);
+CREATE INDEX IF NOT EXISTS idx_reposts_created_at ON reposts (created_at);
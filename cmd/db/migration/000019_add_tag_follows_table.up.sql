@@ -0,0 +1,10 @@
+-- hashtags a user follows, posts tagged with them show up in the feed
+CREATE TABLE IF NOT EXISTS tag_follows (
+  user_id BIGINT NOT NULL,
+  -- lower case, without the leading #
+  tag varchar(100) NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, tag),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_reposts_user_id_created_at;
+DROP INDEX IF EXISTS idx_posts_user_id_publish_at;
+
+DROP TABLE IF EXISTS timeline_pull_authors;
+DROP TABLE IF EXISTS timeline_entries;
@@ -0,0 +1,30 @@
+-- materialized home timelines filled by the fan-out worker
+CREATE TABLE IF NOT EXISTS timeline_entries (
+  user_id BIGINT NOT NULL,
+  post_id BIGINT NOT NULL,
+  -- own, following or repost
+  source varchar(20) NOT NULL,
+  reposted_by BIGINT,
+  activity_at TIMESTAMP(0) with time zone NOT NULL,
+
+  PRIMARY KEY (user_id, post_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (reposted_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timeline_entries_user_id_activity_at ON timeline_entries (user_id, activity_at DESC);
+CREATE INDEX IF NOT EXISTS idx_timeline_entries_reposted_by ON timeline_entries (reposted_by);
+
+-- authors with too many followers to fan out to, their posts are pulled
+-- into the timelines when they are read
+CREATE TABLE IF NOT EXISTS timeline_pull_authors (
+  user_id BIGINT PRIMARY KEY,
+  followers_count int NOT NULL,
+  updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_publish_at ON posts (user_id, publish_at DESC);
+CREATE INDEX IF NOT EXISTS idx_reposts_user_id_created_at ON reposts (user_id, created_at DESC);
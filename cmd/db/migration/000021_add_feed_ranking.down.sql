@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS feed_sessions;
+DROP TABLE IF EXISTS feed_ranking_weights;
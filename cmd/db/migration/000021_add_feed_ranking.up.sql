@@ -0,0 +1,26 @@
+-- weights of the ranked feed, a single row tuned at runtime by admins
+CREATE TABLE IF NOT EXISTS feed_ranking_weights (
+  id boolean PRIMARY KEY DEFAULT TRUE CHECK (id),
+  recency double precision NOT NULL,
+  affinity double precision NOT NULL,
+  engagement double precision NOT NULL,
+  tags double precision NOT NULL,
+  half_life_hours double precision NOT NULL CHECK (half_life_hours > 0),
+  updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO feed_ranking_weights (recency, affinity, engagement, tags, half_life_hours)
+VALUES (3, 1, 1, 0.5, 12)
+ON CONFLICT DO NOTHING;
+
+-- ranked feed snapshots, so paging through a ranked feed is stable
+CREATE TABLE IF NOT EXISTS feed_sessions (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id BIGINT NOT NULL,
+  post_ids BIGINT[] NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_feed_sessions_created_at ON feed_sessions (created_at);
@@ -0,0 +1,23 @@
+-- notifications are grouped: unread notifications of the same kind about the
+-- same post (or every unread follow) are one row listing who acted
+CREATE TABLE IF NOT EXISTS notifications (
+  id bigserial PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  kind VARCHAR(20) NOT NULL,
+  group_key VARCHAR(100) NOT NULL,
+  post_id BIGINT,
+  comment_id BIGINT,
+  -- who acted, most recent first
+  actor_ids BIGINT[] NOT NULL,
+  read_at TIMESTAMP(0) with time zone,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+-- only one unread group per key, new activity is added to it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group ON notifications (user_id, group_key) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_updated ON notifications (user_id, updated_at DESC, id DESC);
@@ -0,0 +1,20 @@
+-- how each kind of notification reaches a user, kinds without a row are
+-- delivered in-app
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id BIGINT NOT NULL,
+  kind VARCHAR(20) NOT NULL,
+  channel VARCHAR(10) NOT NULL CHECK (channel IN ('in_app', 'email', 'none')),
+
+  PRIMARY KEY (user_id, kind),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- how often the notifications sent by email are summed up, users without a
+-- row get a daily digest
+CREATE TABLE IF NOT EXISTS notification_digests (
+  user_id BIGINT PRIMARY KEY,
+  frequency VARCHAR(10) NOT NULL DEFAULT 'daily' CHECK (frequency IN ('daily', 'weekly', 'off')),
+  sent_at TIMESTAMP(0) with time zone,
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,41 @@
+-- endpoints users registered to receive events, admins may register ones
+-- receiving the events of every user
+CREATE TABLE IF NOT EXISTS webhooks (
+  id bigserial PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  event_types TEXT[] NOT NULL,
+  all_users BOOLEAN NOT NULL DEFAULT FALSE,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  -- failed deliveries since the last successful one
+  failure_count INT NOT NULL DEFAULT 0,
+  disabled_at TIMESTAMP(0) with time zone,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_event_types ON webhooks USING gin (event_types) WHERE active;
+
+-- every delivery of an event to a webhook and its attempts so far
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id bigserial PRIMARY KEY,
+  webhook_id BIGINT NOT NULL,
+  event_id uuid NOT NULL,
+  event_type VARCHAR(50) NOT NULL,
+  payload jsonb NOT NULL,
+  status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  last_status_code INT,
+  last_error TEXT,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  delivered_at TIMESTAMP(0) with time zone,
+
+  FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at DESC, id DESC);
@@ -0,0 +1,63 @@
+-- users whose messages a user does not want, blocks work both ways
+CREATE TABLE IF NOT EXISTS user_blocks (
+  user_id BIGINT NOT NULL,
+  blocked_id BIGINT NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, blocked_id),
+  CHECK (user_id <> blocked_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+-- users without a row take messages from everyone
+CREATE TABLE IF NOT EXISTS message_settings (
+  user_id BIGINT PRIMARY KEY,
+  followed_only BOOLEAN NOT NULL DEFAULT FALSE,
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS conversations (
+  id bigserial PRIMARY KEY,
+  -- "lowID:highID" of the two members of a 1:1 conversation, so there is
+  -- only one per pair, NULL for groups
+  direct_key VARCHAR(50) UNIQUE,
+  title VARCHAR(100),
+  created_by BIGINT,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  -- when the last message was sent
+  updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+  conversation_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  -- the last message the member has read, the read receipt
+  last_read_id BIGINT NOT NULL DEFAULT 0,
+  last_read_at TIMESTAMP(0) with time zone,
+  joined_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (conversation_id, user_id),
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id ON conversation_members (user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+  id bigserial PRIMARY KEY,
+  conversation_id BIGINT NOT NULL,
+  sender_id BIGINT NOT NULL,
+  content TEXT NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+  FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (conversation_id, created_at DESC, id DESC);
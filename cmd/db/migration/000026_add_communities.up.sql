@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS communities (
+  id bigserial PRIMARY KEY,
+  name citext NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- the roles of members within a community, ranked by level like the roles
+-- of users
+CREATE TABLE IF NOT EXISTS community_roles (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL UNIQUE,
+  level INT NOT NULL DEFAULT 0,
+  description TEXT
+);
+
+INSERT INTO community_roles (name, level, description) VALUES ('owner', 10, 'Community owner');
+INSERT INTO community_roles (name, level, description) VALUES ('moderator', 5, 'Community moderator');
+INSERT INTO community_roles (name, level, description) VALUES ('member', 1, 'Community member');
+
+CREATE TABLE IF NOT EXISTS community_members (
+  community_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  role_id BIGINT NOT NULL,
+  joined_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (community_id, user_id),
+  FOREIGN KEY (community_id) REFERENCES communities(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (role_id) REFERENCES community_roles(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_community_members_user_id ON community_members (user_id);
+
+ALTER TABLE posts ADD COLUMN community_id BIGINT REFERENCES communities(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_community_id ON posts (community_id, publish_at DESC) WHERE community_id IS NOT NULL;
@@ -0,0 +1,25 @@
+-- named lists of accounts curated by a user, private ones are only visible
+-- to their owner
+CREATE TABLE IF NOT EXISTS lists (
+  id bigserial PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  private BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_lists_user_id ON lists (user_id);
+
+CREATE TABLE IF NOT EXISTS list_members (
+  list_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (list_id, user_id),
+  FOREIGN KEY (list_id) REFERENCES lists(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
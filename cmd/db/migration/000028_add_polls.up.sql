@@ -0,0 +1,50 @@
+-- a post carries at most one poll, closed_at is set once the scheduler
+-- found it expired
+CREATE TABLE IF NOT EXISTS polls (
+  id bigserial PRIMARY KEY,
+  post_id BIGINT NOT NULL UNIQUE,
+  multiple BOOLEAN NOT NULL DEFAULT FALSE,
+  expires_at TIMESTAMP(0) with time zone NOT NULL,
+  closed_at TIMESTAMP(0) with time zone,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_polls_expires_at ON polls (expires_at) WHERE closed_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS poll_options (
+  id bigserial PRIMARY KEY,
+  poll_id BIGINT NOT NULL,
+  position INT NOT NULL,
+  text VARCHAR(100) NOT NULL,
+
+  UNIQUE (poll_id, position),
+  -- lets the choices of a vote reference an option of the same poll
+  UNIQUE (id, poll_id),
+  FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE
+);
+
+-- one vote per user and poll
+CREATE TABLE IF NOT EXISTS poll_votes (
+  poll_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (poll_id, user_id),
+  FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- the options of a vote, several ones for multiple choice polls
+CREATE TABLE IF NOT EXISTS poll_vote_choices (
+  poll_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  option_id BIGINT NOT NULL,
+
+  PRIMARY KEY (poll_id, user_id, option_id),
+  FOREIGN KEY (poll_id, user_id) REFERENCES poll_votes(poll_id, user_id) ON DELETE CASCADE,
+  FOREIGN KEY (option_id, poll_id) REFERENCES poll_options(id, poll_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_vote_choices_option_id ON poll_vote_choices (option_id);
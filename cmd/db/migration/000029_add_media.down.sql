@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS comment_media;
+DROP TABLE IF EXISTS post_media;
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,38 @@
+-- files users uploaded, the file itself is kept in the blob store under key
+CREATE TABLE IF NOT EXISTS media (
+  id bigserial PRIMARY KEY,
+  user_id BIGINT NOT NULL,
+  key TEXT NOT NULL UNIQUE,
+  content_type VARCHAR(100) NOT NULL,
+  size BIGINT NOT NULL,
+  filename VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media (user_id);
+
+CREATE TABLE IF NOT EXISTS post_media (
+  post_id BIGINT NOT NULL,
+  media_id BIGINT NOT NULL,
+  position INT NOT NULL,
+
+  PRIMARY KEY (post_id, media_id),
+  FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+  FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_media_media_id ON post_media (media_id);
+
+CREATE TABLE IF NOT EXISTS comment_media (
+  comment_id BIGINT NOT NULL,
+  media_id BIGINT NOT NULL,
+  position INT NOT NULL,
+
+  PRIMARY KEY (comment_id, media_id),
+  FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+  FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_media_media_id ON comment_media (media_id);
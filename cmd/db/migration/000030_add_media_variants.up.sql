@@ -0,0 +1,28 @@
+-- images are processed in the background after they are uploaded: their
+-- metadata is stripped and smaller variants are generated
+ALTER TABLE media
+  ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'ready' CHECK (status IN ('processing', 'ready', 'failed')),
+  ADD COLUMN IF NOT EXISTS width INT,
+  ADD COLUMN IF NOT EXISTS height INT,
+  ADD COLUMN IF NOT EXISTS blurhash VARCHAR(100),
+  ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS process_after TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW();
+
+-- images uploaded before still carry their metadata
+UPDATE media SET status = 'processing' WHERE content_type LIKE 'image/%';
+
+CREATE INDEX IF NOT EXISTS idx_media_processing ON media (process_after) WHERE status = 'processing';
+
+-- sizes derived from an image, kept in the blob store next to the original
+CREATE TABLE IF NOT EXISTS media_variants (
+  media_id BIGINT NOT NULL,
+  name VARCHAR(20) NOT NULL,
+  key TEXT NOT NULL UNIQUE,
+  content_type VARCHAR(100) NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  size BIGINT NOT NULL,
+
+  PRIMARY KEY (media_id, name),
+  FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+-- profile fields users fill in themselves, the avatar is an uploaded image
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS display_name VARCHAR(50) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS bio VARCHAR(300) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS location VARCHAR(100) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS links TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS avatar_id BIGINT REFERENCES media(id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- backfilled entries can not be told apart from fanned out ones, the
+-- timelines keep them; 000020 down drops the table with everything in it
+SELECT 1;
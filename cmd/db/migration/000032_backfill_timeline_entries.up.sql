@@ -0,0 +1,40 @@
+-- timelines of users who existed before they were materialized start out
+-- like a rebuild with the default TIMELINE_BACKFILL would leave them: the
+-- latest 50 posts and reposts of their own and of every followed author
+-- that is fanned out to
+
+-- posts go in first so they win over reposts of the same post
+WITH authors AS (
+  SELECT f.user_id, f.follow_id AS author_id FROM followers f
+  WHERE NOT EXISTS (SELECT 1 FROM timeline_pull_authors pa WHERE pa.user_id = f.follow_id)
+  UNION
+  SELECT id, id FROM users
+)
+INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+SELECT a.user_id, lp.id, CASE WHEN a.author_id = a.user_id THEN 'own' ELSE 'following' END, NULL, lp.publish_at
+FROM authors a
+CROSS JOIN LATERAL (
+  SELECT p.id, p.publish_at FROM posts p
+  WHERE p.user_id = a.author_id AND p.status = 'published' AND p.publish_at <= NOW()
+  ORDER BY p.publish_at DESC
+  LIMIT 50
+) lp
+ON CONFLICT DO NOTHING;
+
+WITH authors AS (
+  SELECT f.user_id, f.follow_id AS author_id FROM followers f
+  WHERE NOT EXISTS (SELECT 1 FROM timeline_pull_authors pa WHERE pa.user_id = f.follow_id)
+  UNION
+  SELECT id, id FROM users
+)
+INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+SELECT DISTINCT ON (a.user_id, lr.post_id) a.user_id, lr.post_id, 'repost', lr.user_id, lr.created_at
+FROM authors a
+CROSS JOIN LATERAL (
+  SELECT r.post_id, r.user_id, r.created_at FROM reposts r
+  WHERE r.user_id = a.author_id
+  ORDER BY r.created_at DESC
+  LIMIT 50
+) lr
+ORDER BY a.user_id, lr.post_id, lr.created_at DESC
+ON CONFLICT DO NOTHING;
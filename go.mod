@@ -3,6 +3,7 @@ module github.com/dubass83/go_social
 go 1.24.6
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/derektata/lorem v0.0.2
 	github.com/go-chi/chi/v5 v5.2.2
 	github.com/go-chi/cors v1.2.2
@@ -10,6 +11,7 @@ require (
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.9
 	github.com/rs/zerolog v1.34.0
 	github.com/stretchr/testify v1.11.1
@@ -18,6 +20,7 @@ require (
 	github.com/vanng822/go-premailer v1.25.0
 	github.com/wneessen/go-mail v0.7.2
 	golang.org/x/crypto v0.42.0
+	golang.org/x/image v0.25.0
 )
 
 require (
@@ -0,0 +1,26 @@
+package auth
+
+import "testing"
+
+func TestSigner(t *testing.T) {
+	s := NewSigner("secret", "unsubscribe")
+	token := s.Sign("42")
+
+	payload, err := s.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload != "42" {
+		t.Errorf("expected the payload 42, got %q", payload)
+	}
+
+	if _, err := NewSigner("secret", "other").Verify(token); err == nil {
+		t.Error("expected a token signed for another purpose to be rejected")
+	}
+	if _, err := s.Verify(s.Sign("43")[:4] + token[4:]); err == nil {
+		t.Error("expected a tampered token to be rejected")
+	}
+	if _, err := s.Verify("garbage"); err == nil {
+		t.Error("expected a malformed token to be rejected")
+	}
+}
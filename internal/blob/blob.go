@@ -0,0 +1,34 @@
+// Package blob stores the files users upload. Files are addressed by keys
+// like "media/42/3f2b….jpg" and kept either on the local filesystem or in
+// an S3-compatible object store such as AWS S3 or MinIO.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps files by key
+type BlobStore interface {
+	// Put stores size bytes of r under key, replacing what was there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the file under key, ErrNotFound when there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key, deleting a missing file is not
+	// an error
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that would escape the store, like "../x" or "/x"
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
@@ -10,7 +10,8 @@ import (
 
 func NewMockStoreCache() *StoreCache {
 	return &StoreCache{
-		User: &MockUserCache{},
+		User:        &MockUserCache{},
+		Suggestions: &MockSuggestionsCache{},
 	}
 }
 
@@ -31,3 +32,29 @@ func (muc *MockUserCache) Set(ctx context.Context, user *store.User) error {
 	args := muc.Called(ctx, user)
 	return args.Error(0)
 }
+func (muc *MockUserCache) Delete(ctx context.Context, id int64) error {
+	args := muc.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockSuggestionsCache struct {
+	mock.Mock
+}
+
+func (msc *MockSuggestionsCache) Get(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	args := msc.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.Suggestion), args.Error(1)
+}
+
+func (msc *MockSuggestionsCache) Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error {
+	args := msc.Called(ctx, userID, suggestions)
+	return args.Error(0)
+}
+
+func (msc *MockSuggestionsCache) Delete(ctx context.Context, userID int64) error {
+	args := msc.Called(ctx, userID)
+	return args.Error(0)
+}
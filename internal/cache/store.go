@@ -11,11 +11,18 @@ type StoreCache struct {
 	User interface {
 		Get(ctx context.Context, id int64) (*store.User, error)
 		Set(ctx context.Context, user *store.User) error
+		Delete(ctx context.Context, id int64) error
+	}
+	Suggestions interface {
+		Get(ctx context.Context, userID int64) ([]store.Suggestion, error)
+		Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error
+		Delete(ctx context.Context, userID int64) error
 	}
 }
 
 func NewStoreCache(rdb *redis.Client) *StoreCache {
 	return &StoreCache{
-		User: NewUserCache(rdb),
+		User:        NewUserCache(rdb),
+		Suggestions: NewSuggestionsCache(rdb),
 	}
 }
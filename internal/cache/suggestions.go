@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dubass83/go_social/internal/store"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SuggestionsKeyPrefix is the prefix for follow suggestion cache keys
+	SuggestionsKeyPrefix = "suggestions:"
+	// SuggestionsCacheTTL is the default TTL for cached suggestions
+	SuggestionsCacheTTL = 30 * time.Minute
+)
+
+type suggestionsCache struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewSuggestionsCache creates a new cache of the follow suggestions of each
+// user with the provided Redis client and default TTL
+func NewSuggestionsCache(rdb *redis.Client) *suggestionsCache {
+	return &suggestionsCache{
+		rdb: rdb,
+		ttl: SuggestionsCacheTTL,
+	}
+}
+
+// getSuggestionsKey generates a Redis key for the suggestions of a user ID
+func (sch *suggestionsCache) getSuggestionsKey(userID int64) string {
+	return SuggestionsKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+func (sch *suggestionsCache) Get(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	// If Redis client is not configured, return cache miss
+	if sch.rdb == nil {
+		return nil, nil
+	}
+
+	key := sch.getSuggestionsKey(userID)
+
+	data, err := sch.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		log.Debug().Str("key", key).Msg("Cache miss")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggestions from cache: %w", err)
+	}
+
+	suggestions := []store.Suggestion{}
+	if err := json.Unmarshal(data, &suggestions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal suggestions from cache: %w", err)
+	}
+
+	log.Debug().Int64("user_id", userID).Msg("Cache hit")
+	return suggestions, nil
+}
+
+func (sch *suggestionsCache) Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error {
+	// If Redis client is not configured, silently skip
+	if sch.rdb == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(suggestions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal suggestions for cache: %w", err)
+	}
+
+	if err := sch.rdb.Set(ctx, sch.getSuggestionsKey(userID), data, sch.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set suggestions in cache: %w", err)
+	}
+	return nil
+}
+
+// Delete drops the cached suggestions of a user, e.g. after following
+// someone who should not be suggested anymore
+func (sch *suggestionsCache) Delete(ctx context.Context, userID int64) error {
+	if sch.rdb == nil {
+		return nil
+	}
+
+	if err := sch.rdb.Del(ctx, sch.getSuggestionsKey(userID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete suggestions from cache: %w", err)
+	}
+	return nil
+}
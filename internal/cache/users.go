@@ -89,3 +89,15 @@ func (uch *userCache) Set(ctx context.Context, user *store.User) error {
 	log.Debug().Int64("user_id", user.ID).Str("username", user.Username).Msg("User cached")
 	return nil
 }
+
+// Delete drops a cached user, e.g. after their profile changed
+func (uch *userCache) Delete(ctx context.Context, id int64) error {
+	if uch.rdb == nil {
+		return nil
+	}
+
+	if err := uch.rdb.Del(ctx, uch.getUserKey(id)).Err(); err != nil {
+		return fmt.Errorf("failed to delete user from cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package entities extracts @mentions and #hashtags from user content.
+package entities
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Offsets are counted in Unicode code points, End is exclusive and both
+// include the leading @ or #.
+
+type Mention struct {
+	Username string `json:"username"`
+	// UserID is 0 when no user goes by the username
+	UserID int64 `json:"user_id,omitempty"`
+	Start  int   `json:"start"`
+	End    int   `json:"end"`
+}
+
+type Hashtag struct {
+	// Tag is the normalized (lower case) hashtag without #
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type Entities struct {
+	Mentions []Mention `json:"mentions"`
+	Hashtags []Hashtag `json:"hashtags"`
+}
+
+var (
+	mentionRegexp = regexp.MustCompile(`(?:^|[^\w@])(@(\w{2,100}))`)
+	hashtagRegexp = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&])(#([\p{L}\p{N}_]{1,100}))`)
+	digitsRegexp  = regexp.MustCompile(`^[0-9]+$`)
+	tagRegexp     = regexp.MustCompile(`^[\p{L}\p{N}_]{1,100}$`)
+)
+
+// Parse returns the mentions and hashtags of content in order of appearance
+func Parse(content string) *Entities {
+	e := &Entities{
+		Mentions: []Mention{},
+		Hashtags: []Hashtag{},
+	}
+
+	for _, m := range mentionRegexp.FindAllStringSubmatchIndex(content, -1) {
+		e.Mentions = append(e.Mentions, Mention{
+			Username: content[m[4]:m[5]],
+			Start:    runeOffset(content, m[2]),
+			End:      runeOffset(content, m[3]),
+		})
+	}
+
+	for _, m := range hashtagRegexp.FindAllStringSubmatchIndex(content, -1) {
+		tag := content[m[4]:m[5]]
+		// #1 is a number, not a hashtag
+		if digitsRegexp.MatchString(tag) {
+			continue
+		}
+		e.Hashtags = append(e.Hashtags, Hashtag{
+			Tag:   strings.ToLower(tag),
+			Start: runeOffset(content, m[2]),
+			End:   runeOffset(content, m[3]),
+		})
+	}
+
+	return e
+}
+
+// NormalizeTag returns tag, with or without its leading #, the way hashtags
+// are stored, and false when it is not a valid hashtag
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.TrimPrefix(tag, "#")
+	if !tagRegexp.MatchString(tag) || digitsRegexp.MatchString(tag) {
+		return "", false
+	}
+	return strings.ToLower(tag), true
+}
+
+// Usernames returns the distinct mentioned usernames
+func (e *Entities) Usernames() []string {
+	usernames := []string{}
+	seen := map[string]bool{}
+	for _, m := range e.Mentions {
+		if !seen[m.Username] {
+			seen[m.Username] = true
+			usernames = append(usernames, m.Username)
+		}
+	}
+	return usernames
+}
+
+// Tags returns the distinct hashtags
+func (e *Entities) Tags() []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, h := range e.Hashtags {
+		if !seen[h.Tag] {
+			seen[h.Tag] = true
+			tags = append(tags, h.Tag)
+		}
+	}
+	return tags
+}
+
+// UserIDs returns the distinct IDs of the mentioned users that exist
+func (e *Entities) UserIDs() []int64 {
+	ids := []int64{}
+	seen := map[int64]bool{}
+	for _, m := range e.Mentions {
+		if m.UserID != 0 && !seen[m.UserID] {
+			seen[m.UserID] = true
+			ids = append(ids, m.UserID)
+		}
+	}
+	return ids
+}
+
+// MentionedSince returns the entities with only the mentions of users that
+// previous does not mention, previous may be nil
+func (e *Entities) MentionedSince(previous *Entities) *Entities {
+	if e == nil {
+		return nil
+	}
+	known := map[int64]bool{}
+	if previous != nil {
+		for _, id := range previous.UserIDs() {
+			known[id] = true
+		}
+	}
+	added := &Entities{Mentions: []Mention{}, Hashtags: e.Hashtags}
+	for _, m := range e.Mentions {
+		if !known[m.UserID] {
+			added.Mentions = append(added.Mentions, m)
+		}
+	}
+	return added
+}
+
+// ResolveMentions sets the user IDs of the mentions from usernames to IDs
+func (e *Entities) ResolveMentions(userIDs map[string]int64) {
+	for i := range e.Mentions {
+		e.Mentions[i].UserID = userIDs[e.Mentions[i].Username]
+	}
+}
+
+func runeOffset(s string, byteOffset int) int {
+	return utf8.RuneCountInString(s[:byteOffset])
+}
@@ -0,0 +1,94 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		content  string
+		mentions []Mention
+		hashtags []Hashtag
+	}{
+		{
+			content:  "no entities here",
+			mentions: []Mention{},
+			hashtags: []Hashtag{},
+		},
+		{
+			content: "@alice meet @bob_2 #Go",
+			mentions: []Mention{
+				{Username: "alice", Start: 0, End: 6},
+				{Username: "bob_2", Start: 12, End: 18},
+			},
+			hashtags: []Hashtag{{Tag: "go", Start: 19, End: 22}},
+		},
+		{
+			content:  "mail me@example.com, issue #42, a&#39;b, x#y",
+			mentions: []Mention{},
+			hashtags: []Hashtag{},
+		},
+		{
+			content:  "héllo #café (@carol)",
+			mentions: []Mention{{Username: "carol", Start: 13, End: 19}},
+			hashtags: []Hashtag{{Tag: "café", Start: 6, End: 11}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Parse(tt.content)
+		if !reflect.DeepEqual(got.Mentions, tt.mentions) {
+			t.Errorf("Parse(%q).Mentions = %+v, want %+v", tt.content, got.Mentions, tt.mentions)
+		}
+		if !reflect.DeepEqual(got.Hashtags, tt.hashtags) {
+			t.Errorf("Parse(%q).Hashtags = %+v, want %+v", tt.content, got.Hashtags, tt.hashtags)
+		}
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	e := Parse("@alice #Go @alice #go #rust")
+
+	if got, want := e.Usernames(), []string{"alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Usernames() = %v, want %v", got, want)
+	}
+	if got, want := e.Tags(), []string{"go", "rust"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+}
+
+func TestMentionedSince(t *testing.T) {
+	previous := Parse("hi @alice and @carol")
+	previous.ResolveMentions(map[string]int64{"alice": 1, "carol": 3})
+	e := Parse("hi @alice, @bob and @dave")
+	e.ResolveMentions(map[string]int64{"alice": 1, "bob": 2})
+
+	if got, want := e.MentionedSince(previous).UserIDs(), []int64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MentionedSince(previous).UserIDs() = %v, want %v", got, want)
+	}
+	if got, want := e.MentionedSince(nil).UserIDs(), []int64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MentionedSince(nil).UserIDs() = %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+		ok   bool
+	}{
+		{tag: "Go", want: "go", ok: true},
+		{tag: "#Café_2", want: "café_2", ok: true},
+		{tag: "42", ok: false},
+		{tag: "two words", ok: false},
+		{tag: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizeTag(tt.tag)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeTag(%q) = %q, %v, want %q, %v", tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package events delivers real-time events to the users they are meant for,
+// or to whoever subscribed to their topic. A Broker keeps the subscriptions
+// of the clients connected to this process and a short history of every
+// user's events, so reconnecting clients can resume where they left off.
+// With a Backend the events published on any replica reach the subscribers
+// of all of them.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Types of events
+const (
+	TypePostCreated    = "post.created"
+	TypeCommentCreated = "comment.created"
+	TypeReaction       = "reaction"
+	TypeNotification   = "notification"
+	TypeUserFollowed   = "user.followed"
+	TypeMessage        = "message"
+	TypeMessageRead    = "message.read"
+	TypePollClosed     = "poll.closed"
+	TypeMediaProcessed = "media.processed"
+	TypeTyping         = "typing"
+	TypePresence       = "presence"
+	// TypeReset tells a resuming client that some of its events are gone
+	// and it has to reload what it shows
+	TypeReset = "reset"
+)
+
+// Event is delivered to every subscription of the users in UserIDs and of
+// its Topic. Only user events are kept for resuming.
+type Event struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	UserIDs []int64         `json:"user_ids"`
+	Topic   string          `json:"topic,omitempty"`
+	Data    json.RawMessage `json:"data"`
+	// At is when the event was published
+	At time.Time `json:"at"`
+}
+
+// New creates an event of a type for the users, data is sent as JSON
+func New(typ string, data any, userIDs ...int64) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %w", typ, err)
+	}
+	return Event{Type: typ, UserIDs: userIDs, Data: raw}, nil
+}
+
+// NewTopic creates an event of a type for the subscribers of a topic
+func NewTopic(typ, topic string, data any) (Event, error) {
+	ev, err := New(typ, data)
+	ev.Topic = topic
+	return ev, err
+}
+
+// PostTopic is the topic of the live activity on a post
+func PostTopic(postID int64) string {
+	return "post:" + strconv.FormatInt(postID, 10)
+}
+
+// PresenceTopic is the topic of a user going online and offline
+func PresenceTopic(userID int64) string {
+	return "presence:" + strconv.FormatInt(userID, 10)
+}
+
+// Backend carries events between the replicas of the API
+type Backend interface {
+	// Publish sends the event to every replica, this one included
+	Publish(ctx context.Context, ev Event) error
+	// Receive calls deliver with the events published by any replica
+	// until ctx is cancelled
+	Receive(ctx context.Context, deliver func(Event)) error
+}
+
+// Config sizes the broker
+type Config struct {
+	// HistorySize events are kept per user for resuming clients
+	HistorySize int
+	// HistoryTTL is how long the events of a user are kept for resuming
+	HistoryTTL time.Duration
+	// BufferSize events are queued per subscription, a subscription that
+	// falls further behind is closed and has to resume
+	BufferSize int
+}
+
+// Subscription receives the events of a user or a topic until it is closed
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	userID int64
+	topic  string
+	closed bool
+}
+
+type Broker struct {
+	conf    Config
+	backend Backend
+	node    string
+	seq     atomic.Uint64
+
+	mu      sync.Mutex
+	subs    map[int64]map[*Subscription]struct{}
+	topics  map[string]map[*Subscription]struct{}
+	history map[int64][]Event
+}
+
+// NewBroker creates a broker, without a backend events only reach the
+// subscribers of this process
+func NewBroker(conf Config, backend Backend) *Broker {
+	node := make([]byte, 4)
+	rand.Read(node)
+
+	return &Broker{
+		conf:    conf,
+		backend: backend,
+		node:    hex.EncodeToString(node),
+		subs:    make(map[int64]map[*Subscription]struct{}),
+		topics:  make(map[string]map[*Subscription]struct{}),
+		history: make(map[int64][]Event),
+	}
+}
+
+// Run receives the events of the backend and prunes old history until ctx is
+// cancelled
+func (b *Broker) Run(ctx context.Context) {
+	if b.backend != nil {
+		go func() {
+			for {
+				err := b.backend.Receive(ctx, b.deliver)
+				if ctx.Err() != nil {
+					return
+				}
+				log.Error().Err(err).Msg("event backend failed, reconnecting")
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(b.conf.HistoryTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.pruneHistory(time.Now().Add(-b.conf.HistoryTTL))
+		}
+	}
+}
+
+// Publish assigns the event an ID and delivers it
+func (b *Broker) Publish(ctx context.Context, ev Event) error {
+	if len(ev.UserIDs) == 0 && ev.Topic == "" {
+		return nil
+	}
+	ev.ID = fmt.Sprintf("%x-%s-%x", time.Now().UnixMilli(), b.node, b.seq.Add(1))
+	ev.At = time.Now()
+
+	if b.backend != nil {
+		return b.backend.Publish(ctx, ev)
+	}
+	b.deliver(ev)
+	return nil
+}
+
+// Subscribe subscribes to the events of a user. With the ID of the last
+// event a client saw, the events after it are returned to be sent first;
+// resumed is false when that event is no longer known and some may be lost.
+func (b *Broker) Subscribe(userID int64, lastEventID string) (sub *Subscription, missed []Event, resumed bool) {
+	c := make(chan Event, b.conf.BufferSize)
+	sub = &Subscription{C: c, c: c, userID: userID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+	history := b.history[userID]
+	for i, ev := range history {
+		if ev.ID == lastEventID {
+			return sub, append([]Event{}, history[i+1:]...), true
+		}
+	}
+	return sub, nil, false
+}
+
+// SubscribeTopic subscribes to the events of a topic from now on
+func (b *Broker) SubscribeTopic(topic string) *Subscription {
+	c := make(chan Event, b.conf.BufferSize)
+	sub := &Subscription{C: c, c: c, topic: topic}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*Subscription]struct{})
+	}
+	b.topics[topic][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe closes the subscription
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closeLocked(sub)
+}
+
+func (b *Broker) closeLocked(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.c)
+	if sub.topic != "" {
+		delete(b.topics[sub.topic], sub)
+		if len(b.topics[sub.topic]) == 0 {
+			delete(b.topics, sub.topic)
+		}
+		return
+	}
+	delete(b.subs[sub.userID], sub)
+	if len(b.subs[sub.userID]) == 0 {
+		delete(b.subs, sub.userID)
+	}
+}
+
+// deliver records the event in the history of its users and hands it to
+// their subscriptions and the ones of its topic
+func (b *Broker) deliver(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.topics[ev.Topic] {
+		b.sendLocked(sub, ev)
+	}
+
+	for _, userID := range ev.UserIDs {
+		history := append(b.history[userID], ev)
+		if len(history) > b.conf.HistorySize {
+			history = history[len(history)-b.conf.HistorySize:]
+		}
+		b.history[userID] = history
+
+		for sub := range b.subs[userID] {
+			b.sendLocked(sub, ev)
+		}
+	}
+}
+
+// sendLocked hands the event to a subscription, closing it when it fell
+// too far behind
+func (b *Broker) sendLocked(sub *Subscription, ev Event) {
+	select {
+	case sub.c <- ev:
+	default:
+		log.Warn().Int64("user_id", sub.userID).Str("topic", sub.topic).Msg("event subscription is too slow, closing it")
+		b.closeLocked(sub)
+	}
+}
+
+// pruneHistory forgets the events published before a time
+func (b *Broker) pruneHistory(before time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for userID, history := range b.history {
+		i := 0
+		for i < len(history) && history[i].At.Before(before) {
+			i++
+		}
+		if i == len(history) {
+			delete(b.history, userID)
+			continue
+		}
+		b.history[userID] = history[i:]
+	}
+}
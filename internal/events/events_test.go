@@ -0,0 +1,162 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testBroker() *Broker {
+	return NewBroker(Config{HistorySize: 3, HistoryTTL: time.Minute, BufferSize: 2}, nil)
+}
+
+func publish(t *testing.T, b *Broker, typ string, userIDs ...int64) {
+	t.Helper()
+	ev, err := New(typ, map[string]string{"type": typ}, userIDs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription was closed")
+		}
+		return ev
+	default:
+		t.Fatal("no event was delivered")
+	}
+	return Event{}
+}
+
+func TestPublishReachesTheUsers(t *testing.T) {
+	b := testBroker()
+	alice, _, _ := b.Subscribe(1, "")
+	bob, _, _ := b.Subscribe(2, "")
+
+	publish(t, b, TypePostCreated, 1)
+
+	if ev := receive(t, alice); ev.Type != TypePostCreated || ev.ID == "" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if len(bob.C) != 0 {
+		t.Error("the event reached a user it was not meant for")
+	}
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	b := testBroker()
+	sub, _, _ := b.Subscribe(1, "")
+	publish(t, b, TypePostCreated, 1)
+	first := receive(t, sub)
+	b.Unsubscribe(sub)
+
+	publish(t, b, TypeCommentCreated, 1)
+	publish(t, b, TypeReaction, 1)
+
+	_, missed, resumed := b.Subscribe(1, first.ID)
+	if !resumed {
+		t.Fatal("expected to resume after a known event")
+	}
+	if len(missed) != 2 || missed[0].Type != TypeCommentCreated || missed[1].Type != TypeReaction {
+		t.Errorf("unexpected missed events %+v", missed)
+	}
+
+	// the history only holds the last 3 events
+	publish(t, b, TypeNotification, 1)
+	publish(t, b, TypeNotification, 1)
+	if _, missed, resumed := b.Subscribe(1, first.ID); resumed || len(missed) != 0 {
+		t.Errorf("expected a forgotten event not to resume, got %d missed", len(missed))
+	}
+}
+
+func TestSlowSubscriptionIsClosed(t *testing.T) {
+	b := testBroker()
+	sub, _, _ := b.Subscribe(1, "")
+
+	for range 3 {
+		publish(t, b, TypePostCreated, 1)
+	}
+
+	for range 2 {
+		receive(t, sub)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("expected the subscription to be closed")
+	}
+	// closing twice is fine
+	b.Unsubscribe(sub)
+}
+
+func TestPruneHistory(t *testing.T) {
+	b := testBroker()
+	publish(t, b, TypePostCreated, 1)
+
+	b.pruneHistory(time.Now().Add(time.Second))
+	if len(b.history) != 0 {
+		t.Errorf("expected the history to be empty, got %v", b.history)
+	}
+}
+
+func TestSubscribeTopic(t *testing.T) {
+	b := testBroker()
+	watcher := b.SubscribeTopic(PostTopic(7))
+	other := b.SubscribeTopic(PostTopic(8))
+
+	ev, err := NewTopic(TypeTyping, PostTopic(7), map[string]int64{"user_id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := receive(t, watcher); got.Topic != PostTopic(7) || got.Type != TypeTyping {
+		t.Errorf("unexpected event %+v", got)
+	}
+	if len(other.C) != 0 {
+		t.Error("the event reached another topic")
+	}
+	if len(b.history) != 0 {
+		t.Error("topic events must not be kept for resuming")
+	}
+
+	b.Unsubscribe(watcher)
+	if _, ok := b.topics[PostTopic(7)]; ok {
+		t.Error("expected the topic to be forgotten without subscribers")
+	}
+}
+
+func TestMemoryPresence(t *testing.T) {
+	ctx := context.Background()
+	p := NewMemoryPresence(time.Minute)
+
+	p.Connect(ctx, 1, "a")
+	p.Connect(ctx, 1, "b")
+	p.Disconnect(ctx, 1, "a")
+
+	online, err := p.Online(ctx, []int64{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !online[1] || online[2] {
+		t.Errorf("unexpected presence %v", online)
+	}
+
+	p.Disconnect(ctx, 1, "b")
+	if online, _ := p.Online(ctx, []int64{1}); online[1] {
+		t.Error("expected the user to be offline after the last disconnect")
+	}
+
+	expired := NewMemoryPresence(-time.Second)
+	expired.Connect(ctx, 3, "c")
+	if online, _ := expired.Online(ctx, []int64{3}); online[3] {
+		t.Error("expected an expired connection not to count")
+	}
+}
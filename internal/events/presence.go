@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Presence tracks which users have a connection open. Connections refresh
+// themselves with Connect while they live, a connection of a replica that
+// went away without disconnecting expires after the TTL of the tracker.
+type Presence interface {
+	Connect(ctx context.Context, userID int64, connID string) error
+	Disconnect(ctx context.Context, userID int64, connID string) error
+	Online(ctx context.Context, userIDs []int64) (map[int64]bool, error)
+}
+
+type memoryPresence struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	conns map[int64]map[string]time.Time
+}
+
+// NewMemoryPresence tracks the connections of this process only
+func NewMemoryPresence(ttl time.Duration) Presence {
+	return &memoryPresence{ttl: ttl, conns: make(map[int64]map[string]time.Time)}
+}
+
+func (mp *memoryPresence) Connect(ctx context.Context, userID int64, connID string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mp.conns[userID] == nil {
+		mp.conns[userID] = make(map[string]time.Time)
+	}
+	mp.conns[userID][connID] = time.Now().Add(mp.ttl)
+	return nil
+}
+
+func (mp *memoryPresence) Disconnect(ctx context.Context, userID int64, connID string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	delete(mp.conns[userID], connID)
+	if len(mp.conns[userID]) == 0 {
+		delete(mp.conns, userID)
+	}
+	return nil
+}
+
+func (mp *memoryPresence) Online(ctx context.Context, userIDs []int64) (map[int64]bool, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	now := time.Now()
+	online := make(map[int64]bool, len(userIDs))
+	for _, userID := range userIDs {
+		for connID, expires := range mp.conns[userID] {
+			if expires.After(now) {
+				online[userID] = true
+				break
+			}
+			delete(mp.conns[userID], connID)
+		}
+	}
+	return online, nil
+}
+
+// presenceKeyPrefix prefixes the sorted sets of the connections of a user,
+// scored by the time they expire
+const presenceKeyPrefix = "presence:"
+
+type redisPresence struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewRedisPresence tracks the connections of all replicas in Redis
+func NewRedisPresence(rdb *redis.Client, ttl time.Duration) Presence {
+	return &redisPresence{rdb: rdb, ttl: ttl}
+}
+
+func (rp *redisPresence) key(userID int64) string {
+	return presenceKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+func (rp *redisPresence) Connect(ctx context.Context, userID int64, connID string) error {
+	key := rp.key(userID)
+	expires := time.Now().Add(rp.ttl)
+
+	pipe := rp.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(expires.Unix()), Member: connID})
+	pipe.Expire(ctx, key, rp.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record presence: %w", err)
+	}
+	return nil
+}
+
+func (rp *redisPresence) Disconnect(ctx context.Context, userID int64, connID string) error {
+	if err := rp.rdb.ZRem(ctx, rp.key(userID), connID).Err(); err != nil {
+		return fmt.Errorf("failed to remove presence: %w", err)
+	}
+	return nil
+}
+
+func (rp *redisPresence) Online(ctx context.Context, userIDs []int64) (map[int64]bool, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	pipe := rp.rdb.Pipeline()
+	counts := make([]*redis.IntCmd, len(userIDs))
+	for i, userID := range userIDs {
+		counts[i] = pipe.ZCount(ctx, rp.key(userID), "("+now, "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read presence: %w", err)
+	}
+
+	online := make(map[int64]bool, len(userIDs))
+	for i, userID := range userIDs {
+		if counts[i].Val() > 0 {
+			online[userID] = true
+		}
+	}
+	return online, nil
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// RedisChannel is the pub/sub channel events are published on
+const RedisChannel = "events"
+
+type redisBackend struct {
+	rdb *redis.Client
+}
+
+// NewRedisBackend carries events between replicas over Redis pub/sub
+func NewRedisBackend(rdb *redis.Client) Backend {
+	return &redisBackend{rdb: rdb}
+}
+
+func (rb *redisBackend) Publish(ctx context.Context, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := rb.rdb.Publish(ctx, RedisChannel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func (rb *redisBackend) Receive(ctx context.Context, deliver func(Event)) error {
+	pubsub := rb.rdb.Subscribe(ctx, RedisChannel)
+	defer pubsub.Close()
+
+	// wait for the subscription, so a broken connection is reported
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("event subscription closed")
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				log.Error().Err(err).Msg("failed to unmarshal event")
+				continue
+			}
+			deliver(ev)
+		}
+	}
+}
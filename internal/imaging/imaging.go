@@ -0,0 +1,243 @@
+// Package imaging prepares uploaded images to be served: metadata such as
+// EXIF and GPS data is stripped, smaller variants are generated and a
+// blurhash placeholder is computed. JPEG, PNG, GIF and still WebP images are
+// decoded, animated WebP images can not be and only have their metadata
+// stripped.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/webp"
+)
+
+// MaxPixels is the size of the largest image that is decoded, larger ones
+// would take too much memory
+const MaxPixels = 50_000_000
+
+var ErrTooLarge = errors.New("image has too many pixels")
+
+const (
+	originalQuality = 90
+	variantQuality  = 85
+	// blurhashes are computed on a small copy of the image
+	blurhashSize = 32
+)
+
+// Size is a variant to generate, fitting in a square of Max pixels
+type Size struct {
+	Name string
+	Max  int
+}
+
+// Image is an encoded image
+type Image struct {
+	Name        string
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Result is a processed image
+type Result struct {
+	// Original is the uploaded image without its metadata
+	Original Image
+	// Variants are the sizes smaller than the original, from the smallest
+	Variants []Image
+	// Blurhash is empty for images that can not be decoded
+	Blurhash string
+}
+
+// Process strips the metadata of an image of contentType and generates the
+// sizes that are smaller than the image
+func Process(data []byte, contentType string, sizes []Size) (*Result, error) {
+	switch contentType {
+	case "image/jpeg":
+		return processJPEG(data, sizes)
+	case "image/png":
+		stripped, err := stripPNG(data)
+		if err != nil {
+			return nil, err
+		}
+		return process(stripped, contentType, sizes)
+	case "image/gif":
+		// GIFs carry no EXIF data and are kept as they are, animated
+		return process(data, contentType, sizes)
+	case "image/webp":
+		return processWebP(data, sizes)
+	default:
+		return nil, fmt.Errorf("can not process images of type %s", contentType)
+	}
+}
+
+func processJPEG(data []byte, sizes []Size) (*Result, error) {
+	if err := checkConfig(data); err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// the orientation is part of the stripped metadata, so it is applied
+	// to the pixels instead
+	oriented := orient(toNRGBA(img), jpegOrientation(data))
+
+	// re-encoding drops every segment but the image itself
+	original, err := encode(oriented, "image/jpeg", originalQuality)
+	if err != nil {
+		return nil, err
+	}
+	return withVariants(oriented, original, sizes)
+}
+
+// process keeps data as the original and derives the variants from it
+func process(data []byte, contentType string, sizes []Size) (*Result, error) {
+	if err := checkConfig(data); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	original := Image{
+		Data:        data,
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+	}
+	return withVariants(toNRGBA(img), original, sizes)
+}
+
+func processWebP(data []byte, sizes []Size) (*Result, error) {
+	stripped, err := stripWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := webpSize(stripped)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	// the stripped original is kept, WebPs are smaller than any re-encoding
+	original := Image{
+		Data:        stripped,
+		ContentType: "image/webp",
+		Width:       width,
+		Height:      height,
+	}
+	if webpAnimated(stripped) {
+		return &Result{Original: original}, nil
+	}
+	img, err := webp.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, err
+	}
+	return withVariants(toNRGBA(img), original, sizes)
+}
+
+func checkConfig(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+func withVariants(img *image.NRGBA, original Image, sizes []Size) (*Result, error) {
+	result := &Result{Original: original}
+
+	// JPEGs stay JPEGs, anything else may be transparent
+	contentType := "image/png"
+	if original.ContentType == "image/jpeg" {
+		contentType = "image/jpeg"
+	}
+
+	src := img
+	for i := len(sizes) - 1; i >= 0; i-- {
+		size := sizes[i]
+		width, height, ok := fit(src.Bounds().Dx(), src.Bounds().Dy(), size.Max)
+		if !ok {
+			continue
+		}
+		// each variant is resized from the next larger one, which is
+		// cheaper and looks about the same with an area filter
+		src = resize(src, width, height)
+		variant, err := encode(src, contentType, variantQuality)
+		if err != nil {
+			return nil, err
+		}
+		variant.Name = size.Name
+		result.Variants = append([]Image{variant}, result.Variants...)
+	}
+
+	width, height, ok := fit(src.Bounds().Dx(), src.Bounds().Dy(), blurhashSize)
+	if ok {
+		src = resize(src, width, height)
+	}
+	result.Blurhash = blurhash(src)
+	return result, nil
+}
+
+// fit returns the size of an image of width and height scaled down to fit
+// in a square of max pixels, and false when it already fits
+func fit(width, height, max int) (int, int, bool) {
+	if width <= max && height <= max {
+		return width, height, false
+	}
+	if width >= height {
+		return max, scaled(height, max, width), true
+	}
+	return scaled(width, max, height), max, true
+}
+
+func scaled(side, max, longest int) int {
+	s := (side*max + longest/2) / longest
+	if s < 1 {
+		return 1
+	}
+	return s
+}
+
+func encode(img *image.NRGBA, contentType string, quality int) (Image, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{
+		Data:        buf.Bytes(),
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	bounds := img.Bounds()
+	n := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(n, n.Bounds(), img, bounds.Min, draw.Src)
+	return n
+}
@@ -0,0 +1,304 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var testSizes = []Size{{Name: "small", Max: 320}, {Name: "medium", Max: 800}, {Name: "large", Max: 1600}}
+
+func filled(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// exifSegment is an APP1 segment with a single orientation tag
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestProcessJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, filled(2000, 1000, color.NRGBA{R: 200, G: 80, B: 40, A: 255}), nil); err != nil {
+		t.Fatal(err)
+	}
+	// the EXIF segment goes right after the start of image marker
+	data := append([]byte{0xff, 0xd8}, exifSegment(6)...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("expected orientation 6, got %d", got)
+	}
+
+	result, err := Process(data, "image/jpeg", testSizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(result.Original.Data, []byte("Exif")) {
+		t.Error("expected the EXIF data to be stripped")
+	}
+	if result.Original.Width != 1000 || result.Original.Height != 2000 {
+		t.Errorf("expected the original to be turned upright to 1000x2000, got %dx%d", result.Original.Width, result.Original.Height)
+	}
+
+	want := []struct {
+		name          string
+		width, height int
+	}{{"small", 160, 320}, {"medium", 400, 800}, {"large", 800, 1600}}
+	if len(result.Variants) != len(want) {
+		t.Fatalf("expected %d variants, got %d", len(want), len(result.Variants))
+	}
+	for i, w := range want {
+		v := result.Variants[i]
+		if v.Name != w.name || v.Width != w.width || v.Height != w.height || v.ContentType != "image/jpeg" {
+			t.Errorf("expected %s variant of %dx%d, got %s of %dx%d (%s)", w.name, w.width, w.height, v.Name, v.Width, v.Height, v.ContentType)
+		}
+		config, err := jpeg.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil || config.Width != w.width || config.Height != w.height {
+			t.Errorf("expected the %s variant to decode to %dx%d, got %dx%d (%v)", w.name, w.width, w.height, config.Width, config.Height, err)
+		}
+	}
+
+	// 3x4 components along the longer height
+	if len(result.Blurhash) != 28 || result.Blurhash[0] != base83[(3-1)+(4-1)*9] {
+		t.Errorf("expected a 28 character blurhash with 3x4 components, got %q", result.Blurhash)
+	}
+}
+
+func TestProcessPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, filled(300, 200, color.NRGBA{G: 255, A: 128})); err != nil {
+		t.Fatal(err)
+	}
+	// a text chunk right after the header chunk
+	text := []byte("Location\x0052.52,13.40")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	data := append(append(append([]byte{}, buf.Bytes()[:33]...), chunk...), buf.Bytes()[33:]...)
+
+	result, err := Process(data, "image/png", testSizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(result.Original.Data, []byte("Location")) {
+		t.Error("expected the text chunk to be stripped")
+	}
+	if _, err := png.Decode(bytes.NewReader(result.Original.Data)); err != nil {
+		t.Errorf("expected the stripped original to decode, got %v", err)
+	}
+	if len(result.Variants) != 0 {
+		t.Errorf("expected no variants for an image smaller than every size, got %d", len(result.Variants))
+	}
+	if result.Original.Width != 300 || result.Original.Height != 200 {
+		t.Errorf("expected 300x200, got %dx%d", result.Original.Width, result.Original.Height)
+	}
+}
+
+// webpChunk encodes a RIFF chunk, padded to an even size
+func webpChunk(fourCC string, data []byte) []byte {
+	c := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	c = append(c, data...)
+	if len(data)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(data, body...)
+}
+
+// filledVP8L encodes a lossless image of one color: every prefix code has a
+// single symbol, which takes no bits, so the pixels take none either
+func filledVP8L(w, h int, c color.NRGBA) []byte {
+	var buf []byte
+	var n uint
+	write := func(v uint32, bits uint) {
+		for i := uint(0); i < bits; i++ {
+			if n%8 == 0 {
+				buf = append(buf, 0)
+			}
+			buf[len(buf)-1] |= byte(v>>i&1) << (n % 8)
+			n++
+		}
+	}
+	write(0x2f, 8)
+	write(uint32(w-1), 14)
+	write(uint32(h-1), 14)
+	write(1, 1) // alpha is used
+	write(0, 3) // version
+	write(0, 1) // no transform
+	write(0, 1) // no color cache
+	write(0, 1) // no meta prefix codes
+	// green, red, blue, alpha and distance codes
+	for _, symbol := range []uint8{c.G, c.R, c.B, c.A, 0} {
+		write(1, 1) // simple code
+		write(0, 1) // of one symbol
+		write(1, 1) // of 8 bits
+		write(uint32(symbol), 8)
+	}
+	return webpChunk("VP8L", buf)
+}
+
+func TestProcessWebP(t *testing.T) {
+	t.Run("should strip the metadata", func(t *testing.T) {
+		// extended header with the EXIF and XMP flags of a 100x50 canvas
+		vp8x := []byte{0x0c, 0, 0, 0, 99, 0, 0, 49, 0, 0}
+		data := webpFile(
+			webpChunk("VP8X", vp8x),
+			filledVP8L(100, 50, color.NRGBA{R: 200, A: 255}),
+			webpChunk("EXIF", []byte("GPS 52.52,13.40")),
+			webpChunk("XMP ", []byte("<x/>")),
+		)
+
+		result, err := Process(data, "image/webp", testSizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := result.Original.Data
+		if bytes.Contains(out, []byte("GPS")) || bytes.Contains(out, []byte("XMP ")) {
+			t.Error("expected the EXIF and XMP chunks to be stripped")
+		}
+		if out[20] != 0 {
+			t.Errorf("expected the EXIF and XMP flags to be cleared, got %#x", out[20])
+		}
+		if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+			t.Errorf("expected a RIFF size of %d, got %d", len(out)-8, size)
+		}
+		if result.Original.Width != 100 || result.Original.Height != 50 {
+			t.Errorf("expected 100x50, got %dx%d", result.Original.Width, result.Original.Height)
+		}
+	})
+
+	t.Run("should generate variants and a blurhash", func(t *testing.T) {
+		data := webpFile(filledVP8L(1000, 500, color.NRGBA{G: 200, A: 255}))
+
+		result, err := Process(data, "image/webp", testSizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Original.ContentType != "image/webp" || !bytes.Equal(result.Original.Data, data) {
+			t.Error("expected the original to be kept")
+		}
+		if len(result.Variants) != 2 {
+			t.Fatalf("expected 2 variants, got %d", len(result.Variants))
+		}
+		small := result.Variants[0]
+		if small.Name != "small" || small.Width != 320 || small.Height != 160 || small.ContentType != "image/png" {
+			t.Errorf("unexpected small variant %s %dx%d %s", small.Name, small.Width, small.Height, small.ContentType)
+		}
+		if result.Blurhash == "" {
+			t.Error("expected a blurhash")
+		}
+	})
+
+	t.Run("should keep an animation as it is", func(t *testing.T) {
+		// extended header with the animation flag of a 100x50 canvas
+		vp8x := []byte{0x02, 0, 0, 0, 99, 0, 0, 49, 0, 0}
+		data := webpFile(webpChunk("VP8X", vp8x), webpChunk("ANIM", make([]byte, 6)))
+
+		result, err := Process(data, "image/webp", testSizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Variants) != 0 || result.Blurhash != "" {
+			t.Errorf("expected only the original, got %d variants and blurhash %q", len(result.Variants), result.Blurhash)
+		}
+	})
+}
+
+func TestOrient(t *testing.T) {
+	// a 2x1 image, red on the left and blue on the right
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	img.SetNRGBA(0, 0, red)
+	img.SetNRGBA(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		// the colors from top to bottom or left to right
+		first, second color.NRGBA
+		vertical      bool
+	}{
+		{orientation: 1, first: red, second: blue},
+		{orientation: 2, first: blue, second: red},
+		{orientation: 6, first: red, second: blue, vertical: true},
+		{orientation: 8, first: blue, second: red, vertical: true},
+	}
+	for _, tt := range tests {
+		got := orient(img, tt.orientation)
+		x, y := 1, 0
+		if tt.vertical {
+			x, y = 0, 1
+		}
+		if got.Rect.Dx() != x+1 || got.Rect.Dy() != y+1 {
+			t.Errorf("orientation %d: expected %dx%d, got %dx%d", tt.orientation, x+1, y+1, got.Rect.Dx(), got.Rect.Dy())
+			continue
+		}
+		if got.NRGBAAt(0, 0) != tt.first || got.NRGBAAt(x, y) != tt.second {
+			t.Errorf("orientation %d: expected %v then %v, got %v then %v", tt.orientation, tt.first, tt.second, got.NRGBAAt(0, 0), got.NRGBAAt(x, y))
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{G: 255, A: 0})
+
+	got := resize(img, 1, 1).NRGBAAt(0, 0)
+	// the transparent green pixel only lowers the alpha
+	if got.R != 255 || got.G != 0 || got.A != 128 {
+		t.Errorf("expected half transparent red, got %v", got)
+	}
+}
+
+func TestBlurhashSolid(t *testing.T) {
+	hash := blurhash(filled(32, 24, color.NRGBA{R: 10, G: 120, B: 250, A: 255}))
+	if len(hash) != 28 {
+		t.Fatalf("expected 28 characters, got %q", hash)
+	}
+
+	decode := func(s string) int {
+		v := 0
+		for _, c := range []byte(s) {
+			v = v*83 + bytes.IndexByte([]byte(base83), c)
+		}
+		return v
+	}
+	if flag := decode(hash[:1]); flag != (4-1)+(3-1)*9 {
+		t.Errorf("expected 4x3 components, got size flag %d", flag)
+	}
+	if dc := decode(hash[2:6]); dc != 10<<16|120<<8|250 {
+		t.Errorf("expected the average color to be encoded, got %06x", dc)
+	}
+}
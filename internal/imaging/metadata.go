@@ -0,0 +1,123 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// pngMetadata are the PNG chunks holding text, EXIF data and timestamps
+var pngMetadata = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// stripPNG drops the metadata chunks of a PNG, the pixels are untouched
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, signature...)
+	for i := len(signature); i < len(data); {
+		// length, type, data and CRC
+		if i+12 > len(data) {
+			return nil, errMalformed
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) {
+			return nil, errMalformed
+		}
+		if !pngMetadata[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// stripWebP drops the EXIF and XMP chunks of a WebP and clears their flags
+// in the extended header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if i+8+size > len(data) {
+			return nil, errMalformed
+		}
+		// chunks are padded to an even size
+		end := min(i+8+size+size&1, len(data))
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[i:end]...)
+			if size > 0 {
+				const exifFlag, xmpFlag = 0x08, 0x04
+				out[start+8] &^= exifFlag | xmpFlag
+			}
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// webpAnimated reports whether the extended header of a WebP flags it as
+// animated, the decoder only reads still images
+func webpAnimated(data []byte) bool {
+	const animationFlag = 0x02
+	return len(data) > 20 && string(data[12:16]) == "VP8X" && data[20]&animationFlag != 0
+}
+
+// webpSize reads the canvas size of a WebP from its first chunk
+func webpSize(data []byte) (int, int, error) {
+	if len(data) < 30 {
+		return 0, 0, errMalformed
+	}
+	chunk := data[20:]
+	switch string(data[12:16]) {
+	case "VP8X":
+		// 24 bit canvas width and height minus one, after 4 bytes of flags
+		w := int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16
+		h := int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16
+		return w + 1, h + 1, nil
+	case "VP8 ":
+		// a lossy key frame starts with a 3 byte tag and a start code
+		if chunk[3] != 0x9d || chunk[4] != 0x01 || chunk[5] != 0x2a {
+			return 0, 0, errMalformed
+		}
+		w := int(binary.LittleEndian.Uint16(chunk[6:])) & 0x3fff
+		h := int(binary.LittleEndian.Uint16(chunk[8:])) & 0x3fff
+		return w, h, nil
+	case "VP8L":
+		// a lossless image starts with a signature and two 14 bit sizes
+		// minus one
+		if chunk[0] != 0x2f {
+			return 0, 0, errMalformed
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	default:
+		return 0, 0, errMalformed
+	}
+}
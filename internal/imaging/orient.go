@@ -0,0 +1,117 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation returns the EXIF orientation of a JPEG, from 1 to 8, and
+// 1 when it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		// the image data starts at SOS, metadata comes before it
+		if marker == 0xda || marker == 0xd9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		segment := data[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag of the first IFD of a TIFF
+// structure, as found in the APP1 segment of JPEGs
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		const orientationTag, shortType = 0x0112, 3
+		if order.Uint16(tiff[entry:]) != orientationTag {
+			continue
+		}
+		if order.Uint16(tiff[entry+2:]) != shortType {
+			return 1
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// orient turns and flips img so it shows upright for an EXIF orientation
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+
+	// src returns the source pixel of destination pixel x, y
+	var src func(x, y int) (int, int)
+	dstW, dstH := w, h
+	switch orientation {
+	case 2: // mirrored
+		src = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // upside down
+		src = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // upside down and mirrored
+		src = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transposed
+		dstW, dstH = h, w
+		src = func(x, y int) (int, int) { return y, x }
+	case 6: // needs a quarter turn clockwise
+		dstW, dstH = h, w
+		src = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // transversed
+		dstW, dstH = h, w
+		src = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // needs a quarter turn counterclockwise
+		dstW, dstH = h, w
+		src = func(x, y int) (int, int) { return w - 1 - y, x }
+	default:
+		return img
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			sx, sy := src(x, y)
+			copy(dst.Pix[y*dst.Stride+x*4:][:4], img.Pix[sy*img.Stride+sx*4:])
+		}
+	}
+	return dst
+}
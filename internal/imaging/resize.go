@@ -0,0 +1,89 @@
+package imaging
+
+import (
+	"image"
+)
+
+// resize scales img to width and height with an area filter: every pixel
+// is the average of the source pixels it covers, which keeps thin details
+// when scaling down. Colors are averaged premultiplied by their alpha so
+// transparent pixels do not bleed into their neighbours.
+func resize(img *image.NRGBA, width, height int) *image.NRGBA {
+	srcW, srcH := img.Rect.Dx(), img.Rect.Dy()
+	xs := weights(srcW, width)
+	ys := weights(srcH, height)
+
+	// horizontal pass into premultiplied floats, srcH rows of width pixels
+	tmp := make([]float32, srcH*width*4)
+	for y := 0; y < srcH; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x, ws := range xs {
+			var r, g, b, a float32
+			for _, w := range ws {
+				p := row[w.index*4:]
+				alpha := float32(p[3]) * w.weight
+				r += float32(p[0]) * alpha
+				g += float32(p[1]) * alpha
+				b += float32(p[2]) * alpha
+				a += alpha
+			}
+			t := tmp[(y*width+x)*4:]
+			t[0], t[1], t[2], t[3] = r, g, b, a
+		}
+	}
+
+	// vertical pass, then back to straight alpha
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y, ws := range ys {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float32
+			for _, w := range ws {
+				t := tmp[(w.index*width+x)*4:]
+				r += t[0] * w.weight
+				g += t[1] * w.weight
+				b += t[2] * w.weight
+				a += t[3] * w.weight
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			if a > 0 {
+				p[0], p[1], p[2] = clamp8(r/a), clamp8(g/a), clamp8(b/a)
+			}
+			p[3] = clamp8(a)
+		}
+	}
+	return dst
+}
+
+type weight struct {
+	index  int
+	weight float32
+}
+
+// weights returns for every destination pixel the source pixels it covers,
+// weighted by how much of them it covers. The weights of a pixel add up
+// to one.
+func weights(src, dst int) [][]weight {
+	scale := float64(src) / float64(dst)
+	all := make([][]weight, dst)
+	for i := range all {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < src && float64(j) < end; j++ {
+			lo, hi := max(start, float64(j)), min(end, float64(j+1))
+			if hi > lo {
+				all[i] = append(all[i], weight{index: j, weight: float32((hi - lo) / scale)})
+			}
+		}
+	}
+	return all
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
@@ -31,6 +31,8 @@ type Message struct {
 	AttachFiles   []string
 	AttachmentMap map[string]string
 	Template      string
+	// Headers are added to the message, like List-Unsubscribe
+	Headers map[string]string
 }
 
 type MailConf struct {
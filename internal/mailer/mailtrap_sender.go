@@ -51,6 +51,9 @@ func (sender *MailTrapSender) Send(email Message) error {
 		return fmt.Errorf("failed to set BCC address: %s", err)
 	}
 	m.Subject(email.Subject)
+	for key, value := range email.Headers {
+		m.SetGenHeader(mail.Header(key), value)
+	}
 
 	data := map[string]any{
 		"message": email.Data,
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// BlockedUser is a user someone blocked
+type BlockedUser struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserBlock is a block between two users, UserID blocked BlockedID
+type UserBlock struct {
+	UserID    int64
+	BlockedID int64
+}
+
+// Involves tells whether userID blocked or was blocked in b, and returns
+// the other user
+func (b UserBlock) Involves(userID int64) (int64, bool) {
+	switch userID {
+	case b.UserID:
+		return b.BlockedID, true
+	case b.BlockedID:
+		return b.UserID, true
+	default:
+		return 0, false
+	}
+}
+
+type BlocksStore struct {
+	db *sql.DB
+}
+
+func NewBlocksStore(db *sql.DB) *BlocksStore {
+	return &BlocksStore{db: db}
+}
+
+// Block blocks blockedID for userID, blocking twice is not an error. It
+// returns ErrNotFound when there is no such user.
+func (bs *BlocksStore) Block(ctx context.Context, userID, blockedID int64) error {
+	query := `
+	INSERT INTO user_blocks (user_id, blocked_id)
+	SELECT $1::bigint, id FROM users WHERE id = $2
+	ON CONFLICT (user_id, blocked_id) DO NOTHING
+	RETURNING blocked_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var id int64
+	err := bs.db.QueryRowContext(ctx, query, userID, blockedID).Scan(&id)
+	if err == sql.ErrNoRows {
+		// either there is no such user or the block already exists
+		var exists bool
+		if err := bs.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, blockedID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return nil
+	}
+	return err
+}
+
+func (bs *BlocksStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE user_id = $1 AND blocked_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := bs.db.ExecContext(ctx, query, userID, blockedID)
+	return err
+}
+
+// GetByUserID returns the users userID blocked, latest first
+func (bs *BlocksStore) GetByUserID(ctx context.Context, userID int64) ([]BlockedUser, error) {
+	query := `
+	SELECT u.id, u.username, b.created_at
+	FROM user_blocks b
+	JOIN users u ON u.id = b.blocked_id
+	WHERE b.user_id = $1
+	ORDER BY b.created_at DESC, u.id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := bs.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.ID, &b.Username, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, rows.Err()
+}
+
+// GetAmong returns the blocks between any two of userIDs
+func (bs *BlocksStore) GetAmong(ctx context.Context, userIDs []int64) ([]UserBlock, error) {
+	query := `
+	SELECT user_id, blocked_id
+	FROM user_blocks
+	WHERE user_id = ANY($1) AND blocked_id = ANY($1)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := bs.db.QueryContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []UserBlock{}
+	for rows.Next() {
+		var b UserBlock
+		if err := rows.Scan(&b.UserID, &b.BlockedID); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
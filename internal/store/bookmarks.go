@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Bookmark struct {
+	UserID     int64  `json:"user_id"`
+	PostID     int64  `json:"post_id"`
+	Collection string `json:"collection"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type BookmarkCollection struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type BookmarksStore struct {
+	db *sql.DB
+}
+
+func NewBookmarksStore(db *sql.DB) *BookmarksStore {
+	return &BookmarksStore{db: db}
+}
+
+// Save bookmarks the post or moves an existing bookmark to another collection
+func (bs *BookmarksStore) Save(ctx context.Context, bookmark *Bookmark) error {
+	query := `
+	   INSERT INTO bookmarks (user_id, post_id, collection)
+       VALUES ($1, $2, $3)
+       ON CONFLICT (user_id, post_id) DO UPDATE SET collection = EXCLUDED.collection
+       RETURNING created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return bs.db.QueryRowContext(
+		ctx,
+		query,
+		bookmark.UserID,
+		bookmark.PostID,
+		bookmark.Collection,
+	).Scan(
+		&bookmark.CreatedAt,
+	)
+}
+
+func (bs *BookmarksStore) Delete(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := bs.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+// GetPosts returns the posts bookmarked by the user, most recently saved
+// first, together with the cursor of the next page. An empty collection
+// lists the bookmarks of every collection. Bookmarked posts that are no
+// longer visible to the user are left out.
+func (bs *BookmarksStore) GetPosts(ctx context.Context, userID int64, collection string, cq CursorPaginatedQuery) ([]*PostWithMetadata, string, error) {
+	cursor, err := cq.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+	SELECT ` + postWithMetadataColumns("$1") + `,
+      bm.created_at
+    FROM bookmarks bm
+    JOIN posts p ON p.id = bm.post_id
+    LEFT JOIN users u ON u.id = p.user_id
+    WHERE
+      bm.user_id = $1
+      AND ($2 = '' OR bm.collection = $2)
+      AND (bm.created_at, bm.post_id) < ($3, $4)
+      AND (p.user_id = $1 OR (` + publishedCondition + ` AND ` + visibleToCondition("$1") + `))
+    ORDER BY bm.created_at DESC, bm.post_id DESC
+    LIMIT $5;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := bs.db.QueryContext(ctx, query, userID, collection, cursor.CreatedAt, cursor.ID, cq.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	posts := []*PostWithMetadata{}
+	var last Cursor
+	for rows.Next() {
+		p, err := scanPostWithMetadata(rows, &last.CreatedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		last.ID = p.ID
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if err := attachPostDetails(ctx, bs.db, userID, postsOf(posts)); err != nil {
+		return nil, "", err
+	}
+
+	// a short page is the last one
+	next := ""
+	if len(posts) == cq.Limit {
+		next = last.Encode()
+	}
+	return posts, next, nil
+}
+
+// GetCollections returns the collections of the user with their sizes
+func (bs *BookmarksStore) GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	query := `
+	SELECT collection, COUNT(*)
+	FROM bookmarks
+	WHERE user_id = $1
+	GROUP BY collection
+	ORDER BY collection
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := bs.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"database/sql"
+
+	"github.com/dubass83/go_social/internal/entities"
 )
 
 type CommentsStore struct {
@@ -21,7 +23,10 @@ type Comment struct {
 	UserID    int64  `json:"user_id"`
 	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	// Entities are the mentions and hashtags found in the content
+	Entities *entities.Entities `json:"entities"`
+	Media    []Media            `json:"media"`
+	User     User               `json:"user"`
 }
 
 func (cs *CommentsStore) Create(ctx context.Context, comment *Comment) error {
@@ -32,20 +37,26 @@ func (cs *CommentsStore) Create(ctx context.Context, comment *Comment) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := cs.db.QueryRowContext(
-		ctx,
-		query,
-		comment.PostID,
-		comment.UserID,
-		comment.Content,
-	).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
-	)
-	if err != nil {
-		return err
-	}
-	return nil
+	return withTx(cs.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			comment.PostID,
+			comment.UserID,
+			comment.Content,
+		).Scan(
+			&comment.ID,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		comment.Entities, err = setEntitiesTx(ctx, tx, entityKindComment, comment.ID, comment.Content)
+		if err != nil {
+			return err
+		}
+		return setMediaTx(ctx, tx, entityKindComment, comment.ID, comment.Media)
+	})
 }
 
 func (cs *CommentsStore) GetByPostID(ctx context.Context, id int64) ([]Comment, error) {
@@ -75,6 +86,29 @@ func (cs *CommentsStore) GetByPostID(ctx context.Context, id int64) ([]Comment,
 		}
 		comments = append(comments, c)
 	}
-	return comments, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	mentioned, err := getMentionedUserIDs(ctx, cs.db, entityKindComment, ids)
+	if err != nil {
+		return nil, err
+	}
+	attached, err := getAttachedMedia(ctx, cs.db, entityKindComment, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].Entities = entities.Parse(comments[i].Content)
+		comments[i].Entities.ResolveMentions(mentioned[comments[i].ID])
+		comments[i].Media = attached[comments[i].ID]
+		if comments[i].Media == nil {
+			comments[i].Media = []Media{}
+		}
+	}
+	return comments, nil
 }
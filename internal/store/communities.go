@@ -0,0 +1,335 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// Roles of members within a community, from community_roles
+const (
+	CommunityRoleOwner     = "owner"
+	CommunityRoleModerator = "moderator"
+	CommunityRoleMember    = "member"
+)
+
+type Community struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	MembersCount int    `json:"members_count"`
+	// Role is the role of the current user, empty when they are not a member
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CommunityMember struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// Level ranks the role like the level of roles
+	Level    int       `json:"-"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type CommunitiesStore struct {
+	db *sql.DB
+}
+
+func NewCommunitiesStore(db *sql.DB) *CommunitiesStore {
+	return &CommunitiesStore{db: db}
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a foreign key violation
+func isForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23503"
+}
+
+// communityColumns selects a community c with the role of the user bound to
+// viewer, 0 stands for an anonymous visitor
+func communityColumns(viewer string) string {
+	return `
+	c.id, c.name, c.description,
+	(SELECT COUNT(*) FROM community_members m WHERE m.community_id = c.id),
+	COALESCE((
+	  SELECT r.name FROM community_members m
+	  JOIN community_roles r ON r.id = m.role_id
+	  WHERE m.community_id = c.id AND m.user_id = ` + viewer + `
+	), ''),
+	c.created_at`
+}
+
+func scanCommunity(row interface{ Scan(...any) error }) (*Community, error) {
+	c := &Community{}
+	err := row.Scan(&c.ID, &c.Name, &c.Description, &c.MembersCount, &c.Role, &c.CreatedAt)
+	return c, err
+}
+
+// Create creates a community owned by ownerID, ErrDuplicate when the name is
+// taken
+func (cs *CommunitiesStore) Create(ctx context.Context, c *Community, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := withTx(cs.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO communities (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+		`
+		if err := tx.QueryRowContext(ctx, query, c.Name, c.Description).Scan(&c.ID, &c.CreatedAt); err != nil {
+			return err
+		}
+		return setMemberTx(ctx, tx, c.ID, ownerID, CommunityRoleOwner)
+	})
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	c.MembersCount = 1
+	c.Role = CommunityRoleOwner
+	return nil
+}
+
+// setMemberTx adds a member with a role, or changes the role of a member
+func setMemberTx(ctx context.Context, tx *sql.Tx, communityID, userID int64, role string) error {
+	query := `
+	INSERT INTO community_members (community_id, user_id, role_id)
+	SELECT $1::bigint, $2::bigint, id FROM community_roles WHERE name = $3
+	ON CONFLICT (community_id, user_id) DO UPDATE SET role_id = EXCLUDED.role_id
+	`
+	_, err := tx.ExecContext(ctx, query, communityID, userID, role)
+	return err
+}
+
+// GetByID returns the community with the role of viewerID in it
+func (cs *CommunitiesStore) GetByID(ctx context.Context, id, viewerID int64) (*Community, error) {
+	query := `SELECT ` + communityColumns("$2") + ` FROM communities c WHERE c.id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	c, err := scanCommunity(cs.db.QueryRowContext(ctx, query, id, viewerID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// GetAll returns the communities whose name or description match the
+// search, the ones with the most members first
+func (cs *CommunitiesStore) GetAll(ctx context.Context, viewerID int64, pg PaginatedFeedQuery) ([]*Community, error) {
+	query := `
+	SELECT ` + communityColumns("$1") + `
+	FROM communities c
+	WHERE c.name ILIKE '%' || $4 || '%' OR c.description ILIKE '%' || $4 || '%'
+	ORDER BY 4 DESC, c.id DESC
+	LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	log.Debug().Msgf("viewerID: %d, limit: %d, offset: %d, search: '%s'", viewerID, pg.Limit, pg.Offset, pg.Search)
+
+	rows, err := cs.db.QueryContext(ctx, query, viewerID, pg.Limit, pg.Offset, pg.Search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	communities := []*Community{}
+	for rows.Next() {
+		c, err := scanCommunity(rows)
+		if err != nil {
+			return nil, err
+		}
+		communities = append(communities, c)
+	}
+	return communities, rows.Err()
+}
+
+// Update changes the name and description, ErrDuplicate when the name is
+// taken
+func (cs *CommunitiesStore) Update(ctx context.Context, c *Community) error {
+	query := `UPDATE communities SET name = $2, description = $3 WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := cs.db.ExecContext(ctx, query, c.ID, c.Name, c.Description)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes the community together with its posts
+func (cs *CommunitiesStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM communities WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := cs.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Join makes userID a member, members keep their role
+func (cs *CommunitiesStore) Join(ctx context.Context, communityID, userID int64) error {
+	query := `
+	INSERT INTO community_members (community_id, user_id, role_id)
+	SELECT $1::bigint, $2::bigint, id FROM community_roles WHERE name = $3
+	ON CONFLICT (community_id, user_id) DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := cs.db.ExecContext(ctx, query, communityID, userID, CommunityRoleMember)
+	return err
+}
+
+// RemoveMember removes a member, whether they left or were removed
+func (cs *CommunitiesStore) RemoveMember(ctx context.Context, communityID, userID int64) error {
+	query := `DELETE FROM community_members WHERE community_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := cs.db.ExecContext(ctx, query, communityID, userID)
+	return err
+}
+
+// SetRole changes the role of a member, ErrNotFound when they are not one.
+// Making someone the owner hands the community over: the previous owner
+// becomes a moderator.
+func (cs *CommunitiesStore) SetRole(ctx context.Context, communityID, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(cs.db, ctx, func(tx *sql.Tx) error {
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM community_members WHERE community_id = $1 AND user_id = $2)`
+		if err := tx.QueryRowContext(ctx, query, communityID, userID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+
+		if role == CommunityRoleOwner {
+			query := `
+			UPDATE community_members
+			SET role_id = (SELECT id FROM community_roles WHERE name = $2)
+			WHERE community_id = $1 AND role_id = (SELECT id FROM community_roles WHERE name = $3)
+			`
+			if _, err := tx.ExecContext(ctx, query, communityID, CommunityRoleModerator, CommunityRoleOwner); err != nil {
+				return err
+			}
+		}
+		return setMemberTx(ctx, tx, communityID, userID, role)
+	})
+}
+
+// GetMember returns the membership of userID, ErrNotFound when they are not
+// a member
+func (cs *CommunitiesStore) GetMember(ctx context.Context, communityID, userID int64) (*CommunityMember, error) {
+	query := `
+	SELECT m.user_id, u.username, r.name, r.level, m.joined_at
+	FROM community_members m
+	JOIN community_roles r ON r.id = m.role_id
+	JOIN users u ON u.id = m.user_id
+	WHERE m.community_id = $1 AND m.user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	m := &CommunityMember{}
+	err := cs.db.QueryRowContext(ctx, query, communityID, userID).Scan(&m.UserID, &m.Username, &m.Role, &m.Level, &m.JoinedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// GetMembers returns the members of the community, the highest roles first
+func (cs *CommunitiesStore) GetMembers(ctx context.Context, communityID int64, pg PaginatedFeedQuery) ([]CommunityMember, error) {
+	query := `
+	SELECT m.user_id, u.username, r.name, r.level, m.joined_at
+	FROM community_members m
+	JOIN community_roles r ON r.id = m.role_id
+	JOIN users u ON u.id = m.user_id
+	WHERE m.community_id = $1 AND u.username ILIKE '%' || $4 || '%'
+	ORDER BY r.level DESC, m.joined_at ` + pg.Sort + `, m.user_id
+	LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := cs.db.QueryContext(ctx, query, communityID, pg.Limit, pg.Offset, pg.Search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []CommunityMember{}
+	for rows.Next() {
+		var m CommunityMember
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role, &m.Level, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// IsPrecedent reports whether userID is a member of the community with at
+// least the required role
+func (cs *CommunitiesStore) IsPrecedent(ctx context.Context, communityID, userID int64, requiredRole string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM community_members m
+		JOIN community_roles r ON r.id = m.role_id
+		WHERE m.community_id = $1 AND m.user_id = $2 AND r.level >= (
+			SELECT level
+			FROM community_roles
+			WHERE name = $3
+		)
+	)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var allowed bool
+	if err := cs.db.QueryRowContext(ctx, query, communityID, userID, requiredRole).Scan(&allowed); err != nil {
+		return false, err
+	}
+	return allowed, nil
+}
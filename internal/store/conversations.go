@@ -0,0 +1,444 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Conversation is a 1:1 or group conversation as seen by one of its members
+type Conversation struct {
+	ID int64 `json:"id"`
+	// Title is only set for groups, and optional there
+	Title   *string `json:"title"`
+	IsGroup bool    `json:"is_group"`
+	// Members lists everyone with how far they have read
+	Members     []ConversationMember `json:"members"`
+	LastMessage *Message             `json:"last_message"`
+	// Unread is the number of messages of others the member has not read
+	Unread    int       `json:"unread"`
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is when the last message was sent
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConversationMember is a member of a conversation and their read receipt
+type ConversationMember struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// LastReadID is the last message the member has read, 0 for none
+	LastReadID int64      `json:"last_read_id"`
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+// MemberIDs returns the IDs of the members of the conversation
+func (c *Conversation) MemberIDs() []int64 {
+	ids := make([]int64, 0, len(c.Members))
+	for _, m := range c.Members {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversation_id"`
+	SenderID       int64     `json:"sender_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// MessageSettings are who may start conversations with a user
+type MessageSettings struct {
+	// FollowedOnly only lets the users followed message
+	FollowedOnly bool `json:"followed_only"`
+}
+
+type ConversationsStore struct {
+	db *sql.DB
+}
+
+func NewConversationsStore(db *sql.DB) *ConversationsStore {
+	return &ConversationsStore{db: db}
+}
+
+// directKey identifies the 1:1 conversation of two users
+func directKey(a, b int64) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d:%d", a, b)
+}
+
+// conversationColumns selects a conversation joined with the membership of
+// the viewer as "me"
+const conversationColumns = `
+	c.id, c.title, c.direct_key IS NULL, c.created_at, c.updated_at,
+	(
+	  SELECT json_agg(json_build_object(
+	    'id', u.id, 'username', u.username,
+	    'last_read_id', cm.last_read_id, 'last_read_at', cm.last_read_at
+	  ) ORDER BY cm.joined_at, u.id)
+	  FROM conversation_members cm
+	  JOIN users u ON u.id = cm.user_id
+	  WHERE cm.conversation_id = c.id
+	),
+	(
+	  SELECT json_build_object(
+	    'id', m.id, 'conversation_id', m.conversation_id, 'sender_id', m.sender_id,
+	    'content', m.content, 'created_at', m.created_at
+	  )
+	  FROM messages m
+	  WHERE m.conversation_id = c.id
+	  ORDER BY m.created_at DESC, m.id DESC
+	  LIMIT 1
+	),
+	(
+	  SELECT COUNT(*)
+	  FROM messages m
+	  WHERE m.conversation_id = c.id AND m.id > me.last_read_id AND m.sender_id <> me.user_id
+	)`
+
+func scanConversation(row interface{ Scan(...any) error }) (*Conversation, error) {
+	c := &Conversation{}
+	var members, lastMessage []byte
+	if err := row.Scan(
+		&c.ID,
+		&c.Title,
+		&c.IsGroup,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&members,
+		&lastMessage,
+		&c.Unread,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(members, &c.Members); err != nil {
+		return nil, err
+	}
+	if lastMessage != nil {
+		c.LastMessage = &Message{}
+		if err := json.Unmarshal(lastMessage, c.LastMessage); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Create starts a conversation of userID with memberIDs, a 1:1 one when
+// there is a single other member and no title. The 1:1 conversation of two
+// users is only created once, created is false when it already existed;
+// both users are members of it again.
+func (cs *ConversationsStore) Create(ctx context.Context, userID int64, memberIDs []int64, title *string) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var key *string
+	if len(memberIDs) == 1 && title == nil {
+		k := directKey(userID, memberIDs[0])
+		key = &k
+	}
+
+	var id int64
+	created := true
+	err := withTx(cs.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO conversations (direct_key, title, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (direct_key) DO NOTHING
+		RETURNING id
+		`
+		err := tx.QueryRowContext(ctx, query, key, title, userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			created = false
+			err = tx.QueryRowContext(ctx, `SELECT id FROM conversations WHERE direct_key = $1`, key).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		// members who left an existing 1:1 conversation join it again
+		query = `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT $1::bigint, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, id, pq.Array(append([]int64{userID}, memberIDs...)))
+		return err
+	})
+	return id, created, err
+}
+
+// GetByID returns the conversation as seen by userID, ErrNotFound when they
+// are not a member
+func (cs *ConversationsStore) GetByID(ctx context.Context, id, userID int64) (*Conversation, error) {
+	query := `
+	SELECT ` + conversationColumns + `
+	FROM conversations c
+	JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $2
+	WHERE c.id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	c, err := scanConversation(cs.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// GetByUserID returns a page of the conversations of the user, the one with
+// the latest message first, together with the cursor of the next page
+func (cs *ConversationsStore) GetByUserID(ctx context.Context, userID int64, cq CursorPaginatedQuery) ([]*Conversation, string, error) {
+	cursor, err := cq.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+	SELECT ` + conversationColumns + `
+	FROM conversations c
+	JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1
+	WHERE (c.updated_at, c.id) < ($2, $3)
+	ORDER BY c.updated_at DESC, c.id DESC
+	LIMIT $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := cs.db.QueryContext(ctx, query, userID, cursor.CreatedAt, cursor.ID, cq.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	conversations := []*Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		conversations = append(conversations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// a short page is the last one
+	next := ""
+	if len(conversations) == cq.Limit {
+		last := conversations[len(conversations)-1]
+		next = Cursor{CreatedAt: last.UpdatedAt, ID: last.ID}.Encode()
+	}
+	return conversations, next, nil
+}
+
+// AddMessage stores a message, which the sender has read
+func (cs *ConversationsStore) AddMessage(ctx context.Context, m *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(cs.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO messages (conversation_id, sender_id, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+		`
+		if err := tx.QueryRowContext(ctx, query, m.ConversationID, m.SenderID, m.Content).Scan(&m.ID, &m.CreatedAt); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE conversations SET updated_at = $2 WHERE id = $1`, m.ConversationID, m.CreatedAt); err != nil {
+			return err
+		}
+
+		query = `
+		UPDATE conversation_members SET last_read_id = $3, last_read_at = $4
+		WHERE conversation_id = $1 AND user_id = $2
+		`
+		_, err := tx.ExecContext(ctx, query, m.ConversationID, m.SenderID, m.ID, m.CreatedAt)
+		return err
+	})
+}
+
+// GetMessages returns a page of the messages of the conversation, newest
+// first, together with the cursor of the next page
+func (cs *ConversationsStore) GetMessages(ctx context.Context, conversationID int64, cq CursorPaginatedQuery) ([]*Message, string, error) {
+	cursor, err := cq.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+	SELECT id, conversation_id, sender_id, content, created_at
+	FROM messages
+	WHERE conversation_id = $1 AND (created_at, id) < ($2, $3)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := cs.db.QueryContext(ctx, query, conversationID, cursor.CreatedAt, cursor.ID, cq.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt); err != nil {
+			return nil, "", err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// a short page is the last one
+	next := ""
+	if len(messages) == cq.Limit {
+		last := messages[len(messages)-1]
+		next = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return messages, next, nil
+}
+
+// MarkRead marks the messages of the conversation up to messageID, or all of
+// them when it is 0, as read by the member. The read receipt never moves
+// back; the member is returned with it.
+func (cs *ConversationsStore) MarkRead(ctx context.Context, conversationID, userID, messageID int64) (*ConversationMember, error) {
+	query := `
+	UPDATE conversation_members SET
+	  last_read_id = GREATEST(last_read_id, (
+	    SELECT COALESCE(MAX(id), 0)
+	    FROM messages
+	    WHERE conversation_id = $1 AND ($3::bigint = 0 OR id <= $3::bigint)
+	  )),
+	  last_read_at = NOW()
+	WHERE conversation_id = $1 AND user_id = $2
+	RETURNING user_id, last_read_id, last_read_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	m := &ConversationMember{}
+	err := cs.db.QueryRowContext(ctx, query, conversationID, userID, messageID).Scan(&m.ID, &m.LastReadID, &m.LastReadAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Leave removes the user from the conversation, ErrNotFound when they are
+// not a member. A conversation left by everyone is deleted.
+func (cs *ConversationsStore) Leave(ctx context.Context, conversationID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(cs.db, ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM conversation_members WHERE conversation_id = $1 AND user_id = $2`
+		res, err := tx.ExecContext(ctx, query, conversationID, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query = `
+		DELETE FROM conversations c
+		WHERE c.id = $1
+		AND NOT EXISTS (SELECT 1 FROM conversation_members cm WHERE cm.conversation_id = c.id)
+		`
+		_, err = tx.ExecContext(ctx, query, conversationID)
+		return err
+	})
+}
+
+// GetUnmessageable returns the ones of recipientIDs senderID may not start
+// or continue a conversation with: users that do not exist or are not
+// active, that blocked the sender or were blocked by them, and users only
+// taking messages from the users they follow who do not follow the sender.
+func (cs *ConversationsStore) GetUnmessageable(ctx context.Context, senderID int64, recipientIDs []int64) ([]int64, error) {
+	query := `
+	SELECT r.id
+	FROM unnest($2::bigint[]) r(id)
+	WHERE
+	  NOT EXISTS (SELECT 1 FROM users u WHERE u.id = r.id AND u.active)
+	  OR EXISTS (
+	    SELECT 1 FROM user_blocks b
+	    WHERE (b.user_id = r.id AND b.blocked_id = $1) OR (b.user_id = $1 AND b.blocked_id = r.id)
+	  )
+	  OR (
+	    EXISTS (SELECT 1 FROM message_settings s WHERE s.user_id = r.id AND s.followed_only)
+	    AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = r.id AND f.follow_id = $1)
+	  )
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := cs.db.QueryContext(ctx, query, senderID, pq.Array(recipientIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (cs *ConversationsStore) GetSettings(ctx context.Context, userID int64) (*MessageSettings, error) {
+	query := `SELECT followed_only FROM message_settings WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	s := &MessageSettings{}
+	err := cs.db.QueryRowContext(ctx, query, userID).Scan(&s.FollowedOnly)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (cs *ConversationsStore) SetSettings(ctx context.Context, userID int64, s *MessageSettings) error {
+	query := `
+	INSERT INTO message_settings (user_id, followed_only)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET followed_only = EXCLUDED.followed_only
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := cs.db.ExecContext(ctx, query, userID, s.FollowedOnly)
+	return err
+}
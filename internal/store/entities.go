@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dubass83/go_social/internal/entities"
+	"github.com/lib/pq"
+)
+
+// The mentions and hashtags of posts and comments live in <kind>_mentions
+// and <kind>_hashtags keyed by <kind>_id.
+const (
+	entityKindPost    = "post"
+	entityKindComment = "comment"
+)
+
+// setEntitiesTx parses content, replaces the stored mentions and hashtags of
+// the post or comment id and returns the entities with the mentioned users
+// resolved. Mentions of unknown usernames are kept without a user ID.
+func setEntitiesTx(ctx context.Context, tx *sql.Tx, kind string, id int64, content string) (*entities.Entities, error) {
+	e := entities.Parse(content)
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+kind+`_mentions WHERE `+kind+`_id = $1`, id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+kind+`_hashtags WHERE `+kind+`_id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	if usernames := e.Usernames(); len(usernames) > 0 {
+		query := `
+		WITH mentioned AS (
+		   SELECT id, username FROM users WHERE username = ANY($2)
+		), inserted AS (
+		   INSERT INTO ` + kind + `_mentions (` + kind + `_id, user_id)
+		   SELECT $1, id FROM mentioned
+		   ON CONFLICT DO NOTHING
+		)
+		SELECT id, username FROM mentioned
+		`
+		rows, err := tx.QueryContext(ctx, query, id, pq.Array(usernames))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		userIDs := map[string]int64{}
+		for rows.Next() {
+			var userID int64
+			var username string
+			if err := rows.Scan(&userID, &username); err != nil {
+				return nil, err
+			}
+			userIDs[username] = userID
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		e.ResolveMentions(userIDs)
+	}
+
+	if tags := e.Tags(); len(tags) > 0 {
+		query := `INSERT INTO hashtags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, pq.Array(tags)); err != nil {
+			return nil, err
+		}
+
+		query = `
+		   INSERT INTO ` + kind + `_hashtags (` + kind + `_id, hashtag_id)
+		   SELECT $1, id FROM hashtags WHERE name = ANY($2)
+		   ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, id, pq.Array(tags)); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// getMentionedUserIDs returns the stored mentions of the posts or comments
+// ids as id -> username -> user ID
+func getMentionedUserIDs(ctx context.Context, db *sql.DB, kind string, ids []int64) (map[int64]map[string]int64, error) {
+	mentioned := map[int64]map[string]int64{}
+	if len(ids) == 0 {
+		return mentioned, nil
+	}
+
+	query := `
+	SELECT m.` + kind + `_id, u.id, u.username
+	FROM ` + kind + `_mentions m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.` + kind + `_id = ANY($1)
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, userID int64
+		var username string
+		if err := rows.Scan(&id, &userID, &username); err != nil {
+			return nil, err
+		}
+		if mentioned[id] == nil {
+			mentioned[id] = map[string]int64{}
+		}
+		mentioned[id][username] = userID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mentioned, nil
+}
+
+// attachPostEntities sets the entities of the posts from their content and
+// the stored mentions
+func attachPostEntities(ctx context.Context, db *sql.DB, posts []*Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	mentioned, err := getMentionedUserIDs(ctx, db, entityKindPost, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Entities = entities.Parse(p.Content)
+		p.Entities.ResolveMentions(mentioned[p.ID])
+	}
+	return nil
+}
@@ -21,13 +21,23 @@ func NewFollowsStore(db *sql.DB) *FollowsStore {
 	}
 }
 
-func (fs *FollowsStore) CreateFollow(ctx context.Context, userID, followID int64) error {
-	query := `INSERT INTO followers (user_id, follow_id) VALUES ($1, $2)`
+// CreateFollow makes userID follow followID and reports whether it did not
+// already, following twice is a no-op
+func (fs *FollowsStore) CreateFollow(ctx context.Context, userID, followID int64) (bool, error) {
+	query := `INSERT INTO followers (user_id, follow_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return fs.db.QueryRowContext(ctx, query, userID, followID).Err()
+	res, err := fs.db.ExecContext(ctx, query, userID, followID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
 }
 
 func (fs *FollowsStore) DeleteFollow(ctx context.Context, userID, followID int64) error {
@@ -38,3 +48,30 @@ func (fs *FollowsStore) DeleteFollow(ctx context.Context, userID, followID int64
 
 	return fs.db.QueryRowContext(ctx, query, userID, followID).Err()
 }
+
+// GetFollowerIDs returns the IDs of the users following userID
+func (fs *FollowsStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `SELECT user_id FROM followers WHERE follow_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := fs.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
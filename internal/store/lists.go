@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// List is a named list of accounts curated by its owner UserID
+type List struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Private      bool      `json:"private"`
+	MembersCount int       `json:"members_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ListMember is an account on a list
+type ListMember struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListsStore struct {
+	db *sql.DB
+}
+
+func NewListsStore(db *sql.DB) *ListsStore {
+	return &ListsStore{db: db}
+}
+
+const listColumns = `
+	l.id, l.user_id, l.name, l.description, l.private,
+	(SELECT COUNT(*) FROM list_members m WHERE m.list_id = l.id),
+	l.created_at, l.updated_at`
+
+func scanList(row interface{ Scan(...any) error }) (*List, error) {
+	l := &List{}
+	err := row.Scan(&l.ID, &l.UserID, &l.Name, &l.Description, &l.Private, &l.MembersCount, &l.CreatedAt, &l.UpdatedAt)
+	return l, err
+}
+
+func (ls *ListsStore) Create(ctx context.Context, l *List) error {
+	query := `
+	INSERT INTO lists (user_id, name, description, private)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return ls.db.QueryRowContext(ctx, query, l.UserID, l.Name, l.Description, l.Private).Scan(&l.ID, &l.CreatedAt, &l.UpdatedAt)
+}
+
+func (ls *ListsStore) GetByID(ctx context.Context, id int64) (*List, error) {
+	query := `SELECT ` + listColumns + ` FROM lists l WHERE l.id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	l, err := scanList(ls.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// GetByUserID returns the lists of userID, latest first. The private ones
+// are only returned to their owner.
+func (ls *ListsStore) GetByUserID(ctx context.Context, userID, viewerID int64) ([]*List, error) {
+	query := `
+	SELECT ` + listColumns + `
+	FROM lists l
+	WHERE l.user_id = $1 AND (NOT l.private OR l.user_id = $2)
+	ORDER BY l.created_at DESC, l.id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ls.db.QueryContext(ctx, query, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		l, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+func (ls *ListsStore) Update(ctx context.Context, l *List) error {
+	query := `
+	UPDATE lists
+	SET name = $2, description = $3, private = $4, updated_at = NOW()
+	WHERE id = $1
+	RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ls.db.QueryRowContext(ctx, query, l.ID, l.Name, l.Description, l.Private).Scan(&l.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (ls *ListsStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM lists WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ls.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// AddMember puts userID on the list, adding a member again is a no-op. It
+// returns ErrNotFound when there is no such user and ErrLimitExceeded when
+// the list already has max members.
+func (ls *ListsStore) AddMember(ctx context.Context, listID, userID int64, max int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ls.db, ctx, func(tx *sql.Tx) error {
+		// serialize concurrent additions to the same list so the limit holds
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID); err != nil {
+			return err
+		}
+
+		var exists, member bool
+		var count int
+		query := `
+		SELECT
+		    EXISTS (SELECT 1 FROM users WHERE id = $2),
+		    EXISTS (SELECT 1 FROM list_members WHERE list_id = $1 AND user_id = $2),
+		    (SELECT COUNT(*) FROM list_members WHERE list_id = $1)
+		`
+		if err := tx.QueryRowContext(ctx, query, listID, userID).Scan(&exists, &member, &count); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		if member {
+			return nil
+		}
+		if count >= max {
+			return ErrLimitExceeded
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO list_members (list_id, user_id) VALUES ($1, $2)`, listID, userID)
+		return err
+	})
+}
+
+func (ls *ListsStore) RemoveMember(ctx context.Context, listID, userID int64) error {
+	query := `DELETE FROM list_members WHERE list_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ls.db.ExecContext(ctx, query, listID, userID)
+	return err
+}
+
+// GetMembers returns the accounts on the list, the latest added first
+func (ls *ListsStore) GetMembers(ctx context.Context, listID int64) ([]ListMember, error) {
+	query := `
+	SELECT u.id, u.username, m.created_at
+	FROM list_members m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.list_id = $1
+	ORDER BY m.created_at DESC, u.id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ls.db.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ListMember{}
+	for rows.Next() {
+		var m ListMember
+		if err := rows.Scan(&m.ID, &m.Username, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
@@ -0,0 +1,366 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// MediaProcessing images are not served until their metadata is
+	// stripped
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	// MediaFailed images could not be processed and are never served
+	MediaFailed = "failed"
+)
+
+// Media is a file a user uploaded to attach to posts and comments
+type Media struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// Key addresses the file in the blob store
+	Key         string `json:"-"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Filename    string `json:"filename"`
+	Status      string `json:"status"`
+	// Width, Height and Blurhash are set once an image is processed
+	Width    *int           `json:"width"`
+	Height   *int           `json:"height"`
+	Blurhash *string        `json:"blurhash"`
+	Variants []MediaVariant `json:"variants"`
+	// URL is a signed download link, the API sets it on every response
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	// Attempts counts how often processing was tried
+	Attempts int `json:"-"`
+}
+
+// Variant returns the variant of an image by name
+func (m *Media) Variant(name string) (MediaVariant, bool) {
+	for _, v := range m.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return MediaVariant{}, false
+}
+
+// MediaVariant is a smaller size of an image
+type MediaVariant struct {
+	Name        string `json:"name"`
+	Key         string `json:"-"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func NewMediaStore(db *sql.DB) *MediaStore {
+	return &MediaStore{db: db}
+}
+
+const mediaColumns = `m.id, m.user_id, m.key, m.content_type, m.size, m.filename, m.status, m.width, m.height, m.blurhash, m.attempts, m.created_at`
+
+func scanMedia(row interface{ Scan(...any) error }, extra ...any) (Media, error) {
+	m := Media{Variants: []MediaVariant{}}
+	dest := append([]any{&m.ID, &m.UserID, &m.Key, &m.ContentType, &m.Size, &m.Filename, &m.Status, &m.Width, &m.Height, &m.Blurhash, &m.Attempts, &m.CreatedAt}, extra...)
+	err := row.Scan(dest...)
+	return m, err
+}
+
+// Create stores media, images are created processing and other files ready
+func (ms *MediaStore) Create(ctx context.Context, m *Media) error {
+	query := `
+	INSERT INTO media (user_id, key, content_type, size, filename, status)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if m.Variants == nil {
+		m.Variants = []MediaVariant{}
+	}
+	return ms.db.QueryRowContext(ctx, query, m.UserID, m.Key, m.ContentType, m.Size, m.Filename, m.Status).Scan(&m.ID, &m.CreatedAt)
+}
+
+func (ms *MediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media m WHERE m.id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	m, err := scanMedia(ms.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	variants, err := getVariants(ctx, ms.db, []int64{m.ID})
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := variants[m.ID]; ok {
+		m.Variants = v
+	}
+	return &m, nil
+}
+
+// GetOwned returns the media of ids that userID uploaded, by ID
+func (ms *MediaStore) GetOwned(ctx context.Context, userID int64, ids []int64) (map[int64]Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media m WHERE m.id = ANY($1) AND m.user_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ms.db.QueryContext(ctx, query, pq.Array(ids), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := map[int64]Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		owned[m.ID] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	variants, err := getVariants(ctx, ms.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, v := range variants {
+		if m, ok := owned[id]; ok {
+			m.Variants = v
+			owned[id] = m
+		}
+	}
+	return owned, nil
+}
+
+// Delete deletes the media and detaches it from posts and comments, the
+// file is left to the caller
+func (ms *MediaStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM media WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ms.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// ClaimProcessing returns up to limit images waiting to be processed. They
+// are leased, so other replicas skip them until the lease runs out, and a
+// replica going away mid-processing only delays them.
+func (ms *MediaStore) ClaimProcessing(ctx context.Context, limit int, lease time.Duration) ([]*Media, error) {
+	query := `
+	UPDATE media m
+	SET process_after = NOW() + make_interval(secs => $2), attempts = m.attempts + 1
+	WHERE m.id IN (
+	  SELECT id
+	  FROM media
+	  WHERE status = 'processing' AND process_after <= NOW()
+	  ORDER BY process_after
+	  LIMIT $1
+	  FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + mediaColumns + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ms.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claimed := []*Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, &m)
+	}
+	return claimed, rows.Err()
+}
+
+// SetProcessed marks an image ready with its size, dimensions, blurhash and
+// variants
+func (ms *MediaStore) SetProcessed(ctx context.Context, m *Media) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ms.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE media
+		SET status = 'ready', size = $2, width = $3, height = $4, blurhash = $5
+		WHERE id = $1 AND status = 'processing'
+		`
+		res, err := tx.ExecContext(ctx, query, m.ID, m.Size, m.Width, m.Height, m.Blurhash)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// deleted while it was processed
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM media_variants WHERE media_id = $1`, m.ID); err != nil {
+			return err
+		}
+		query = `
+		INSERT INTO media_variants (media_id, name, key, content_type, width, height, size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+		for _, v := range m.Variants {
+			if _, err := tx.ExecContext(ctx, query, m.ID, v.Name, v.Key, v.ContentType, v.Width, v.Height, v.Size); err != nil {
+				return err
+			}
+		}
+		m.Status = MediaReady
+		return nil
+	})
+}
+
+// SetFailed gives up on processing an image
+func (ms *MediaStore) SetFailed(ctx context.Context, id int64) error {
+	query := `UPDATE media SET status = 'failed' WHERE id = $1 AND status = 'processing'`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ms.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// getVariants returns the variants of media by their ID, from the smallest
+func getVariants(ctx context.Context, db *sql.DB, ids []int64) (map[int64][]MediaVariant, error) {
+	variants := map[int64][]MediaVariant{}
+	if len(ids) == 0 {
+		return variants, nil
+	}
+
+	query := `
+	SELECT media_id, name, key, content_type, width, height, size
+	FROM media_variants
+	WHERE media_id = ANY($1)
+	ORDER BY media_id, width
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var v MediaVariant
+		if err := rows.Scan(&id, &v.Name, &v.Key, &v.ContentType, &v.Width, &v.Height, &v.Size); err != nil {
+			return nil, err
+		}
+		variants[id] = append(variants[id], v)
+	}
+	return variants, rows.Err()
+}
+
+// setMediaTx attaches media in order to the post or comment of kind id
+func setMediaTx(ctx context.Context, tx *sql.Tx, kind string, id int64, media []Media) error {
+	query := `INSERT INTO ` + kind + `_media (` + kind + `_id, media_id, position) VALUES ($1, $2, $3)`
+	for i, m := range media {
+		if _, err := tx.ExecContext(ctx, query, id, m.ID, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAttachedMedia returns the media attached to the posts or comments of
+// kind by their ID, in order
+func getAttachedMedia(ctx context.Context, db *sql.DB, kind string, ids []int64) (map[int64][]Media, error) {
+	attached := map[int64][]Media{}
+	if len(ids) == 0 {
+		return attached, nil
+	}
+
+	query := `
+	SELECT ` + mediaColumns + `, a.` + kind + `_id
+	FROM ` + kind + `_media a
+	JOIN media m ON m.id = a.media_id
+	WHERE a.` + kind + `_id = ANY($1)
+	ORDER BY a.` + kind + `_id, a.position
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mediaIDs []int64
+	for rows.Next() {
+		var id int64
+		m, err := scanMedia(rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		attached[id] = append(attached[id], m)
+		mediaIDs = append(mediaIDs, m.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	variants, err := getVariants(ctx, db, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, media := range attached {
+		for i := range media {
+			if v, ok := variants[media[i].ID]; ok {
+				media[i].Variants = v
+			}
+		}
+	}
+	return attached, nil
+}
+
+// attachPostMedia sets the media of posts
+func attachPostMedia(ctx context.Context, db *sql.DB, posts []*Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	attached, err := getAttachedMedia(ctx, db, entityKindPost, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.Media = attached[p.ID]
+		if p.Media == nil {
+			p.Media = []Media{}
+		}
+	}
+	return nil
+}
@@ -1,12 +1,41 @@
 package store
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dubass83/go_social/internal/entities"
+	"github.com/google/uuid"
 )
 
 func NewMockStorage() *Storage {
 	return &Storage{
-		User: &MockUserStore{},
+		User:                   &MockUserStore{},
+		Post:                   &MockPostStore{},
+		Comment:                &MockCommentStore{},
+		Follow:                 &MockFollowStore{},
+		Media:                  &MockMediaStore{},
+		Block:                  &MockBlockStore{},
+		Conversation:           &MockConversationStore{},
+		Pin:                    &MockPinStore{},
+		Bookmark:               &MockBookmarkStore{},
+		Repost:                 &MockRepostStore{},
+		Trending:               &MockTrendingStore{},
+		Timeline:               &MockTimelineStore{},
+		Role:                   &MockRoleStore{},
+		Community:              &MockCommunityStore{},
+		List:                   &MockListStore{},
+		Webhook:                &MockWebhookStore{},
+		TagFollow:              &MockTagFollowStore{},
+		Ranking:                &MockRankingStore{},
+		Suggestion:             &MockSuggestionStore{},
+		Notification:           &MockNotificationStore{},
+		NotificationPreference: &MockNotificationPreferenceStore{},
 	}
 }
 
@@ -22,7 +51,7 @@ func (mus *MockUserStore) CreateAndInviteTx(ctx context.Context, u *User) error
 	return nil
 }
 func (mus *MockUserStore) GetByID(ctx context.Context, id int64) (*User, error) {
-	return &User{}, nil
+	return &User{ID: id, Active: true}, nil
 }
 func (mus *MockUserStore) GetByEmail(ctx context.Context, em string) (*User, error) {
 	return &User{}, nil
@@ -33,3 +62,868 @@ func (mus *MockUserStore) DeleteByID(ctx context.Context, id int64) error {
 func (mus *MockUserStore) Activate(ctx context.Context, plainToken string) error {
 	return nil
 }
+func (mus *MockUserStore) UpdateProfile(ctx context.Context, u *User) error {
+	return nil
+}
+
+// MockPostStore serves a single post owned by the test user (ID 42)
+// whose version is always 1, and lists the Listed posts. The post is
+// published unless Status is set, posted to CommunityID and has the Poll
+// attached. Saving the post resolves mentions of @user<ID> to that user.
+type MockPostStore struct {
+	Listed      []*PostWithMetadata
+	Status      string
+	Poll        *Poll
+	CommunityID *int64
+}
+
+const mockPostVersion = 1
+
+func (mps *MockPostStore) Create(ctx context.Context, p *Post) error {
+	return nil
+}
+func (mps *MockPostStore) GetByID(ctx context.Context, id string) (*Post, error) {
+	publishAt := time.Now().Add(-time.Hour)
+	status := PostStatusPublished
+	if mps.Status != "" {
+		status = mps.Status
+	}
+	return &Post{
+		ID:          1,
+		UserID:      42,
+		Title:       "title",
+		Content:     "content",
+		Version:     mockPostVersion,
+		Status:      status,
+		PublishAt:   &publishAt,
+		Visibility:  PostVisibilityPublic,
+		CommunityID: mps.CommunityID,
+	}, nil
+}
+func (mps *MockPostStore) Update(ctx context.Context, postID, version int64, p *Post) error {
+	if version != mockPostVersion {
+		return ErrConflict
+	}
+	p.ID = postID
+	p.UserID = 42
+	p.Version = version + 1
+	p.Entities = mockEntities(p.Content)
+	return nil
+}
+
+// mockEntities parses content and resolves the mentions of @user<ID>
+func mockEntities(content string) *entities.Entities {
+	e := entities.Parse(content)
+	userIDs := map[string]int64{}
+	for _, username := range e.Usernames() {
+		var id int64
+		if _, err := fmt.Sscanf(username, "user%d", &id); err == nil {
+			userIDs[username] = id
+		}
+	}
+	e.ResolveMentions(userIDs)
+	return e
+}
+
+func (mps *MockPostStore) DeleteByID(ctx context.Context, id string) error {
+	return nil
+}
+func (mps *MockPostStore) GetUserFeed(ctx context.Context, userID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+func (mps *MockPostStore) GetUserPosts(ctx context.Context, userID, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	posts := []*PostWithMetadata{}
+	for _, p := range mps.Listed {
+		if p.UserID == userID {
+			posts = append(posts, p)
+		}
+	}
+	return posts, nil
+}
+func (mps *MockPostStore) GetAllPosts(ctx context.Context, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+func (mps *MockPostStore) GetCommunityPosts(ctx context.Context, communityID, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+func (mps *MockPostStore) GetListFeed(ctx context.Context, listID, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+func (mps *MockPostStore) GetUserDrafts(ctx context.Context, userID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+func (mps *MockPostStore) Publish(ctx context.Context, p *Post, publishAt *time.Time) error {
+	p.Status = PostStatusPublished
+	if publishAt != nil && publishAt.After(time.Now()) {
+		p.Status = PostStatusScheduled
+		p.PublishAt = publishAt
+	}
+	p.Version++
+	return nil
+}
+func (mps *MockPostStore) PublishScheduled(ctx context.Context) ([]*Post, error) {
+	return []*Post{}, nil
+}
+
+func (mps *MockPostStore) IsVisibleTo(ctx context.Context, postID, viewerID int64) (bool, error) {
+	return true, nil
+}
+
+func (mps *MockPostStore) AttachDetails(ctx context.Context, viewerID int64, p *Post) error {
+	p.Poll = mps.Poll
+	return nil
+}
+
+type MockCommentStore struct{}
+
+func (mcs *MockCommentStore) Create(ctx context.Context, c *Comment) error {
+	return nil
+}
+func (mcs *MockCommentStore) GetByPostID(ctx context.Context, id int64) ([]Comment, error) {
+	return []Comment{}, nil
+}
+
+// MockFollowStore remembers who follows whom
+type MockFollowStore struct {
+	follows map[[2]int64]bool
+}
+
+func (mfs *MockFollowStore) CreateFollow(ctx context.Context, userID, followID int64) (bool, error) {
+	if mfs.follows == nil {
+		mfs.follows = map[[2]int64]bool{}
+	}
+	if mfs.follows[[2]int64{userID, followID}] {
+		return false, nil
+	}
+	mfs.follows[[2]int64{userID, followID}] = true
+	return true, nil
+}
+func (mfs *MockFollowStore) DeleteFollow(ctx context.Context, userID, followID int64) error {
+	delete(mfs.follows, [2]int64{userID, followID})
+	return nil
+}
+func (mfs *MockFollowStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	ids := []int64{}
+	for follow := range mfs.follows {
+		if follow[1] == userID {
+			ids = append(ids, follow[0])
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// MockBookmarkStore pages through the Bookmarks like the database does,
+// their CreatedAt is in RFC 3339
+type MockBookmarkStore struct {
+	Bookmarks []Bookmark
+}
+
+func (mbs *MockBookmarkStore) Save(ctx context.Context, b *Bookmark) error {
+	b.CreatedAt = time.Now().Format(time.RFC3339Nano)
+	mbs.Bookmarks = append(mbs.Bookmarks, *b)
+	return nil
+}
+func (mbs *MockBookmarkStore) Delete(ctx context.Context, userID, postID int64) error {
+	mbs.Bookmarks = slices.DeleteFunc(mbs.Bookmarks, func(b Bookmark) bool { return b.UserID == userID && b.PostID == postID })
+	return nil
+}
+func (mbs *MockBookmarkStore) GetPosts(ctx context.Context, userID int64, collection string, cq CursorPaginatedQuery) ([]*PostWithMetadata, string, error) {
+	after, err := cq.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	saved := []Cursor{}
+	for _, b := range mbs.Bookmarks {
+		createdAt, err := time.Parse(time.RFC3339Nano, b.CreatedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		c := Cursor{CreatedAt: createdAt, ID: b.PostID}
+		if b.UserID == userID && (collection == "" || b.Collection == collection) && cursorBefore(c, *after) {
+			saved = append(saved, c)
+		}
+	}
+	slices.SortFunc(saved, func(a, b Cursor) int {
+		if cursorBefore(b, a) {
+			return -1
+		}
+		return 1
+	})
+
+	posts := []*PostWithMetadata{}
+	for _, c := range saved[:min(len(saved), cq.Limit)] {
+		posts = append(posts, &PostWithMetadata{Post: Post{ID: c.ID}, Bookmarked: true})
+	}
+	next := ""
+	if len(posts) == cq.Limit {
+		next = saved[cq.Limit-1].Encode()
+	}
+	return posts, next, nil
+}
+func (mbs *MockBookmarkStore) GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	return []BookmarkCollection{}, nil
+}
+
+// cursorBefore reports whether a comes before b in (created_at, id) order
+func cursorBefore(a, b Cursor) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.ID < b.ID
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// MockPinStore has the Pinned posts of every user
+type MockPinStore struct {
+	Pinned map[int64][]int64
+}
+
+func (mps *MockPinStore) Pin(ctx context.Context, userID, postID int64, max int) error {
+	if mps.Pinned == nil {
+		mps.Pinned = map[int64][]int64{}
+	}
+	if slices.Contains(mps.Pinned[userID], postID) {
+		return nil
+	}
+	if len(mps.Pinned[userID]) >= max {
+		return ErrLimitExceeded
+	}
+	mps.Pinned[userID] = append(mps.Pinned[userID], postID)
+	return nil
+}
+func (mps *MockPinStore) Unpin(ctx context.Context, userID, postID int64) error {
+	mps.Pinned[userID] = slices.DeleteFunc(mps.Pinned[userID], func(id int64) bool { return id == postID })
+	return nil
+}
+
+// MockRepostStore remembers who reposted what
+type MockRepostStore struct {
+	reposts map[[2]int64]bool
+}
+
+func (mrs *MockRepostStore) Create(ctx context.Context, userID, postID int64) (bool, error) {
+	if mrs.reposts == nil {
+		mrs.reposts = map[[2]int64]bool{}
+	}
+	if mrs.reposts[[2]int64{userID, postID}] {
+		return false, nil
+	}
+	mrs.reposts[[2]int64{userID, postID}] = true
+	return true, nil
+}
+func (mrs *MockRepostStore) Delete(ctx context.Context, userID, postID int64) error {
+	delete(mrs.reposts, [2]int64{userID, postID})
+	return nil
+}
+
+// MockTrendingStore serves the Tags of every window as last refreshed,
+// ordered like the database does
+type MockTrendingStore struct {
+	Tags      map[string][]TrendingTag
+	Refreshed map[string]time.Duration
+}
+
+func (mts *MockTrendingStore) Refresh(ctx context.Context, window string, length time.Duration) error {
+	if mts.Refreshed == nil {
+		mts.Refreshed = map[string]time.Duration{}
+	}
+	mts.Refreshed[window] = length
+	return nil
+}
+func (mts *MockTrendingStore) GetTags(ctx context.Context, tq TrendingQuery) ([]TrendingTag, error) {
+	tags := slices.Clone(mts.Tags[tq.Window])
+	slices.SortStableFunc(tags, func(a, b TrendingTag) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+	tags = tags[min(tq.Offset, len(tags)):]
+	return tags[:min(tq.Limit, len(tags))], nil
+}
+func (mts *MockTrendingStore) GetPosts(ctx context.Context, viewerID int64, tq TrendingQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+// MockTimelineStore records the changes made to the timelines, it is safe
+// for the fan-out workers
+type MockTimelineStore struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (mts *MockTimelineStore) record(format string, args ...any) error {
+	mts.mu.Lock()
+	defer mts.mu.Unlock()
+	mts.calls = append(mts.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+// Calls are the changes made so far, like "follow 42 7"
+func (mts *MockTimelineStore) Calls() []string {
+	mts.mu.Lock()
+	defer mts.mu.Unlock()
+	return slices.Clone(mts.calls)
+}
+
+func (mts *MockTimelineStore) AddPost(ctx context.Context, post *Post, maxFollowers int) error {
+	return mts.record("post %d %d", post.UserID, post.ID)
+}
+func (mts *MockTimelineStore) AddRepost(ctx context.Context, userID, postID int64, maxFollowers int) error {
+	return mts.record("repost %d %d", userID, postID)
+}
+func (mts *MockTimelineStore) RemoveRepost(ctx context.Context, userID, postID int64) error {
+	return mts.record("undo repost %d %d", userID, postID)
+}
+func (mts *MockTimelineStore) AddFollow(ctx context.Context, userID, followID int64, backfill int) error {
+	return mts.record("follow %d %d", userID, followID)
+}
+func (mts *MockTimelineStore) RemoveFollow(ctx context.Context, userID, followID int64) error {
+	return mts.record("unfollow %d %d", userID, followID)
+}
+func (mts *MockTimelineStore) Rebuild(ctx context.Context, userID int64, backfill int) error {
+	return mts.record("rebuild %d", userID)
+}
+func (mts *MockTimelineStore) RebuildAll(ctx context.Context, maxFollowers, backfill int) (int, error) {
+	return 0, mts.record("rebuild all")
+}
+
+// MockRoleStore has the user, moderator and admin roles of the database,
+// whose IDs are their levels
+type MockRoleStore struct{}
+
+var mockRoleLevels = map[string]int{"user": 1, "moderator": 2, "admin": 3}
+
+func (mrs *MockRoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
+	level, ok := mockRoleLevels[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &Role{ID: int64(level), Name: name, Level: level}, nil
+}
+func (mrs *MockRoleStore) IsPrecedent(ctx context.Context, roleID int, name string) (bool, error) {
+	return roleID >= mockRoleLevels[name], nil
+}
+
+// MockCommunityStore keeps the members of every community with their
+// roles, ranked like the community roles in the database
+type MockCommunityStore struct {
+	members map[[2]int64]string
+}
+
+var mockCommunityRoleLevels = map[string]int{CommunityRoleMember: 1, CommunityRoleModerator: 5, CommunityRoleOwner: 10}
+
+func (mcs *MockCommunityStore) Create(ctx context.Context, c *Community, ownerID int64) error {
+	if mcs.members == nil {
+		mcs.members = map[[2]int64]string{}
+	}
+	mcs.members[[2]int64{c.ID, ownerID}] = CommunityRoleOwner
+	c.Role = CommunityRoleOwner
+	return nil
+}
+func (mcs *MockCommunityStore) GetByID(ctx context.Context, id, viewerID int64) (*Community, error) {
+	return &Community{ID: id, Name: fmt.Sprintf("community%d", id), Role: mcs.members[[2]int64{id, viewerID}]}, nil
+}
+func (mcs *MockCommunityStore) GetAll(ctx context.Context, viewerID int64, pg PaginatedFeedQuery) ([]*Community, error) {
+	return []*Community{}, nil
+}
+func (mcs *MockCommunityStore) Update(ctx context.Context, c *Community) error {
+	return nil
+}
+func (mcs *MockCommunityStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+func (mcs *MockCommunityStore) Join(ctx context.Context, communityID, userID int64) error {
+	if mcs.members == nil {
+		mcs.members = map[[2]int64]string{}
+	}
+	if _, ok := mcs.members[[2]int64{communityID, userID}]; !ok {
+		mcs.members[[2]int64{communityID, userID}] = CommunityRoleMember
+	}
+	return nil
+}
+func (mcs *MockCommunityStore) RemoveMember(ctx context.Context, communityID, userID int64) error {
+	delete(mcs.members, [2]int64{communityID, userID})
+	return nil
+}
+func (mcs *MockCommunityStore) SetRole(ctx context.Context, communityID, userID int64, role string) error {
+	if _, ok := mcs.members[[2]int64{communityID, userID}]; !ok {
+		return ErrNotFound
+	}
+	if role == CommunityRoleOwner {
+		for member, r := range mcs.members {
+			if member[0] == communityID && r == CommunityRoleOwner {
+				mcs.members[member] = CommunityRoleModerator
+			}
+		}
+	}
+	mcs.members[[2]int64{communityID, userID}] = role
+	return nil
+}
+func (mcs *MockCommunityStore) GetMember(ctx context.Context, communityID, userID int64) (*CommunityMember, error) {
+	role, ok := mcs.members[[2]int64{communityID, userID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &CommunityMember{UserID: userID, Username: fmt.Sprintf("user%d", userID), Role: role, Level: mockCommunityRoleLevels[role]}, nil
+}
+func (mcs *MockCommunityStore) GetMembers(ctx context.Context, communityID int64, pg PaginatedFeedQuery) ([]CommunityMember, error) {
+	return []CommunityMember{}, nil
+}
+func (mcs *MockCommunityStore) IsPrecedent(ctx context.Context, communityID, userID int64, requiredRole string) (bool, error) {
+	role, ok := mcs.members[[2]int64{communityID, userID}]
+	return ok && mockCommunityRoleLevels[role] >= mockCommunityRoleLevels[requiredRole], nil
+}
+
+// MockListStore serves the Lists and keeps their members, up to the
+// maximum like the database
+type MockListStore struct {
+	Lists   []*List
+	members map[int64][]int64
+}
+
+func (mls *MockListStore) Create(ctx context.Context, l *List) error {
+	l.ID = int64(len(mls.Lists) + 1)
+	mls.Lists = append(mls.Lists, l)
+	return nil
+}
+func (mls *MockListStore) GetByID(ctx context.Context, id int64) (*List, error) {
+	for _, l := range mls.Lists {
+		if l.ID == id {
+			list := *l
+			list.MembersCount = len(mls.members[id])
+			return &list, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+func (mls *MockListStore) GetByUserID(ctx context.Context, userID, viewerID int64) ([]*List, error) {
+	lists := []*List{}
+	for _, l := range mls.Lists {
+		if l.UserID == userID && (!l.Private || l.UserID == viewerID) {
+			lists = append(lists, l)
+		}
+	}
+	return lists, nil
+}
+func (mls *MockListStore) Update(ctx context.Context, l *List) error {
+	return nil
+}
+func (mls *MockListStore) Delete(ctx context.Context, id int64) error {
+	mls.Lists = slices.DeleteFunc(mls.Lists, func(l *List) bool { return l.ID == id })
+	return nil
+}
+func (mls *MockListStore) AddMember(ctx context.Context, listID, userID int64, max int) error {
+	if mls.members == nil {
+		mls.members = map[int64][]int64{}
+	}
+	if slices.Contains(mls.members[listID], userID) {
+		return nil
+	}
+	if len(mls.members[listID]) >= max {
+		return ErrLimitExceeded
+	}
+	mls.members[listID] = append(mls.members[listID], userID)
+	return nil
+}
+func (mls *MockListStore) RemoveMember(ctx context.Context, listID, userID int64) error {
+	mls.members[listID] = slices.DeleteFunc(mls.members[listID], func(id int64) bool { return id == userID })
+	return nil
+}
+func (mls *MockListStore) GetMembers(ctx context.Context, listID int64) ([]ListMember, error) {
+	members := []ListMember{}
+	for _, id := range slices.Backward(mls.members[listID]) {
+		members = append(members, ListMember{ID: id, Username: fmt.Sprintf("user%d", id)})
+	}
+	return members, nil
+}
+
+// MockWebhookStore keeps the Webhooks and the outcome of every delivery
+// attempt, webhooks failing too often are disabled like in the database
+type MockWebhookStore struct {
+	Webhooks []*Webhook
+	Attempts []MockWebhookAttempt
+}
+
+// MockWebhookAttempt is a recorded delivery attempt
+type MockWebhookAttempt struct {
+	DeliveryID  int64
+	StatusCode  int
+	Succeeded   bool
+	NextAttempt *time.Time
+}
+
+func (mws *MockWebhookStore) Create(ctx context.Context, w *Webhook) error {
+	w.ID = int64(len(mws.Webhooks) + 1)
+	w.Active = true
+	w.CreatedAt = time.Now()
+	mws.Webhooks = append(mws.Webhooks, w)
+	return nil
+}
+func (mws *MockWebhookStore) GetByID(ctx context.Context, id int64) (*Webhook, error) {
+	for _, w := range mws.Webhooks {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+func (mws *MockWebhookStore) GetByUserID(ctx context.Context, userID int64) ([]*Webhook, error) {
+	webhooks := []*Webhook{}
+	for _, w := range mws.Webhooks {
+		if w.UserID == userID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+func (mws *MockWebhookStore) Update(ctx context.Context, w *Webhook) error {
+	return nil
+}
+func (mws *MockWebhookStore) Delete(ctx context.Context, id int64) error {
+	mws.Webhooks = slices.DeleteFunc(mws.Webhooks, func(w *Webhook) bool { return w.ID == id })
+	return nil
+}
+func (mws *MockWebhookStore) Enqueue(ctx context.Context, eventID, eventType string, userIDs []int64, payload []byte) (int64, error) {
+	return 0, nil
+}
+func (mws *MockWebhookStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	return []*WebhookDelivery{}, nil
+}
+func (mws *MockWebhookStore) RecordSuccess(ctx context.Context, d *WebhookDelivery, statusCode int) error {
+	mws.Attempts = append(mws.Attempts, MockWebhookAttempt{DeliveryID: d.ID, StatusCode: statusCode, Succeeded: true})
+	if w, err := mws.GetByID(ctx, d.WebhookID); err == nil {
+		w.FailureCount = 0
+	}
+	return nil
+}
+func (mws *MockWebhookStore) RecordFailure(ctx context.Context, d *WebhookDelivery, statusCode int, reason string, nextAttempt *time.Time, disableAfter int) (bool, error) {
+	mws.Attempts = append(mws.Attempts, MockWebhookAttempt{DeliveryID: d.ID, StatusCode: statusCode, NextAttempt: nextAttempt})
+	w, err := mws.GetByID(ctx, d.WebhookID)
+	if err != nil {
+		return false, nil
+	}
+	w.FailureCount++
+	if w.Active && w.FailureCount >= disableAfter {
+		now := time.Now()
+		w.Active = false
+		w.DisabledAt = &now
+	}
+	return !w.Active, nil
+}
+func (mws *MockWebhookStore) GetDeliveries(ctx context.Context, webhookID int64, cq CursorPaginatedQuery) ([]*WebhookDelivery, string, error) {
+	return []*WebhookDelivery{}, "", nil
+}
+
+// MockTagFollowStore remembers the tags every user follows, latest first
+type MockTagFollowStore struct {
+	tags map[int64][]FollowedTag
+}
+
+func (mts *MockTagFollowStore) Follow(ctx context.Context, userID int64, tag string) error {
+	if mts.tags == nil {
+		mts.tags = map[int64][]FollowedTag{}
+	}
+	if slices.ContainsFunc(mts.tags[userID], func(t FollowedTag) bool { return t.Tag == tag }) {
+		return nil
+	}
+	followed := FollowedTag{Tag: tag, CreatedAt: time.Now().Format(time.RFC3339Nano)}
+	mts.tags[userID] = append([]FollowedTag{followed}, mts.tags[userID]...)
+	return nil
+}
+func (mts *MockTagFollowStore) Unfollow(ctx context.Context, userID int64, tag string) error {
+	if mts.tags == nil {
+		return nil
+	}
+	mts.tags[userID] = slices.DeleteFunc(mts.tags[userID], func(t FollowedTag) bool { return t.Tag == tag })
+	return nil
+}
+func (mts *MockTagFollowStore) GetByUserID(ctx context.Context, userID int64) ([]FollowedTag, error) {
+	return append([]FollowedTag{}, mts.tags[userID]...), nil
+}
+
+// MockRankingStore ranks every feed as the Ranked posts. Sessions keep the
+// order they were created with, like the snapshots in the database.
+type MockRankingStore struct {
+	Weights  RankingWeights
+	Ranked   []int64
+	sessions map[string]*FeedSession
+}
+
+func (mrs *MockRankingStore) GetWeights(ctx context.Context) (*RankingWeights, error) {
+	w := mrs.Weights
+	return &w, nil
+}
+func (mrs *MockRankingStore) SetWeights(ctx context.Context, w *RankingWeights) error {
+	w.UpdatedAt = time.Now().Format(time.RFC3339)
+	mrs.Weights = *w
+	return nil
+}
+func (mrs *MockRankingStore) CreateSession(ctx context.Context, userID int64, pg PaginatedFeedQuery, opts RankedFeedOptions) (*FeedSession, error) {
+	if mrs.sessions == nil {
+		mrs.sessions = map[string]*FeedSession{}
+	}
+	ranked := mrs.Ranked[:min(opts.MaxCandidates, len(mrs.Ranked))]
+	session := &FeedSession{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		PostIDs:   slices.Clone(ranked),
+		CreatedAt: time.Now(),
+	}
+	mrs.sessions[session.ID] = session
+	return session, nil
+}
+func (mrs *MockRankingStore) GetSessionPage(ctx context.Context, userID int64, sessionID string, ttl time.Duration, limit, offset int) ([]*PostWithMetadata, bool, error) {
+	session, ok := mrs.sessions[sessionID]
+	if !ok || session.UserID != userID || time.Since(session.CreatedAt) > ttl {
+		return nil, false, ErrNotFound
+	}
+	ids := session.PostIDs[min(offset, len(session.PostIDs)):]
+	ids = ids[:min(limit, len(ids))]
+
+	feed := []*PostWithMetadata{}
+	for _, id := range ids {
+		feed = append(feed, &PostWithMetadata{Post: Post{ID: id}})
+	}
+	return feed, offset+limit < len(session.PostIDs), nil
+}
+
+// MockSuggestionStore suggests the same Suggestions to everyone and counts
+// how often they were computed
+type MockSuggestionStore struct {
+	Suggestions []Suggestion
+	Computed    int
+}
+
+func (mss *MockSuggestionStore) GetForUser(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	mss.Computed++
+	return mss.Suggestions[:min(limit, len(mss.Suggestions))], nil
+}
+
+// MockNotificationStore keeps the notifications in memory and groups the
+// unread ones like the database does, actor N is called userN. It is safe
+// for the goroutines notifications are added from.
+type MockNotificationStore struct {
+	mu            sync.Mutex
+	notifications []*mockNotification
+}
+
+type mockNotification struct {
+	Notification
+	actorIDs []int64
+}
+
+// notification returns a copy of the notification as the database would
+func (mn *mockNotification) notification() *Notification {
+	n := mn.Notification
+	n.Actors = []NotificationActor{}
+	for _, id := range mn.actorIDs[:min(len(mn.actorIDs), notificationActorsShown)] {
+		n.Actors = append(n.Actors, NotificationActor{ID: id, Username: fmt.Sprintf("user%d", id)})
+	}
+	n.ActorsCount = len(mn.actorIDs)
+	n.summarize()
+	return &n
+}
+
+func (mns *MockNotificationStore) Add(ctx context.Context, n *Notification, actorID int64) error {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+
+	now := time.Now()
+	for _, mn := range mns.notifications {
+		if mn.UserID == n.UserID && mn.ReadAt == nil && mn.groupKey() == n.groupKey() {
+			mn.actorIDs = append([]int64{actorID}, slices.DeleteFunc(mn.actorIDs, func(id int64) bool { return id == actorID })...)
+			mn.CommentID = n.CommentID
+			mn.UpdatedAt = now
+			*n = *mn.notification()
+			return nil
+		}
+	}
+
+	mn := &mockNotification{Notification: *n, actorIDs: []int64{actorID}}
+	mn.ID = int64(len(mns.notifications) + 1)
+	mn.CreatedAt = now
+	mn.UpdatedAt = now
+	mns.notifications = append(mns.notifications, mn)
+	*n = *mn.notification()
+	return nil
+}
+
+// find returns the notifications of the user most recently updated first
+func (mns *MockNotificationStore) find(userID int64, match func(*mockNotification) bool) []*Notification {
+	found := []*Notification{}
+	for i := len(mns.notifications) - 1; i >= 0; i-- {
+		if mn := mns.notifications[i]; mn.UserID == userID && match(mn) {
+			found = append(found, mn.notification())
+		}
+	}
+	slices.SortStableFunc(found, func(a, b *Notification) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+	return found
+}
+
+func (mns *MockNotificationStore) GetByUserID(ctx context.Context, userID int64, nq NotificationsQuery) ([]*Notification, string, error) {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+
+	found := mns.find(userID, func(mn *mockNotification) bool { return !nq.Unread || mn.ReadAt == nil })
+	return found[:min(len(found), nq.Limit)], "", nil
+}
+func (mns *MockNotificationStore) CountUnread(ctx context.Context, userID int64) (int, error) {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+
+	return len(mns.find(userID, func(mn *mockNotification) bool { return mn.ReadAt == nil })), nil
+}
+func (mns *MockNotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+
+	for _, mn := range mns.notifications {
+		if mn.ID == id && mn.UserID == userID {
+			if mn.ReadAt == nil {
+				now := time.Now()
+				mn.ReadAt = &now
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+func (mns *MockNotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+
+	now := time.Now()
+	for _, mn := range mns.notifications {
+		if mn.UserID == userID && mn.ReadAt == nil {
+			mn.ReadAt = &now
+		}
+	}
+	return nil
+}
+func (mns *MockNotificationStore) GetUnreadSince(ctx context.Context, userID int64, since time.Time, kinds []string, limit int) ([]*Notification, error) {
+	mns.mu.Lock()
+	defer mns.mu.Unlock()
+
+	found := mns.find(userID, func(mn *mockNotification) bool {
+		return mn.ReadAt == nil && mn.UpdatedAt.After(since) && slices.Contains(kinds, mn.Kind)
+	})
+	return found[:min(len(found), limit)], nil
+}
+
+// MockNotificationPreferenceStore has the default preferences for everybody
+// and remembers who unsubscribed from emails
+type MockNotificationPreferenceStore struct {
+	mu           sync.Mutex
+	Unsubscribed []int64
+}
+
+func (mps *MockNotificationPreferenceStore) Get(ctx context.Context, userID int64) (*NotificationPreferences, error) {
+	return DefaultNotificationPreferences(), nil
+}
+func (mps *MockNotificationPreferenceStore) Set(ctx context.Context, userID int64, p *NotificationPreferences) error {
+	return nil
+}
+func (mps *MockNotificationPreferenceStore) GetChannel(ctx context.Context, userID int64, kind string) (string, error) {
+	return ChannelInApp, nil
+}
+func (mps *MockNotificationPreferenceStore) UnsubscribeEmail(ctx context.Context, userID int64) error {
+	mps.mu.Lock()
+	defer mps.mu.Unlock()
+
+	mps.Unsubscribed = append(mps.Unsubscribed, userID)
+	return nil
+}
+func (mps *MockNotificationPreferenceStore) GetDueDigests(ctx context.Context, now time.Time, limit int) ([]DigestRecipient, error) {
+	return []DigestRecipient{}, nil
+}
+func (mps *MockNotificationPreferenceStore) MarkDigestSent(ctx context.Context, userID int64, sentAt time.Time) error {
+	return nil
+}
+
+type MockMediaStore struct{}
+
+func (mms *MockMediaStore) Create(ctx context.Context, m *Media) error {
+	return nil
+}
+func (mms *MockMediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	return nil, ErrNotFound
+}
+func (mms *MockMediaStore) GetOwned(ctx context.Context, userID int64, ids []int64) (map[int64]Media, error) {
+	return map[int64]Media{}, nil
+}
+func (mms *MockMediaStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+func (mms *MockMediaStore) ClaimProcessing(ctx context.Context, limit int, lease time.Duration) ([]*Media, error) {
+	return []*Media{}, nil
+}
+func (mms *MockMediaStore) SetProcessed(ctx context.Context, m *Media) error {
+	return nil
+}
+func (mms *MockMediaStore) SetFailed(ctx context.Context, id int64) error {
+	return nil
+}
+
+// MockBlockStore reports Blocks as the blocks among any users
+type MockBlockStore struct {
+	Blocks []UserBlock
+}
+
+func (mbs *MockBlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	return nil
+}
+func (mbs *MockBlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	return nil
+}
+func (mbs *MockBlockStore) GetByUserID(ctx context.Context, userID int64) ([]BlockedUser, error) {
+	return []BlockedUser{}, nil
+}
+func (mbs *MockBlockStore) GetAmong(ctx context.Context, userIDs []int64) ([]UserBlock, error) {
+	return mbs.Blocks, nil
+}
+
+// MockConversationStore has the one Conversation every member sees
+type MockConversationStore struct {
+	Conversation *Conversation
+}
+
+func (mcs *MockConversationStore) Create(ctx context.Context, userID int64, memberIDs []int64, title *string) (int64, bool, error) {
+	return 1, true, nil
+}
+func (mcs *MockConversationStore) GetByID(ctx context.Context, id, userID int64) (*Conversation, error) {
+	if mcs.Conversation == nil || mcs.Conversation.ID != id {
+		return nil, ErrNotFound
+	}
+	return mcs.Conversation, nil
+}
+func (mcs *MockConversationStore) GetByUserID(ctx context.Context, userID int64, cq CursorPaginatedQuery) ([]*Conversation, string, error) {
+	return []*Conversation{}, "", nil
+}
+func (mcs *MockConversationStore) AddMessage(ctx context.Context, m *Message) error {
+	m.ID = 1
+	m.CreatedAt = time.Now()
+	return nil
+}
+func (mcs *MockConversationStore) GetMessages(ctx context.Context, conversationID int64, cq CursorPaginatedQuery) ([]*Message, string, error) {
+	return []*Message{}, "", nil
+}
+func (mcs *MockConversationStore) MarkRead(ctx context.Context, conversationID, userID, messageID int64) (*ConversationMember, error) {
+	return &ConversationMember{ID: userID}, nil
+}
+func (mcs *MockConversationStore) Leave(ctx context.Context, conversationID, userID int64) error {
+	return nil
+}
+func (mcs *MockConversationStore) GetUnmessageable(ctx context.Context, senderID int64, recipientIDs []int64) ([]int64, error) {
+	return []int64{}, nil
+}
+func (mcs *MockConversationStore) GetSettings(ctx context.Context, userID int64) (*MessageSettings, error) {
+	return &MessageSettings{}, nil
+}
+func (mcs *MockConversationStore) SetSettings(ctx context.Context, userID int64, s *MessageSettings) error {
+	return nil
+}
@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channels notifications are delivered through. Email notifications are
+// shown in-app too and summed up in the digest.
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+	ChannelNone  = "none"
+)
+
+// How often digests are sent
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+// NotificationKinds are the kinds of notifications users have preferences for
+var NotificationKinds = []string{NotificationFollow, NotificationComment, NotificationMention, NotificationRepost, NotificationPost}
+
+type NotificationPreferences struct {
+	// Channels maps every kind of notification to its channel
+	Channels map[string]string `json:"channels"`
+	Digest   string            `json:"digest"`
+}
+
+// DefaultNotificationPreferences delivers everything in-app and sends a
+// daily digest once some kind is switched to email
+func DefaultNotificationPreferences() *NotificationPreferences {
+	p := &NotificationPreferences{Channels: make(map[string]string), Digest: DigestDaily}
+	for _, kind := range NotificationKinds {
+		p.Channels[kind] = ChannelInApp
+	}
+	return p
+}
+
+// DigestRecipient is a user due for a digest of the notifications of Kinds
+// since the last one
+type DigestRecipient struct {
+	UserID    int64
+	Username  string
+	Email     string
+	Frequency string
+	Kinds     []string
+	SentAt    *time.Time
+}
+
+// Since is when the activity in the digest starts, the last digest or one
+// period ago for the first one
+func (d DigestRecipient) Since(now time.Time) time.Time {
+	if d.SentAt != nil {
+		return *d.SentAt
+	}
+	if d.Frequency == DigestWeekly {
+		return now.AddDate(0, 0, -7)
+	}
+	return now.AddDate(0, 0, -1)
+}
+
+type NotificationPreferencesStore struct {
+	db *sql.DB
+}
+
+func NewNotificationPreferencesStore(db *sql.DB) *NotificationPreferencesStore {
+	return &NotificationPreferencesStore{db: db}
+}
+
+func (ps *NotificationPreferencesStore) Get(ctx context.Context, userID int64) (*NotificationPreferences, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	prefs := DefaultNotificationPreferences()
+
+	rows, err := ps.db.QueryContext(ctx, `SELECT kind, channel FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, channel string
+		if err := rows.Scan(&kind, &channel); err != nil {
+			return nil, err
+		}
+		prefs.Channels[kind] = channel
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = ps.db.QueryRowContext(ctx, `SELECT frequency FROM notification_digests WHERE user_id = $1`, userID).Scan(&prefs.Digest)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// Set stores the channels given for some kinds and the digest frequency,
+// the other kinds keep theirs
+func (ps *NotificationPreferencesStore) Set(ctx context.Context, userID int64, prefs *NotificationPreferences) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		for kind, channel := range prefs.Channels {
+			query := `
+			INSERT INTO notification_preferences (user_id, kind, channel)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, kind) DO UPDATE SET channel = EXCLUDED.channel
+			`
+			if _, err := tx.ExecContext(ctx, query, userID, kind, channel); err != nil {
+				return err
+			}
+		}
+
+		if prefs.Digest == "" {
+			return nil
+		}
+		query := `
+		INSERT INTO notification_digests (user_id, frequency)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET frequency = EXCLUDED.frequency
+		`
+		_, err := tx.ExecContext(ctx, query, userID, prefs.Digest)
+		return err
+	})
+}
+
+// GetChannel returns how notifications of a kind reach the user
+func (ps *NotificationPreferencesStore) GetChannel(ctx context.Context, userID int64, kind string) (string, error) {
+	query := `SELECT channel FROM notification_preferences WHERE user_id = $1 AND kind = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	channel := ChannelInApp
+	err := ps.db.QueryRowContext(ctx, query, userID, kind).Scan(&channel)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return channel, nil
+}
+
+// UnsubscribeEmail stops the digests of the user, the notifications sent by
+// email are kept in-app
+func (ps *NotificationPreferencesStore) UnsubscribeEmail(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE notification_preferences SET channel = 'in_app' WHERE user_id = $1 AND channel = 'email'`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+		INSERT INTO notification_digests (user_id, frequency)
+		VALUES ($1, 'off')
+		ON CONFLICT (user_id) DO UPDATE SET frequency = 'off'
+		`
+		_, err := tx.ExecContext(ctx, query, userID)
+		return err
+	})
+}
+
+// GetDueDigests returns up to limit active users with some kind of
+// notification sent by email whose last digest is at least a period old
+func (ps *NotificationPreferencesStore) GetDueDigests(ctx context.Context, now time.Time, limit int) ([]DigestRecipient, error) {
+	query := `
+	SELECT u.id, u.username, u.email, COALESCE(d.frequency, 'daily'), d.sent_at, array_agg(p.kind ORDER BY p.kind)
+	FROM notification_preferences p
+	JOIN users u ON u.id = p.user_id AND u.active
+	LEFT JOIN notification_digests d ON d.user_id = p.user_id
+	WHERE
+	  p.channel = 'email'
+	  AND COALESCE(d.frequency, 'daily') <> 'off'
+	  AND (
+	    d.sent_at IS NULL
+	    OR d.sent_at <= $1 - CASE WHEN d.frequency = 'weekly' THEN INTERVAL '7 days' ELSE INTERVAL '1 day' END
+	  )
+	GROUP BY u.id, u.username, u.email, d.frequency, d.sent_at
+	ORDER BY d.sent_at NULLS FIRST
+	LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []DigestRecipient{}
+	for rows.Next() {
+		var d DigestRecipient
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Email, &d.Frequency, &d.SentAt, pq.Array(&d.Kinds)); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// MarkDigestSent records when the last digest of the user was sent
+func (ps *NotificationPreferencesStore) MarkDigestSent(ctx context.Context, userID int64, at time.Time) error {
+	query := `
+	INSERT INTO notification_digests (user_id, sent_at)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET sent_at = EXCLUDED.sent_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.db.ExecContext(ctx, query, userID, at)
+	return err
+}
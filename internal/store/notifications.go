@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of notifications
+const (
+	NotificationFollow  = "follow"
+	NotificationComment = "comment"
+	NotificationMention = "mention"
+	NotificationRepost  = "repost"
+	// NotificationPost tells followers that an author they follow published
+	// a post
+	NotificationPost = "post"
+)
+
+// notificationActorsShown is how many of the users who acted are listed with
+// a notification, the others are only counted
+const notificationActorsShown = 3
+
+// Notification tells a user that others acted on them or their posts. Until
+// it is read, new activity of the same kind on the same post (or every new
+// follower) is added to it instead of creating another one.
+type Notification struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"-"`
+	Kind      string `json:"kind"`
+	PostID    *int64 `json:"post_id,omitempty"`
+	CommentID *int64 `json:"comment_id,omitempty"`
+	// Actors are the most recent users who acted, ActorsCount all of them
+	Actors      []NotificationActor `json:"actors"`
+	ActorsCount int                 `json:"actors_count"`
+	// Summary describes the notification, like "alice and 2 others reposted
+	// your post"
+	Summary   string     `json:"summary"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// NotificationsQuery pages through the notifications of a user, most
+// recently updated first
+type NotificationsQuery struct {
+	CursorPaginatedQuery
+	Unread bool `json:"unread"`
+}
+
+type NotificationsStore struct {
+	db *sql.DB
+}
+
+func NewNotificationsStore(db *sql.DB) *NotificationsStore {
+	return &NotificationsStore{db: db}
+}
+
+// groupKey is what unread notifications are grouped by. Mentions in
+// different comments are told apart since each points at its comment.
+func (n *Notification) groupKey() string {
+	switch {
+	case n.PostID == nil:
+		return n.Kind
+	case n.Kind == NotificationMention && n.CommentID != nil:
+		return fmt.Sprintf("%s:%d:%d", n.Kind, *n.PostID, *n.CommentID)
+	default:
+		return fmt.Sprintf("%s:%d", n.Kind, *n.PostID)
+	}
+}
+
+func (n *Notification) summarize() {
+	if len(n.Actors) == 0 {
+		return
+	}
+
+	who := n.Actors[0].Username
+	switch others := n.ActorsCount - 1; {
+	case others == 1 && len(n.Actors) > 1:
+		who += " and " + n.Actors[1].Username
+	case others == 1:
+		who += " and 1 other"
+	case others > 1:
+		who += fmt.Sprintf(" and %d others", others)
+	}
+
+	switch n.Kind {
+	case NotificationFollow:
+		n.Summary = who + " followed you"
+	case NotificationComment:
+		n.Summary = who + " commented on your post"
+	case NotificationRepost:
+		n.Summary = who + " reposted your post"
+	case NotificationPost:
+		n.Summary = who + " published a post"
+	case NotificationMention:
+		if n.CommentID != nil {
+			n.Summary = who + " mentioned you in a comment"
+		} else {
+			n.Summary = who + " mentioned you in a post"
+		}
+	}
+}
+
+var notificationColumns = fmt.Sprintf(`
+	n.id, n.user_id, n.kind, n.post_id, n.comment_id, cardinality(n.actor_ids),
+	COALESCE((
+	  SELECT json_agg(json_build_object('id', u.id, 'username', u.username) ORDER BY a.ord)
+	  FROM unnest(n.actor_ids[1:%d]) WITH ORDINALITY a(id, ord)
+	  JOIN users u ON u.id = a.id
+	), '[]'),
+	n.read_at, n.created_at, n.updated_at`, notificationActorsShown)
+
+func scanNotification(row interface{ Scan(...any) error }) (*Notification, error) {
+	n := &Notification{}
+	var actors []byte
+	if err := row.Scan(
+		&n.ID,
+		&n.UserID,
+		&n.Kind,
+		&n.PostID,
+		&n.CommentID,
+		&n.ActorsCount,
+		&actors,
+		&n.ReadAt,
+		&n.CreatedAt,
+		&n.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(actors, &n.Actors); err != nil {
+		return nil, err
+	}
+	n.summarize()
+	return n, nil
+}
+
+// Add records that actorID acted, adding them to the unread notification of
+// the same group when there is one. The notification is filled in with the
+// group it ended up in.
+func (ns *NotificationsStore) Add(ctx context.Context, n *Notification, actorID int64) error {
+	query := `
+	WITH upserted AS (
+      INSERT INTO notifications (user_id, kind, group_key, post_id, comment_id, actor_ids)
+      VALUES ($1, $2, $3, $4, $5, ARRAY[$6::bigint])
+      ON CONFLICT (user_id, group_key) WHERE read_at IS NULL DO UPDATE SET
+        actor_ids = $6::bigint || array_remove(notifications.actor_ids, $6::bigint),
+        comment_id = EXCLUDED.comment_id,
+        updated_at = NOW()
+      RETURNING *
+    )
+    SELECT ` + notificationColumns + `
+    FROM upserted n
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	row := ns.db.QueryRowContext(ctx, query, n.UserID, n.Kind, n.groupKey(), n.PostID, n.CommentID, actorID)
+	added, err := scanNotification(row)
+	if err != nil {
+		return err
+	}
+	*n = *added
+	return nil
+}
+
+// GetByUserID returns a page of the notifications of the user together with
+// the cursor of the next page. Notifications that get new activity move to
+// the top, so a page may repeat one already seen.
+func (ns *NotificationsStore) GetByUserID(ctx context.Context, userID int64, nq NotificationsQuery) ([]*Notification, string, error) {
+	cursor, err := nq.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+	SELECT ` + notificationColumns + `
+    FROM notifications n
+    WHERE
+      n.user_id = $1
+      AND (NOT $2 OR n.read_at IS NULL)
+      AND (n.updated_at, n.id) < ($3, $4)
+    ORDER BY n.updated_at DESC, n.id DESC
+    LIMIT $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ns.db.QueryContext(ctx, query, userID, nq.Unread, cursor.CreatedAt, cursor.ID, nq.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// a short page is the last one
+	next := ""
+	if len(notifications) == nq.Limit {
+		last := notifications[len(notifications)-1]
+		next = Cursor{CreatedAt: last.UpdatedAt, ID: last.ID}.Encode()
+	}
+	return notifications, next, nil
+}
+
+// GetUnreadSince returns up to limit unread notifications of some kinds that
+// got activity after a time, for digests
+func (ns *NotificationsStore) GetUnreadSince(ctx context.Context, userID int64, since time.Time, kinds []string, limit int) ([]*Notification, error) {
+	query := `
+	SELECT ` + notificationColumns + `
+    FROM notifications n
+    WHERE
+      n.user_id = $1
+      AND n.read_at IS NULL
+      AND n.updated_at > $2
+      AND n.kind = ANY($3)
+    ORDER BY n.updated_at DESC, n.id DESC
+    LIMIT $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ns.db.QueryContext(ctx, query, userID, since, pq.Array(kinds), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnread returns the number of unread notifications of the user
+func (ns *NotificationsStore) CountUnread(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := ns.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a notification of the user as read, reading it again is
+// fine
+func (ns *NotificationsStore) MarkRead(ctx context.Context, userID, id int64) error {
+	query := `
+	UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+	WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ns.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every notification of the user as read
+func (ns *NotificationsStore) MarkAllRead(ctx context.Context, userID int64) error {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ns.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNotificationGroupKey(t *testing.T) {
+	post, otherPost := int64(1), int64(2)
+	comment, otherComment := int64(10), int64(11)
+
+	tests := []struct {
+		name      string
+		a, b      Notification
+		wantGroup bool
+	}{
+		{"should group every follow", Notification{Kind: NotificationFollow}, Notification{Kind: NotificationFollow}, true},
+		{"should group the reposts of a post", Notification{Kind: NotificationRepost, PostID: &post}, Notification{Kind: NotificationRepost, PostID: &post}, true},
+		{"should group the comments on a post", Notification{Kind: NotificationComment, PostID: &post, CommentID: &comment}, Notification{Kind: NotificationComment, PostID: &post, CommentID: &otherComment}, true},
+		{"should not group the reposts of different posts", Notification{Kind: NotificationRepost, PostID: &post}, Notification{Kind: NotificationRepost, PostID: &otherPost}, false},
+		{"should not group different kinds", Notification{Kind: NotificationRepost, PostID: &post}, Notification{Kind: NotificationComment, PostID: &post}, false},
+		{"should not group mentions in different comments", Notification{Kind: NotificationMention, PostID: &post, CommentID: &comment}, Notification{Kind: NotificationMention, PostID: &post, CommentID: &otherComment}, false},
+		{"should not group a mention in a post with one in a comment", Notification{Kind: NotificationMention, PostID: &post}, Notification{Kind: NotificationMention, PostID: &post, CommentID: &comment}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.groupKey() == tt.b.groupKey(); got != tt.wantGroup {
+				t.Errorf("expected grouping %v, got %v for %q and %q", tt.wantGroup, got, tt.a.groupKey(), tt.b.groupKey())
+			}
+		})
+	}
+}
+
+func TestNotificationSummarize(t *testing.T) {
+	comment := int64(10)
+	actors := []NotificationActor{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}, {ID: 3, Username: "carol"}}
+
+	tests := []struct {
+		name string
+		n    Notification
+		want string
+	}{
+		{"should name a single actor", Notification{Kind: NotificationFollow, Actors: actors[:1], ActorsCount: 1}, "alice followed you"},
+		{"should name both of two actors", Notification{Kind: NotificationRepost, Actors: actors[:2], ActorsCount: 2}, "alice and bob reposted your post"},
+		{"should count the other actors", Notification{Kind: NotificationComment, Actors: actors, ActorsCount: 5}, "alice and 4 others commented on your post"},
+		{"should count an actor that is not listed", Notification{Kind: NotificationFollow, Actors: actors[:1], ActorsCount: 2}, "alice and 1 other followed you"},
+		{"should tell a mention in a post", Notification{Kind: NotificationMention, Actors: actors[:1], ActorsCount: 1}, "alice mentioned you in a post"},
+		{"should tell a published post", Notification{Kind: NotificationPost, Actors: actors[:1], ActorsCount: 1}, "alice published a post"},
+		{"should tell a mention in a comment", Notification{Kind: NotificationMention, CommentID: &comment, Actors: actors[:1], ActorsCount: 1}, "alice mentioned you in a comment"},
+		{"should not summarize without actors", Notification{Kind: NotificationFollow}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.n.summarize()
+			if tt.n.Summary != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, tt.n.Summary)
+			}
+		})
+	}
+}
+
+var notificationNames = []string{"id", "user_id", "kind", "post_id", "comment_id", "actors_count", "actors", "read_at", "created_at", "updated_at"}
+
+func TestNotificationsAdd(t *testing.T) {
+	db, mock := newTestDB(t)
+	ns := NewNotificationsStore(db)
+
+	// the latest actor goes first, the unread notification of the group is
+	// updated instead of adding another one
+	post := int64(5)
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO notifications(.|\s)*ON CONFLICT \(user_id, group_key\) WHERE read_at IS NULL DO UPDATE SET\s*actor_ids = \$6::bigint \|\| array_remove\(notifications\.actor_ids, \$6::bigint\)`).
+		WithArgs(42, NotificationRepost, "repost:5", &post, nil, 8).
+		WillReturnRows(sqlmock.NewRows(notificationNames).
+			AddRow(3, 42, NotificationRepost, 5, nil, 4, `[{"id": 8, "username": "user8"}, {"id": 7, "username": "user7"}, {"id": 9, "username": "user9"}]`, nil, now, now))
+
+	n := &Notification{UserID: 42, Kind: NotificationRepost, PostID: &post}
+	if err := ns.Add(context.Background(), n, 8); err != nil {
+		t.Fatal(err)
+	}
+	if n.ID != 3 || n.ActorsCount != 4 || len(n.Actors) != 3 || n.Actors[0].Username != "user8" {
+		t.Errorf("expected notification 3 with 4 actors, user8 first, got %+v", n)
+	}
+	if want := "user8 and 3 others reposted your post"; n.Summary != want {
+		t.Errorf("expected %q, got %q", want, n.Summary)
+	}
+}
+
+func TestNotificationsGetByUserID(t *testing.T) {
+	db, mock := newTestDB(t)
+	ns := NewNotificationsStore(db)
+
+	updatedAt := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`WHERE\s*n\.user_id = \$1\s*AND \(NOT \$2 OR n\.read_at IS NULL\)\s*AND \(n\.updated_at, n\.id\) < \(\$3, \$4\)\s*ORDER BY n\.updated_at DESC, n\.id DESC\s*LIMIT \$5`).
+		WithArgs(42, true, sqlmock.AnyArg(), 0, 2).
+		WillReturnRows(sqlmock.NewRows(notificationNames).
+			AddRow(4, 42, NotificationFollow, nil, nil, 2, `[{"id": 8, "username": "user8"}, {"id": 7, "username": "user7"}]`, nil, updatedAt, updatedAt.Add(time.Hour)).
+			AddRow(2, 42, NotificationFollow, nil, nil, 1, `[{"id": 6, "username": "user6"}]`, nil, updatedAt, updatedAt))
+
+	notifications, next, err := ns.GetByUserID(context.Background(), 42, NotificationsQuery{CursorPaginatedQuery: CursorPaginatedQuery{Limit: 2}, Unread: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 || notifications[0].Summary != "user8 and user7 followed you" {
+		t.Fatalf("expected the follows of user8 and user7 first, got %+v", notifications)
+	}
+	cursor, err := DecodeCursor(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.CreatedAt.Equal(updatedAt) || cursor.ID != 2 {
+		t.Errorf("expected the next page after notification 2, got %v", cursor)
+	}
+}
+
+func TestNotificationsCountAndMarkRead(t *testing.T) {
+	db, mock := newTestDB(t)
+	ns := NewNotificationsStore(db)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM notifications WHERE user_id = \$1 AND read_at IS NULL`).
+		WithArgs(42).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectExec(`UPDATE notifications SET read_at = COALESCE\(read_at, NOW\(\)\)\s*WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(9, 42).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	count, err := ns.CountUnread(context.Background(), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 unread notifications, got %d", count)
+	}
+	if err := ns.MarkRead(context.Background(), 42, 9); err != ErrNotFound {
+		t.Errorf("expected %v marking another user's notification, got %v", ErrNotFound, err)
+	}
+}
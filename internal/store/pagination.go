@@ -1,9 +1,14 @@
 package store
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/dubass83/go_social/internal/entities"
 )
 
 type PaginatedFeedQuery struct {
@@ -12,6 +17,10 @@ type PaginatedFeedQuery struct {
 	Sort   string   `json:"sort" validate:"oneof=asc desc"`
 	Search string   `json:"search" validate:"max=100"`
 	Tags   []string `json:"tags" validate:"max=100"`
+	// Mode is latest for the chronological feed or ranked for the scored one
+	Mode string `json:"mode" validate:"omitempty,oneof=latest ranked"`
+	// Session is the ranked snapshot being paged through
+	Session string `json:"session" validate:"omitempty,uuid"`
 }
 
 func (fd PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -37,8 +46,91 @@ func (fd PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fd.Search = search
 	}
 	if tags := query.Get("tags"); tags != "" {
-		fd.Tags = strings.Split(tags, ",")
+		// tags are stored normalized, ?tags=Go finds the posts tagged go
+		fd.Tags = []string{}
+		for _, t := range strings.Split(tags, ",") {
+			tag, ok := entities.NormalizeTag(t)
+			if !ok {
+				return fd, fmt.Errorf("%q is not a valid tag", t)
+			}
+			fd.Tags = append(fd.Tags, tag)
+		}
+	}
+	if mode := query.Get("mode"); mode != "" {
+		fd.Mode = mode
+	}
+	if session := query.Get("session"); session != "" {
+		fd.Session = session
 	}
 
 	return fd, nil
 }
+
+// CursorPaginatedQuery is used by listings paginated with an opaque cursor
+// instead of an offset, the cursor of the next page is handed out by the
+// previous one
+type CursorPaginatedQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lt=101"`
+	Cursor string `json:"cursor" validate:"max=200"`
+}
+
+func (cq CursorPaginatedQuery) Parse(r *http.Request) (CursorPaginatedQuery, error) {
+	query := r.URL.Query()
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil {
+			return cq, err
+		}
+		cq.Limit = limit
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		// a malformed cursor is the client's fault, not the store's
+		if _, err := DecodeCursor(cursor); err != nil {
+			return cq, err
+		}
+		cq.Cursor = cursor
+	}
+
+	return cq, nil
+}
+
+// after returns the cursor the page starts after, the first page starts
+// after anything created so far
+func (cq CursorPaginatedQuery) after() (*Cursor, error) {
+	if cq.Cursor == "" {
+		return &Cursor{CreatedAt: time.Now().Add(time.Hour)}, nil
+	}
+	return DecodeCursor(cq.Cursor)
+}
+
+// Cursor points at the last item of a page in a listing ordered by
+// (created_at, id)
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%s|%d", c.CreatedAt.UTC().Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor: %s", s)
+	}
+
+	c := &Cursor{}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 678, time.FixedZone("CET", 3600)), ID: 42}
+
+	decoded, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.CreatedAt.Equal(c.CreatedAt) || decoded.ID != c.ID {
+		t.Errorf("expected %v, got %v", c, decoded)
+	}
+
+	for _, s := range []string{"", "***", "MjAyNC0wMS0wMVQwMDowMDowMFo", "bm90IGEgdGltZXw0Mg"} {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Errorf("expected cursor %q to be invalid", s)
+		}
+	}
+}
+
+func TestPaginatedFeedQueryParseTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "should keep no tags", query: "", want: nil},
+		{name: "should read the tags", query: "?tags=go,sql", want: []string{"go", "sql"}},
+		{name: "should normalize the tags", query: "?tags=Go,%23SQL", want: []string{"go", "sql"}},
+		{name: "should reject an invalid tag", query: "?tags=go,two%20words", wantErr: true},
+		{name: "should reject an empty tag", query: "?tags=go,", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := PaginatedFeedQuery{Limit: 10}.Parse(r)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !slices.Equal(got.Tags, tt.want) {
+				t.Errorf("expected tags %v, got %v", tt.want, got.Tags)
+			}
+		})
+	}
+}
+
+func TestCursorPaginatedQueryParse(t *testing.T) {
+	valid := Cursor{CreatedAt: time.Now(), ID: 7}.Encode()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    CursorPaginatedQuery
+		wantErr bool
+	}{
+		{name: "should keep the defaults", query: "", want: CursorPaginatedQuery{Limit: 10}},
+		{name: "should read the limit and cursor", query: "?limit=5&cursor=" + valid, want: CursorPaginatedQuery{Limit: 5, Cursor: valid}},
+		{name: "should reject a limit that is not a number", query: "?limit=ten", wantErr: true},
+		{name: "should reject a malformed cursor", query: "?cursor=garbage", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := CursorPaginatedQuery{Limit: 10}.Parse(r)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCursorPaginatedQueryAfter(t *testing.T) {
+	first, err := CursorPaginatedQuery{}.after()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.CreatedAt.After(time.Now()) {
+		t.Errorf("expected the first page to start after now, got %v", first.CreatedAt)
+	}
+}
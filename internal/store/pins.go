@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type PinsStore struct {
+	db *sql.DB
+}
+
+func NewPinsStore(db *sql.DB) *PinsStore {
+	return &PinsStore{db: db}
+}
+
+// Pin pins the post on the profile of userID. Pinning a pinned post again is
+// a no-op, pinning more than max posts returns ErrLimitExceeded.
+func (ps *PinsStore) Pin(ctx context.Context, userID, postID int64, max int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		// serialize concurrent pins of the same user so the limit holds
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return err
+		}
+
+		var pinned bool
+		var count int
+		query := `
+		SELECT
+		    EXISTS (SELECT 1 FROM pinned_posts WHERE post_id = $2),
+		    (SELECT COUNT(*) FROM pinned_posts WHERE user_id = $1)
+		`
+		if err := tx.QueryRowContext(ctx, query, userID, postID).Scan(&pinned, &count); err != nil {
+			return err
+		}
+		if pinned {
+			return nil
+		}
+		if count >= max {
+			return ErrLimitExceeded
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO pinned_posts (post_id, user_id) VALUES ($1, $2)`, postID, userID)
+		return err
+	})
+}
+
+func (ps *PinsStore) Unpin(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM pinned_posts WHERE post_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ps.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
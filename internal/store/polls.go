@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Poll is the poll a post carries
+type Poll struct {
+	ID       int64        `json:"id"`
+	PostID   int64        `json:"post_id"`
+	Multiple bool         `json:"multiple"`
+	Options  []PollOption `json:"options"`
+	// VotersCount is the number of users who voted, options of multiple
+	// choice polls may add up to more votes
+	VotersCount int       `json:"voters_count"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Closed      bool      `json:"closed"`
+	// MyVote holds the options the current user voted for, it is empty when
+	// they did not vote
+	MyVote []int64 `json:"my_vote"`
+}
+
+type PollOption struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// HasOption reports whether optionID is an option of the poll
+func (p *Poll) HasOption(optionID int64) bool {
+	for _, o := range p.Options {
+		if o.ID == optionID {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosedPoll is a poll the scheduler closed with the users to tell about it
+type ClosedPoll struct {
+	Poll     *Poll
+	AuthorID int64
+	VoterIDs []int64
+}
+
+type PollsStore struct {
+	db *sql.DB
+}
+
+func NewPollsStore(db *sql.DB) *PollsStore {
+	return &PollsStore{db: db}
+}
+
+// createPollTx adds the poll of a post being created
+func createPollTx(ctx context.Context, tx *sql.Tx, postID int64, poll *Poll) error {
+	query := `
+	INSERT INTO polls (post_id, multiple, expires_at)
+	VALUES ($1, $2, $3)
+	RETURNING id
+	`
+	if err := tx.QueryRowContext(ctx, query, postID, poll.Multiple, poll.ExpiresAt).Scan(&poll.ID); err != nil {
+		return err
+	}
+	poll.PostID = postID
+	poll.MyVote = []int64{}
+
+	for i := range poll.Options {
+		query := `INSERT INTO poll_options (poll_id, position, text) VALUES ($1, $2, $3) RETURNING id`
+		if err := tx.QueryRowContext(ctx, query, poll.ID, i, poll.Options[i].Text).Scan(&poll.Options[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPolls returns the polls of the posts by post ID with the tallies and
+// the vote of viewerID
+func getPolls(ctx context.Context, db *sql.DB, viewerID int64, postIDs []int64) (map[int64]*Poll, error) {
+	query := `
+	SELECT
+	  pl.id, pl.post_id, pl.multiple, pl.expires_at,
+	  (pl.closed_at IS NOT NULL OR pl.expires_at <= NOW()),
+	  (SELECT COUNT(*) FROM poll_votes v WHERE v.poll_id = pl.id),
+	  o.id, o.text,
+	  (SELECT COUNT(*) FROM poll_vote_choices c WHERE c.option_id = o.id),
+	  EXISTS (SELECT 1 FROM poll_vote_choices c WHERE c.option_id = o.id AND c.user_id = $2)
+	FROM polls pl
+	JOIN poll_options o ON o.poll_id = pl.id
+	WHERE pl.post_id = ANY($1)
+	ORDER BY pl.id, o.position
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := map[int64]*Poll{}
+	for rows.Next() {
+		var p Poll
+		var o PollOption
+		var mine bool
+		err := rows.Scan(&p.ID, &p.PostID, &p.Multiple, &p.ExpiresAt, &p.Closed, &p.VotersCount, &o.ID, &o.Text, &o.Votes, &mine)
+		if err != nil {
+			return nil, err
+		}
+		poll, ok := polls[p.PostID]
+		if !ok {
+			p.Options = []PollOption{}
+			p.MyVote = []int64{}
+			poll = &p
+			polls[p.PostID] = poll
+		}
+		poll.Options = append(poll.Options, o)
+		if mine {
+			poll.MyVote = append(poll.MyVote, o.ID)
+		}
+	}
+	return polls, rows.Err()
+}
+
+// attachPolls sets the polls of posts that carry one
+func attachPolls(ctx context.Context, db *sql.DB, viewerID int64, posts []*Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	polls, err := getPolls(ctx, db, viewerID, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range posts {
+		p.Poll = polls[p.ID]
+	}
+	return nil
+}
+
+// GetByPostID returns the poll of postID with the vote of viewerID,
+// ErrNotFound when the post has none
+func (ps *PollsStore) GetByPostID(ctx context.Context, postID, viewerID int64) (*Poll, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	polls, err := getPolls(ctx, ps.db, viewerID, []int64{postID})
+	if err != nil {
+		return nil, err
+	}
+	poll, ok := polls[postID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return poll, nil
+}
+
+// Vote records the vote of userID for the options. It returns ErrPollClosed
+// once the poll expired, ErrDuplicate when the user already voted and
+// ErrNotFound when an option is not one of the poll.
+func (ps *PollsStore) Vote(ctx context.Context, pollID, userID int64, optionIDs []int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		var closed bool
+		query := `SELECT closed_at IS NOT NULL OR expires_at <= NOW() FROM polls WHERE id = $1`
+		if err := tx.QueryRowContext(ctx, query, pollID).Scan(&closed); err != nil {
+			return err
+		}
+		if closed {
+			return ErrPollClosed
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO poll_votes (poll_id, user_id) VALUES ($1, $2)`, pollID, userID); err != nil {
+			return err
+		}
+
+		query = `
+		INSERT INTO poll_vote_choices (poll_id, user_id, option_id)
+		SELECT $1::bigint, $2::bigint, unnest($3::bigint[])
+		`
+		_, err := tx.ExecContext(ctx, query, pollID, userID, pq.Array(optionIDs))
+		return err
+	})
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Retract removes the vote of userID, ErrPollClosed once the poll expired
+func (ps *PollsStore) Retract(ctx context.Context, pollID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		var closed bool
+		query := `SELECT closed_at IS NOT NULL OR expires_at <= NOW() FROM polls WHERE id = $1`
+		if err := tx.QueryRowContext(ctx, query, pollID).Scan(&closed); err != nil {
+			return err
+		}
+		if closed {
+			return ErrPollClosed
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM poll_votes WHERE poll_id = $1 AND user_id = $2`, pollID, userID)
+		return err
+	})
+}
+
+// CloseExpired closes the polls of published posts that expired since the
+// last run and returns them with their final tallies, the author of their
+// post and their voters
+func (ps *PollsStore) CloseExpired(ctx context.Context) ([]ClosedPoll, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+	UPDATE polls pl
+	SET closed_at = NOW()
+	FROM posts p
+	WHERE p.id = pl.post_id AND pl.closed_at IS NULL AND pl.expires_at <= NOW()
+	  AND p.status = 'published'
+	RETURNING pl.post_id, p.user_id,
+	  ARRAY(SELECT v.user_id FROM poll_votes v WHERE v.poll_id = pl.id)
+	`
+	rows, err := ps.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	closed := []ClosedPoll{}
+	postIDs := []int64{}
+	for rows.Next() {
+		var c ClosedPoll
+		var postID int64
+		if err := rows.Scan(&postID, &c.AuthorID, pq.Array(&c.VoterIDs)); err != nil {
+			return nil, err
+		}
+		c.Poll = &Poll{PostID: postID}
+		closed = append(closed, c)
+		postIDs = append(postIDs, postID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(closed) == 0 {
+		return closed, nil
+	}
+
+	polls, err := getPolls(ctx, ps.db, 0, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range closed {
+		if poll, ok := polls[closed[i].Poll.PostID]; ok {
+			closed[i].Poll = poll
+		}
+	}
+	return closed, nil
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPollsCloseExpired(t *testing.T) {
+	db, mock := newTestDB(t)
+	ps := NewPollsStore(db)
+
+	// the polls of drafts and scheduled posts stay open until they are published
+	mock.ExpectQuery(`UPDATE polls pl\s*SET closed_at = NOW\(\)\s*FROM posts p\s*WHERE p\.id = pl\.post_id AND pl\.closed_at IS NULL AND pl\.expires_at <= NOW\(\)\s*AND p\.status = 'published'`).
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "user_id", "voters"}))
+
+	closed, err := ps.CloseExpired(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 0 {
+		t.Errorf("expected no polls to be closed, got %v", closed)
+	}
+}
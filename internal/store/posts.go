@@ -4,29 +4,84 @@ package store
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/dubass83/go_social/internal/entities"
 	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+const (
+	PostVisibilityPublic    = "public"
+	PostVisibilityFollowers = "followers"
+	PostVisibilityMentioned = "mentioned"
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	UserID    int64     `json:"user_id"`
-	Version   int64     `json:"version"`
-	Tags      []string  `json:"tags"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID         int64      `json:"id"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	CreatedAt  string     `json:"created_at"`
+	UpdatedAt  string     `json:"updated_at"`
+	UserID     int64      `json:"user_id"`
+	Version    int64      `json:"version"`
+	Tags       []string   `json:"tags"`
+	Status     string     `json:"status"`
+	PublishAt  *time.Time `json:"publish_at"`
+	Visibility string     `json:"visibility"`
+	// Entities are the mentions and hashtags found in the content
+	Entities *entities.Entities `json:"entities"`
+	// QuotedPostID is set on quote posts, QuotedPost stays empty when the
+	// quoted post was deleted or is not visible to the current user
+	QuotedPostID *int64 `json:"quoted_post_id"`
+	QuotedPost   *Post  `json:"quoted_post"`
+	// CommunityID is the community the post was posted to, if any
+	CommunityID *int64 `json:"community_id"`
+	// Poll is the poll the post carries, if any
+	Poll     *Poll     `json:"poll"`
+	Media    []Media   `json:"media"`
+	Comments []Comment `json:"comments"`
+	User     User      `json:"user"`
+}
+
+// IsPublished reports whether the post can be shown to other users
+func (p *Post) IsPublished() bool {
+	return p.Status == PostStatusPublished && p.PublishAt != nil && !p.PublishAt.After(time.Now())
 }
 
 type PostWithMetadata struct {
 	Post
-	CommentsCount int `json:"comments_count"`
+	CommentsCount int  `json:"comments_count"`
+	Pinned        bool `json:"pinned"`
+	// Bookmarked tells whether the current user saved the post
+	Bookmarked   bool `json:"bookmarked"`
+	RepostsCount int  `json:"reposts_count"`
+	QuotesCount  int  `json:"quotes_count"`
+	// Reposted tells whether the current user reposted the post
+	Reposted bool `json:"reposted"`
+	// RepostedBy is the followed user who brought the post into the feed
+	RepostedBy *User `json:"reposted_by"`
+	// Source tells why a post is in the feed, SourceTag is the followed tag
+	// for tag entries. Both are only set in feeds.
+	Source    string `json:"source,omitempty"`
+	SourceTag string `json:"source_tag,omitempty"`
 }
 
+// Sources of feed entries
+const (
+	FeedSourceOwn       = "own"
+	FeedSourceFollowing = "following"
+	FeedSourceRepost    = "repost"
+	FeedSourceTag       = "tag"
+	FeedSourceList      = "list"
+)
+
 type PostsStore struct {
 	db *sql.DB
 }
@@ -39,30 +94,77 @@ func NewPostsStore(db *sql.DB) *PostsStore {
 
 func (ps *PostsStore) Create(ctx context.Context, post *Post) error {
 	query := `
-	   INSERT INTO posts (title, content, user_id, tags)
-       VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+	   INSERT INTO posts (title, content, user_id, tags, status, publish_at, visibility, quoted_post_id, community_id)
+       VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 = 'published' THEN NOW() ELSE $6 END, $7, $8, $9)
+       RETURNING id, created_at, updated_at, publish_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := ps.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
-	if err != nil {
-		return err
+	if post.Status == "" {
+		post.Status = PostStatusPublished
 	}
-	return nil
+	if post.Visibility == "" {
+		post.Visibility = PostVisibilityPublic
+	}
+
+	return withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+			post.Visibility,
+			post.QuotedPostID,
+			post.CommunityID,
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.PublishAt,
+		)
+		if err != nil {
+			return err
+		}
+		post.Entities, err = setEntitiesTx(ctx, tx, entityKindPost, post.ID, post.Content)
+		if err != nil {
+			return err
+		}
+		if err := setMediaTx(ctx, tx, entityKindPost, post.ID, post.Media); err != nil {
+			return err
+		}
+		if post.Poll == nil {
+			return nil
+		}
+		return createPollTx(ctx, tx, post.ID, post.Poll)
+	})
+}
+
+// publishedCondition limits a query on posts p to the ones other users may see
+const publishedCondition = `(p.status = 'published' AND p.publish_at <= NOW())`
+
+// visibleToCondition limits a query on posts p to the ones the user bound to
+// the viewer parameter is allowed to see, 0 stands for an anonymous visitor.
+// Mentioned users can see the post whatever its visibility.
+func visibleToCondition(viewer string) string {
+	return `(p.visibility = 'public' OR p.user_id = ` + viewer + `
+      OR (p.visibility = 'followers' AND EXISTS (
+           SELECT 1 FROM followers f WHERE f.user_id = ` + viewer + ` AND f.follow_id = p.user_id
+      ))
+      OR EXISTS (
+           SELECT 1 FROM post_mentions m WHERE m.post_id = p.id AND m.user_id = ` + viewer + `
+      ))`
 }
 
+// GetUserFeed reads the timeline of the user materialized by TimelineStore,
+// merged with the posts and reposts of followed authors that are read on
+// pull and the posts tagged with a tag the user follows. A post shows up once
+// with the first matching source: its author is in the feed, a followed user
+// reposted it or it has a followed tag.
 func (ps *PostsStore) GetUserFeed(ctx context.Context, userID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
 	var tagsCondition string
 
@@ -73,23 +175,18 @@ func (ps *PostsStore) GetUserFeed(ctx context.Context, userID int64, pg Paginate
 	}
 
 	query := `
-	SELECT
-      p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
-      u.username,
-      COUNT(c.id) AS comments_count
-    FROM posts p
+	WITH ` + feedEntriesCTEs + `
+	SELECT ` + postWithMetadataColumns("$1") + `, ` + feedSourceColumns + `
+    FROM entries e
+    JOIN posts p ON p.id = e.post_id
     LEFT JOIN users u ON u.id = p.user_id
-    LEFT JOIN comments c ON p.id = c.post_id
+    LEFT JOIN users ru ON ru.id = e.reposted_by
     WHERE
-      (p.user_id = $1 OR p.user_id IN (
-           SELECT follow_id
-           FROM followers
-           WHERE user_id = $1
-      ))
+      ` + publishedCondition + `
+      AND ` + visibleToCondition("$1") + `
       AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
       AND ` + tagsCondition + `
-    GROUP BY p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username
-    ORDER BY p.created_at ` + pg.Sort + `, p.id ` + pg.Sort + `
+    ORDER BY e.activity_at ` + pg.Sort + `, p.id ` + pg.Sort + `
     LIMIT $2 OFFSET $3;
     `
 
@@ -105,33 +202,155 @@ func (ps *PostsStore) GetUserFeed(ctx context.Context, userID int64, pg Paginate
 	}
 	defer rows.Close()
 
+	feed, err := scanFeed(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachPostDetails(ctx, ps.db, userID, postsOf(feed)); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// GetListFeed returns the posts and reposts of the members of listID that
+// viewerID may see, like GetUserFeed does for followed users
+func (ps *PostsStore) GetListFeed(ctx context.Context, listID, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	var tagsCondition string
+
+	if len(pg.Tags) == 0 {
+		tagsCondition = "($5 = $5 OR TRUE)"
+	} else {
+		tagsCondition = "(p.tags @> $5)"
+	}
+
+	query := `
+	WITH ` + listEntriesCTEs + `
+	SELECT ` + postWithMetadataColumns("$1") + `, e.source, e.reposted_by, ru.username, NULL
+    FROM entries e
+    JOIN posts p ON p.id = e.post_id
+    LEFT JOIN users u ON u.id = p.user_id
+    LEFT JOIN users ru ON ru.id = e.reposted_by
+    WHERE
+      ` + publishedCondition + `
+      AND ` + visibleToCondition("$1") + `
+      AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+      AND ` + tagsCondition + `
+    ORDER BY e.activity_at ` + pg.Sort + `, p.id ` + pg.Sort + `
+    LIMIT $2 OFFSET $3;
+    `
+
+	log.Debug().Msgf("listID: %d, viewerID: %d, limit: %d, offset: %d, tags: %+v, search: '%s'",
+		listID, viewerID, pg.Limit, pg.Offset, pg.Tags, pg.Search)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.db.QueryContext(ctx, query, viewerID, pg.Limit, pg.Offset, pg.Search, pq.Array(pg.Tags), listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feed, err := scanFeed(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachPostDetails(ctx, ps.db, viewerID, postsOf(feed)); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// listEntriesCTEs defines entries, the posts and reposts of the members of
+// the list bound to $6, preferring a post over reposts of it
+const listEntriesCTEs = `members AS (
+      SELECT user_id FROM list_members WHERE list_id = $6
+    ),
+    entries AS (
+      SELECT DISTINCT ON (e.post_id) e.post_id, e.source, e.reposted_by, e.activity_at
+      FROM (
+        SELECT p.id AS post_id, 0 AS priority, '` + FeedSourceList + `' AS source, NULL::bigint AS reposted_by, p.publish_at AS activity_at
+        FROM posts p
+        WHERE p.user_id IN (SELECT user_id FROM members)
+        UNION ALL
+        SELECT r.post_id, 1, '` + FeedSourceRepost + `', r.user_id, r.created_at
+        FROM reposts r
+        WHERE r.user_id IN (SELECT user_id FROM members)
+      ) e
+      ORDER BY e.post_id, e.priority, e.activity_at DESC
+    )`
+
+// feedEntriesCTEs defines entries, the posts in the feed of the user bound
+// to $1 with their source, from the materialized timeline, the posts and
+// reposts of followed authors read on pull and the posts with followed tags
+const feedEntriesCTEs = `pulled AS (
+      SELECT f.follow_id AS user_id
+      FROM followers f
+      JOIN timeline_pull_authors pa ON pa.user_id = f.follow_id
+      WHERE f.user_id = $1
+    ),
+    followed_tags AS (
+      SELECT COALESCE(array_agg(tag), '{}') AS tags FROM tag_follows WHERE user_id = $1
+    ),
+    entries AS (
+      SELECT DISTINCT ON (e.post_id) e.post_id, e.source, e.reposted_by, e.activity_at
+      FROM (
+        SELECT te.post_id, CASE WHEN te.source = '` + FeedSourceRepost + `' THEN 1 ELSE 0 END AS priority,
+          te.source, te.reposted_by, te.activity_at
+        FROM timeline_entries te
+        WHERE te.user_id = $1
+        UNION ALL
+        SELECT p.id, 0, '` + FeedSourceFollowing + `', NULL::bigint, p.publish_at
+        FROM posts p
+        WHERE p.user_id IN (SELECT user_id FROM pulled)
+        UNION ALL
+        SELECT r.post_id, 1, '` + FeedSourceRepost + `', r.user_id, r.created_at
+        FROM reposts r
+        WHERE r.user_id IN (SELECT user_id FROM pulled)
+        UNION ALL
+        SELECT p.id, 2, '` + FeedSourceTag + `', NULL, p.publish_at
+        FROM posts p
+        WHERE p.tags && (SELECT tags FROM followed_tags)
+      ) e
+      ORDER BY e.post_id, e.priority, e.activity_at DESC
+    )`
+
+// feedSourceColumns are the columns read by scanFeed after the ones of
+// postWithMetadataColumns from entries e and the reposter ru
+const feedSourceColumns = `
+      e.source, e.reposted_by, ru.username,
+      CASE WHEN e.source = '` + FeedSourceTag + `' THEN (
+        SELECT t FROM unnest(p.tags) t WHERE t = ANY((SELECT tags FROM followed_tags)) ORDER BY t LIMIT 1
+      ) END`
+
+// scanFeed reads the rows of the feed queries
+func scanFeed(rows *sql.Rows) ([]*PostWithMetadata, error) {
 	feed := []*PostWithMetadata{}
 	for rows.Next() {
-		p := &PostWithMetadata{}
-		err = rows.Scan(
-			&p.ID,
-			&p.UserID,
-			&p.Title,
-			&p.Content,
-			&p.CreatedAt,
-			&p.Version,
-			pq.Array(&p.Tags),
-			&p.User.Username,
-			&p.CommentsCount,
-		)
+		var repostedByID sql.NullInt64
+		var source, repostedByName, sourceTag sql.NullString
+		p, err := scanPostWithMetadata(rows, &source, &repostedByID, &repostedByName, &sourceTag)
 		if err != nil {
 			return nil, err
 		}
+		if repostedByID.Valid {
+			p.RepostedBy = &User{ID: repostedByID.Int64, Username: repostedByName.String}
+		}
+		p.Source = source.String
+		p.SourceTag = sourceTag.String
 		feed = append(feed, p)
 	}
 	// Check for any iteration errors
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return feed, nil
 }
 
-func (ps *PostsStore) GetUserPosts(ctx context.Context, userID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+// GetUserPosts returns the published posts of userID that viewerID may see
+func (ps *PostsStore) GetUserPosts(ctx context.Context, userID, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
 	var tagsCondition string
 
 	if len(pg.Tags) == 0 {
@@ -141,61 +360,44 @@ func (ps *PostsStore) GetUserPosts(ctx context.Context, userID int64, pg Paginat
 	}
 
 	query := `
-	SELECT
-      p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
-      u.username,
-      COUNT(c.id) AS comments_count
+	SELECT ` + postWithMetadataColumns("$6") + `
     FROM posts p
     LEFT JOIN users u ON u.id = p.user_id
-    LEFT JOIN comments c ON p.id = c.post_id
     WHERE
-      p.user_id = $1
+      ` + publishedCondition + `
+      AND ` + visibleToCondition("$6") + `
+      AND p.user_id = $1
       AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
       AND ` + tagsCondition + `
-    GROUP BY p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username
-    ORDER BY p.created_at ` + pg.Sort + `, p.id ` + pg.Sort + `
+    ORDER BY pinned DESC, p.publish_at ` + pg.Sort + `, p.id ` + pg.Sort + `
     LIMIT $2 OFFSET $3;
     `
 
-	log.Debug().Msgf("userID: %d, limit: %d, offset: %d, tags: %+v, search: '%s'",
-		userID, pg.Limit, pg.Offset, pg.Tags, pg.Search)
+	log.Debug().Msgf("userID: %d, viewerID: %d, limit: %d, offset: %d, tags: %+v, search: '%s'",
+		userID, viewerID, pg.Limit, pg.Offset, pg.Tags, pg.Search)
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := ps.db.QueryContext(ctx, query, userID, pg.Limit, pg.Offset, pg.Search, pq.Array(pg.Tags))
+	rows, err := ps.db.QueryContext(ctx, query, userID, pg.Limit, pg.Offset, pg.Search, pq.Array(pg.Tags), viewerID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	posts := []*PostWithMetadata{}
-	for rows.Next() {
-		p := &PostWithMetadata{}
-		err = rows.Scan(
-			&p.ID,
-			&p.UserID,
-			&p.Title,
-			&p.Content,
-			&p.CreatedAt,
-			&p.Version,
-			pq.Array(&p.Tags),
-			&p.User.Username,
-			&p.CommentsCount,
-		)
-		if err != nil {
-			return nil, err
-		}
-		posts = append(posts, p)
+	posts, err := scanPostsWithMetadata(rows)
+	if err != nil {
+		return nil, err
 	}
-	// Check for any iteration errors
-	if err = rows.Err(); err != nil {
+
+	if err := attachPostDetails(ctx, ps.db, viewerID, postsOf(posts)); err != nil {
 		return nil, err
 	}
 	return posts, nil
 }
 
-func (ps *PostsStore) GetAllPosts(ctx context.Context, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+// GetAllPosts returns the published posts viewerID may see
+func (ps *PostsStore) GetAllPosts(ctx context.Context, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
 	var tagsCondition string
 
 	if len(pg.Tags) == 0 {
@@ -205,54 +407,84 @@ func (ps *PostsStore) GetAllPosts(ctx context.Context, pg PaginatedFeedQuery) ([
 	}
 
 	query := `
-	SELECT
-      p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
-      u.username,
-      COUNT(c.id) AS comments_count
+	SELECT ` + postWithMetadataColumns("$1") + `
     FROM posts p
     LEFT JOIN users u ON u.id = p.user_id
-    LEFT JOIN comments c ON p.id = c.post_id
     WHERE
-      (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+      ` + publishedCondition + `
+      AND ` + visibleToCondition("$1") + `
+      AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
       AND ` + tagsCondition + `
-    GROUP BY p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username
-    ORDER BY p.created_at ` + pg.Sort + `, p.id ` + pg.Sort + `
+    ORDER BY p.publish_at ` + pg.Sort + `, p.id ` + pg.Sort + `
     LIMIT $2 OFFSET $3;
     `
 
-	log.Debug().Msgf("limit: %d, offset: %d, tags: %+v, search: '%s'",
-		pg.Limit, pg.Offset, pg.Tags, pg.Search)
+	log.Debug().Msgf("viewerID: %d, limit: %d, offset: %d, tags: %+v, search: '%s'",
+		viewerID, pg.Limit, pg.Offset, pg.Tags, pg.Search)
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := ps.db.QueryContext(ctx, query, pg.Limit, pg.Offset, pg.Search, pq.Array(pg.Tags))
+	rows, err := ps.db.QueryContext(ctx, query, viewerID, pg.Limit, pg.Offset, pg.Search, pq.Array(pg.Tags))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	posts := []*PostWithMetadata{}
-	for rows.Next() {
-		p := &PostWithMetadata{}
-		err = rows.Scan(
-			&p.ID,
-			&p.UserID,
-			&p.Title,
-			&p.Content,
-			&p.CreatedAt,
-			&p.Version,
-			pq.Array(&p.Tags),
-			&p.User.Username,
-			&p.CommentsCount,
-		)
-		if err != nil {
-			return nil, err
-		}
-		posts = append(posts, p)
+	posts, err := scanPostsWithMetadata(rows)
+	if err != nil {
+		return nil, err
 	}
-	// Check for any iteration errors
-	if err = rows.Err(); err != nil {
+
+	if err := attachPostDetails(ctx, ps.db, viewerID, postsOf(posts)); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetCommunityPosts returns the published posts of the community viewerID
+// may see
+func (ps *PostsStore) GetCommunityPosts(ctx context.Context, communityID, viewerID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	var tagsCondition string
+
+	if len(pg.Tags) == 0 {
+		tagsCondition = "($5 = $5 OR TRUE)"
+	} else {
+		tagsCondition = "(p.tags @> $5)"
+	}
+
+	query := `
+	SELECT ` + postWithMetadataColumns("$6") + `
+    FROM posts p
+    LEFT JOIN users u ON u.id = p.user_id
+    WHERE
+      ` + publishedCondition + `
+      AND ` + visibleToCondition("$6") + `
+      AND p.community_id = $1
+      AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+      AND ` + tagsCondition + `
+    ORDER BY p.publish_at ` + pg.Sort + `, p.id ` + pg.Sort + `
+    LIMIT $2 OFFSET $3;
+    `
+
+	log.Debug().Msgf("communityID: %d, viewerID: %d, limit: %d, offset: %d, tags: %+v, search: '%s'",
+		communityID, viewerID, pg.Limit, pg.Offset, pg.Tags, pg.Search)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.db.QueryContext(ctx, query, communityID, pg.Limit, pg.Offset, pg.Search, pq.Array(pg.Tags), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPostsWithMetadata(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachPostDetails(ctx, ps.db, viewerID, postsOf(posts)); err != nil {
 		return nil, err
 	}
 	return posts, nil
@@ -260,7 +492,7 @@ func (ps *PostsStore) GetAllPosts(ctx context.Context, pg PaginatedFeedQuery) ([
 
 func (ps *PostsStore) GetByID(ctx context.Context, id string) (*Post, error) {
 	query := `
-	SELECT id, title, content, created_at, updated_at, user_id, version, tags
+	SELECT id, title, content, created_at, updated_at, user_id, version, tags, status, publish_at, visibility, quoted_post_id, community_id
 	FROM posts
 	WHERE id = $1
 	LIMIT 1
@@ -284,6 +516,11 @@ func (ps *PostsStore) GetByID(ctx context.Context, id string) (*Post, error) {
 		&post.UserID,
 		&post.Version,
 		pq.Array(&post.Tags),
+		&post.Status,
+		&post.PublishAt,
+		&post.Visibility,
+		&post.QuotedPostID,
+		&post.CommunityID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -315,30 +552,341 @@ func (ps *PostsStore) DeleteByID(ctx context.Context, id string) error {
 
 func (ps *PostsStore) Update(ctx context.Context, postID int64, version int64, post *Post) error {
 	query := `
-	   UPDATE posts SET title = $1, content = $2, tags = $3, updated_at = NOW(), version = version + 1
+	   UPDATE posts SET title = $1, content = $2, tags = $3, visibility = $6, updated_at = NOW(), version = version + 1
        WHERE id = $4 AND version = $5
        RETURNING id, user_id, created_at, updated_at, version
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := ps.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		pq.Array(post.Tags),
-		postID,
-		version,
-	).Scan(
-		&post.ID,
-		&post.UserID,
-		&post.CreatedAt,
+	return withTx(ps.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			pq.Array(post.Tags),
+			postID,
+			version,
+			post.Visibility,
+		).Scan(
+			&post.ID,
+			&post.UserID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.Version,
+		)
+		if err != nil {
+			// the post exists (it was loaded by the caller), so no matching row
+			// means the version has moved on since the client read it
+			if err == sql.ErrNoRows {
+				return ErrConflict
+			}
+			return err
+		}
+		post.Entities, err = setEntitiesTx(ctx, tx, entityKindPost, post.ID, post.Content)
+		return err
+	})
+}
+
+// IsVisibleTo reports whether viewerID may see the post, 0 stands for an
+// anonymous visitor
+func (ps *PostsStore) IsVisibleTo(ctx context.Context, postID, viewerID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM posts p
+		WHERE p.id = $1 AND ` + visibleToCondition("$2") + `
+	)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	if err := ps.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&visible); err != nil {
+		return false, err
+	}
+	return visible, nil
+}
+
+// GetUserDrafts returns the drafts and scheduled posts of the user
+func (ps *PostsStore) GetUserDrafts(ctx context.Context, userID int64, pg PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	query := `
+	SELECT ` + postWithMetadataColumns("$1") + `
+    FROM posts p
+    LEFT JOIN users u ON u.id = p.user_id
+    WHERE
+      p.user_id = $1
+      AND p.status <> 'published'
+      AND (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+    ORDER BY p.created_at ` + pg.Sort + `, p.id ` + pg.Sort + `
+    LIMIT $2 OFFSET $3;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.db.QueryContext(ctx, query, userID, pg.Limit, pg.Offset, pg.Search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPostsWithMetadata(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachPostDetails(ctx, ps.db, userID, postsOf(posts)); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// Publish publishes a draft or scheduled post. A publishAt in the future
+// schedules the post instead, nil publishes it right away.
+func (ps *PostsStore) Publish(ctx context.Context, post *Post, publishAt *time.Time) error {
+	query := `
+	   UPDATE posts
+       SET status = CASE WHEN $2::timestamptz > NOW() THEN 'scheduled' ELSE 'published' END,
+           publish_at = CASE WHEN $2::timestamptz > NOW() THEN $2::timestamptz ELSE NOW() END,
+           updated_at = NOW(), version = version + 1
+       WHERE id = $1 AND status <> 'published'
+       RETURNING status, publish_at, updated_at, version
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ps.db.QueryRowContext(ctx, query, post.ID, publishAt).Scan(
+		&post.Status,
+		&post.PublishAt,
 		&post.UpdatedAt,
 		&post.Version,
 	)
+	if err != nil {
+		// already published in the meantime
+		if err == sql.ErrNoRows {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// PublishScheduled publishes every scheduled post that is due and returns them
+func (ps *PostsStore) PublishScheduled(ctx context.Context) ([]*Post, error) {
+	query := `
+	   UPDATE posts
+       SET status = 'published', updated_at = NOW(), version = version + 1
+       WHERE status = 'scheduled' AND publish_at <= NOW()
+       RETURNING id, title, content, created_at, updated_at, user_id, version, tags, status, publish_at, visibility, quoted_post_id, community_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ps.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	for rows.Next() {
+		p := &Post{}
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.UserID,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
+			&p.Visibility,
+			&p.QuotedPostID,
+			&p.CommunityID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the posts are streamed to their followers, so nothing is loaded as
+	// seen by one of them
+	if err := attachPostDetails(ctx, ps.db, 0, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// postWithMetadataColumns are the columns read by scanPostWithMetadata from
+// posts p joined with their author u, viewer is the parameter holding the
+// current user
+func postWithMetadataColumns(viewer string) string {
+	return `
+      p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags,
+      p.status, p.publish_at, p.visibility, p.quoted_post_id, p.community_id,
+      u.username,
+      (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+      EXISTS (SELECT 1 FROM pinned_posts pp WHERE pp.post_id = p.id) AS pinned,
+      EXISTS (SELECT 1 FROM bookmarks b WHERE b.post_id = p.id AND b.user_id = ` + viewer + `) AS bookmarked,
+      (SELECT COUNT(*) FROM reposts r WHERE r.post_id = p.id) AS reposts_count,
+      (SELECT COUNT(*) FROM posts q WHERE q.quoted_post_id = p.id AND q.status = 'published') AS quotes_count,
+      EXISTS (SELECT 1 FROM reposts r WHERE r.post_id = p.id AND r.user_id = ` + viewer + `) AS reposted`
+}
+
+// AttachDetails fills in the entities of a post and the quoted post of a
+// quote post
+func (ps *PostsStore) AttachDetails(ctx context.Context, viewerID int64, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return attachPostDetails(ctx, ps.db, viewerID, []*Post{post})
+}
+
+// attachPostDetails fills in what the listing queries leave out: the
+// entities, polls and media of the posts and the quoted posts with their
+// own entities, polls and media
+func attachPostDetails(ctx context.Context, db *sql.DB, viewerID int64, posts []*Post) error {
+	if err := attachQuotedPosts(ctx, db, viewerID, posts); err != nil {
+		return err
+	}
+
+	all := append([]*Post{}, posts...)
+	for _, p := range posts {
+		if p.QuotedPost != nil {
+			all = append(all, p.QuotedPost)
+		}
+	}
+	if err := attachPolls(ctx, db, viewerID, all); err != nil {
+		return err
+	}
+	if err := attachPostMedia(ctx, db, all); err != nil {
+		return err
+	}
+	return attachPostEntities(ctx, db, all)
+}
+
+// postsOf returns the posts of a listing
+func postsOf(posts []*PostWithMetadata) []*Post {
+	result := make([]*Post, len(posts))
+	for i, p := range posts {
+		result[i] = &p.Post
+	}
+	return result
+}
+
+// attachQuotedPosts loads the posts quoted in posts that viewerID may see.
+// Quotes of deleted or hidden posts keep their quoted_post_id without a
+// quoted_post.
+func attachQuotedPosts(ctx context.Context, db *sql.DB, viewerID int64, posts []*Post) error {
+	ids := []int64{}
+	for _, p := range posts {
+		if p.QuotedPostID != nil {
+			ids = append(ids, *p.QuotedPostID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT p.id, p.title, p.content, p.created_at, p.updated_at, p.user_id, p.tags, p.publish_at, p.visibility, u.username
+	FROM posts p
+	LEFT JOIN users u ON u.id = p.user_id
+	WHERE p.id = ANY($1)
+	  AND ` + publishedCondition + `
+	  AND ` + visibleToCondition("$2") + `
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), viewerID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	quoted := map[int64]*Post{}
+	for rows.Next() {
+		q := &Post{Status: PostStatusPublished}
+		err := rows.Scan(
+			&q.ID,
+			&q.Title,
+			&q.Content,
+			&q.CreatedAt,
+			&q.UpdatedAt,
+			&q.UserID,
+			pq.Array(&q.Tags),
+			&q.PublishAt,
+			&q.Visibility,
+			&q.User.Username,
+		)
+		if err != nil {
+			return err
+		}
+		q.User.ID = q.UserID
+		quoted[q.ID] = q
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		if p.QuotedPostID != nil {
+			p.QuotedPost = quoted[*p.QuotedPostID]
+		}
+	}
 	return nil
 }
+
+// scanPostsWithMetadata reads the rows of the post listing queries
+func scanPostsWithMetadata(rows *sql.Rows) ([]*PostWithMetadata, error) {
+	posts := []*PostWithMetadata{}
+	for rows.Next() {
+		p, err := scanPostWithMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	// Check for any iteration errors
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// scanPostWithMetadata reads the current row of a post listing query, extra
+// receives the columns a query selects after the common ones
+func scanPostWithMetadata(rows *sql.Rows, extra ...any) (*PostWithMetadata, error) {
+	p := &PostWithMetadata{}
+	dest := []any{
+		&p.ID,
+		&p.UserID,
+		&p.Title,
+		&p.Content,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Version,
+		pq.Array(&p.Tags),
+		&p.Status,
+		&p.PublishAt,
+		&p.Visibility,
+		&p.QuotedPostID,
+		&p.CommunityID,
+		&p.User.Username,
+		&p.CommentsCount,
+		&p.Pinned,
+		&p.Bookmarked,
+		&p.RepostsCount,
+		&p.QuotesCount,
+		&p.Reposted,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
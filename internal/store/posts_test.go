@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var postWithMetadataNames = []string{
+	"id", "user_id", "title", "content", "created_at", "updated_at", "version", "tags",
+	"status", "publish_at", "visibility", "quoted_post_id", "community_id",
+	"username", "comments_count", "pinned", "bookmarked", "reposts_count",
+	"quotes_count", "reposted",
+}
+
+// postRow is a row of postWithMetadataColumns for a published public post
+func postRow(id, userID int64, content string, quotedPostID any, extra ...driver.Value) []driver.Value {
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	row := []driver.Value{
+		id, userID, "title", content, at, at, 1, "{}",
+		PostStatusPublished, at, PostVisibilityPublic, quotedPostID, nil,
+		"author", 0, false, false, 1, 0, false,
+	}
+	return append(row, extra...)
+}
+
+func TestGetUserFeed(t *testing.T) {
+	db, mock := newTestDB(t)
+	ps := NewPostsStore(db)
+
+	// a post is read once from entries, which keeps the entry of the post
+	// itself over the reposts of it and one repost of a post only
+	mock.ExpectQuery(`entries AS \(\s*SELECT DISTINCT ON \(e\.post_id\)(.|\s)*ORDER BY e\.post_id, e\.priority, e\.activity_at DESC`).
+		WithArgs(42, 20, 0, "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(append(postWithMetadataNames, "source", "reposted_by", "reposted_by_username", "source_tag")).
+			AddRow(postRow(3, 7, "quoting", int64(1), FeedSourceFollowing, nil, nil, nil)...).
+			AddRow(postRow(2, 9, "reposted", nil, FeedSourceRepost, int64(7), "user7", nil)...).
+			AddRow(postRow(1, 9, "about #go", nil, FeedSourceTag, nil, nil, "go")...))
+	mock.ExpectQuery(`WHERE p\.id = ANY\(\$1\)`).
+		WithArgs("{1}", 42).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "content", "created_at", "updated_at", "user_id", "tags", "publish_at", "visibility", "username"}).
+			AddRow(1, "title", "about #go", time.Now(), time.Now(), 9, "{go}", time.Now(), PostVisibilityPublic, "user9"))
+	expectPostDetails(mock)
+
+	feed, err := ps.GetUserFeed(context.Background(), 42, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 3 {
+		t.Fatalf("expected 3 posts, got %d", len(feed))
+	}
+
+	quote, repost, tagged := feed[0], feed[1], feed[2]
+	if quote.Source != FeedSourceFollowing || quote.RepostedBy != nil {
+		t.Errorf("expected a followed post, got source %q reposted by %v", quote.Source, quote.RepostedBy)
+	}
+	if quote.QuotedPost == nil || quote.QuotedPost.ID != 1 || quote.QuotedPost.User.Username != "user9" {
+		t.Errorf("expected post 1 by user9 to be quoted, got %+v", quote.QuotedPost)
+	}
+	if repost.Source != FeedSourceRepost || repost.RepostedBy == nil || repost.RepostedBy.ID != 7 || repost.RepostedBy.Username != "user7" {
+		t.Errorf("expected a repost by user7, got source %q reposted by %v", repost.Source, repost.RepostedBy)
+	}
+	if tagged.Source != FeedSourceTag || tagged.SourceTag != "go" {
+		t.Errorf("expected a post tagged go, got source %q tag %q", tagged.Source, tagged.SourceTag)
+	}
+}
+
+func TestGetUserFeedFollowedTags(t *testing.T) {
+	db, mock := newTestDB(t)
+	ps := NewPostsStore(db)
+
+	// posts with a followed tag are merged in below followed posts and
+	// reposts of them, and tell the first followed tag they have
+	mock.ExpectQuery(`followed_tags AS \(\s*SELECT COALESCE\(array_agg\(tag\), '\{\}'\) AS tags FROM tag_follows WHERE user_id = \$1\s*\)` +
+		`(.|\s)*SELECT p\.id, 2, '` + FeedSourceTag + `', NULL, p\.publish_at\s*FROM posts p\s*WHERE p\.tags && \(SELECT tags FROM followed_tags\)` +
+		`(.|\s)*SELECT t FROM unnest\(p\.tags\) t WHERE t = ANY\(\(SELECT tags FROM followed_tags\)\) ORDER BY t LIMIT 1`).
+		WithArgs(42, 10, 0, "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(append(postWithMetadataNames, "source", "reposted_by", "reposted_by_username", "source_tag")).
+			AddRow(postRow(5, 9, "about #go and #sql", nil, FeedSourceTag, nil, nil, "go")...))
+	expectPostDetails(mock)
+
+	feed, err := ps.GetUserFeed(context.Background(), 42, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 1 || feed[0].ID != 5 || feed[0].Source != FeedSourceTag || feed[0].SourceTag != "go" {
+		t.Errorf("expected post 5 from the followed tag go, got %+v", feed)
+	}
+}
+
+func TestGetUserPosts(t *testing.T) {
+	db, mock := newTestDB(t)
+	ps := NewPostsStore(db)
+
+	// the edit time is read so that feed readers see edited posts change
+	row := postRow(1, 7, "edited", nil)
+	editedAt := time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC)
+	row[5] = editedAt
+	mock.ExpectQuery(`p\.created_at, p\.updated_at, p\.version(.|\s)*AND p\.user_id = \$1`).
+		WithArgs(7, 50, 0, "", sqlmock.AnyArg(), 0).
+		WillReturnRows(sqlmock.NewRows(postWithMetadataNames).AddRow(row...))
+	expectPostDetails(mock)
+
+	posts, err := ps.GetUserPosts(context.Background(), 7, 0, PaginatedFeedQuery{Limit: 50, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 post, got %d", len(posts))
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, posts[0].UpdatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updatedAt.Equal(editedAt) {
+		t.Errorf("expected the post to be updated at %s, got %s", editedAt, updatedAt)
+	}
+}
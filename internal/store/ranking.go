@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RankingWeights tune the ranked feed. The score of a post is the sum of
+//   - Recency times 0.5^(age / HalfLifeHours)
+//   - Affinity times ln(1 + interactions of the user with the author)
+//   - Engagement times ln(1 + comments, reposts and quotes of the post)
+//   - Tags times the number of its tags the user follows or posts about
+type RankingWeights struct {
+	Recency       float64 `json:"recency" validate:"gte=0"`
+	Affinity      float64 `json:"affinity" validate:"gte=0"`
+	Engagement    float64 `json:"engagement" validate:"gte=0"`
+	Tags          float64 `json:"tags" validate:"gte=0"`
+	HalfLifeHours float64 `json:"half_life_hours" validate:"gt=0"`
+	UpdatedAt     string  `json:"updated_at"`
+}
+
+// RankedFeedOptions limit the work done to rank a feed
+type RankedFeedOptions struct {
+	// MaxCandidates posts are ranked at most, the ranked feed ends after them
+	MaxCandidates int
+	// Window is how far back posts are considered
+	Window time.Duration
+	// SessionTTL is how long a ranked snapshot can be paged through
+	SessionTTL time.Duration
+}
+
+// FeedSession is a snapshot of a ranked feed
+type FeedSession struct {
+	ID        string
+	UserID    int64
+	PostIDs   []int64
+	CreatedAt time.Time
+}
+
+// interactionsWindow is how far back interactions count towards affinity
+const interactionsWindow = `INTERVAL '90 days'`
+
+type RankingStore struct {
+	db *sql.DB
+}
+
+func NewRankingStore(db *sql.DB) *RankingStore {
+	return &RankingStore{db: db}
+}
+
+func (rs *RankingStore) GetWeights(ctx context.Context) (*RankingWeights, error) {
+	query := `
+	SELECT recency, affinity, engagement, tags, half_life_hours, updated_at
+	FROM feed_ranking_weights
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	w := &RankingWeights{}
+	err := rs.db.QueryRowContext(ctx, query).Scan(
+		&w.Recency,
+		&w.Affinity,
+		&w.Engagement,
+		&w.Tags,
+		&w.HalfLifeHours,
+		&w.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func (rs *RankingStore) SetWeights(ctx context.Context, w *RankingWeights) error {
+	query := `
+	   INSERT INTO feed_ranking_weights (recency, affinity, engagement, tags, half_life_hours)
+       VALUES ($1, $2, $3, $4, $5)
+       ON CONFLICT (id) DO UPDATE
+       SET recency = EXCLUDED.recency, affinity = EXCLUDED.affinity, engagement = EXCLUDED.engagement,
+           tags = EXCLUDED.tags, half_life_hours = EXCLUDED.half_life_hours, updated_at = NOW()
+       RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return rs.db.QueryRowContext(ctx, query, w.Recency, w.Affinity, w.Engagement, w.Tags, w.HalfLifeHours).Scan(&w.UpdatedAt)
+}
+
+// CreateSession ranks the feed of userID, filtered by the search and tags of
+// pg, with the current weights and stores the order as a new session.
+// Expired sessions are cleaned up on the way.
+func (rs *RankingStore) CreateSession(ctx context.Context, userID int64, pg PaginatedFeedQuery, opts RankedFeedOptions) (*FeedSession, error) {
+	var tagsCondition string
+
+	if len(pg.Tags) == 0 {
+		tagsCondition = "($3 = $3 OR TRUE)"
+	} else {
+		tagsCondition = "(p.tags @> $3)"
+	}
+
+	query := `
+	WITH ` + feedEntriesCTEs + `,
+    weights AS (
+      SELECT recency, affinity, engagement, tags, half_life_hours FROM feed_ranking_weights
+    ),
+    affinity AS (
+      SELECT i.author_id, COUNT(*) AS interactions
+      FROM (
+        SELECT p.user_id AS author_id FROM comments c JOIN posts p ON p.id = c.post_id
+        WHERE c.user_id = $1 AND c.created_at > NOW() - ` + interactionsWindow + `
+        UNION ALL
+        SELECT p.user_id FROM reposts r JOIN posts p ON p.id = r.post_id
+        WHERE r.user_id = $1 AND r.created_at > NOW() - ` + interactionsWindow + `
+        UNION ALL
+        SELECT p.user_id FROM bookmarks b JOIN posts p ON p.id = b.post_id
+        WHERE b.user_id = $1 AND b.created_at > NOW() - ` + interactionsWindow + `
+        UNION ALL
+        SELECT q.user_id FROM posts mine JOIN posts q ON q.id = mine.quoted_post_id
+        WHERE mine.user_id = $1 AND mine.created_at > NOW() - ` + interactionsWindow + `
+      ) i
+      WHERE i.author_id <> $1
+      GROUP BY i.author_id
+    ),
+    interests AS (
+      SELECT COALESCE(array_agg(DISTINCT x.tag), '{}') AS tags
+      FROM (
+        SELECT tag::text AS tag FROM tag_follows WHERE user_id = $1
+        UNION
+        SELECT lower(unnest(tags)) FROM posts WHERE user_id = $1 AND created_at > NOW() - ` + interactionsWindow + `
+      ) x
+    ),
+    ranked AS (
+      SELECT p.id,
+        w.recency * power(0.5, EXTRACT(EPOCH FROM NOW() - e.activity_at) / 3600 / w.half_life_hours)
+        + w.affinity * ln(1 + COALESCE(a.interactions, 0))
+        + w.engagement * ln(1
+            + (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id)
+            + (SELECT COUNT(*) FROM reposts r WHERE r.post_id = p.id)
+            + (SELECT COUNT(*) FROM posts q WHERE q.quoted_post_id = p.id AND q.status = 'published'))
+        + w.tags * (SELECT COUNT(*) FROM unnest(p.tags) t WHERE lower(t) = ANY((SELECT tags FROM interests)))
+        AS score
+      FROM entries e
+      JOIN posts p ON p.id = e.post_id
+      CROSS JOIN weights w
+      LEFT JOIN affinity a ON a.author_id = p.user_id
+      WHERE
+        ` + publishedCondition + `
+        AND ` + visibleToCondition("$1") + `
+        AND e.activity_at > NOW() - make_interval(secs => $4)
+        AND (p.title ILIKE '%' || $2 || '%' OR p.content ILIKE '%' || $2 || '%')
+        AND ` + tagsCondition + `
+      ORDER BY score DESC, p.id DESC
+      LIMIT $5
+    )
+	INSERT INTO feed_sessions (user_id, post_ids)
+	SELECT $1, COALESCE(array_agg(id ORDER BY score DESC, id DESC), '{}') FROM ranked
+	RETURNING id, post_ids, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	session := &FeedSession{UserID: userID}
+	err := withTx(rs.db, ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM feed_sessions WHERE created_at < NOW() - make_interval(secs => $1)`, opts.SessionTTL.Seconds())
+		if err != nil {
+			return err
+		}
+		return tx.QueryRowContext(
+			ctx,
+			query,
+			userID,
+			pg.Search,
+			pq.Array(pg.Tags),
+			opts.Window.Seconds(),
+			opts.MaxCandidates,
+		).Scan(
+			&session.ID,
+			pq.Array(&session.PostIDs),
+			&session.CreatedAt,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionPage returns a page of the ranked feed snapshot of sessionID in
+// its order, leaving out posts that were deleted or hidden since, and whether
+// the snapshot goes on after the page. It returns ErrNotFound when the
+// session is unknown, expired or not the user's.
+func (rs *RankingStore) GetSessionPage(ctx context.Context, userID int64, sessionID string, ttl time.Duration, limit, offset int) ([]*PostWithMetadata, bool, error) {
+	query := `
+	WITH ` + feedEntriesCTEs + `,
+    session AS (
+      SELECT post_ids FROM feed_sessions
+      WHERE id = $2 AND user_id = $1 AND created_at >= NOW() - make_interval(secs => $3)
+    ),
+    page AS (
+      SELECT s.id, s.ord
+      FROM session, unnest(session.post_ids) WITH ORDINALITY AS s(id, ord)
+      ORDER BY s.ord
+      LIMIT $4 OFFSET $5
+    )
+	SELECT ` + postWithMetadataColumns("$1") + `, ` + feedSourceColumns + `
+    FROM page
+    JOIN posts p ON p.id = page.id
+    LEFT JOIN entries e ON e.post_id = p.id
+    LEFT JOIN users u ON u.id = p.user_id
+    LEFT JOIN users ru ON ru.id = e.reposted_by
+    WHERE
+      ` + publishedCondition + `
+      AND ` + visibleToCondition("$1") + `
+    ORDER BY page.ord
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var size int
+	err := rs.db.QueryRowContext(
+		ctx,
+		`SELECT cardinality(post_ids) FROM feed_sessions WHERE id = $2 AND user_id = $1 AND created_at >= NOW() - make_interval(secs => $3)`,
+		userID,
+		sessionID,
+		ttl.Seconds(),
+	).Scan(&size)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, ErrNotFound
+		}
+		return nil, false, err
+	}
+
+	rows, err := rs.db.QueryContext(ctx, query, userID, sessionID, ttl.Seconds(), limit, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	feed, err := scanFeed(rows)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := attachPostDetails(ctx, rs.db, userID, postsOf(feed)); err != nil {
+		return nil, false, err
+	}
+	return feed, offset+limit < size, nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRankingGetSessionPage(t *testing.T) {
+	const session = "0b6e7a52-0f7d-4a3e-9a36-2c1f0e3b9d10"
+
+	t.Run("should not find a session that expired or is someone else's", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		rs := NewRankingStore(db)
+
+		mock.ExpectQuery(`SELECT cardinality\(post_ids\) FROM feed_sessions WHERE id = \$2 AND user_id = \$1 AND created_at >= NOW\(\) - make_interval\(secs => \$3\)`).
+			WithArgs(42, session, 3600.0).WillReturnError(sql.ErrNoRows)
+
+		if _, _, err := rs.GetSessionPage(context.Background(), 42, session, time.Hour, 2, 0); err != ErrNotFound {
+			t.Errorf("expected %v, got %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("should read a page in the order of the snapshot", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		rs := NewRankingStore(db)
+
+		mock.ExpectQuery(`SELECT cardinality\(post_ids\) FROM feed_sessions`).
+			WithArgs(42, session, 3600.0).WillReturnRows(sqlmock.NewRows([]string{"cardinality"}).AddRow(5))
+		mock.ExpectQuery(`unnest\(session\.post_ids\) WITH ORDINALITY AS s\(id, ord\)(.|\s)*LIMIT \$4 OFFSET \$5(.|\s)*ORDER BY page\.ord`).
+			WithArgs(42, session, 3600.0, 2, 2).
+			WillReturnRows(sqlmock.NewRows(append(postWithMetadataNames, "source", "reposted_by", "reposted_by_username", "source_tag")).
+				AddRow(postRow(5, 7, "first", nil, FeedSourceFollowing, nil, nil, nil)...).
+				AddRow(postRow(1, 9, "second", nil, FeedSourceFollowing, nil, nil, nil)...))
+		expectPostDetails(mock)
+
+		feed, more, err := rs.GetSessionPage(context.Background(), 42, session, time.Hour, 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(feed) != 2 || feed[0].ID != 5 || feed[1].ID != 1 {
+			t.Errorf("expected posts 5 and 1, got %v", feed)
+		}
+		if !more {
+			t.Error("expected a page to follow the third and fourth of 5 posts")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type RepostsStore struct {
+	db *sql.DB
+}
+
+func NewRepostsStore(db *sql.DB) *RepostsStore {
+	return &RepostsStore{db: db}
+}
+
+// Create reposts the post to the followers of userID and reports whether
+// it was not reposted already, reposting twice is a no-op
+func (rs *RepostsStore) Create(ctx context.Context, userID, postID int64) (bool, error) {
+	query := `
+	   INSERT INTO reposts (user_id, post_id) VALUES ($1, $2)
+       ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := rs.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (rs *RepostsStore) Delete(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM reposts WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := rs.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
@@ -9,6 +9,10 @@ import (
 
 var (
 	ErrNotFound          = fmt.Errorf("sql row not found in the database")
+	ErrConflict          = fmt.Errorf("resource was modified by another request")
+	ErrLimitExceeded     = fmt.Errorf("limit exceeded")
+	ErrDuplicate         = fmt.Errorf("resource already exists")
+	ErrPollClosed        = fmt.Errorf("poll is closed")
 	QueryTimeoutDuration = 5 * time.Second
 )
 
@@ -19,8 +23,15 @@ type Storage struct {
 		Update(context.Context, int64, int64, *Post) error
 		DeleteByID(context.Context, string) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
-		GetUserPosts(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
-		GetAllPosts(context.Context, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetUserPosts(context.Context, int64, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetAllPosts(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetCommunityPosts(context.Context, int64, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetListFeed(context.Context, int64, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetUserDrafts(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		Publish(context.Context, *Post, *time.Time) error
+		PublishScheduled(context.Context) ([]*Post, error)
+		IsVisibleTo(context.Context, int64, int64) (bool, error)
+		AttachDetails(context.Context, int64, *Post) error
 	}
 	User interface {
 		Create(context.Context, *User) error
@@ -30,14 +41,16 @@ type Storage struct {
 		GetByEmail(context.Context, string) (*User, error)
 		DeleteByID(context.Context, int64) error
 		Activate(context.Context, string) error
+		UpdateProfile(context.Context, *User) error
 	}
 	Comment interface {
 		Create(context.Context, *Comment) error
 		GetByPostID(context.Context, int64) ([]Comment, error)
 	}
 	Follow interface {
-		CreateFollow(context.Context, int64, int64) error
+		CreateFollow(context.Context, int64, int64) (bool, error)
 		DeleteFollow(context.Context, int64, int64) error
+		GetFollowerIDs(context.Context, int64) ([]int64, error)
 	}
 	Invitation interface {
 		CleanByID(context.Context, int64) error
@@ -46,15 +59,158 @@ type Storage struct {
 		GetByName(context.Context, string) (*Role, error)
 		IsPrecedent(context.Context, int, string) (bool, error)
 	}
+	Pin interface {
+		Pin(context.Context, int64, int64, int) error
+		Unpin(context.Context, int64, int64) error
+	}
+	Bookmark interface {
+		Save(context.Context, *Bookmark) error
+		Delete(context.Context, int64, int64) error
+		GetPosts(context.Context, int64, string, CursorPaginatedQuery) ([]*PostWithMetadata, string, error)
+		GetCollections(context.Context, int64) ([]BookmarkCollection, error)
+	}
+	Repost interface {
+		Create(context.Context, int64, int64) (bool, error)
+		Delete(context.Context, int64, int64) error
+	}
+	Trending interface {
+		Refresh(context.Context, string, time.Duration) error
+		GetTags(context.Context, TrendingQuery) ([]TrendingTag, error)
+		GetPosts(context.Context, int64, TrendingQuery) ([]*PostWithMetadata, error)
+	}
+	TagFollow interface {
+		Follow(context.Context, int64, string) error
+		Unfollow(context.Context, int64, string) error
+		GetByUserID(context.Context, int64) ([]FollowedTag, error)
+	}
+	Timeline interface {
+		AddPost(context.Context, *Post, int) error
+		AddRepost(context.Context, int64, int64, int) error
+		RemoveRepost(context.Context, int64, int64) error
+		AddFollow(context.Context, int64, int64, int) error
+		RemoveFollow(context.Context, int64, int64) error
+		Rebuild(context.Context, int64, int) error
+		RebuildAll(context.Context, int, int) (int, error)
+	}
+	Suggestion interface {
+		GetForUser(context.Context, int64, int) ([]Suggestion, error)
+	}
+	Ranking interface {
+		GetWeights(context.Context) (*RankingWeights, error)
+		SetWeights(context.Context, *RankingWeights) error
+		CreateSession(context.Context, int64, PaginatedFeedQuery, RankedFeedOptions) (*FeedSession, error)
+		GetSessionPage(context.Context, int64, string, time.Duration, int, int) ([]*PostWithMetadata, bool, error)
+	}
+	Notification interface {
+		Add(context.Context, *Notification, int64) error
+		GetByUserID(context.Context, int64, NotificationsQuery) ([]*Notification, string, error)
+		CountUnread(context.Context, int64) (int, error)
+		MarkRead(context.Context, int64, int64) error
+		MarkAllRead(context.Context, int64) error
+		GetUnreadSince(context.Context, int64, time.Time, []string, int) ([]*Notification, error)
+	}
+	NotificationPreference interface {
+		Get(context.Context, int64) (*NotificationPreferences, error)
+		Set(context.Context, int64, *NotificationPreferences) error
+		GetChannel(context.Context, int64, string) (string, error)
+		UnsubscribeEmail(context.Context, int64) error
+		GetDueDigests(context.Context, time.Time, int) ([]DigestRecipient, error)
+		MarkDigestSent(context.Context, int64, time.Time) error
+	}
+	Webhook interface {
+		Create(context.Context, *Webhook) error
+		GetByID(context.Context, int64) (*Webhook, error)
+		GetByUserID(context.Context, int64) ([]*Webhook, error)
+		Update(context.Context, *Webhook) error
+		Delete(context.Context, int64) error
+		Enqueue(context.Context, string, string, []int64, []byte) (int64, error)
+		ClaimDue(context.Context, int, time.Duration) ([]*WebhookDelivery, error)
+		RecordSuccess(context.Context, *WebhookDelivery, int) error
+		RecordFailure(context.Context, *WebhookDelivery, int, string, *time.Time, int) (bool, error)
+		GetDeliveries(context.Context, int64, CursorPaginatedQuery) ([]*WebhookDelivery, string, error)
+	}
+	Block interface {
+		Block(context.Context, int64, int64) error
+		Unblock(context.Context, int64, int64) error
+		GetByUserID(context.Context, int64) ([]BlockedUser, error)
+		GetAmong(context.Context, []int64) ([]UserBlock, error)
+	}
+	Conversation interface {
+		Create(context.Context, int64, []int64, *string) (int64, bool, error)
+		GetByID(context.Context, int64, int64) (*Conversation, error)
+		GetByUserID(context.Context, int64, CursorPaginatedQuery) ([]*Conversation, string, error)
+		AddMessage(context.Context, *Message) error
+		GetMessages(context.Context, int64, CursorPaginatedQuery) ([]*Message, string, error)
+		MarkRead(context.Context, int64, int64, int64) (*ConversationMember, error)
+		Leave(context.Context, int64, int64) error
+		GetUnmessageable(context.Context, int64, []int64) ([]int64, error)
+		GetSettings(context.Context, int64) (*MessageSettings, error)
+		SetSettings(context.Context, int64, *MessageSettings) error
+	}
+	Community interface {
+		Create(context.Context, *Community, int64) error
+		GetByID(context.Context, int64, int64) (*Community, error)
+		GetAll(context.Context, int64, PaginatedFeedQuery) ([]*Community, error)
+		Update(context.Context, *Community) error
+		Delete(context.Context, int64) error
+		Join(context.Context, int64, int64) error
+		RemoveMember(context.Context, int64, int64) error
+		SetRole(context.Context, int64, int64, string) error
+		GetMember(context.Context, int64, int64) (*CommunityMember, error)
+		GetMembers(context.Context, int64, PaginatedFeedQuery) ([]CommunityMember, error)
+		IsPrecedent(context.Context, int64, int64, string) (bool, error)
+	}
+	Poll interface {
+		GetByPostID(context.Context, int64, int64) (*Poll, error)
+		Vote(context.Context, int64, int64, []int64) error
+		Retract(context.Context, int64, int64) error
+		CloseExpired(context.Context) ([]ClosedPoll, error)
+	}
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByID(context.Context, int64) (*Media, error)
+		GetOwned(context.Context, int64, []int64) (map[int64]Media, error)
+		Delete(context.Context, int64) error
+		ClaimProcessing(context.Context, int, time.Duration) ([]*Media, error)
+		SetProcessed(context.Context, *Media) error
+		SetFailed(context.Context, int64) error
+	}
+	List interface {
+		Create(context.Context, *List) error
+		GetByID(context.Context, int64) (*List, error)
+		GetByUserID(context.Context, int64, int64) ([]*List, error)
+		Update(context.Context, *List) error
+		Delete(context.Context, int64) error
+		AddMember(context.Context, int64, int64, int) error
+		RemoveMember(context.Context, int64, int64) error
+		GetMembers(context.Context, int64) ([]ListMember, error)
+	}
 }
 
 func NewStorage(db *sql.DB) *Storage {
 	return &Storage{
-		Post:       NewPostsStore(db),
-		User:       NewUsersStore(db),
-		Comment:    NewCommentsStore(db),
-		Follow:     NewFollowsStore(db),
-		Invitation: NewInvitationStore(db),
-		Role:       NewRolesStore(db),
+		Post:                   NewPostsStore(db),
+		User:                   NewUsersStore(db),
+		Comment:                NewCommentsStore(db),
+		Follow:                 NewFollowsStore(db),
+		Invitation:             NewInvitationStore(db),
+		Role:                   NewRolesStore(db),
+		Pin:                    NewPinsStore(db),
+		Bookmark:               NewBookmarksStore(db),
+		Repost:                 NewRepostsStore(db),
+		Trending:               NewTrendingStore(db),
+		TagFollow:              NewTagFollowsStore(db),
+		Timeline:               NewTimelineStore(db),
+		Ranking:                NewRankingStore(db),
+		Suggestion:             NewSuggestionsStore(db),
+		Notification:           NewNotificationsStore(db),
+		NotificationPreference: NewNotificationPreferencesStore(db),
+		Webhook:                NewWebhooksStore(db),
+		Block:                  NewBlocksStore(db),
+		Conversation:           NewConversationsStore(db),
+		Community:              NewCommunitiesStore(db),
+		Poll:                   NewPollsStore(db),
+		List:                   NewListsStore(db),
+		Media:                  NewMediaStore(db),
 	}
 }
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Reasons a user is suggested, the strongest one is reported
+const (
+	SuggestionReasonFollowedByFollows = "followed_by_follows"
+	SuggestionReasonTags              = "tags"
+	SuggestionReasonActive            = "active"
+)
+
+// Suggestion is a user worth following
+type Suggestion struct {
+	UserID   int64   `json:"user_id"`
+	Username string  `json:"username"`
+	Reason   string  `json:"reason"`
+	Score    float64 `json:"score"`
+	// MutualsCount is the number of followed users following this one
+	MutualsCount int `json:"mutuals_count"`
+	// Tags are the shared tags this user posts about
+	Tags []string `json:"tags,omitempty"`
+}
+
+type SuggestionsStore struct {
+	db *sql.DB
+}
+
+func NewSuggestionsStore(db *sql.DB) *SuggestionsStore {
+	return &SuggestionsStore{db: db}
+}
+
+// GetForUser suggests up to limit active users for userID to follow, mixing
+// friends of friends, popular authors in the tags the user posts about or
+// follows, and recently active authors. The user, the accounts they
+// already follow and the ones blocked either way are left out.
+func (ss *SuggestionsStore) GetForUser(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	query := `
+	WITH following AS (
+      SELECT follow_id AS id FROM followers WHERE user_id = $1
+    ),
+    interests AS (
+      SELECT tag::text AS tag FROM tag_follows WHERE user_id = $1
+      UNION
+      SELECT lower(unnest(tags)) FROM posts WHERE user_id = $1 AND created_at > NOW() - INTERVAL '90 days'
+    ),
+    mutuals AS (
+      SELECT f.follow_id AS id, COUNT(*) AS mutuals
+      FROM followers f
+      JOIN following ON following.id = f.user_id
+      GROUP BY f.follow_id
+    ),
+    tag_authors AS (
+      SELECT p.user_id AS id, array_agg(DISTINCT i.tag ORDER BY i.tag) AS tags, COUNT(DISTINCT p.id) AS posts
+      FROM posts p
+      CROSS JOIN LATERAL unnest(p.tags) t(tag)
+      JOIN interests i ON i.tag = lower(t.tag)
+      WHERE p.visibility = 'public' AND p.status = 'published'
+        AND p.publish_at > NOW() - INTERVAL '30 days'
+      GROUP BY p.user_id
+    ),
+    active AS (
+      SELECT p.user_id AS id, COUNT(*) AS posts
+      FROM posts p
+      WHERE p.visibility = 'public' AND p.status = 'published'
+        AND p.publish_at > NOW() - INTERVAL '7 days'
+      GROUP BY p.user_id
+    ),
+    scored AS (
+      SELECT u.id, u.username,
+        3 * ln(1 + COALESCE(m.mutuals, 0)) AS mutuals_score,
+        2 * ln(1 + COALESCE(ta.posts, 0)) * ln(2 + (SELECT COUNT(*) FROM followers WHERE follow_id = u.id)) AS tags_score,
+        ln(1 + COALESCE(a.posts, 0)) AS active_score,
+        COALESCE(m.mutuals, 0) AS mutuals,
+        COALESCE(ta.tags, '{}') AS tags
+      FROM users u
+      LEFT JOIN mutuals m ON m.id = u.id
+      LEFT JOIN tag_authors ta ON ta.id = u.id
+      LEFT JOIN active a ON a.id = u.id
+      WHERE u.active AND u.id <> $1
+        AND NOT EXISTS (SELECT 1 FROM following WHERE following.id = u.id)
+        AND NOT EXISTS (
+          SELECT 1 FROM user_blocks b
+          WHERE (b.user_id = $1 AND b.blocked_id = u.id) OR (b.user_id = u.id AND b.blocked_id = $1)
+        )
+        AND (m.id IS NOT NULL OR ta.id IS NOT NULL OR a.id IS NOT NULL)
+    )
+    SELECT id, username,
+      CASE GREATEST(mutuals_score, tags_score, active_score)
+        WHEN mutuals_score THEN '` + SuggestionReasonFollowedByFollows + `'
+        WHEN tags_score THEN '` + SuggestionReasonTags + `'
+        ELSE '` + SuggestionReasonActive + `'
+      END,
+      mutuals_score + tags_score + active_score AS score,
+      mutuals,
+      tags
+    FROM scored
+    ORDER BY score DESC, id DESC
+    LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ss.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(
+			&s.UserID,
+			&s.Username,
+			&s.Reason,
+			&s.Score,
+			&s.MutualsCount,
+			pq.Array(&s.Tags),
+		); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
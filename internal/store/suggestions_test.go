@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSuggestionsGetForUser(t *testing.T) {
+	db, mock := newTestDB(t)
+	ss := NewSuggestionsStore(db)
+
+	// the accounts blocked either way are never suggested
+	mock.ExpectQuery(`NOT EXISTS \(SELECT 1 FROM following WHERE following\.id = u\.id\)\s*AND NOT EXISTS \(\s*SELECT 1 FROM user_blocks b\s*WHERE \(b\.user_id = \$1 AND b\.blocked_id = u\.id\) OR \(b\.user_id = u\.id AND b\.blocked_id = \$1\)\s*\)(.|\s)*LIMIT \$2`).
+		WithArgs(42, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "reason", "score", "mutuals", "tags"}).
+			AddRow(7, "user7", SuggestionReasonFollowedByFollows, 3.2, 2, "{}").
+			AddRow(8, "user8", SuggestionReasonTags, 1.5, 0, "{go,sql}"))
+
+	suggestions, err := ss.GetForUser(context.Background(), 42, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 2 || suggestions[0].UserID != 7 || suggestions[0].MutualsCount != 2 {
+		t.Fatalf("expected user7 with 2 mutuals first, got %+v", suggestions)
+	}
+	if tags := suggestions[1].Tags; len(tags) != 2 || tags[0] != "go" || tags[1] != "sql" {
+		t.Errorf("expected user8 to share the tags go and sql, got %v", tags)
+	}
+}
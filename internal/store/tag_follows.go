@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type FollowedTag struct {
+	Tag       string `json:"tag"`
+	CreatedAt string `json:"created_at"`
+}
+
+type TagFollowsStore struct {
+	db *sql.DB
+}
+
+func NewTagFollowsStore(db *sql.DB) *TagFollowsStore {
+	return &TagFollowsStore{db: db}
+}
+
+// Follow adds the normalized tag to the feed of userID, following it twice is a no-op
+func (ts *TagFollowsStore) Follow(ctx context.Context, userID int64, tag string) error {
+	query := `
+	   INSERT INTO tag_follows (user_id, tag) VALUES ($1, $2)
+       ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ts.db.ExecContext(ctx, query, userID, tag)
+	return err
+}
+
+func (ts *TagFollowsStore) Unfollow(ctx context.Context, userID int64, tag string) error {
+	query := `DELETE FROM tag_follows WHERE user_id = $1 AND tag = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ts.db.ExecContext(ctx, query, userID, tag)
+	return err
+}
+
+// GetByUserID returns the tags userID follows, latest first
+func (ts *TagFollowsStore) GetByUserID(ctx context.Context, userID int64) ([]FollowedTag, error) {
+	query := `
+	SELECT tag, created_at FROM tag_follows
+	WHERE user_id = $1
+	ORDER BY created_at DESC, tag
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ts.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []FollowedTag{}
+	for rows.Next() {
+		var t FollowedTag
+		if err := rows.Scan(&t.Tag, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTagFollows(t *testing.T) {
+	db, mock := newTestDB(t)
+	ts := NewTagFollowsStore(db)
+
+	// following a tag twice is a no-op
+	mock.ExpectExec(`INSERT INTO tag_follows \(user_id, tag\) VALUES \(\$1, \$2\)\s*ON CONFLICT DO NOTHING`).
+		WithArgs(42, "go").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM tag_follows WHERE user_id = \$1 AND tag = \$2`).
+		WithArgs(42, "rust").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT tag, created_at FROM tag_follows\s*WHERE user_id = \$1\s*ORDER BY created_at DESC, tag`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "created_at"}).
+			AddRow("sql", "2024-01-02T10:00:00Z").
+			AddRow("go", "2024-01-01T10:00:00Z"))
+
+	ctx := context.Background()
+	if err := ts.Follow(ctx, 42, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Unfollow(ctx, 42, "rust"); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := ts.GetByUserID(ctx, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Tag != "sql" || tags[1].Tag != "go" {
+		t.Errorf("expected the tags sql and go, latest first, got %v", tags)
+	}
+}
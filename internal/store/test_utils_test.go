@@ -0,0 +1,34 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newTestDB returns a database whose queries are matched against the
+// expectations of the mock, as regular expressions
+func newTestDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return db, mock
+}
+
+// expectPostDetails expects the queries of attachPostDetails for posts
+// without polls, media or mentions
+func expectPostDetails(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM polls pl`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM post_media a`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM post_mentions m`).WillReturnRows(sqlmock.NewRows([]string{"post_id"}))
+}
@@ -0,0 +1,332 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Home timelines are materialized in timeline_entries: one row per post a
+// user sees in their feed, written when posts are published, reposted or
+// their authors followed. Authors in timeline_pull_authors have too many
+// followers to write to and their posts are read from posts and reposts
+// directly by GetUserFeed, so are the posts with followed tags.
+
+type TimelineStore struct {
+	db *sql.DB
+}
+
+func NewTimelineStore(db *sql.DB) *TimelineStore {
+	return &TimelineStore{db: db}
+}
+
+// AddPost fans a published post out to the timelines of its author and the
+// author's followers, unless the author has more than maxFollowers
+func (ts *TimelineStore) AddPost(ctx context.Context, post *Post, maxFollowers int) error {
+	query := `
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT f.user_id, $2, 'following', NULL, $3 FROM followers f WHERE f.follow_id = $1 AND f.user_id <> $1 AND NOT $4
+       UNION ALL
+       SELECT $1, $2, 'own', NULL, $3
+       ON CONFLICT (user_id, post_id) DO UPDATE
+       SET source = EXCLUDED.source, reposted_by = NULL, activity_at = EXCLUDED.activity_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		pull, err := markPullAuthorTx(ctx, tx, post.UserID, maxFollowers)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, query, post.UserID, post.ID, post.PublishAt, pull)
+		return err
+	})
+}
+
+// AddRepost fans a repost out to the timelines of the reposter and their
+// followers, where the post is not in already as itself
+func (ts *TimelineStore) AddRepost(ctx context.Context, userID, postID int64, maxFollowers int) error {
+	query := `
+	   WITH repost AS (
+         SELECT user_id, post_id, created_at FROM reposts WHERE user_id = $1 AND post_id = $2
+       )
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT f.user_id, r.post_id, 'repost', r.user_id, r.created_at
+       FROM repost r JOIN followers f ON f.follow_id = r.user_id
+       WHERE f.user_id <> r.user_id AND NOT $3
+       UNION ALL
+       SELECT r.user_id, r.post_id, 'repost', r.user_id, r.created_at FROM repost r
+       ON CONFLICT (user_id, post_id) DO UPDATE
+       SET reposted_by = EXCLUDED.reposted_by, activity_at = EXCLUDED.activity_at
+       WHERE timeline_entries.source = 'repost'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		pull, err := markPullAuthorTx(ctx, tx, userID, maxFollowers)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, query, userID, postID, pull)
+		return err
+	})
+}
+
+// RemoveRepost takes an undone repost out of the timelines, falling back to
+// the latest repost of the post by another followed user
+func (ts *TimelineStore) RemoveRepost(ctx context.Context, userID, postID int64) error {
+	query := `
+	   DELETE FROM timeline_entries
+       WHERE post_id = $1 AND reposted_by = $2 AND source = 'repost'
+       RETURNING user_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		userIDs, err := queryIDsTx(ctx, tx, query, postID, userID)
+		if err != nil {
+			return err
+		}
+		return restoreRepostsTx(ctx, tx, userIDs, []int64{postID})
+	})
+}
+
+// AddFollow backfills the timeline of userID with the latest posts and
+// reposts of followID, at most backfill of each
+func (ts *TimelineStore) AddFollow(ctx context.Context, userID, followID int64, backfill int) error {
+	postsQuery := `
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT $1, p.id, 'following', NULL, p.publish_at
+       FROM posts p
+       WHERE p.user_id = $2 AND ` + publishedCondition + `
+       ORDER BY p.publish_at DESC
+       LIMIT $3
+       ON CONFLICT (user_id, post_id) DO UPDATE
+       SET source = EXCLUDED.source, reposted_by = NULL, activity_at = EXCLUDED.activity_at
+	`
+	repostsQuery := `
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT $1, r.post_id, 'repost', r.user_id, r.created_at
+       FROM reposts r
+       WHERE r.user_id = $2
+       ORDER BY r.created_at DESC
+       LIMIT $3
+       ON CONFLICT (user_id, post_id) DO UPDATE
+       SET reposted_by = EXCLUDED.reposted_by, activity_at = EXCLUDED.activity_at
+       WHERE timeline_entries.source = 'repost' AND timeline_entries.activity_at < EXCLUDED.activity_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		var pull bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM timeline_pull_authors WHERE user_id = $1)`, followID).Scan(&pull)
+		if err != nil {
+			return err
+		}
+		// read from posts and reposts anyway
+		if pull {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, postsQuery, userID, followID, backfill); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, repostsQuery, userID, followID, backfill)
+		return err
+	})
+}
+
+// RemoveFollow takes the posts and reposts of followID out of the timeline
+// of userID. Posts of followID that other followed users reposted stay in as
+// their reposts.
+func (ts *TimelineStore) RemoveFollow(ctx context.Context, userID, followID int64) error {
+	postsQuery := `
+	   DELETE FROM timeline_entries te
+       USING posts p
+       WHERE te.user_id = $1 AND te.post_id = p.id AND te.source = 'following' AND p.user_id = $2
+       RETURNING te.post_id
+	`
+	repostsQuery := `
+	   DELETE FROM timeline_entries
+       WHERE user_id = $1 AND source = 'repost' AND reposted_by = $2
+       RETURNING post_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		postIDs, err := queryIDsTx(ctx, tx, postsQuery, userID, followID)
+		if err != nil {
+			return err
+		}
+		repostIDs, err := queryIDsTx(ctx, tx, repostsQuery, userID, followID)
+		if err != nil {
+			return err
+		}
+		return restoreRepostsTx(ctx, tx, []int64{userID}, append(postIDs, repostIDs...))
+	})
+}
+
+// Rebuild recomputes the timeline of userID from the latest posts and
+// reposts, at most backfill of each, of the users they follow and their own
+func (ts *TimelineStore) Rebuild(ctx context.Context, userID int64, backfill int) error {
+	authors := `
+	   SELECT f.follow_id AS user_id FROM followers f
+       WHERE f.user_id = $1 AND NOT EXISTS (SELECT 1 FROM timeline_pull_authors pa WHERE pa.user_id = f.follow_id)
+       UNION
+       SELECT $1::bigint
+	`
+	postsQuery := `
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT $1, lp.id, CASE WHEN a.user_id = $1 THEN 'own' ELSE 'following' END, NULL, lp.publish_at
+       FROM (` + authors + `) a
+       CROSS JOIN LATERAL (
+         SELECT p.id, p.publish_at FROM posts p
+         WHERE p.user_id = a.user_id AND ` + publishedCondition + `
+         ORDER BY p.publish_at DESC
+         LIMIT $2
+       ) lp
+       ON CONFLICT DO NOTHING
+	`
+	repostsQuery := `
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT DISTINCT ON (lr.post_id) $1, lr.post_id, 'repost', lr.user_id, lr.created_at
+       FROM (` + authors + `) a
+       CROSS JOIN LATERAL (
+         SELECT r.post_id, r.user_id, r.created_at FROM reposts r
+         WHERE r.user_id = a.user_id
+         ORDER BY r.created_at DESC
+         LIMIT $2
+       ) lr
+       ORDER BY lr.post_id, lr.created_at DESC
+       ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM timeline_entries WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		// posts go in first so they win over reposts of the same post
+		if _, err := tx.ExecContext(ctx, postsQuery, userID, backfill); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, repostsQuery, userID, backfill)
+		return err
+	})
+}
+
+// RebuildAll decides again which authors are read on pull and rebuilds the
+// timeline of every user, it returns the number of rebuilt timelines
+func (ts *TimelineStore) RebuildAll(ctx context.Context, maxFollowers, backfill int) (int, error) {
+	pullQuery := `
+	   INSERT INTO timeline_pull_authors (user_id, followers_count)
+       SELECT follow_id, COUNT(*) FROM followers
+       GROUP BY follow_id
+       HAVING COUNT(*) > $1
+	`
+	err := withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM timeline_pull_authors`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, pullQuery, maxFollowers)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := ts.db.QueryContext(ctx, `SELECT id FROM users ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	userIDs := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range userIDs {
+		if err := ts.Rebuild(ctx, id, backfill); err != nil {
+			return i, err
+		}
+	}
+	return len(userIDs), nil
+}
+
+// markPullAuthorTx reports whether the posts of userID are read on pull,
+// which they are from the moment the user has more than maxFollowers
+func markPullAuthorTx(ctx context.Context, tx *sql.Tx, userID int64, maxFollowers int) (bool, error) {
+	var pull bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM timeline_pull_authors WHERE user_id = $1)`, userID).Scan(&pull)
+	if err != nil || pull {
+		return pull, err
+	}
+
+	var followers int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM followers WHERE follow_id = $1`, userID).Scan(&followers); err != nil {
+		return false, err
+	}
+	if followers <= maxFollowers {
+		return false, nil
+	}
+
+	query := `
+	   INSERT INTO timeline_pull_authors (user_id, followers_count) VALUES ($1, $2)
+       ON CONFLICT (user_id) DO UPDATE SET followers_count = EXCLUDED.followers_count, updated_at = NOW()
+	`
+	_, err = tx.ExecContext(ctx, query, userID, followers)
+	return true, err
+}
+
+// restoreRepostsTx puts posts that lost their entry back into the timelines
+// of userIDs as the latest repost by a followed user, if there is one
+func restoreRepostsTx(ctx context.Context, tx *sql.Tx, userIDs, postIDs []int64) error {
+	if len(userIDs) == 0 || len(postIDs) == 0 {
+		return nil
+	}
+
+	query := `
+	   INSERT INTO timeline_entries (user_id, post_id, source, reposted_by, activity_at)
+       SELECT DISTINCT ON (f.user_id, r.post_id) f.user_id, r.post_id, 'repost', r.user_id, r.created_at
+       FROM followers f
+       JOIN reposts r ON r.user_id = f.follow_id
+       WHERE f.user_id = ANY($1) AND r.post_id = ANY($2)
+       ORDER BY f.user_id, r.post_id, r.created_at DESC
+       ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, pq.Array(userIDs), pq.Array(postIDs))
+	return err
+}
+
+// queryIDsTx runs a query returning a single id column
+func queryIDsTx(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
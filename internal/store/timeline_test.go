@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTimelineAddPost(t *testing.T) {
+	publishAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	post := &Post{ID: 5, UserID: 7, PublishAt: &publishAt}
+
+	t.Run("should fan a post out to the followers of its author", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTimelineStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM timeline_pull_authors WHERE user_id = \$1\)`).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM followers WHERE follow_id = \$1`).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectExec(`INSERT INTO timeline_entries(.|\s)*FROM followers f WHERE f\.follow_id = \$1 AND f\.user_id <> \$1 AND NOT \$4`).
+			WithArgs(7, 5, &publishAt, false).WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectCommit()
+
+		if err := ts.AddPost(context.Background(), post, 3); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should only add a post to the timeline of an author with too many followers", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTimelineStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM timeline_pull_authors`).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM followers`).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+		mock.ExpectExec(`INSERT INTO timeline_pull_authors`).
+			WithArgs(7, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO timeline_entries`).
+			WithArgs(7, 5, &publishAt, true).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := ts.AddPost(context.Background(), post, 3); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestTimelineAddFollow(t *testing.T) {
+	t.Run("should backfill the posts, then the reposts of a followed user", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTimelineStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM timeline_pull_authors`).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(`INSERT INTO timeline_entries(.|\s)*FROM posts p(.|\s)*LIMIT \$3`).
+			WithArgs(42, 7, 50).WillReturnResult(sqlmock.NewResult(0, 50))
+		mock.ExpectExec(`INSERT INTO timeline_entries(.|\s)*FROM reposts r(.|\s)*LIMIT \$3`).
+			WithArgs(42, 7, 50).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		if err := ts.AddFollow(context.Background(), 42, 7, 50); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should not backfill the posts of an author read on pull", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTimelineStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`FROM timeline_pull_authors`).
+			WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectCommit()
+
+		if err := ts.AddFollow(context.Background(), 42, 7, 50); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestTimelineRemoveFollow(t *testing.T) {
+	db, mock := newTestDB(t)
+	ts := NewTimelineStore(db)
+
+	// post 3 was also reposted by another followed user and comes back as
+	// that repost
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM timeline_entries te(.|\s)*te\.source = 'following'`).
+		WithArgs(42, 7).WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(3).AddRow(4))
+	mock.ExpectQuery(`DELETE FROM timeline_entries(.|\s)*source = 'repost' AND reposted_by = \$2`).
+		WithArgs(42, 7).WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow(9))
+	mock.ExpectExec(`INSERT INTO timeline_entries(.|\s)*JOIN reposts r ON r\.user_id = f\.follow_id`).
+		WithArgs("{42}", "{3,4,9}").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := ts.RemoveFollow(context.Background(), 42, 7); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimelineRebuild(t *testing.T) {
+	t.Run("should replace the timeline with posts first, then reposts", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTimelineStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM timeline_entries WHERE user_id = \$1`).
+			WithArgs(42).WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectExec(`INSERT INTO timeline_entries(.|\s)*CROSS JOIN LATERAL \(\s*SELECT p\.id, p\.publish_at FROM posts p(.|\s)*ON CONFLICT DO NOTHING`).
+			WithArgs(42, 50).WillReturnResult(sqlmock.NewResult(0, 8))
+		mock.ExpectExec(`INSERT INTO timeline_entries(.|\s)*SELECT DISTINCT ON \(lr\.post_id\)(.|\s)*ON CONFLICT DO NOTHING`).
+			WithArgs(42, 50).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+
+		if err := ts.Rebuild(context.Background(), 42, 50); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should decide the pull authors again and rebuild every timeline", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTimelineStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM timeline_pull_authors`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO timeline_pull_authors(.|\s)*HAVING COUNT\(\*\) > \$1`).
+			WithArgs(1000).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`SELECT id FROM users ORDER BY id`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		for _, id := range []int{1, 2} {
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM timeline_entries`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`INSERT INTO timeline_entries`).WithArgs(id, 50).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`INSERT INTO timeline_entries`).WithArgs(id, 50).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+		}
+
+		n, err := ts.RebuildAll(context.Background(), 1000, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("expected 2 rebuilt timelines, got %d", n)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TrendingWindows are the sliding windows trending scores are computed over
+var TrendingWindows = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// Weights of the activity counted in trending scores, reposts are the
+// reactions a post can get
+const (
+	trendingPostWeight    = 1.0
+	trendingCommentWeight = 0.5
+	trendingRepostWeight  = 1.0
+	trendingQuoteWeight   = 1.5
+	// only the top of each window is kept
+	trendingMaxEntries = 200
+	// computing the scores reads the whole window
+	trendingRefreshTimeout = 30 * time.Second
+)
+
+type TrendingTag struct {
+	Tag         string    `json:"tag"`
+	Score       float64   `json:"score"`
+	PostsCount  int       `json:"posts_count"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+type TrendingQuery struct {
+	Window string `json:"window" validate:"oneof=hour day week"`
+	Limit  int    `json:"limit" validate:"gte=1,lt=101"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (tq TrendingQuery) Parse(r *http.Request) (TrendingQuery, error) {
+	query := r.URL.Query()
+	if w := query.Get("window"); w != "" {
+		tq.Window = w
+	}
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil {
+			return tq, err
+		}
+		tq.Limit = limit
+	}
+	if of := query.Get("offset"); of != "" {
+		offset, err := strconv.Atoi(of)
+		if err != nil {
+			return tq, err
+		}
+		tq.Offset = offset
+	}
+
+	return tq, nil
+}
+
+type TrendingStore struct {
+	db *sql.DB
+}
+
+func NewTrendingStore(db *sql.DB) *TrendingStore {
+	return &TrendingStore{db: db}
+}
+
+// Refresh recomputes the trending tags and posts of the window. Every
+// comment, repost, quote and (for tags) post on a public post within the
+// window adds its weight, halved for every quarter of the window it is old.
+func (ts *TrendingStore) Refresh(ctx context.Context, window string, length time.Duration) error {
+	decay := `power(0.5, EXTRACT(EPOCH FROM NOW() - e.at) / $3)`
+	since := `NOW() - make_interval(secs => $2)`
+	publicCondition := publishedCondition + ` AND p.visibility = 'public'`
+	tagsOf := `CROSS JOIN LATERAL (SELECT DISTINCT lower(x) AS tag FROM unnest(p.tags) x) t`
+
+	tagsQuery := `
+	INSERT INTO trending_tags (time_window, tag, score, posts_count)
+	SELECT $1, e.tag, SUM(e.weight * ` + decay + `) AS score,
+	    COUNT(DISTINCT e.post_id) FILTER (WHERE e.is_post)
+	FROM (
+	    SELECT p.id AS post_id, t.tag, p.publish_at AS at, $4::float8 AS weight, TRUE AS is_post
+	    FROM posts p ` + tagsOf + `
+	    WHERE ` + publicCondition + ` AND p.publish_at > ` + since + `
+	    UNION ALL
+	    SELECT p.id, t.tag, c.created_at, $5::float8, FALSE
+	    FROM comments c JOIN posts p ON p.id = c.post_id ` + tagsOf + `
+	    WHERE ` + publicCondition + ` AND c.created_at > ` + since + `
+	    UNION ALL
+	    SELECT p.id, t.tag, r.created_at, $6::float8, FALSE
+	    FROM reposts r JOIN posts p ON p.id = r.post_id ` + tagsOf + `
+	    WHERE ` + publicCondition + ` AND r.created_at > ` + since + `
+	) e
+	GROUP BY e.tag
+	ORDER BY score DESC
+	LIMIT $7
+	`
+
+	postsQuery := `
+	INSERT INTO trending_posts (time_window, post_id, score)
+	SELECT $1, e.post_id, SUM(e.weight * ` + decay + `) AS score
+	FROM (
+	    SELECT c.post_id, c.created_at AS at, $4::float8 AS weight
+	    FROM comments c WHERE c.created_at > ` + since + `
+	    UNION ALL
+	    SELECT r.post_id, r.created_at, $5::float8
+	    FROM reposts r WHERE r.created_at > ` + since + `
+	    UNION ALL
+	    SELECT p.quoted_post_id, p.publish_at, $6::float8
+	    FROM posts p
+	    WHERE p.quoted_post_id IS NOT NULL AND ` + publishedCondition + ` AND p.publish_at > ` + since + `
+	) e
+	JOIN posts p ON p.id = e.post_id
+	WHERE ` + publicCondition + `
+	GROUP BY e.post_id
+	ORDER BY score DESC
+	LIMIT $7
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, trendingRefreshTimeout)
+	defer cancel()
+
+	seconds := length.Seconds()
+	halfLife := seconds / 4
+
+	return withTx(ts.db, ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_tags WHERE time_window = $1`, window); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, tagsQuery, window, seconds, halfLife,
+			trendingPostWeight, trendingCommentWeight, trendingRepostWeight, trendingMaxEntries)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_posts WHERE time_window = $1`, window); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, postsQuery, window, seconds, halfLife,
+			trendingCommentWeight, trendingRepostWeight, trendingQuoteWeight, trendingMaxEntries)
+		return err
+	})
+}
+
+func (ts *TrendingStore) GetTags(ctx context.Context, tq TrendingQuery) ([]TrendingTag, error) {
+	query := `
+	SELECT tag, score, posts_count, refreshed_at
+	FROM trending_tags
+	WHERE time_window = $1
+	ORDER BY score DESC, tag
+	LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ts.db.QueryContext(ctx, query, tq.Window, tq.Limit, tq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Score, &t.PostsCount, &t.RefreshedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetPosts returns the trending posts of the window that viewerID may still
+// see, a post may have been hidden or deleted since the last refresh
+func (ts *TrendingStore) GetPosts(ctx context.Context, viewerID int64, tq TrendingQuery) ([]*PostWithMetadata, error) {
+	query := `
+	SELECT ` + postWithMetadataColumns("$2") + `
+	FROM trending_posts tp
+	JOIN posts p ON p.id = tp.post_id
+	LEFT JOIN users u ON u.id = p.user_id
+	WHERE tp.time_window = $1
+	  AND ` + publishedCondition + `
+	  AND ` + visibleToCondition("$2") + `
+	ORDER BY tp.score DESC, p.id DESC
+	LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ts.db.QueryContext(ctx, query, tq.Window, viewerID, tq.Limit, tq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPostsWithMetadata(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachPostDetails(ctx, ts.db, viewerID, postsOf(posts)); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTrendingRefresh(t *testing.T) {
+	t.Run("should replace the scores of the window, halved every quarter of it", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTrendingStore(db)
+
+		// a day is 86400 seconds, activity loses half its weight every 6 hours
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM trending_tags WHERE time_window = \$1`).
+			WithArgs("day").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`INSERT INTO trending_tags(.|\s)*power\(0\.5, EXTRACT\(EPOCH FROM NOW\(\) - e\.at\) / \$3\)(.|\s)*ORDER BY score DESC\s*LIMIT \$7`).
+			WithArgs("day", 86400.0, 21600.0, trendingPostWeight, trendingCommentWeight, trendingRepostWeight, trendingMaxEntries).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`DELETE FROM trending_posts WHERE time_window = \$1`).
+			WithArgs("day").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO trending_posts(.|\s)*power\(0\.5, EXTRACT\(EPOCH FROM NOW\(\) - e\.at\) / \$3\)(.|\s)*ORDER BY score DESC\s*LIMIT \$7`).
+			WithArgs("day", 86400.0, 21600.0, trendingCommentWeight, trendingRepostWeight, trendingQuoteWeight, trendingMaxEntries).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectCommit()
+
+		if err := ts.Refresh(context.Background(), "day", TrendingWindows["day"]); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should keep the previous scores when computing them fails", func(t *testing.T) {
+		db, mock := newTestDB(t)
+		ts := NewTrendingStore(db)
+
+		failed := errors.New("canceling statement due to statement timeout")
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM trending_tags`).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`INSERT INTO trending_tags`).WillReturnError(failed)
+		mock.ExpectRollback()
+
+		if err := ts.Refresh(context.Background(), "hour", TrendingWindows["hour"]); !errors.Is(err, failed) {
+			t.Errorf("expected %v, got %v", failed, err)
+		}
+	})
+}
+
+func TestTrendingGetTags(t *testing.T) {
+	db, mock := newTestDB(t)
+	ts := NewTrendingStore(db)
+
+	refreshedAt := time.Now()
+	mock.ExpectQuery(`FROM trending_tags\s*WHERE time_window = \$1\s*ORDER BY score DESC, tag\s*LIMIT \$2 OFFSET \$3`).
+		WithArgs("week", 2, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "score", "posts_count", "refreshed_at"}).
+			AddRow("go", 12.5, 3, refreshedAt).
+			AddRow("rust", 7.25, 2, refreshedAt))
+
+	tags, err := ts.GetTags(context.Background(), TrendingQuery{Window: "week", Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TrendingTag{
+		{Tag: "go", Score: 12.5, PostsCount: 3, RefreshedAt: refreshedAt},
+		{Tag: "rust", Score: 7.25, PostsCount: 2, RefreshedAt: refreshedAt},
+	}
+	if len(tags) != len(want) {
+		t.Fatalf("expected %v, got %v", want, tags)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], tags[i])
+		}
+	}
+}
+
+func TestTrendingQueryParse(t *testing.T) {
+	defaults := TrendingQuery{Window: "day", Limit: 10}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    TrendingQuery
+		wantErr bool
+	}{
+		{"should keep the defaults", "", defaults, false},
+		{"should read the window and the page", "window=hour&limit=5&offset=10", TrendingQuery{Window: "hour", Limit: 5, Offset: 10}, false},
+		{"should reject a limit that is not a number", "limit=ten", defaults, true},
+		{"should reject an offset that is not a number", "offset=-", defaults, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/trending/tags?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := defaults.Parse(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/dubass83/go_social/internal/util"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,8 +19,65 @@ type User struct {
 	Password        string `json:"-"`
 	CreatedAt       string `json:"created_at"`
 	Active          bool   `json:"active"`
-	ActivationToken string `json:"activation_token"`
+	ActivationToken string `json:"activation_token,omitempty"`
 	RoleID          int    `json:"role_id"`
+	Profile
+}
+
+// Profile are the fields users fill in about themselves, shown to everyone
+type Profile struct {
+	DisplayName string   `json:"display_name"`
+	Bio         string   `json:"bio"`
+	Location    string   `json:"location"`
+	Links       []string `json:"links"`
+	AvatarID    *int64   `json:"avatar_id"`
+	// Avatar is attached by handlers, it is not cached with the user
+	Avatar *Media `json:"avatar,omitempty"`
+}
+
+// PublicUser is what other users see of a user, without email, role and
+// activation details
+type PublicUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+	Profile
+}
+
+// Public returns the public view of the user
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		ID:        u.ID,
+		Username:  u.Username,
+		CreatedAt: u.CreatedAt,
+		Profile:   u.Profile,
+	}
+}
+
+// userColumns are the columns scanned by scanUser, in order
+const userColumns = `id, username, email, password, created_at, active, role_id,
+	display_name, bio, location, links, avatar_id`
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	user := &User{}
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password,
+		&user.CreatedAt,
+		&user.Active,
+		&user.RoleID,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Location,
+		pq.Array(&user.Links),
+		&user.AvatarID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 type UsersStore struct {
@@ -62,28 +120,14 @@ func (us *UsersStore) Create(ctx context.Context, user *User) error {
 
 func (us *UsersStore) GetByID(ctx context.Context, id int64) (*User, error) {
 	query := `
-    SELECT *
+    SELECT ` + userColumns + `
     FROM users
-    WHERE ID = $1
+    WHERE id = $1
     `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	user := &User{}
-
-	err := us.db.QueryRowContext(
-		ctx,
-		query,
-		id,
-	).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-		&user.Active,
-		&user.RoleID,
-	)
+	user, err := scanUser(us.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -209,28 +253,14 @@ func (us *UsersStore) DeleteByID(ctx context.Context, userID int64) error {
 
 func (us *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-    SELECT *
+    SELECT ` + userColumns + `
     FROM users
     WHERE email = $1
     `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	user := &User{}
-
-	err := us.db.QueryRowContext(
-		ctx,
-		query,
-		email,
-	).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-		&user.Active,
-		&user.RoleID,
-	)
+	user, err := scanUser(us.db.QueryRowContext(ctx, query, email))
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -241,3 +271,36 @@ func (us *UsersStore) GetByEmail(ctx context.Context, email string) (*User, erro
 	}
 	return user, nil
 }
+
+// UpdateProfile saves the profile fields of the user
+func (us *UsersStore) UpdateProfile(ctx context.Context, user *User) error {
+	query := `
+	UPDATE users
+	SET display_name = $1, bio = $2, location = $3, links = $4, avatar_id = $5
+	WHERE id = $6
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := us.db.ExecContext(
+		ctx,
+		query,
+		user.DisplayName,
+		user.Bio,
+		user.Location,
+		pq.Array(user.Links),
+		user.AvatarID,
+		user.ID,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Statuses of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook receives the events of a type that are meant for its user, or
+// the ones meant for anybody with AllUsers. Webhooks failing too often in a
+// row are disabled until their owner enables them again.
+type Webhook struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	URL    string `json:"url"`
+	// Secret signs the deliveries, it is only shown when the webhook is
+	// created
+	Secret       string     `json:"secret,omitempty"`
+	EventTypes   []string   `json:"event_types"`
+	AllUsers     bool       `json:"all_users"`
+	Active       bool       `json:"active"`
+	FailureCount int        `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is an event on its way to a webhook
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	// URL and Secret of the webhook, set on claimed deliveries
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhooksStore struct {
+	db *sql.DB
+}
+
+func NewWebhooksStore(db *sql.DB) *WebhooksStore {
+	return &WebhooksStore{db: db}
+}
+
+const webhookColumns = `id, user_id, url, event_types, all_users, active, failure_count, disabled_at, created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	w := &Webhook{}
+	err := row.Scan(
+		&w.ID,
+		&w.UserID,
+		&w.URL,
+		pq.Array(&w.EventTypes),
+		&w.AllUsers,
+		&w.Active,
+		&w.FailureCount,
+		&w.DisabledAt,
+		&w.CreatedAt,
+	)
+	return w, err
+}
+
+func (ws *WebhooksStore) Create(ctx context.Context, w *Webhook) error {
+	query := `
+	INSERT INTO webhooks (user_id, url, secret, event_types, all_users)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, active, failure_count, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return ws.db.QueryRowContext(
+		ctx,
+		query,
+		w.UserID,
+		w.URL,
+		w.Secret,
+		pq.Array(w.EventTypes),
+		w.AllUsers,
+	).Scan(
+		&w.ID,
+		&w.Active,
+		&w.FailureCount,
+		&w.CreatedAt,
+	)
+}
+
+func (ws *WebhooksStore) GetByID(ctx context.Context, id int64) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	w, err := scanWebhook(ws.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (ws *WebhooksStore) GetByUserID(ctx context.Context, userID int64) ([]*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ws.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// Update changes the URL, event types and active flag of the webhook.
+// Enabling it again forgets the failures that disabled it.
+func (ws *WebhooksStore) Update(ctx context.Context, w *Webhook) error {
+	query := `
+	UPDATE webhooks SET
+	  url = $2,
+	  event_types = $3,
+	  failure_count = CASE WHEN $4 AND NOT active THEN 0 ELSE failure_count END,
+	  disabled_at = CASE WHEN $4 THEN NULL ELSE disabled_at END,
+	  active = $4
+	WHERE id = $1
+	RETURNING failure_count, disabled_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := ws.db.QueryRowContext(ctx, query, w.ID, w.URL, pq.Array(w.EventTypes), w.Active).Scan(&w.FailureCount, &w.DisabledAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (ws *WebhooksStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ws.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Enqueue queues an event for the active webhooks subscribed to its type
+// that belong to one of userIDs or take the events of all users, and
+// returns how many deliveries were queued
+func (ws *WebhooksStore) Enqueue(ctx context.Context, eventID, eventType string, userIDs []int64, payload []byte) (int64, error) {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+	SELECT id, $1, $2, $4
+	FROM webhooks
+	WHERE
+	  active
+	  AND $2 = ANY(event_types)
+	  AND (all_users OR user_id = ANY($3))
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ws.db.ExecContext(ctx, query, eventID, eventType, pq.Array(userIDs), payload)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimDue returns up to limit pending deliveries of active webhooks whose
+// next attempt is due, and holds them off for the lease so other replicas
+// do not deliver them too
+func (ws *WebhooksStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = NOW() + make_interval(secs => $2)
+	FROM webhooks w
+	WHERE
+	  w.id = d.webhook_id
+	  AND d.id IN (
+	    SELECT dd.id
+	    FROM webhook_deliveries dd
+	    JOIN webhooks ww ON ww.id = dd.webhook_id AND ww.active
+	    WHERE dd.status = 'pending' AND dd.next_attempt_at <= NOW()
+	    ORDER BY dd.next_attempt_at
+	    LIMIT $1
+	    FOR UPDATE OF dd SKIP LOCKED
+	  )
+	RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts, w.url, w.secret
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ws.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{Status: DeliveryPending}
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordSuccess marks the delivery as succeeded and clears the failures of
+// its webhook
+func (ws *WebhooksStore) RecordSuccess(ctx context.Context, d *WebhookDelivery, statusCode int) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(ws.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, d.ID, statusCode); err != nil {
+			return err
+		}
+
+		query = `UPDATE webhooks SET failure_count = 0 WHERE id = $1 AND failure_count > 0`
+		_, err := tx.ExecContext(ctx, query, d.WebhookID)
+		return err
+	})
+}
+
+// RecordFailure records a failed attempt. The delivery is retried at
+// nextAttempt, or given up on when it is nil. The webhook is disabled once
+// it failed disableAfter times in a row; it reports whether it was.
+func (ws *WebhooksStore) RecordFailure(ctx context.Context, d *WebhookDelivery, statusCode int, reason string, nextAttempt *time.Time, disableAfter int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	disabled := false
+	err := withTx(ws.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE webhook_deliveries SET
+		  status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		  next_attempt_at = COALESCE($2::timestamptz, next_attempt_at),
+		  attempts = attempts + 1,
+		  last_status_code = $3,
+		  last_error = $4
+		WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, d.ID, nextAttempt, code, reason); err != nil {
+			return err
+		}
+
+		query = `
+		UPDATE webhooks SET
+		  failure_count = failure_count + 1,
+		  active = active AND failure_count + 1 < $2,
+		  disabled_at = CASE WHEN active AND failure_count + 1 >= $2 THEN NOW() ELSE disabled_at END
+		WHERE id = $1
+		RETURNING disabled_at IS NOT NULL AND NOT active
+		`
+		return tx.QueryRowContext(ctx, query, d.WebhookID, disableAfter).Scan(&disabled)
+	})
+	return disabled, err
+}
+
+// GetDeliveries returns the deliveries of the webhook, newest first,
+// together with the cursor of the next page
+func (ws *WebhooksStore) GetDeliveries(ctx context.Context, webhookID int64, cq CursorPaginatedQuery) ([]*WebhookDelivery, string, error) {
+	cursor, err := cq.after()
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+	SELECT id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	  last_status_code, last_error, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE webhook_id = $1 AND (created_at, id) < ($2, $3)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := ws.db.QueryContext(ctx, query, webhookID, cursor.CreatedAt, cursor.ID, cq.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d := &WebhookDelivery{}
+		if err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastStatusCode,
+			&d.LastError,
+			&d.CreatedAt,
+			&d.DeliveredAt,
+		); err != nil {
+			return nil, "", err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// a short page is the last one
+	next := ""
+	if len(deliveries) == cq.Limit {
+		last := deliveries[len(deliveries)-1]
+		next = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return deliveries, next, nil
+}
@@ -0,0 +1,159 @@
+package syndication
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	published := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return &Feed{
+		Title:       "alice on GO Social",
+		Description: "Posts by alice",
+		Link:        "http://localhost:5173/users/1",
+		FeedURL:     "http://localhost:8080/v1/users/1/feed.rss",
+		Updated:     published.Add(time.Hour),
+		Items: []Item{
+			{
+				URL:       "http://localhost:5173/posts/7",
+				Title:     "Hello <world>",
+				Content:   "Tom & Jerry #go",
+				Author:    "alice",
+				Tags:      []string{"go"},
+				Published: published,
+				Updated:   published.Add(time.Hour),
+			},
+		},
+	}
+}
+
+func TestWriteRSS(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testFeed().Write(&buf, FormatRSS); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title       string   `xml:"title"`
+				GUID        string   `xml:"guid"`
+				Description string   `xml:"description"`
+				PubDate     string   `xml:"pubDate"`
+				Categories  []string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Version != "2.0" || doc.Channel.Title != "alice on GO Social" {
+		t.Errorf("unexpected channel: version %q, title %q", doc.Version, doc.Channel.Title)
+	}
+	if len(doc.Channel.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(doc.Channel.Items))
+	}
+	item := doc.Channel.Items[0]
+	if item.Title != "Hello <world>" || item.Description != "Tom & Jerry #go" {
+		t.Errorf("text was not escaped and restored: title %q, description %q", item.Title, item.Description)
+	}
+	if item.GUID != "http://localhost:5173/posts/7" {
+		t.Errorf("unexpected guid %q", item.GUID)
+	}
+	if item.PubDate != "Wed, 01 May 2024 10:00:00 +0000" {
+		t.Errorf("unexpected pubDate %q", item.PubDate)
+	}
+	if !reflect.DeepEqual(item.Categories, []string{"go"}) {
+		t.Errorf("unexpected categories %v", item.Categories)
+	}
+}
+
+func TestWriteAtom(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testFeed().Write(&buf, FormatAtom); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`) {
+		t.Errorf("feed is not in the Atom namespace:\n%s", buf.String())
+	}
+
+	var doc struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			ID        string `xml:"id"`
+			Published string `xml:"published"`
+			Author    string `xml:"author>name"`
+			Content   string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Updated != "2024-05-01T11:00:00Z" {
+		t.Errorf("unexpected updated %q", doc.Updated)
+	}
+	if len(doc.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(doc.Entries))
+	}
+	entry := doc.Entries[0]
+	if entry.ID != "http://localhost:5173/posts/7" || entry.Published != "2024-05-01T10:00:00Z" {
+		t.Errorf("unexpected entry id %q, published %q", entry.ID, entry.Published)
+	}
+	if entry.Author != "alice" || entry.Content != "Tom & Jerry #go" {
+		t.Errorf("unexpected entry author %q, content %q", entry.Author, entry.Content)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testFeed().Write(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Version string `json:"version"`
+		Items   []struct {
+			ID            string `json:"id"`
+			ContentText   string `json:"content_text"`
+			DatePublished string `json:"date_published"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Version != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("unexpected version %q", doc.Version)
+	}
+	if len(doc.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(doc.Items))
+	}
+	item := doc.Items[0]
+	if item.ID != "http://localhost:5173/posts/7" || item.ContentText != "Tom & Jerry #go" || item.DatePublished != "2024-05-01T10:00:00Z" {
+		t.Errorf("unexpected item %+v", item)
+	}
+
+	buf.Reset()
+	if err := (&Feed{Title: "empty"}).Write(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"items": []`) {
+		t.Errorf("an empty feed must still have items:\n%s", buf.String())
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testFeed().Write(&buf, Format("yaml")); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,113 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrAddressNotAllowed is returned for receivers on loopback, private,
+// link-local and other internal addresses, which users must not make the
+// server call
+var ErrAddressNotAllowed = errors.New("webhook receivers can not be on internal addresses")
+
+// internalPrefixes are the ranges netip does not classify but that are not
+// reachable on the internet either
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// allowedAddr tells whether deliveries may be sent to ip. Networks given
+// to NewClient are allowed whatever they are.
+func (c *Client) allowedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range c.allowed {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, p := range internalPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of a receiver URL and fails with
+// ErrAddressNotAllowed when any of its addresses is internal. Deliveries
+// check the address again when they connect, the name may resolve
+// differently by then.
+func (c *Client) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+
+	addrs := []netip.Addr{}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, ip)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("can not resolve %s: %w", host, err)
+		}
+	}
+	for _, ip := range addrs {
+		if !c.allowedAddr(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrAddressNotAllowed, host, ip)
+		}
+	}
+	return nil
+}
+
+// control refuses connections to internal addresses, it runs once the
+// address was resolved
+func (c *Client) control(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !c.allowedAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, ap.Addr())
+	}
+	return nil
+}
+
+// ParseNetworks parses a comma separated list of networks in CIDR notation
+// or single addresses, as allowed to NewClient
+func ParseNetworks(s string) ([]netip.Prefix, error) {
+	networks := []netip.Prefix{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if ip, err := netip.ParseAddr(field); err == nil {
+			networks = append(networks, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", field, err)
+		}
+		networks = append(networks, p.Masked())
+	}
+	return networks, nil
+}
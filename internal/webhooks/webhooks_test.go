@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeliver(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":"1","type":"post.created","data":{}}`)
+
+	var received http.Header
+	var receivedBody []byte
+	status := http.StatusNoContent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	// the receiver listens on loopback
+	client := NewClient(time.Second, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+
+	t.Run("should sign the delivery", func(t *testing.T) {
+		code, err := client.Deliver(context.Background(), receiver.URL, secret, "1", "post.created", body)
+		if err != nil || code != http.StatusNoContent {
+			t.Fatalf("unexpected result %d %v", code, err)
+		}
+		if received.Get(HeaderEvent) != "post.created" || received.Get(HeaderID) != "1" {
+			t.Errorf("unexpected headers %v", received)
+		}
+		if err := Verify(secret, received, receivedBody, time.Minute); err != nil {
+			t.Errorf("expected the signature to verify: %v", err)
+		}
+		if err := Verify("whsec_other", received, receivedBody, time.Minute); err == nil {
+			t.Error("expected another secret not to verify")
+		}
+		if err := Verify(secret, received, append(receivedBody, ' '), time.Minute); err == nil {
+			t.Error("expected a changed body not to verify")
+		}
+	})
+
+	t.Run("should fail on an error status", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		code, err := client.Deliver(context.Background(), receiver.URL, secret, "2", "post.created", body)
+		if err == nil || code != http.StatusInternalServerError {
+			t.Errorf("expected a failure with the status code, got %d %v", code, err)
+		}
+	})
+}
+
+func TestVerifyRejectsOldDeliveries(t *testing.T) {
+	body := []byte(`{}`)
+	timestamp := time.Now().Add(-time.Hour).Unix()
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(HeaderSignature, Sign("secret", timestamp, body))
+
+	if err := Verify("secret", header, body, 5*time.Minute); err == nil {
+		t.Error("expected an old delivery to be rejected")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts, 30*time.Second, time.Hour); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	client := NewClient(time.Second, nil)
+
+	t.Run("should refuse internal receivers at registration", func(t *testing.T) {
+		for _, u := range []string{
+			"http://127.0.0.1/hooks",
+			"http://localhost:8080/hooks",
+			"http://[::1]/hooks",
+			"http://10.1.2.3/hooks",
+			"http://192.168.0.10/hooks",
+			"http://169.254.169.254/latest/meta-data",
+			"http://100.64.0.1/hooks",
+			"http://[::ffff:127.0.0.1]/hooks",
+			"http://0.0.0.0/hooks",
+		} {
+			if err := client.CheckURL(context.Background(), u); !errors.Is(err, ErrAddressNotAllowed) {
+				t.Errorf("expected %s to be refused, got %v", u, err)
+			}
+		}
+		if err := client.CheckURL(context.Background(), "https://93.184.215.14/hooks"); err != nil {
+			t.Errorf("expected a public address to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("should refuse internal receivers when delivering", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected no delivery to reach the receiver")
+		}))
+		defer receiver.Close()
+
+		_, err := client.Deliver(context.Background(), receiver.URL, "whsec_test", "1", "post.created", []byte(`{}`))
+		if !errors.Is(err, ErrAddressNotAllowed) {
+			t.Errorf("expected the delivery to be refused, got %v", err)
+		}
+	})
+}
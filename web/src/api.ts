@@ -1,5 +1,41 @@
 import { API_URL } from "./config";
-import type { Comment, FeedParams, Post, PostWithMetadata, User } from "./types";
+import type {
+  BlockedUser,
+  Comment,
+  Community,
+  CommunityMember,
+  CommunityRole,
+  Conversation,
+  ConversationMember,
+  FeedParams,
+  FollowedTag,
+  GatewayClientMessage,
+  GatewayMessage,
+  List,
+  ListMember,
+  Media,
+  Message,
+  MessageSettings,
+  Notification,
+  NotificationPreferences,
+  Page,
+  Poll,
+  Post,
+  PostWithMetadata,
+  PublicUser,
+  RankedPage,
+  RankingWeights,
+  StreamEvent,
+  StreamEventType,
+  Suggestion,
+  TrendingTag,
+  TrendingWindow,
+  UpdateProfileParams,
+  User,
+  Webhook,
+  WebhookDelivery,
+  WebhookEventType,
+} from "./types";
 
 function requestHeaders(withBody = false): Record<string, string> {
   const headers: Record<string, string> = {};
@@ -17,6 +53,14 @@ async function handleResponse<T>(res: Response): Promise<T> {
   return body.data as T;
 }
 
+// nextCursor reads the cursor of the next page from a Link header
+function nextCursor(res: Response): string | null {
+  const link = res.headers.get("Link");
+  const match = link?.match(/<([^>]+)>;\s*rel="next"/);
+  if (!match) return null;
+  return new URL(match[1], API_URL).searchParams.get("cursor");
+}
+
 // --- Auth ---
 
 export async function login(email: string, password: string): Promise<string> {
@@ -50,10 +94,38 @@ export async function getMe(): Promise<User> {
   return handleResponse<User>(res);
 }
 
-export async function getUser(userID: number): Promise<User> {
+export async function getUser(userID: number): Promise<PublicUser> {
   const res = await fetch(`${API_URL}/users/${userID}`, {
     headers: requestHeaders(),
   });
+  return handleResponse<PublicUser>(res);
+}
+
+export async function updateProfile(params: UpdateProfileParams): Promise<User> {
+  const res = await fetch(`${API_URL}/users/me`, {
+    method: "PATCH",
+    headers: requestHeaders(true),
+    body: JSON.stringify(params),
+  });
+  return handleResponse<User>(res);
+}
+
+export async function uploadAvatar(file: File): Promise<User> {
+  const form = new FormData();
+  form.append("file", file);
+  const res = await fetch(`${API_URL}/users/me/avatar`, {
+    method: "PUT",
+    headers: requestHeaders(),
+    body: form,
+  });
+  return handleResponse<User>(res);
+}
+
+export async function deleteAvatar(): Promise<User> {
+  const res = await fetch(`${API_URL}/users/me/avatar`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
   return handleResponse<User>(res);
 }
 
@@ -103,7 +175,9 @@ export async function getAllPosts(
   if (params.tags) query.set("tags", params.tags);
   if (params.search) query.set("search", params.search);
 
-  const res = await fetch(`${API_URL}/posts?${query}`);
+  const res = await fetch(`${API_URL}/posts?${query}`, {
+    headers: requestHeaders(),
+  });
   const data = await handleResponse<PostWithMetadata[] | null>(res);
   return data ?? [];
 }
@@ -127,6 +201,51 @@ export async function getFeed(
   return data ?? [];
 }
 
+// getRankedFeed ranks a new snapshot without a session and pages through it
+// with the session and offset of the previous page's next
+export async function getRankedFeed(
+  params: Omit<FeedParams, "sort"> & { session?: string } = {}
+): Promise<RankedPage> {
+  const query = new URLSearchParams({ mode: "ranked" });
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.offset != null) query.set("offset", String(params.offset));
+  if (params.tags) query.set("tags", params.tags);
+  if (params.search) query.set("search", params.search);
+  if (params.session) query.set("session", params.session);
+
+  const res = await fetch(`${API_URL}/users/feed?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<PostWithMetadata[] | null>(res);
+
+  const link = res.headers.get("Link")?.match(/<([^>]+)>;\s*rel="next"/);
+  const next = link ? new URL(link[1], API_URL).searchParams : null;
+  return {
+    items: data ?? [],
+    next: next
+      ? { session: next.get("session") ?? "", offset: Number(next.get("offset")) }
+      : null,
+  };
+}
+
+export async function getRankingWeights(): Promise<RankingWeights> {
+  const res = await fetch(`${API_URL}/feed/ranking`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<RankingWeights>(res);
+}
+
+export async function updateRankingWeights(
+  weights: RankingWeights
+): Promise<RankingWeights> {
+  const res = await fetch(`${API_URL}/feed/ranking`, {
+    method: "PUT",
+    headers: requestHeaders(true),
+    body: JSON.stringify(weights),
+  });
+  return handleResponse<RankingWeights>(res);
+}
+
 // --- Posts ---
 
 export async function getPost(postID: number): Promise<Post> {
@@ -139,28 +258,160 @@ export async function getPost(postID: number): Promise<Post> {
 export async function createPost(
   title: string,
   content: string,
-  tags: string[]
+  tags: string[],
+  communityID?: number,
+  poll?: { options: string[]; multiple: boolean; expires_at: string },
+  mediaIDs?: number[]
 ): Promise<Post> {
   const res = await fetch(`${API_URL}/posts`, {
     method: "POST",
     headers: requestHeaders(true),
-    body: JSON.stringify({ title, content, tags }),
+    body: JSON.stringify({
+      title,
+      content,
+      tags,
+      community_id: communityID,
+      poll,
+      media_ids: mediaIDs,
+    }),
   });
   return handleResponse<Post>(res);
 }
 
+export async function getPoll(postID: number): Promise<Poll> {
+  const res = await fetch(`${API_URL}/posts/${postID}/poll`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<Poll>(res);
+}
+
+export async function votePoll(postID: number, optionIDs: number[]): Promise<Poll> {
+  const res = await fetch(`${API_URL}/posts/${postID}/poll/votes`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ option_ids: optionIDs }),
+  });
+  return handleResponse<Poll>(res);
+}
+
+export async function retractVote(postID: number): Promise<Poll> {
+  const res = await fetch(`${API_URL}/posts/${postID}/poll/votes`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  return handleResponse<Poll>(res);
+}
+
 export async function updatePost(
   postID: number,
+  version: number,
   updates: { title?: string; content?: string; tags?: string[] }
 ): Promise<Post> {
+  const headers = requestHeaders(true);
+  headers["If-Match"] = `"${version}"`;
   const res = await fetch(`${API_URL}/posts/${postID}`, {
     method: "PATCH",
-    headers: requestHeaders(true),
+    headers,
     body: JSON.stringify(updates),
   });
   return handleResponse<Post>(res);
 }
 
+export async function getDrafts(
+  params: FeedParams = {}
+): Promise<PostWithMetadata[]> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.offset != null) query.set("offset", String(params.offset));
+  if (params.sort) query.set("sort", params.sort);
+  if (params.search) query.set("search", params.search);
+
+  const res = await fetch(`${API_URL}/users/me/drafts?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<PostWithMetadata[] | null>(res);
+  return data ?? [];
+}
+
+export async function publishPost(
+  postID: number,
+  publishAt?: string
+): Promise<Post> {
+  const res = await fetch(`${API_URL}/posts/${postID}/publish`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify(publishAt ? { publish_at: publishAt } : {}),
+  });
+  return handleResponse<Post>(res);
+}
+
+export async function pinPost(postID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/posts/${postID}/pin`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
+export async function unpinPost(postID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/posts/${postID}/pin`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
+export async function bookmarkPost(
+  postID: number,
+  collection = ""
+): Promise<void> {
+  const res = await fetch(`${API_URL}/posts/${postID}/bookmark`, {
+    method: "PUT",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ collection }),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function removeBookmark(postID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/posts/${postID}/bookmark`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
+export async function getBookmarks(
+  params: { collection?: string; limit?: number; cursor?: string } = {}
+): Promise<Page<PostWithMetadata>> {
+  const query = new URLSearchParams();
+  if (params.collection) query.set("collection", params.collection);
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.cursor) query.set("cursor", params.cursor);
+
+  const res = await fetch(`${API_URL}/users/me/bookmarks?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<PostWithMetadata[] | null>(res);
+  return { items: data ?? [], nextCursor: nextCursor(res) };
+}
+
+export async function repost(postID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/posts/${postID}/repost`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
+export async function undoRepost(postID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/posts/${postID}/repost`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
 export async function deletePost(postID: number): Promise<void> {
   const res = await fetch(`${API_URL}/posts/${postID}`, {
     method: "DELETE",
@@ -174,12 +425,634 @@ export async function deletePost(postID: number): Promise<void> {
 export async function createComment(
   postID: number,
   userID: number,
-  content: string
+  content: string,
+  mediaIDs?: number[]
 ): Promise<Comment> {
   const res = await fetch(`${API_URL}/posts/${postID}/comments`, {
     method: "POST",
     headers: requestHeaders(true),
-    body: JSON.stringify({ user_id: userID, content }),
+    body: JSON.stringify({ user_id: userID, content, media_ids: mediaIDs }),
   });
   return handleResponse<Comment>(res);
 }
+
+// --- Media ---
+
+export async function uploadMedia(file: File): Promise<Media> {
+  const form = new FormData();
+  form.append("file", file);
+  // the browser sets the multipart Content-Type with its boundary
+  const res = await fetch(`${API_URL}/media`, {
+    method: "POST",
+    headers: requestHeaders(),
+    body: form,
+  });
+  return handleResponse<Media>(res);
+}
+
+export async function deleteMedia(mediaID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/media/${mediaID}`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getTrendingTags(
+  window: TrendingWindow = "day",
+  limit = 10
+): Promise<TrendingTag[]> {
+  const query = new URLSearchParams({ window, limit: String(limit) });
+  const res = await fetch(`${API_URL}/trending/tags?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<TrendingTag[] | null>(res);
+  return data ?? [];
+}
+
+export async function getTrendingPosts(
+  window: TrendingWindow = "day",
+  limit = 10
+): Promise<PostWithMetadata[]> {
+  const query = new URLSearchParams({ window, limit: String(limit) });
+  const res = await fetch(`${API_URL}/trending/posts?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<PostWithMetadata[] | null>(res);
+  return data ?? [];
+}
+
+export async function followTag(tag: string): Promise<void> {
+  const res = await fetch(`${API_URL}/tags/${encodeURIComponent(tag)}/follow`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
+export async function unfollowTag(tag: string): Promise<void> {
+  const res = await fetch(`${API_URL}/tags/${encodeURIComponent(tag)}/follow`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  return handleResponse<void>(res);
+}
+
+export async function getFollowedTags(): Promise<FollowedTag[]> {
+  const res = await fetch(`${API_URL}/users/me/tags`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<FollowedTag[] | null>(res);
+  return data ?? [];
+}
+
+// --- Notifications ---
+
+export async function getNotifications(
+  params: { unread?: boolean; limit?: number; cursor?: string } = {}
+): Promise<Page<Notification>> {
+  const query = new URLSearchParams();
+  if (params.unread) query.set("unread", "true");
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.cursor) query.set("cursor", params.cursor);
+
+  const res = await fetch(`${API_URL}/notifications?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<Notification[] | null>(res);
+  return { items: data ?? [], nextCursor: nextCursor(res) };
+}
+
+export async function getUnreadNotificationsCount(): Promise<number> {
+  const res = await fetch(`${API_URL}/notifications/unread_count`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<{ unread: number }>(res);
+  return data.unread;
+}
+
+export async function markNotificationRead(notificationID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/notifications/${notificationID}/read`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function markAllNotificationsRead(): Promise<void> {
+  const res = await fetch(`${API_URL}/notifications/read`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getNotificationPreferences(): Promise<NotificationPreferences> {
+  const res = await fetch(`${API_URL}/notifications/preferences`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<NotificationPreferences>(res);
+}
+
+export async function updateNotificationPreferences(
+  prefs: {
+    channels?: Partial<NotificationPreferences["channels"]>;
+    digest?: NotificationPreferences["digest"];
+  }
+): Promise<NotificationPreferences> {
+  const res = await fetch(`${API_URL}/notifications/preferences`, {
+    method: "PUT",
+    headers: requestHeaders(true),
+    body: JSON.stringify(prefs),
+  });
+  return handleResponse<NotificationPreferences>(res);
+}
+
+// --- Blocks ---
+
+export async function blockUser(userID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/users/${userID}/block`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function unblockUser(userID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/users/${userID}/block`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getBlockedUsers(): Promise<BlockedUser[]> {
+  const res = await fetch(`${API_URL}/users/me/blocks`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<BlockedUser[] | null>(res);
+  return data ?? [];
+}
+
+// --- Conversations ---
+
+export async function getConversations(
+  params: { limit?: number; cursor?: string } = {}
+): Promise<Page<Conversation>> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.cursor) query.set("cursor", params.cursor);
+
+  const res = await fetch(`${API_URL}/conversations?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<Conversation[] | null>(res);
+  return { items: data ?? [], nextCursor: nextCursor(res) };
+}
+
+export async function createConversation(
+  userIDs: number[],
+  title?: string
+): Promise<Conversation> {
+  const res = await fetch(`${API_URL}/conversations`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ user_ids: userIDs, title }),
+  });
+  return handleResponse<Conversation>(res);
+}
+
+export async function getConversation(conversationID: number): Promise<Conversation> {
+  const res = await fetch(`${API_URL}/conversations/${conversationID}`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<Conversation>(res);
+}
+
+export async function getMessages(
+  conversationID: number,
+  params: { limit?: number; cursor?: string } = {}
+): Promise<Page<Message>> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.cursor) query.set("cursor", params.cursor);
+
+  const res = await fetch(`${API_URL}/conversations/${conversationID}/messages?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<Message[] | null>(res);
+  return { items: data ?? [], nextCursor: nextCursor(res) };
+}
+
+export async function sendMessage(conversationID: number, content: string): Promise<Message> {
+  const res = await fetch(`${API_URL}/conversations/${conversationID}/messages`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ content }),
+  });
+  return handleResponse<Message>(res);
+}
+
+export async function markConversationRead(
+  conversationID: number,
+  messageID?: number
+): Promise<ConversationMember> {
+  const query = new URLSearchParams();
+  if (messageID != null) query.set("message_id", String(messageID));
+
+  const res = await fetch(`${API_URL}/conversations/${conversationID}/read?${query}`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  return handleResponse<ConversationMember>(res);
+}
+
+export async function leaveConversation(conversationID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/conversations/${conversationID}/membership`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getMessageSettings(): Promise<MessageSettings> {
+  const res = await fetch(`${API_URL}/conversations/settings`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<MessageSettings>(res);
+}
+
+export async function updateMessageSettings(settings: MessageSettings): Promise<MessageSettings> {
+  const res = await fetch(`${API_URL}/conversations/settings`, {
+    method: "PUT",
+    headers: requestHeaders(true),
+    body: JSON.stringify(settings),
+  });
+  return handleResponse<MessageSettings>(res);
+}
+
+// --- Lists ---
+
+export async function getLists(): Promise<List[]> {
+  const res = await fetch(`${API_URL}/lists`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<List[] | null>(res);
+  return data ?? [];
+}
+
+export async function getUserLists(userID: number): Promise<List[]> {
+  const res = await fetch(`${API_URL}/users/${userID}/lists`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<List[] | null>(res);
+  return data ?? [];
+}
+
+export async function getList(listID: number): Promise<List> {
+  const res = await fetch(`${API_URL}/lists/${listID}`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<List>(res);
+}
+
+export async function createList(
+  name: string,
+  description: string,
+  isPrivate: boolean
+): Promise<List> {
+  const res = await fetch(`${API_URL}/lists`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ name, description, private: isPrivate }),
+  });
+  return handleResponse<List>(res);
+}
+
+export async function updateList(
+  listID: number,
+  updates: { name?: string; description?: string; private?: boolean }
+): Promise<List> {
+  const res = await fetch(`${API_URL}/lists/${listID}`, {
+    method: "PATCH",
+    headers: requestHeaders(true),
+    body: JSON.stringify(updates),
+  });
+  return handleResponse<List>(res);
+}
+
+export async function deleteList(listID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/lists/${listID}`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getListMembers(listID: number): Promise<ListMember[]> {
+  const res = await fetch(`${API_URL}/lists/${listID}/members`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<ListMember[] | null>(res);
+  return data ?? [];
+}
+
+export async function addListMember(listID: number, userID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/lists/${listID}/members/${userID}`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function removeListMember(listID: number, userID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/lists/${listID}/members/${userID}`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getListFeed(
+  listID: number,
+  params: FeedParams = {}
+): Promise<PostWithMetadata[]> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.offset != null) query.set("offset", String(params.offset));
+  if (params.sort) query.set("sort", params.sort);
+  if (params.tags) query.set("tags", params.tags);
+  if (params.search) query.set("search", params.search);
+
+  const res = await fetch(`${API_URL}/lists/${listID}/feed?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<PostWithMetadata[] | null>(res);
+  return data ?? [];
+}
+
+// --- Communities ---
+
+export async function getCommunities(
+  params: { limit?: number; offset?: number; search?: string } = {}
+): Promise<Community[]> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.offset != null) query.set("offset", String(params.offset));
+  if (params.search) query.set("search", params.search);
+
+  const res = await fetch(`${API_URL}/communities?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<Community[] | null>(res);
+  return data ?? [];
+}
+
+export async function getCommunity(communityID: number): Promise<Community> {
+  const res = await fetch(`${API_URL}/communities/${communityID}`, {
+    headers: requestHeaders(),
+  });
+  return handleResponse<Community>(res);
+}
+
+export async function createCommunity(
+  name: string,
+  description: string
+): Promise<Community> {
+  const res = await fetch(`${API_URL}/communities`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ name, description }),
+  });
+  return handleResponse<Community>(res);
+}
+
+export async function updateCommunity(
+  communityID: number,
+  updates: { name?: string; description?: string }
+): Promise<Community> {
+  const res = await fetch(`${API_URL}/communities/${communityID}`, {
+    method: "PATCH",
+    headers: requestHeaders(true),
+    body: JSON.stringify(updates),
+  });
+  return handleResponse<Community>(res);
+}
+
+export async function deleteCommunity(communityID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/communities/${communityID}`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getCommunityFeed(
+  communityID: number,
+  params: FeedParams = {}
+): Promise<PostWithMetadata[]> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.offset != null) query.set("offset", String(params.offset));
+  if (params.sort) query.set("sort", params.sort);
+  if (params.tags) query.set("tags", params.tags);
+  if (params.search) query.set("search", params.search);
+
+  const res = await fetch(`${API_URL}/communities/${communityID}/feed?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<PostWithMetadata[] | null>(res);
+  return data ?? [];
+}
+
+export async function getCommunityMembers(
+  communityID: number,
+  params: { limit?: number; offset?: number; search?: string } = {}
+): Promise<CommunityMember[]> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.offset != null) query.set("offset", String(params.offset));
+  if (params.search) query.set("search", params.search);
+
+  const res = await fetch(`${API_URL}/communities/${communityID}/members?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<CommunityMember[] | null>(res);
+  return data ?? [];
+}
+
+export async function joinCommunity(communityID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/communities/${communityID}/membership`, {
+    method: "PUT",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function leaveCommunity(communityID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/communities/${communityID}/membership`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function setCommunityRole(
+  communityID: number,
+  userID: number,
+  role: CommunityRole
+): Promise<void> {
+  const res = await fetch(`${API_URL}/communities/${communityID}/members/${userID}/role`, {
+    method: "PUT",
+    headers: requestHeaders(true),
+    body: JSON.stringify({ role }),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function removeCommunityMember(
+  communityID: number,
+  userID: number
+): Promise<void> {
+  const res = await fetch(`${API_URL}/communities/${communityID}/members/${userID}`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+// --- Webhooks ---
+
+export async function getWebhooks(): Promise<Webhook[]> {
+  const res = await fetch(`${API_URL}/webhooks`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<Webhook[] | null>(res);
+  return data ?? [];
+}
+
+export async function createWebhook(webhook: {
+  url: string;
+  event_types: WebhookEventType[];
+  all_users?: boolean;
+}): Promise<Webhook> {
+  const res = await fetch(`${API_URL}/webhooks`, {
+    method: "POST",
+    headers: requestHeaders(true),
+    body: JSON.stringify(webhook),
+  });
+  return handleResponse<Webhook>(res);
+}
+
+export async function updateWebhook(
+  webhookID: number,
+  changes: { url?: string; event_types?: WebhookEventType[]; active?: boolean }
+): Promise<Webhook> {
+  const res = await fetch(`${API_URL}/webhooks/${webhookID}`, {
+    method: "PATCH",
+    headers: requestHeaders(true),
+    body: JSON.stringify(changes),
+  });
+  return handleResponse<Webhook>(res);
+}
+
+export async function deleteWebhook(webhookID: number): Promise<void> {
+  const res = await fetch(`${API_URL}/webhooks/${webhookID}`, {
+    method: "DELETE",
+    headers: requestHeaders(),
+  });
+  await handleResponse<unknown>(res);
+}
+
+export async function getWebhookDeliveries(
+  webhookID: number,
+  params: { limit?: number; cursor?: string } = {}
+): Promise<Page<WebhookDelivery>> {
+  const query = new URLSearchParams();
+  if (params.limit != null) query.set("limit", String(params.limit));
+  if (params.cursor) query.set("cursor", params.cursor);
+
+  const res = await fetch(`${API_URL}/webhooks/${webhookID}/deliveries?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<WebhookDelivery[] | null>(res);
+  return { items: data ?? [], nextCursor: nextCursor(res) };
+}
+
+export async function getSuggestions(limit?: number): Promise<Suggestion[]> {
+  const query = new URLSearchParams();
+  if (limit != null) query.set("limit", String(limit));
+
+  const res = await fetch(`${API_URL}/users/me/suggestions?${query}`, {
+    headers: requestHeaders(),
+  });
+  const data = await handleResponse<Suggestion[] | null>(res);
+  return data ?? [];
+}
+
+export type SyndicationFormat = "rss" | "atom" | "json";
+
+// userFeedURL is the address feed readers subscribe to for a user's posts
+export function userFeedURL(userID: number, format: SyndicationFormat = "rss"): string {
+  return `${API_URL}/users/${userID}/feed.${format}`;
+}
+
+// tagFeedURL is the address feed readers subscribe to for a tag
+export function tagFeedURL(tag: string, format: SyndicationFormat = "rss"): string {
+  return `${API_URL}/tags/${encodeURIComponent(tag)}/feed.${format}`;
+}
+
+// --- Stream ---
+
+const streamEventTypes: StreamEventType[] = [
+  "post.created",
+  "comment.created",
+  "reaction",
+  "notification",
+  "user.followed",
+  "message",
+  "message.read",
+  "poll.closed",
+  "media.processed",
+  "reset",
+];
+
+// openStream listens to the events of the current user until the returned
+// function is called. EventSource reconnects and resumes by itself.
+export function openStream(onEvent: (event: StreamEvent) => void): () => void {
+  const query = new URLSearchParams();
+  const token = localStorage.getItem("token");
+  if (token) query.set("access_token", token);
+
+  const source = new EventSource(`${API_URL}/stream?${query}`);
+  for (const type of streamEventTypes) {
+    source.addEventListener(type, (e) => {
+      const message = e as MessageEvent<string>;
+      onEvent({ id: message.lastEventId, type, data: JSON.parse(message.data) } as StreamEvent);
+    });
+  }
+  return () => source.close();
+}
+
+// openGateway connects to the WebSocket gateway. The returned send function
+// drops messages while the socket is not open, close ends the connection.
+export function openGateway(onMessage: (message: GatewayMessage) => void): {
+  send: (message: GatewayClientMessage) => void;
+  close: () => void;
+} {
+  const query = new URLSearchParams();
+  const token = localStorage.getItem("token");
+  if (token) query.set("access_token", token);
+
+  const url = new URL(`${API_URL}/ws?${query}`, window.location.href);
+  url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+
+  const socket = new WebSocket(url);
+  socket.addEventListener("message", (e) => onMessage(JSON.parse(e.data) as GatewayMessage));
+  return {
+    send: (message) => {
+      if (socket.readyState === WebSocket.OPEN) socket.send(JSON.stringify(message));
+    },
+    close: () => socket.close(),
+  };
+}
@@ -10,6 +10,7 @@ export function CreatePostPage() {
   const [title, setTitle] = useState("");
   const [content, setContent] = useState("");
   const [tagsInput, setTagsInput] = useState("");
+  const [version, setVersion] = useState(0);
 
   const [loading, setLoading] = useState(false);
   const [fetchLoading, setFetchLoading] = useState(isEdit);
@@ -23,6 +24,7 @@ export function CreatePostPage() {
         setTitle(post.title);
         setContent(post.content);
         setTagsInput((post.tags ?? []).join(", "));
+        setVersion(post.version);
       })
       .catch((err) =>
         setError(err instanceof Error ? err.message : "Failed to load post")
@@ -45,7 +47,7 @@ export function CreatePostPage() {
 
     try {
       if (isEdit && postID) {
-        const updated = await updatePost(parseInt(postID, 10), {
+        const updated = await updatePost(parseInt(postID, 10), version, {
           title,
           content,
           tags,
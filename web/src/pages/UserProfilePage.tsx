@@ -1,9 +1,17 @@
-import { useEffect, useState } from "react";
+import { useEffect, useState, type FormEvent } from "react";
 import { useParams } from "react-router-dom";
-import { followUser, getUser, getUserPosts, unfollowUser } from "../api";
+import {
+  deleteAvatar,
+  followUser,
+  getUser,
+  getUserPosts,
+  unfollowUser,
+  updateProfile,
+  uploadAvatar,
+} from "../api";
 import { PostCard } from "../components/PostCard";
 import { useAuth } from "../context/AuthContext";
-import type { PostWithMetadata, User } from "../types";
+import type { Media, PostWithMetadata, PublicUser } from "../types";
 
 const PAGE_SIZE = 10;
 
@@ -14,11 +22,17 @@ function formatDate(iso: string) {
   });
 }
 
+/** The smallest version of an avatar, once it has been processed */
+function avatarURL(avatar?: Media) {
+  if (!avatar || avatar.status !== "ready") return null;
+  return avatar.variants[0]?.url ?? avatar.url;
+}
+
 export function UserProfilePage() {
   const { userID } = useParams<{ userID: string }>();
   const { user: currentUser } = useAuth();
 
-  const [profile, setProfile] = useState<User | null>(null);
+  const [profile, setProfile] = useState<PublicUser | null>(null);
   const [profileLoading, setProfileLoading] = useState(true);
   const [profileError, setProfileError] = useState<string | null>(null);
 
@@ -32,6 +46,14 @@ export function UserProfilePage() {
   const [followLoading, setFollowLoading] = useState(false);
   const [followError, setFollowError] = useState<string | null>(null);
 
+  const [editing, setEditing] = useState(false);
+  const [displayName, setDisplayName] = useState("");
+  const [bio, setBio] = useState("");
+  const [location, setLocation] = useState("");
+  const [linksInput, setLinksInput] = useState("");
+  const [saving, setSaving] = useState(false);
+  const [editError, setEditError] = useState<string | null>(null);
+
   const parsedID = parseInt(userID ?? "0", 10);
 
   useEffect(() => {
@@ -86,6 +108,61 @@ export function UserProfilePage() {
     }
   };
 
+  const startEditing = () => {
+    if (!profile) return;
+    setDisplayName(profile.display_name);
+    setBio(profile.bio);
+    setLocation(profile.location);
+    setLinksInput(profile.links.join("\n"));
+    setEditError(null);
+    setEditing(true);
+  };
+
+  const handleSaveProfile = async (e: FormEvent) => {
+    e.preventDefault();
+    setSaving(true);
+    setEditError(null);
+    try {
+      const links = linksInput
+        .split("\n")
+        .map((l) => l.trim())
+        .filter(Boolean);
+      setProfile(
+        await updateProfile({ display_name: displayName, bio, location, links })
+      );
+      setEditing(false);
+    } catch (err) {
+      setEditError(err instanceof Error ? err.message : "Failed to save profile");
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  const handleAvatarChange = async (file: File | undefined) => {
+    if (!file) return;
+    setSaving(true);
+    setEditError(null);
+    try {
+      setProfile(await uploadAvatar(file));
+    } catch (err) {
+      setEditError(err instanceof Error ? err.message : "Failed to upload avatar");
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  const handleRemoveAvatar = async () => {
+    setSaving(true);
+    setEditError(null);
+    try {
+      setProfile(await deleteAvatar());
+    } catch (err) {
+      setEditError(err instanceof Error ? err.message : "Failed to remove avatar");
+    } finally {
+      setSaving(false);
+    }
+  };
+
   const handlePrev = () => {
     const newOffset = Math.max(0, offset - PAGE_SIZE);
     setOffset(newOffset);
@@ -102,26 +179,44 @@ export function UserProfilePage() {
   if (profileError) return <div className="error-message">{profileError}</div>;
   if (!profile) return null;
 
-  const initial = profile.username.charAt(0).toUpperCase();
+  const name = profile.display_name || profile.username;
+  const initial = name.charAt(0).toUpperCase();
+  const avatar = avatarURL(profile.avatar);
 
   return (
     <>
       <div className="user-profile">
         <div className="user-profile-header">
           <div>
-            <div className="user-avatar">{initial}</div>
-            <h1>{profile.username}</h1>
-            <div className="user-email">{profile.email}</div>
+            <div className="user-avatar">
+              {avatar ? <img src={avatar} alt={name} /> : initial}
+            </div>
+            <h1>{name}</h1>
+            <div className="user-handle">@{profile.username}</div>
+            {profile.bio && <p className="user-bio">{profile.bio}</p>}
             <div className="text-secondary" style={{ marginTop: 6 }}>
+              {profile.location && <>{profile.location} · </>}
               Joined {formatDate(profile.created_at)}
             </div>
-            {!profile.active && (
-              <div style={{ marginTop: 6, fontSize: 13, color: "#f59e0b" }}>
-                Account not yet activated
-              </div>
+            {profile.links.length > 0 && (
+              <ul className="user-links">
+                {profile.links.map((link) => (
+                  <li key={link}>
+                    <a href={link} target="_blank" rel="noopener noreferrer nofollow">
+                      {link.replace(/^https?:\/\//, "")}
+                    </a>
+                  </li>
+                ))}
+              </ul>
             )}
           </div>
 
+          {isOwnProfile && !editing && (
+            <button className="btn btn-secondary" onClick={startEditing}>
+              Edit profile
+            </button>
+          )}
+
           {!isOwnProfile && currentUser && (
             <button
               className={following ? "btn btn-secondary" : "btn btn-primary"}
@@ -138,11 +233,101 @@ export function UserProfilePage() {
             {followError}
           </div>
         )}
+
+        {editing && (
+          <form onSubmit={handleSaveProfile}>
+            {editError && <div className="error-message">{editError}</div>}
+
+            <div className="form-group">
+              <label htmlFor="avatar">Avatar</label>
+              <input
+                id="avatar"
+                type="file"
+                accept="image/*"
+                disabled={saving}
+                onChange={(e) => handleAvatarChange(e.target.files?.[0])}
+              />
+              {profile.avatar_id != null && (
+                <button
+                  type="button"
+                  className="btn btn-secondary"
+                  onClick={handleRemoveAvatar}
+                  disabled={saving}
+                >
+                  Remove avatar
+                </button>
+              )}
+            </div>
+
+            <div className="form-group">
+              <label htmlFor="display-name">Display name</label>
+              <input
+                id="display-name"
+                type="text"
+                className="form-control"
+                value={displayName}
+                onChange={(e) => setDisplayName(e.target.value)}
+                maxLength={50}
+                placeholder={profile.username}
+              />
+            </div>
+
+            <div className="form-group">
+              <label htmlFor="bio">Bio</label>
+              <textarea
+                id="bio"
+                className="form-control"
+                rows={3}
+                value={bio}
+                onChange={(e) => setBio(e.target.value)}
+                maxLength={300}
+              />
+              <span className="text-secondary">{bio.length}/300</span>
+            </div>
+
+            <div className="form-group">
+              <label htmlFor="location">Location</label>
+              <input
+                id="location"
+                type="text"
+                className="form-control"
+                value={location}
+                onChange={(e) => setLocation(e.target.value)}
+                maxLength={100}
+              />
+            </div>
+
+            <div className="form-group">
+              <label htmlFor="links">Links</label>
+              <textarea
+                id="links"
+                className="form-control"
+                rows={3}
+                value={linksInput}
+                onChange={(e) => setLinksInput(e.target.value)}
+                placeholder="https://example.com"
+              />
+              <span className="text-secondary">One URL per line, up to 5</span>
+            </div>
+
+            <button type="submit" className="btn btn-primary" disabled={saving}>
+              {saving ? "Saving…" : "Save"}
+            </button>{" "}
+            <button
+              type="button"
+              className="btn btn-secondary"
+              onClick={() => setEditing(false)}
+              disabled={saving}
+            >
+              Cancel
+            </button>
+          </form>
+        )}
       </div>
 
       <div style={{ marginTop: 16 }}>
         <h2 style={{ fontSize: 17, fontWeight: 700, marginBottom: 12 }}>
-          Posts by {profile.username}
+          Posts by {name}
         </h2>
 
         {postsLoading && <div className="loading-spinner">Loading posts…</div>}
@@ -151,7 +336,7 @@ export function UserProfilePage() {
         {!postsLoading && !postsError && posts.length === 0 && (
           <div className="empty-state">
             <h3>No posts yet</h3>
-            <p>{profile.username} hasn't published anything.</p>
+            <p>{name} hasn't published anything.</p>
           </div>
         )}
 
@@ -1,4 +1,15 @@
-export interface User {
+/** What users tell about themselves, shown to everyone */
+export interface Profile {
+  display_name: string;
+  bio: string;
+  location: string;
+  links: string[];
+  avatar_id: number | null;
+  avatar?: Media;
+}
+
+/** The signed-in user, from /users/me */
+export interface User extends Profile {
   id: number;
   username: string;
   email: string;
@@ -7,15 +18,83 @@ export interface User {
   role_id: number;
 }
 
+/** Another user as seen on their profile, without account details */
+export interface PublicUser extends Profile {
+  id: number;
+  username: string;
+  created_at: string;
+}
+
+/** Fields left out are kept */
+export interface UpdateProfileParams {
+  display_name?: string;
+  bio?: string;
+  location?: string;
+  links?: string[];
+}
+
+export interface Mention {
+  username: string;
+  user_id?: number;
+  start: number;
+  end: number;
+}
+
+export interface Hashtag {
+  tag: string;
+  start: number;
+  end: number;
+}
+
+export interface Entities {
+  mentions: Mention[];
+  hashtags: Hashtag[];
+}
+
+export type MediaStatus = "processing" | "ready" | "failed";
+
+export interface MediaVariant {
+  name: "small" | "medium" | "large";
+  content_type: string;
+  width: number;
+  height: number;
+  size: number;
+  url: string;
+}
+
+export interface Media {
+  id: number;
+  user_id: number;
+  content_type: string;
+  size: number;
+  filename: string;
+  /** Images can only be downloaded once ready */
+  status: MediaStatus;
+  width: number | null;
+  height: number | null;
+  blurhash: string | null;
+  /** Smaller sizes of an image, from the smallest */
+  variants: MediaVariant[];
+  /** Signed download URL, valid for a limited time */
+  url: string;
+  created_at: string;
+}
+
 export interface Comment {
   id: number;
   post_id: number;
   user_id: number;
   content: string;
   created_at: string;
+  entities: Entities | null;
+  media: Media[] | null;
   user: User;
 }
 
+export type PostStatus = "draft" | "scheduled" | "published";
+
+export type PostVisibility = "public" | "followers" | "mentioned";
+
 export interface Post {
   id: number;
   title: string;
@@ -25,12 +104,249 @@ export interface Post {
   user_id: number;
   version: number;
   tags: string[] | null;
+  status: PostStatus;
+  publish_at: string | null;
+  visibility: PostVisibility;
+  entities: Entities | null;
+  quoted_post_id: number | null;
+  quoted_post: Post | null;
+  community_id: number | null;
+  poll: Poll | null;
+  media: Media[] | null;
   comments: Comment[] | null;
   user: User;
 }
 
+export interface PollOption {
+  id: number;
+  text: string;
+  votes: number;
+}
+
+export interface Poll {
+  id: number;
+  post_id: number;
+  multiple: boolean;
+  options: PollOption[];
+  voters_count: number;
+  expires_at: string;
+  closed: boolean;
+  // the options I voted for, empty when I did not vote
+  my_vote: number[];
+}
+
 export interface PostWithMetadata extends Post {
   comments_count: number;
+  pinned: boolean;
+  bookmarked: boolean;
+  reposts_count: number;
+  quotes_count: number;
+  reposted: boolean;
+  reposted_by: User | null;
+  source?: FeedSource;
+  source_tag?: string;
+}
+
+export type FeedSource = "own" | "following" | "repost" | "tag" | "list";
+
+export interface FollowedTag {
+  tag: string;
+  created_at: string;
+}
+
+export type NotificationKind = "follow" | "comment" | "mention" | "repost" | "post";
+
+export interface Notification {
+  id: number;
+  kind: NotificationKind;
+  post_id?: number;
+  comment_id?: number;
+  actors: { id: number; username: string }[];
+  actors_count: number;
+  summary: string;
+  read_at: string | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export type NotificationChannel = "in_app" | "email" | "none";
+
+export type DigestFrequency = "daily" | "weekly" | "off";
+
+export interface NotificationPreferences {
+  channels: Record<NotificationKind, NotificationChannel>;
+  digest: DigestFrequency;
+}
+
+export interface Message {
+  id: number;
+  conversation_id: number;
+  sender_id: number;
+  content: string;
+  created_at: string;
+}
+
+export interface ConversationMember {
+  id: number;
+  username: string;
+  // the last message the member has read, 0 for none
+  last_read_id: number;
+  last_read_at: string | null;
+}
+
+export interface Conversation {
+  id: number;
+  title: string | null;
+  is_group: boolean;
+  members: ConversationMember[];
+  last_message: Message | null;
+  unread: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface MessageSettings {
+  followed_only: boolean;
+}
+
+export interface BlockedUser {
+  id: number;
+  username: string;
+  created_at: string;
+}
+
+export type WebhookEventType =
+  | "post.created"
+  | "comment.created"
+  | "reaction"
+  | "notification"
+  | "user.followed";
+
+export interface Webhook {
+  id: number;
+  user_id: number;
+  url: string;
+  // only returned when the webhook is created
+  secret?: string;
+  event_types: WebhookEventType[];
+  all_users: boolean;
+  active: boolean;
+  failure_count: number;
+  disabled_at: string | null;
+  created_at: string;
+}
+
+export interface WebhookDelivery {
+  id: number;
+  webhook_id: number;
+  event_id: string;
+  event_type: WebhookEventType;
+  payload: unknown;
+  status: "pending" | "succeeded" | "failed";
+  attempts: number;
+  next_attempt_at: string;
+  last_status_code: number | null;
+  last_error: string | null;
+  created_at: string;
+  delivered_at: string | null;
+}
+
+export interface List {
+  id: number;
+  user_id: number;
+  name: string;
+  description: string;
+  private: boolean;
+  members_count: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ListMember {
+  id: number;
+  username: string;
+  created_at: string;
+}
+
+export type CommunityRole = "owner" | "moderator" | "member";
+
+export interface Community {
+  id: number;
+  name: string;
+  description: string;
+  members_count: number;
+  // my role, absent when I am not a member
+  role?: CommunityRole;
+  created_at: string;
+}
+
+export interface CommunityMember {
+  user_id: number;
+  username: string;
+  role: CommunityRole;
+  joined_at: string;
+}
+
+export type StreamEventType =
+  | "post.created"
+  | "comment.created"
+  | "reaction"
+  | "notification"
+  | "user.followed"
+  | "message"
+  | "message.read"
+  | "poll.closed"
+  | "media.processed"
+  | "reset";
+
+export type StreamEvent =
+  | { id: string; type: "post.created"; data: Post }
+  | { id: string; type: "comment.created"; data: { post_id: number; comment: Comment } }
+  | { id: string; type: "reaction"; data: { kind: "repost"; post_id: number; user_id: number } }
+  | { id: string; type: "notification"; data: Notification }
+  | { id: string; type: "user.followed"; data: { user_id: number; follow_id: number } }
+  | { id: string; type: "message"; data: Message }
+  | { id: string; type: "message.read"; data: ConversationMember & { conversation_id: number } }
+  | { id: string; type: "poll.closed"; data: Poll }
+  | { id: string; type: "media.processed"; data: Media }
+  | { id: string; type: "reset"; data: Record<string, never> };
+
+export type GatewayClientMessage =
+  | { type: "subscribe" | "unsubscribe" | "typing"; post_id: number }
+  | { type: "presence.subscribe" | "presence.unsubscribe"; user_ids: number[] }
+  | { type: "ping" };
+
+export type GatewayMessage =
+  | (StreamEvent & { topic?: string })
+  | { id: string; type: "typing"; topic: string; data: { post_id: number; user_id: number } }
+  | { id?: string; type: "presence"; topic: string; data: { user_id: number; online: boolean } }
+  | { type: "subscribed" | "unsubscribed"; topic?: string; data?: number[] }
+  | { type: "pong" }
+  | { type: "error"; data: { error: string } };
+
+export type SuggestionReason = "followed_by_follows" | "tags" | "active";
+
+export interface Suggestion {
+  user_id: number;
+  username: string;
+  reason: SuggestionReason;
+  score: number;
+  mutuals_count: number;
+  tags?: string[];
+}
+
+export type TrendingWindow = "hour" | "day" | "week";
+
+export interface TrendingTag {
+  tag: string;
+  score: number;
+  posts_count: number;
+  refreshed_at: string;
+}
+
+export interface Page<T> {
+  items: T[];
+  nextCursor: string | null;
 }
 
 export interface FeedParams {
@@ -40,3 +356,18 @@ export interface FeedParams {
   tags?: string;
   search?: string;
 }
+
+// RankedPage is a page of the ranked feed, next is null on the last page
+export interface RankedPage {
+  items: PostWithMetadata[];
+  next: { session: string; offset: number } | null;
+}
+
+export interface RankingWeights {
+  recency: number;
+  affinity: number;
+  engagement: number;
+  tags: number;
+  half_life_hours: number;
+  updated_at?: string;
+}